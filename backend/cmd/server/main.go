@@ -3,11 +3,20 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"meet-backend/internal/auth"
+	"meet-backend/internal/config"
 	"meet-backend/internal/database"
+	"meet-backend/internal/encryption"
+	"meet-backend/internal/events"
 	"meet-backend/internal/handlers"
 	"meet-backend/internal/middleware"
+	"meet-backend/internal/models"
+	"meet-backend/internal/notifications"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+	"meet-backend/internal/webhooks"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -19,6 +28,11 @@ func main() {
 		log.Println("No .env file found, using system environment variables")
 	}
 
+	// Secrets stored in the database are encrypted with DB_ENCRYPTION_KEY
+	if err := encryption.LoadKeyFromEnv(); err != nil {
+		log.Fatalf("Failed to load encryption key: %v", err)
+	}
+
 	// Initialize database
 	if err := database.InitDatabase(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -27,6 +41,13 @@ func main() {
 	// Initialize router
 	r := gin.Default()
 
+	// Only the proxies in TRUSTED_PROXIES may set the client IP with
+	// X-Forwarded-For. Passcode lockouts, the lobby and guest bans go by
+	// client IP, so trusting every proxy would let clients pick their own.
+	if err := r.SetTrustedProxies(config.SplitList(os.Getenv("TRUSTED_PROXIES"))); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS middleware
 	r.Use(middleware.CORS())
 
@@ -40,54 +61,246 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok", "database": "healthy"})
 	})
 
+	// Load JWT signing keys
+	keyManager, err := auth.NewKeyManagerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	go keyManager.StartRotationRoutine()
+
+	// Public keys for services that verify our tokens
+	r.GET("/.well-known/jwks.json", keyManager.JWKS)
+
 	// Initialize auth service
 	authService := auth.NewAuthService(
 		os.Getenv("SSO_CLIENT_ID"),
 		os.Getenv("SSO_CLIENT_SECRET"),
 		os.Getenv("SSO_REDIRECT_URL"),
 		os.Getenv("SSO_ISSUER_URL"),
+		keyManager,
 	)
+	go authService.StartCleanupRoutine()
+
+	// Load the mapping from IdP groups to roles and permissions
+	policy, err := permissions.NewPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load RBAC config: %v", err)
+	}
+
+	// Emails are queued in the outbox and sent in the background
+	mailer, err := notifications.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure email: %v", err)
+	}
+	outbox := notifications.NewOutbox(mailer)
+	go outbox.StartDeliveryRoutine(30 * time.Second)
+
+	// Outbound webhooks are queued the same way
+	go webhooks.NewDispatcher(database.GetDatabase()).StartDeliveryRoutine(15 * time.Second)
 
 	// Initialize handlers
 	roomHandler := handlers.NewRoomHandler(
 		os.Getenv("LIVEKIT_API_KEY"),
 		os.Getenv("LIVEKIT_API_SECRET"),
 		os.Getenv("LIVEKIT_URL"),
+		services.NewRecordingConfigFromEnv(),
+	)
+	roomManagementHandler := handlers.NewRoomManagementHandler(
+		os.Getenv("LIVEKIT_API_KEY"),
+		os.Getenv("LIVEKIT_API_SECRET"),
+		os.Getenv("LIVEKIT_URL"),
+		outbox,
+	)
+	roomMemberHandler := handlers.NewRoomMemberHandler()
+	meetingHandler := handlers.NewMeetingHandler(outbox)
+	calendarHandler := handlers.NewCalendarHandler()
+	recordingHandler := handlers.NewRecordingHandler()
+	sessionHandler := handlers.NewSessionHandler()
+	userHandler := handlers.NewUserHandler()
+	webhookSubscriptionHandler := handlers.NewWebhookSubscriptionHandler()
+	banHandler := handlers.NewBanHandler(
+		os.Getenv("LIVEKIT_API_KEY"),
+		os.Getenv("LIVEKIT_API_SECRET"),
+		os.Getenv("LIVEKIT_URL"),
+	)
+	breakoutHandler := handlers.NewBreakoutHandler(
+		os.Getenv("LIVEKIT_API_KEY"),
+		os.Getenv("LIVEKIT_API_SECRET"),
+		os.Getenv("LIVEKIT_URL"),
 	)
-	roomManagementHandler := handlers.NewRoomManagementHandler()
+	expiryWarnings, err := events.ExpiryWarningsFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load room expiry warnings: %v", err)
+	}
+	roomEventHandler := handlers.NewRoomEventHandler(expiryWarnings)
+	chatHandler := handlers.NewChatHandler()
+	chatRecorder := services.NewChatRecorder(
+		os.Getenv("LIVEKIT_API_KEY"),
+		os.Getenv("LIVEKIT_API_SECRET"),
+		os.Getenv("LIVEKIT_URL"),
+	)
+	webhookHandler := handlers.NewWebhookHandler(
+		os.Getenv("LIVEKIT_API_KEY"),
+		os.Getenv("LIVEKIT_API_SECRET"),
+		chatRecorder,
+	)
+	// The chat recorder leaves rooms that close before LiveKit finishes them
+	services.OnRoomClosed(chatRecorder.Stop)
+
+	// Keep the recording catalogue in sync with LiveKit egress status
+	go roomHandler.StartRecordingStatusRoutine(time.Minute)
+	go services.NewPasscodeService().StartCleanupRoutine()
+	go services.NewLobbyService().StartCleanupRoutine()
+
+	// Send participants back to their main room when breakout time is up
+	go breakoutHandler.StartBreakoutTimerRoutine(10 * time.Second)
+
+	// Expire rooms past their time limit, with their breakout rooms
+	go services.NewRoomService().StartExpiryRoutine(5 * time.Minute)
+
+	// Remove chat messages past CHAT_RETENTION_DAYS
+	go services.NewChatService().StartRetentionRoutine()
 
 	// Auth routes
 	auth := r.Group("/auth")
 	{
 		auth.GET("/login", authService.Login)
 		auth.GET("/callback", authService.Callback)
+		auth.POST("/exchange", authService.Exchange)
 		auth.POST("/refresh", authService.RefreshToken)
+		auth.POST("/logout", authService.Logout)
 	}
 
+	// LiveKit webhooks (verified by signature, not by user auth)
+	r.POST("/webhooks/livekit", webhookHandler.LiveKit)
+
+	// Calendar subscriptions (authenticated by the secret token in the URL)
+	r.GET("/calendar/:token/feed.ics", calendarHandler.Feed)
+
+	// Room event stream (SSE or WebSocket). Browsers can't set headers on
+	// EventSource and WebSocket requests, so ?access_token= works too.
+	r.GET("/api/rooms/:roomName/events", middleware.TokenFromQuery(), middleware.AuthRequired(authService, policy), roomEventHandler.Stream)
+
 	// Public room management routes (for guest access)
 	publicRooms := r.Group("/api/public/rooms")
+	publicRooms.Use(middleware.OptionalAuth(authService, policy))
 	{
-		publicRooms.POST("/", roomManagementHandler.CreateRoom)                               // Create room (guest or auth)
+		publicRooms.POST("/", roomManagementHandler.CreateRoom)                               // Create room (guest or auth), name generated when empty
 		publicRooms.GET("/:roomName", roomManagementHandler.GetRoom)                          // Get room info
-		publicRooms.POST("/:roomName/join", roomManagementHandler.JoinRoom)                   // Join room
+		publicRooms.POST("/:roomName/join", roomManagementHandler.JoinRoom)                   // Join room and get a LiveKit token
 		publicRooms.POST("/:roomName/leave/:identity", roomManagementHandler.LeaveRoom)       // Leave room
 		publicRooms.GET("/:roomName/participants", roomManagementHandler.GetRoomParticipants) // Get participants
+		publicRooms.GET("/:roomName/lobby/:identity", roomManagementHandler.LobbyStatus)      // Wait for admission
+	}
+
+	// Invite links (for guests and signed-in users)
+	publicInvites := r.Group("/api/public/invites")
+	publicInvites.Use(middleware.OptionalAuth(authService, policy))
+	{
+		publicInvites.POST("/:token/redeem", roomManagementHandler.RedeemInvite)
 	}
 
 	// Protected API routes
 	api := r.Group("/api")
-	api.Use(middleware.AuthRequired(authService))
+	api.Use(middleware.AuthRequired(authService, policy))
 	{
+		// Mutating room endpoints need the room's owner or a moderator
+		roomManagers := middleware.RequireRoomRole(models.RoomRoleOwner, models.RoomRoleModerator)
+		roomOwner := middleware.RequireRoomRole(models.RoomRoleOwner)
+
 		api.POST("/rooms/:roomName/token", roomHandler.GenerateToken)
 		api.GET("/rooms/:roomName/participants", roomHandler.GetParticipants)
-		api.DELETE("/rooms/:roomName/participants/:participantId", roomHandler.RemoveParticipant)
-		api.POST("/rooms/:roomName/recording/start", roomHandler.StartRecording)
-		api.POST("/rooms/:roomName/recording/stop", roomHandler.StopRecording)
+		api.DELETE("/rooms/:roomName/participants/:participantId", roomManagers, roomHandler.RemoveParticipant)
+		api.POST("/rooms/:roomName/participants/:participantId/mute", roomManagers, roomHandler.MuteParticipant)
+		api.PUT("/rooms/:roomName/participants/:participantId/permissions", roomManagers, roomHandler.UpdateParticipantPermissions)
+		api.PUT("/rooms/:roomName/participants/:participantId/metadata", roomManagers, roomHandler.UpdateParticipantMetadata)
+		api.POST("/rooms/:roomName/participants/:participantId/move", roomManagers, roomHandler.MoveParticipant)
+		api.POST("/rooms/:roomName/mute-all", roomManagers, roomHandler.MuteAll)
+		api.GET("/rooms/:roomName/moderation", roomManagers, roomHandler.ListModerationActions)
+		api.POST("/rooms/:roomName/recording/start", middleware.RequirePermission(permissions.Record), roomHandler.StartRecording)
+		api.POST("/rooms/:roomName/recording/stop", middleware.RequirePermission(permissions.Record), roomHandler.StopRecording)
+		api.GET("/rooms/:roomName/recordings", middleware.RequirePermission(permissions.Record), recordingHandler.ListRoomRecordings)
+		api.GET("/recordings/:id", middleware.RequirePermission(permissions.Record), recordingHandler.GetRecording)
+
+		// Current user
+		api.GET("/me", userHandler.GetMe)
+		api.GET("/me/sessions", sessionHandler.ListSessions)
+		api.DELETE("/me/sessions/:id", sessionHandler.RevokeSession)
+		api.POST("/me/calendar-feed", calendarHandler.CreateFeed)
+		api.DELETE("/me/calendar-feed", calendarHandler.RevokeFeed)
 
 		// Room management for authenticated users
-		api.POST("/rooms/:roomName/extend", roomManagementHandler.ExtendRoom) // Extend guest room
-		api.DELETE("/rooms/:roomName", roomManagementHandler.DeactivateRoom)  // Deactivate room
-		api.GET("/rooms/:roomName/stats", roomManagementHandler.GetRoomStats) // Room statistics
+		api.POST("/rooms/:roomName/extend", roomManagers, roomManagementHandler.ExtendRoom) // Extend guest room
+		api.DELETE("/rooms/:roomName", roomManagers, roomManagementHandler.DeactivateRoom)  // Deactivate room
+		api.GET("/rooms/:roomName/stats", roomManagementHandler.GetRoomStats)               // Room statistics
+		api.GET("/rooms/:roomName/attendance", roomManagementHandler.GetAttendance)         // Attendance report, also of inactive rooms
+		api.GET("/rooms/:roomName/policy", roomManagers, roomManagementHandler.GetRoomPolicy)
+		api.PUT("/rooms/:roomName/policy", roomManagers, roomManagementHandler.UpdateRoomPolicy)
+		api.PUT("/rooms/:roomName/passcode", roomOwner, roomManagementHandler.SetRoomPasscode)
+
+		// Invite links
+		api.GET("/rooms/:roomName/invites", roomOwner, roomManagementHandler.ListInvites)
+		api.POST("/rooms/:roomName/invites", roomOwner, roomManagementHandler.CreateInvite)
+		api.DELETE("/rooms/:roomName/invites/:id", roomOwner, roomManagementHandler.RevokeInvite)
+
+		// Lobby
+		api.GET("/rooms/:roomName/lobby", roomManagers, roomManagementHandler.ListLobby)
+		api.PUT("/rooms/:roomName/lobby", roomManagers, roomManagementHandler.UpdateLobby)
+		api.POST("/rooms/:roomName/lobby/:identity/admit", roomManagers, roomManagementHandler.AdmitFromLobby)
+		api.POST("/rooms/:roomName/lobby/:identity/deny", roomManagers, roomManagementHandler.DenyFromLobby)
+
+		// Bans
+		api.POST("/rooms/:roomName/bans", roomManagers, banHandler.BanFromRoom)
+		api.GET("/rooms/:roomName/bans", roomOwner, banHandler.ListRoomBans)
+		api.DELETE("/rooms/:roomName/bans/:id", roomOwner, banHandler.LiftRoomBan)
+
+		// Breakout rooms; the token is for participants assigned to one
+		api.POST("/rooms/:roomName/breakouts", roomManagers, breakoutHandler.OpenBreakouts)
+		api.GET("/rooms/:roomName/breakouts", roomManagers, breakoutHandler.ListBreakouts)
+		api.DELETE("/rooms/:roomName/breakouts", roomManagers, breakoutHandler.CloseBreakouts)
+		api.PUT("/rooms/:roomName/breakouts/assignments", roomManagers, breakoutHandler.AssignBreakouts)
+		api.POST("/rooms/:roomName/breakouts/token", breakoutHandler.BreakoutToken)
+
+		// Chat history; reading and exporting also works after the meeting
+		api.POST("/rooms/:roomName/messages", chatHandler.SendMessage)
+		api.GET("/rooms/:roomName/messages", chatHandler.ListMessages)
+		api.GET("/rooms/:roomName/messages/export", chatHandler.ExportMessages)
+		api.PUT("/rooms/:roomName/messages/:messageId", chatHandler.EditMessage)
+		api.DELETE("/rooms/:roomName/messages/:messageId", chatHandler.DeleteMessage)
+
+		// Room owner and moderators
+		api.GET("/rooms/:roomName/members", roomManagers, roomMemberHandler.ListMembers)
+		api.PUT("/rooms/:roomName/moderators/:userId", roomOwner, roomMemberHandler.GrantModerator)
+		api.DELETE("/rooms/:roomName/moderators/:userId", roomOwner, roomMemberHandler.RevokeModerator)
+
+		// Scheduled meetings (organizer or admin)
+		api.GET("/meetings", meetingHandler.ListMeetings)
+		api.POST("/meetings", meetingHandler.CreateMeeting)
+		api.GET("/meetings/:id", meetingHandler.GetMeeting) // JSON, or iCalendar as /meetings/{id}.ics
+		api.PUT("/meetings/:id", meetingHandler.UpdateMeeting)
+		api.DELETE("/meetings/:id", meetingHandler.CancelMeeting)
+
+		// Outbound webhooks (owner or admin)
+		api.GET("/webhooks", webhookSubscriptionHandler.ListWebhooks)
+		api.POST("/webhooks", webhookSubscriptionHandler.CreateWebhook)
+		api.GET("/webhooks/events", webhookSubscriptionHandler.ListEventTypes)
+		api.GET("/webhooks/:id", webhookSubscriptionHandler.GetWebhook)
+		api.PUT("/webhooks/:id", webhookSubscriptionHandler.UpdateWebhook)
+		api.DELETE("/webhooks/:id", webhookSubscriptionHandler.DeleteWebhook)
+		api.GET("/webhooks/:id/deliveries", webhookSubscriptionHandler.ListDeliveries)
+		api.GET("/webhooks/:id/deliveries/:deliveryId", webhookSubscriptionHandler.GetDelivery)
+		api.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", webhookSubscriptionHandler.Redeliver)
+	}
+
+	// Admin API routes
+	admin := api.Group("/admin")
+	admin.Use(middleware.RequirePermission(permissions.Admin))
+	{
+		admin.GET("/users", userHandler.ListUsers)
+		admin.PUT("/users/:id", userHandler.UpdateUser)
+		admin.GET("/bans", banHandler.ListBans)
+		admin.POST("/bans", banHandler.CreateBan)
+		admin.DELETE("/bans/:id", banHandler.LiftBan)
 	}
 
 	port := os.Getenv("PORT")
@@ -5,104 +5,325 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"meet-backend/internal/config"
 	"meet-backend/internal/models"
+	"meet-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/oauth2"
 )
 
 type AuthService struct {
-	oauth2Config *oauth2.Config
-	issuerURL    string
-	jwtSecret    []byte
+	oauth2Config    *oauth2.Config
+	issuerURL       string
+	groupsClaim     string
+	keys            *KeyManager
+	logins          *loginStore
+	sessions        *services.SessionService
+	users           *services.UserService
+	frontendURL     string
+	returnToOrigins []string
+	secureCookies   bool
+
+	providerMu sync.Mutex
+	provider   *oidcProvider
 }
 
-// NewAuthService creates a new authentication service for id.lazentis.com
-func NewAuthService(clientID, clientSecret, redirectURL, issuerURL string) *AuthService {
-	// Generate a random JWT secret if not provided
-	jwtSecret := make([]byte, 32)
-	rand.Read(jwtSecret)
-
-	config := &oauth2.Config{
+// NewAuthService creates a new authentication service for an OpenID Connect
+// provider such as id.lazentis.com, Keycloak, Authentik or Azure AD.
+// Provider endpoints are discovered from issuerURL on first use.
+func NewAuthService(clientID, clientSecret, redirectURL, issuerURL string, keys *KeyManager) *AuthService {
+	oauthConfig := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		RedirectURL:  redirectURL,
 		Scopes:       []string{"openid", "profile", "email"},
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  issuerURL + "/auth",
-			TokenURL: issuerURL + "/token",
-		},
 	}
 
+	groupsClaim := os.Getenv("SSO_GROUPS_CLAIM")
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	frontendURL := strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+
+	// Absolute return_to URLs must point at the frontend or an allowed origin
+	returnToOrigins := append([]string{frontendURL}, config.SplitList(os.Getenv("AUTH_RETURN_TO_ORIGINS"))...)
+
 	return &AuthService{
-		oauth2Config: config,
-		issuerURL:    issuerURL,
-		jwtSecret:    jwtSecret,
+		oauth2Config:    oauthConfig,
+		issuerURL:       issuerURL,
+		groupsClaim:     groupsClaim,
+		keys:            keys,
+		logins:          newLoginStore(),
+		sessions:        services.NewSessionService(),
+		users:           services.NewUserService(),
+		frontendURL:     frontendURL,
+		returnToOrigins: returnToOrigins,
+		secureCookies:   strings.HasPrefix(redirectURL, "https://"),
+	}
+}
+
+// StartCleanupRoutine periodically removes expired login state and sessions
+func (a *AuthService) StartCleanupRoutine() {
+	go a.sessions.StartCleanupRoutine()
+	a.logins.startCleanupRoutine()
+}
+
+// oidc returns the discovered provider. Discovery happens on first use and is
+// retried on failure, so the server can start while the provider is unreachable.
+func (a *AuthService) oidc(ctx context.Context) (*oidcProvider, error) {
+	a.providerMu.Lock()
+	defer a.providerMu.Unlock()
+
+	if a.provider != nil {
+		return a.provider, nil
 	}
+
+	provider, err := discoverProvider(ctx, a.issuerURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := provider.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	a.provider = provider
+	return provider, nil
+}
+
+// config returns the OAuth2 configuration using the provider's endpoints
+func (a *AuthService) config(provider *oidcProvider) *oauth2.Config {
+	config := *a.oauth2Config
+	config.Endpoint = provider.endpoint
+	return &config
 }
 
-// Login initiates the OAuth2 login flow
+// Login initiates the OAuth2 login flow with PKCE.
+// The optional return_to parameter is where the SPA sends the user afterwards.
 func (a *AuthService) Login(c *gin.Context) {
-	state := generateRandomString(32)
+	returnTo, ok := a.validateReturnTo(c.Query("return_to"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return_to parameter"})
+		return
+	}
 
-	// Store state in session/cookie for CSRF protection
-	c.SetCookie("oauth_state", state, 600, "/", "", false, true)
+	provider, err := a.oidc(c.Request.Context())
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	attempt, err := a.logins.createAttempt(verifier, returnTo)
+	if err != nil {
+		log.Printf("Failed to start login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
 
-	url := a.oauth2Config.AuthCodeURL(state, oauth2.AccessTypeOffline)
-	c.Redirect(http.StatusTemporaryRedirect, url)
+	// Bind the login to this browser so a callback link cannot be replayed elsewhere
+	a.setStateCookie(c, attempt.State, int(loginAttemptTTL.Seconds()))
+
+	authURL := a.config(provider).AuthCodeURL(attempt.State,
+		oauth2.AccessTypeOffline,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", attempt.Nonce),
+	)
+	c.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
-// Callback handles the OAuth2 callback
+// Callback handles the OAuth2 callback and sends the user back to the SPA
+// with a one-time code that can be exchanged for tokens
 func (a *AuthService) Callback(c *gin.Context) {
-	// Verify state parameter
+	state := c.Query("state")
 	storedState, err := c.Cookie("oauth_state")
-	if err != nil || storedState != c.Query("state") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state parameter"})
+	if err != nil || state == "" || storedState != state {
+		a.redirectToFrontend(c, url.Values{"error": {"invalid_state"}})
 		return
 	}
 
 	// Clear the state cookie
-	c.SetCookie("oauth_state", "", -1, "/", "", false, true)
+	a.setStateCookie(c, "", -1)
+
+	attempt, err := a.logins.consumeAttempt(state)
+	if err != nil {
+		a.redirectToFrontend(c, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		a.redirectToFrontend(c, url.Values{"error": {providerError}})
+		return
+	}
+
+	provider, err := a.oidc(c.Request.Context())
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		a.redirectToFrontend(c, url.Values{"error": {"provider_unavailable"}})
+		return
+	}
 
 	// Exchange authorization code for token
 	code := c.Query("code")
-	token, err := a.oauth2Config.Exchange(context.Background(), code)
+	token, err := a.config(provider).Exchange(c.Request.Context(), code, oauth2.VerifierOption(attempt.CodeVerifier))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to exchange token"})
+		a.redirectToFrontend(c, url.Values{"error": {"token_exchange_failed"}})
 		return
 	}
 
-	// Get user info from the token
-	user, err := a.getUserInfo(token.AccessToken)
+	// Get user info from the verified ID token
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		a.redirectToFrontend(c, url.Values{"error": {"missing_id_token"}})
+		return
+	}
+
+	idTokenUser, err := a.userFromIDToken(c.Request.Context(), provider, rawIDToken, attempt.Nonce, token.AccessToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		log.Printf("ID token verification failed: %v", err)
+		a.redirectToFrontend(c, url.Values{"error": {"invalid_id_token"}})
+		return
+	}
+
+	// Store the user and refuse accounts disabled by an admin
+	user, err := a.users.UpsertUser(idTokenUser)
+	if err != nil {
+		log.Printf("Failed to store user: %v", err)
+		a.redirectToFrontend(c, url.Values{"error": {"server_error"}})
+		return
+	}
+	if user.Disabled {
+		a.redirectToFrontend(c, url.Values{"error": {"user_disabled"}})
+		return
+	}
+
+	// Start a session; the upstream refresh token stays on the server
+	session, refreshToken, err := a.sessions.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP(), token.RefreshToken)
+	if err != nil {
+		log.Printf("Failed to create session: %v", err)
+		a.redirectToFrontend(c, url.Values{"error": {"server_error"}})
 		return
 	}
 
 	// Generate our own JWT token
-	jwtToken, expiresAt, err := a.generateJWT(user)
+	jwtToken, expiresAt, err := a.generateJWT(user, session.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		a.redirectToFrontend(c, url.Values{"error": {"server_error"}})
 		return
 	}
 
 	response := models.AuthResponse{
 		AccessToken:  jwtToken,
-		RefreshToken: token.RefreshToken,
+		RefreshToken: refreshToken,
 		ExpiresAt:    expiresAt,
 		User:         *user,
 	}
 
+	// Tokens never appear in the URL; the SPA exchanges the code for them
+	loginCode, err := a.logins.createCode(&response)
+	if err != nil {
+		log.Printf("Failed to store login code: %v", err)
+		a.redirectToFrontend(c, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	params := url.Values{"code": {loginCode}}
+	if attempt.ReturnTo != "" {
+		params.Set("return_to", attempt.ReturnTo)
+	}
+	a.redirectToFrontend(c, params)
+}
+
+// Exchange trades a one-time login code for the tokens of the finished login
+func (a *AuthService) Exchange(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := a.logins.consumeCode(request.Code)
+	if err != nil {
+		if errors.Is(err, errLoginExpired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange code"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
 	c.JSON(http.StatusOK, response)
 }
 
-// RefreshToken refreshes the JWT token
+// validateReturnTo accepts same-site paths and absolute URLs on an allowed origin
+func (a *AuthService) validateReturnTo(returnTo string) (string, bool) {
+	if returnTo == "" {
+		return "", true
+	}
+
+	// Relative paths, but not protocol-relative URLs such as //evil.example
+	if strings.HasPrefix(returnTo, "/") && !strings.HasPrefix(returnTo, "//") && !strings.HasPrefix(returnTo, "/\\") {
+		return returnTo, true
+	}
+
+	parsed, err := url.Parse(returnTo)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return "", false
+	}
+
+	origin := parsed.Scheme + "://" + parsed.Host
+	for _, allowed := range a.returnToOrigins {
+		if origin == allowed {
+			return returnTo, true
+		}
+	}
+
+	return "", false
+}
+
+// redirectToFrontend sends the browser to the SPA's auth callback page
+func (a *AuthService) redirectToFrontend(c *gin.Context, params url.Values) {
+	c.Redirect(http.StatusFound, a.frontendURL+"/auth/callback?"+params.Encode())
+}
+
+// setStateCookie sets or clears the cookie that binds a login to the browser
+func (a *AuthService) setStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "oauth_state",
+		Value:    value,
+		Path:     "/auth",
+		MaxAge:   maxAge,
+		Secure:   a.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RefreshToken rotates a session's refresh token and issues a new JWT.
+// The identity provider is asked for fresh user info through the upstream
+// refresh token stored with the session. Providers that issue no refresh
+// tokens leave the session to run until it expires, with the user as stored.
 func (a *AuthService) RefreshToken(c *gin.Context) {
 	var request struct {
 		RefreshToken string `json:"refresh_token" binding:"required"`
@@ -113,26 +334,46 @@ func (a *AuthService) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Use the refresh token to get a new access token
-	token := &oauth2.Token{
-		RefreshToken: request.RefreshToken,
+	session, err := a.sessions.GetSessionByRefreshToken(request.RefreshToken)
+	if err != nil {
+		a.refreshFailed(c, err)
+		return
 	}
 
-	newToken, err := a.oauth2Config.TokenSource(context.Background(), token).Token()
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+	var user *models.User
+	upstreamRefreshToken := ""
+	if session.UpstreamRefreshToken == "" {
+		user, err = a.users.GetUser(session.UserID)
+		if err != nil {
+			if errors.Is(err, services.ErrUserNotFound) {
+				a.sessions.RevokeSession(session.ID, "")
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+			return
+		}
+	} else {
+		var ok bool
+		if user, upstreamRefreshToken, ok = a.refreshUpstream(c, session); !ok {
+			return
+		}
+	}
+
+	if user.Disabled {
+		a.sessions.RevokeSession(session.ID, "")
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is disabled"})
 		return
 	}
 
-	// Get updated user info
-	user, err := a.getUserInfo(newToken.AccessToken)
+	refreshToken, err := a.sessions.RotateRefreshToken(request.RefreshToken, c.Request.UserAgent(), c.ClientIP(), upstreamRefreshToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		a.refreshFailed(c, err)
 		return
 	}
 
 	// Generate new JWT token
-	jwtToken, expiresAt, err := a.generateJWT(user)
+	jwtToken, expiresAt, err := a.generateJWT(user, session.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -140,31 +381,159 @@ func (a *AuthService) RefreshToken(c *gin.Context) {
 
 	response := models.AuthResponse{
 		AccessToken:  jwtToken,
-		RefreshToken: newToken.RefreshToken,
+		RefreshToken: refreshToken,
 		ExpiresAt:    expiresAt,
 		User:         *user,
 	}
 
+	c.Header("Cache-Control", "no-store")
 	c.JSON(http.StatusOK, response)
 }
 
+// refreshUpstream refreshes a session at the identity provider and stores the
+// user info it returns. It returns the user and the provider's new refresh
+// token when that differs from the stored one, or writes an error response.
+func (a *AuthService) refreshUpstream(c *gin.Context, session *models.Session) (*models.User, string, bool) {
+	provider, err := a.oidc(c.Request.Context())
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return nil, "", false
+	}
+
+	// Use the upstream refresh token to get a new access token
+	token := &oauth2.Token{
+		RefreshToken: session.UpstreamRefreshToken,
+	}
+
+	newToken, err := a.config(provider).TokenSource(c.Request.Context(), token).Token()
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			// The provider no longer accepts this login, so neither do we
+			a.sessions.RevokeSession(session.ID, "")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return nil, "", false
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return nil, "", false
+	}
+
+	// Get updated user info; providers may omit the ID token on refresh
+	var providerUser *models.User
+	if rawIDToken, _ := newToken.Extra("id_token").(string); rawIDToken != "" {
+		providerUser, err = a.userFromIDToken(c.Request.Context(), provider, rawIDToken, "", newToken.AccessToken)
+	} else {
+		providerUser, err = a.getUserInfo(c.Request.Context(), provider, newToken.AccessToken)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		return nil, "", false
+	}
+
+	if providerUser.ID != session.UserID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return nil, "", false
+	}
+
+	user, err := a.users.UpsertUser(providerUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store user"})
+		return nil, "", false
+	}
+
+	upstreamRefreshToken := ""
+	if newToken.RefreshToken != session.UpstreamRefreshToken {
+		upstreamRefreshToken = newToken.RefreshToken
+	}
+
+	return user, upstreamRefreshToken, true
+}
+
+// Logout revokes the session of the bearer token or of the given refresh token
+func (a *AuthService) Logout(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	c.ShouldBindJSON(&request)
+
+	var sessionID uuid.UUID
+	if claims, err := a.ValidateToken(c.GetHeader("Authorization")); err == nil {
+		sessionID, _ = uuid.Parse(claims.SessionID)
+	} else if request.RefreshToken != "" {
+		if session, err := a.sessions.GetSessionByRefreshToken(request.RefreshToken); err == nil {
+			sessionID = session.ID
+		}
+	}
+
+	if sessionID == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No active session"})
+		return
+	}
+
+	if err := a.sessions.RevokeSession(sessionID, ""); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// refreshFailed answers a refresh request with an invalid, revoked or reused token
+func (a *AuthService) refreshFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrRefreshTokenReused):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reused, session revoked"})
+	case errors.Is(err, services.ErrSessionNotFound), errors.Is(err, services.ErrSessionInactive):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+	}
+}
+
+// ErrValidationUnavailable is returned by ValidateToken when the token could
+// not be checked against the database; the request is refused either way
+var ErrValidationUnavailable = errors.New("token validation unavailable")
+
 // ValidateToken validates a JWT token and returns the user claims
 func (a *AuthService) ValidateToken(tokenString string) (*models.TokenClaims, error) {
 	// Remove "Bearer " prefix if present
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := a.keys.verificationKey(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return a.jwtSecret, nil
-	})
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods([]string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA}))
 
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		// Tokens stop working as soon as their session is revoked
+		sessionID, _ := claims["sid"].(string)
+		sid, err := uuid.Parse(sessionID)
+		if err != nil || !a.sessions.IsSessionActive(sid) {
+			return nil, fmt.Errorf("session revoked or expired")
+		}
+
+		// Disabled users are refused even while their token is still valid
+		userID, _ := claims["user_id"].(string)
+		disabled, err := a.users.IsUserDisabled(userID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrValidationUnavailable, err)
+		}
+		if disabled {
+			return nil, services.ErrUserDisabled
+		}
+
 		groups := make([]string, 0)
 		if groupsInterface, exists := claims["groups"]; exists {
 			if groupsSlice, ok := groupsInterface.([]interface{}); ok {
@@ -177,30 +546,82 @@ func (a *AuthService) ValidateToken(tokenString string) (*models.TokenClaims, er
 		}
 
 		return &models.TokenClaims{
-			UserID:   claims["user_id"].(string),
-			Email:    claims["email"].(string),
-			Name:     claims["name"].(string),
-			Username: claims["username"].(string),
-			Groups:   groups,
-			Exp:      int64(claims["exp"].(float64)),
-			Iat:      int64(claims["iat"].(float64)),
+			UserID:    claims["user_id"].(string),
+			Email:     claims["email"].(string),
+			Name:      claims["name"].(string),
+			Username:  claims["username"].(string),
+			Groups:    groups,
+			SessionID: sessionID,
+			Exp:       int64(claims["exp"].(float64)),
+			Iat:       int64(claims["iat"].(float64)),
 		}, nil
 	}
 
 	return nil, fmt.Errorf("invalid token")
 }
 
+// userFromIDToken verifies the ID token and builds the user from its claims.
+// The userinfo endpoint is only queried when profile claims are missing.
+func (a *AuthService) userFromIDToken(ctx context.Context, provider *oidcProvider, rawIDToken, nonce, accessToken string) (*models.User, error) {
+	claims, err := provider.verifyIDToken(ctx, rawIDToken, a.oauth2Config.ClientID, nonce, a.groupsClaim)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		ID:       claims.Subject,
+		Email:    claims.Email,
+		Name:     claims.Name,
+		Username: claims.Username,
+		Groups:   claims.Groups,
+	}
+
+	if user.Email != "" && user.Name != "" && user.Username != "" && user.Groups != nil {
+		return user, nil
+	}
+
+	info, err := a.getUserInfo(ctx, provider, accessToken)
+	if err != nil {
+		// The ID token is verified; missing profile claims are not fatal
+		log.Printf("Failed to get user info for %s: %v", user.ID, err)
+		return user, nil
+	}
+
+	// The userinfo response must describe the same user as the ID token
+	if info.ID != user.ID {
+		return nil, fmt.Errorf("userinfo subject mismatch")
+	}
+
+	if user.Email == "" {
+		user.Email = info.Email
+	}
+	if user.Name == "" {
+		user.Name = info.Name
+	}
+	if user.Username == "" {
+		user.Username = info.Username
+	}
+	if user.Groups == nil {
+		user.Groups = info.Groups
+	}
+
+	return user, nil
+}
+
 // getUserInfo fetches user information from the SSO provider
-func (a *AuthService) getUserInfo(accessToken string) (*models.User, error) {
-	req, err := http.NewRequest("GET", a.issuerURL+"/userinfo", nil)
+func (a *AuthService) getUserInfo(ctx context.Context, provider *oidcProvider, accessToken string) (*models.User, error) {
+	if provider.userInfoURL == "" {
+		return nil, fmt.Errorf("provider has no userinfo endpoint")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", provider.userInfoURL, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := provider.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -210,30 +631,36 @@ func (a *AuthService) getUserInfo(accessToken string) (*models.User, error) {
 		return nil, fmt.Errorf("failed to get user info: %d", resp.StatusCode)
 	}
 
-	var userInfo struct {
-		Sub      string   `json:"sub"`
-		Email    string   `json:"email"`
-		Name     string   `json:"name"`
-		Username string   `json:"preferred_username"`
-		Groups   []string `json:"groups"`
-	}
-
+	var userInfo map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
 		return nil, err
 	}
 
-	return &models.User{
-		ID:       userInfo.Sub,
-		Email:    userInfo.Email,
-		Name:     userInfo.Name,
-		Username: userInfo.Username,
-		Groups:   userInfo.Groups,
-	}, nil
+	user := &models.User{}
+	user.ID, _ = userInfo["sub"].(string)
+	user.Email, _ = userInfo["email"].(string)
+	user.Name, _ = userInfo["name"].(string)
+	user.Username, _ = userInfo["preferred_username"].(string)
+	if groups, ok := userInfo[a.groupsClaim].([]interface{}); ok {
+		user.Groups = make([]string, 0, len(groups))
+		for _, group := range groups {
+			if groupStr, ok := group.(string); ok {
+				user.Groups = append(user.Groups, groupStr)
+			}
+		}
+	}
+
+	return user, nil
 }
 
 // generateJWT creates a JWT token for the user
-func (a *AuthService) generateJWT(user *models.User) (string, time.Time, error) {
-	expiresAt := time.Now().Add(24 * time.Hour)
+func (a *AuthService) generateJWT(user *models.User, sessionID uuid.UUID) (string, time.Time, error) {
+	key, err := a.keys.signingKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(accessTokenLifetime)
 
 	claims := jwt.MapClaims{
 		"user_id":  user.ID,
@@ -241,12 +668,14 @@ func (a *AuthService) generateJWT(user *models.User) (string, time.Time, error)
 		"name":     user.Name,
 		"username": user.Username,
 		"groups":   user.Groups,
+		"sid":      sessionID.String(),
 		"exp":      expiresAt.Unix(),
 		"iat":      time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(a.jwtSecret)
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	tokenString, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -0,0 +1,584 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"meet-backend/internal/config"
+	"meet-backend/internal/database"
+	"meet-backend/internal/encryption"
+	"meet-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Supported signing algorithms for the backend's own JWTs
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// accessTokenLifetime is how long a JWT issued by generateJWT stays valid,
+// and therefore how long a retired key must keep verifying tokens
+const accessTokenLifetime = 24 * time.Hour
+
+// minSecretLength is the shortest JWT_SECRET accepted, the size of an HS256
+// key generated for the database
+const minSecretLength = 32
+
+// rotationLockID is the Postgres advisory lock that serializes key rotation
+// between replicas
+const rotationLockID = 0x6d656574 // "meet"
+
+// signingKey is a parsed key that can verify, and optionally sign, JWTs
+type signingKey struct {
+	id        string
+	algorithm string
+	method    jwt.SigningMethod
+	signKey   interface{} // nil for verification-only keys
+	verifyKey interface{}
+	retiredAt *time.Time
+}
+
+// KeyManager holds the keys used to sign and verify the backend's JWTs.
+// Keys come either from configuration or from the signing_keys table; in the
+// latter case they are shared between replicas and rotated automatically.
+type KeyManager struct {
+	mu          sync.RWMutex
+	db          *gorm.DB // nil when keys come from configuration
+	algorithm   string
+	rotateAfter time.Duration
+	active      *signingKey
+	keys        map[string]*signingKey
+	lastReload  time.Time
+}
+
+// NewKeyManagerFromEnv loads signing keys from environment variables, or from
+// the database when neither JWT_PRIVATE_KEY_FILE nor JWT_SECRET is set
+func NewKeyManagerFromEnv() (*KeyManager, error) {
+	km := &KeyManager{keys: make(map[string]*signingKey)}
+
+	if path := os.Getenv("JWT_PRIVATE_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT private key: %w", err)
+		}
+		key, err := parsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		km.active = key
+	} else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("JWT_SECRET must be at least %d bytes (openssl rand -base64 32)", minSecretLength)
+		}
+		km.active = newHMACKey([]byte(secret))
+	}
+
+	if km.active == nil {
+		return newDatabaseKeyManager()
+	}
+
+	km.keys[km.active.id] = km.active
+
+	// Keys that were used before a rotation keep verifying existing tokens
+	for _, secret := range config.SplitList(os.Getenv("JWT_PREVIOUS_SECRETS")) {
+		key := newHMACKey([]byte(secret))
+		key.signKey = nil
+		km.keys[key.id] = key
+	}
+	for _, path := range config.SplitList(os.Getenv("JWT_PREVIOUS_PUBLIC_KEY_FILES")) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+		key, err := parsePublicKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		km.keys[key.id] = key
+	}
+
+	log.Printf("Loaded %d JWT signing key(s) from configuration, active key %s (%s)",
+		len(km.keys), km.active.id, km.active.algorithm)
+	return km, nil
+}
+
+// newDatabaseKeyManager loads keys from the database, creating the first key
+// if needed. Private keys are encrypted with DB_ENCRYPTION_KEY, which release
+// mode requires so a leaked database doesn't let anyone forge tokens.
+func newDatabaseKeyManager() (*KeyManager, error) {
+	if !encryption.Enabled() {
+		if os.Getenv("GIN_MODE") == "release" {
+			return nil, errors.New("DB_ENCRYPTION_KEY is required to store JWT signing keys in the database; set it, JWT_SECRET or JWT_PRIVATE_KEY_FILE")
+		}
+		log.Println("DB_ENCRYPTION_KEY not set, JWT signing keys are stored unencrypted")
+	}
+
+	km := &KeyManager{
+		db:          database.GetDatabase(),
+		algorithm:   AlgorithmHS256,
+		rotateAfter: 30 * 24 * time.Hour,
+		keys:        make(map[string]*signingKey),
+	}
+
+	if algorithm := os.Getenv("JWT_ALGORITHM"); algorithm != "" {
+		switch algorithm {
+		case AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA:
+			km.algorithm = algorithm
+		default:
+			return nil, fmt.Errorf("unsupported JWT_ALGORITHM: %s", algorithm)
+		}
+	}
+
+	if days := os.Getenv("JWT_KEY_ROTATION_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid JWT_KEY_ROTATION_DAYS: %s", days)
+		}
+		km.rotateAfter = time.Duration(n) * 24 * time.Hour
+	}
+
+	if err := km.encryptStoredKeys(); err != nil {
+		return nil, err
+	}
+	if err := km.reload(); err != nil {
+		return nil, err
+	}
+
+	// Changing the algorithm would silently replace a key other replicas may
+	// still sign with, so the operator has to retire the old key explicitly
+	if km.active != nil && km.active.algorithm != km.algorithm {
+		return nil, fmt.Errorf("JWT_ALGORITHM is %s but the active signing key %s uses %s; set JWT_ALGORITHM=%s or retire the key (set retired_at in signing_keys) to switch",
+			km.algorithm, km.active.id, km.active.algorithm, km.active.algorithm)
+	}
+
+	// Another replica starting at the same time may create the first key
+	if err := km.rotate(func(active *models.SigningKey) bool { return active == nil }); err != nil {
+		return nil, err
+	}
+
+	return km, nil
+}
+
+// Rotate creates a new active signing key and retires the current one.
+// Only keys stored in the database can be rotated.
+func (km *KeyManager) Rotate() error {
+	return km.rotate(func(*models.SigningKey) bool { return true })
+}
+
+// rotate replaces the active key when needed reports that it should be
+// replaced. The check runs under a lock, so replicas that rotate at the same
+// time create a single new key.
+func (km *KeyManager) rotate(needed func(active *models.SigningKey) bool) error {
+	if km.db == nil {
+		return errors.New("signing keys from configuration cannot be rotated")
+	}
+
+	var record *models.SigningKey
+	err := km.db.Transaction(func(tx *gorm.DB) error {
+		// The advisory lock also covers an empty table, where there is no
+		// active row to lock
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", rotationLockID).Error; err != nil {
+				return err
+			}
+		}
+
+		var active []models.SigningKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("retired_at IS NULL").
+			Order("created_at DESC").
+			Find(&active).Error; err != nil {
+			return err
+		}
+		var current *models.SigningKey
+		if len(active) > 0 {
+			current = &active[0]
+		}
+		if !needed(current) {
+			return nil
+		}
+
+		var err error
+		if record, err = generateSigningKey(km.algorithm); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.SigningKey{}).
+			Where("retired_at IS NULL").
+			Update("retired_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rotate signing key: %w", err)
+	}
+
+	if record != nil {
+		log.Printf("Rotated JWT signing key, new active key %s (%s)", record.ID, record.Algorithm)
+	}
+	return km.reload()
+}
+
+// encryptStoredKeys encrypts keys that were stored before DB_ENCRYPTION_KEY
+// was set
+func (km *KeyManager) encryptStoredKeys() error {
+	if !encryption.Enabled() {
+		return nil
+	}
+
+	var records []models.SigningKey
+	if err := km.db.Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	for _, record := range records {
+		if encryption.IsEncrypted(record.PrivateKey) {
+			continue
+		}
+		encrypted, err := encryption.Encrypt(record.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if err := km.db.Model(&record).Update("private_key", encrypted).Error; err != nil {
+			return fmt.Errorf("failed to encrypt signing key %s: %w", record.ID, err)
+		}
+		log.Printf("Encrypted JWT signing key %s", record.ID)
+	}
+
+	return nil
+}
+
+// StartRotationRoutine periodically picks up keys created by other replicas,
+// rotates the active key when it is too old and removes expired keys
+func (km *KeyManager) StartRotationRoutine() {
+	if km.db == nil {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := km.reload(); err != nil {
+			log.Printf("Error reloading signing keys: %v", err)
+			continue
+		}
+
+		if km.rotateAfter > 0 {
+			// Replicas share the key, so only the first one to see it expire rotates it
+			err := km.rotate(func(active *models.SigningKey) bool {
+				return active != nil && time.Since(active.CreatedAt) > km.rotateAfter
+			})
+			if err != nil {
+				log.Printf("Error rotating signing key: %v", err)
+			}
+		}
+
+		cutoff := time.Now().Add(-accessTokenLifetime)
+		if err := km.db.Where("retired_at IS NOT NULL AND retired_at < ?", cutoff).
+			Delete(&models.SigningKey{}).Error; err != nil {
+			log.Printf("Error removing expired signing keys: %v", err)
+		}
+	}
+}
+
+// reload replaces the in-memory keys with the ones stored in the database
+func (km *KeyManager) reload() error {
+	var records []models.SigningKey
+	cutoff := time.Now().Add(-accessTokenLifetime)
+	if err := km.db.Where("retired_at IS NULL OR retired_at >= ?", cutoff).
+		Order("created_at DESC").Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	keys := make(map[string]*signingKey, len(records))
+	var active *signingKey
+	for _, record := range records {
+		key, err := parseSigningKey(&record)
+		if err != nil {
+			log.Printf("Skipping unreadable signing key %s: %v", record.ID, err)
+			continue
+		}
+		keys[key.id] = key
+		if active == nil && key.retiredAt == nil {
+			active = key
+		}
+	}
+
+	km.mu.Lock()
+	km.keys = keys
+	km.active = active
+	km.lastReload = time.Now()
+	km.mu.Unlock()
+
+	return nil
+}
+
+// signingKey returns the key that signs new tokens
+func (km *KeyManager) signingKey() (*signingKey, error) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	if km.active == nil {
+		return nil, errors.New("no active signing key")
+	}
+	return km.active, nil
+}
+
+// verificationKey returns the key with the given ID. Unknown IDs trigger a
+// reload (at most every 10 seconds) in case another replica rotated the key.
+func (km *KeyManager) verificationKey(kid string) (*signingKey, bool) {
+	km.mu.RLock()
+	key, ok := km.keys[kid]
+	lastReload := km.lastReload
+	km.mu.RUnlock()
+
+	if ok || km.db == nil || time.Since(lastReload) < 10*time.Second {
+		return key, ok
+	}
+
+	if err := km.reload(); err != nil {
+		log.Printf("Error reloading signing keys: %v", err)
+		return nil, false
+	}
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	key, ok = km.keys[kid]
+	return key, ok
+}
+
+// JWKS serves the public verification keys as a JSON Web Key Set.
+// HMAC keys are secret and never published.
+func (km *KeyManager) JWKS(c *gin.Context) {
+	km.mu.RLock()
+	keys := make([]gin.H, 0, len(km.keys))
+	for _, key := range km.keys {
+		if jwk := publicJWK(key); jwk != nil {
+			keys = append(keys, jwk)
+		}
+	}
+	km.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i]["kid"].(string) < keys[j]["kid"].(string)
+	})
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// generateSigningKey creates a new random key for the given algorithm
+func generateSigningKey(algorithm string) (*models.SigningKey, error) {
+	var (
+		encoded string
+		key     *signingKey
+	)
+
+	switch algorithm {
+	case AlgorithmHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		encoded = base64.StdEncoding.EncodeToString(secret)
+		key = newHMACKey(secret)
+
+	case AlgorithmRS256, AlgorithmEdDSA:
+		var private crypto.Signer
+		var err error
+		if algorithm == AlgorithmRS256 {
+			private, err = rsa.GenerateKey(rand.Reader, 2048)
+		} else {
+			_, private, err = ed25519.GenerateKey(rand.Reader)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return nil, err
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		encoded = string(data)
+		if key, err = parsePrivateKeyPEM(data); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	encrypted, err := encryption.Encrypt(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		ID:         key.id,
+		Algorithm:  algorithm,
+		PrivateKey: encrypted,
+	}, nil
+}
+
+// parseSigningKey turns a stored key into a usable signing key
+func parseSigningKey(record *models.SigningKey) (*signingKey, error) {
+	private, err := encryption.Decrypt(record.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var key *signingKey
+	if record.Algorithm == AlgorithmHS256 {
+		secret, err := base64.StdEncoding.DecodeString(private)
+		if err != nil {
+			return nil, err
+		}
+		key = newHMACKey(secret)
+	} else {
+		if key, err = parsePrivateKeyPEM([]byte(private)); err != nil {
+			return nil, err
+		}
+	}
+
+	if key.algorithm != record.Algorithm {
+		return nil, fmt.Errorf("key algorithm %s does not match %s", key.algorithm, record.Algorithm)
+	}
+
+	// Keep the stored ID so tokens issued under it stay valid
+	key.id = record.ID
+	key.retiredAt = record.RetiredAt
+	return key, nil
+}
+
+// newHMACKey creates an HS256 key whose ID is derived from the secret
+func newHMACKey(secret []byte) *signingKey {
+	sum := sha256.Sum256(append([]byte("hs256:"), secret...))
+	return &signingKey{
+		id:        base64.RawURLEncoding.EncodeToString(sum[:12]),
+		algorithm: AlgorithmHS256,
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// parsePrivateKeyPEM parses an RSA or Ed25519 private key in PKCS#8 or PKCS#1 PEM form
+func parsePrivateKeyPEM(data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if rsaErr != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		private = rsaKey
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+
+	key, err := newPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.signKey = private
+	return key, nil
+}
+
+// parsePublicKeyPEM parses a verification-only RSA or Ed25519 public key
+func parsePublicKeyPEM(data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM public key")
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	return newPublicKey(public)
+}
+
+// newPublicKey creates a verification key whose ID is the RFC 7638 thumbprint
+func newPublicKey(public crypto.PublicKey) (*signingKey, error) {
+	key := &signingKey{verifyKey: public}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		key.algorithm = AlgorithmRS256
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.algorithm = AlgorithmEdDSA
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	jwk := publicJWK(key)
+	var thumbprintInput string
+	if key.algorithm == AlgorithmRS256 {
+		thumbprintInput = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk["e"], jwk["n"])
+	} else {
+		thumbprintInput = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, jwk["x"])
+	}
+	sum := sha256.Sum256([]byte(thumbprintInput))
+	key.id = base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return key, nil
+}
+
+// publicJWK returns the JSON Web Key for an asymmetric key, or nil for HMAC keys
+func publicJWK(key *signingKey) gin.H {
+	switch pub := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return gin.H{
+			"kty": "RSA",
+			"kid": key.id,
+			"alg": AlgorithmRS256,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return gin.H{
+			"kty": "OKP",
+			"kid": key.id,
+			"alg": AlgorithmEdDSA,
+			"use": "sig",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(pub),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/encryption"
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func TestDatabaseKeysAreEncrypted(t *testing.T) {
+	database.DB = testdb.Open(t, &models.SigningKey{})
+	encryption.SetKey(bytes.Repeat([]byte{7}, 32))
+	defer encryption.SetKey(nil)
+
+	// A key stored before DB_ENCRYPTION_KEY was set
+	legacy, err := generateSigningKey(AlgorithmRS256)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	legacy.PrivateKey, _ = encryption.Decrypt(legacy.PrivateKey)
+	if err := database.DB.Create(legacy).Error; err != nil {
+		t.Fatalf("failed to store key: %v", err)
+	}
+
+	t.Setenv("JWT_ALGORITHM", AlgorithmRS256)
+	km, err := newDatabaseKeyManager()
+	if err != nil {
+		t.Fatalf("newDatabaseKeyManager: %v", err)
+	}
+	if err := km.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	var records []models.SigningKey
+	database.DB.Find(&records)
+	if len(records) != 2 {
+		t.Fatalf("got %d stored keys, want the legacy key and a new one", len(records))
+	}
+	for _, record := range records {
+		if !encryption.IsEncrypted(record.PrivateKey) || strings.Contains(record.PrivateKey, "PRIVATE KEY") {
+			t.Errorf("key %s is stored unencrypted", record.ID)
+		}
+	}
+
+	active, err := km.signingKey()
+	if err != nil || active.id == legacy.ID {
+		t.Fatalf("active key = %+v, %v", active, err)
+	}
+	if _, ok := km.verificationKey(legacy.ID); !ok {
+		t.Error("the retired legacy key no longer verifies tokens")
+	}
+}
+
+func TestDatabaseKeysRequireEncryptionInRelease(t *testing.T) {
+	database.DB = testdb.Open(t, &models.SigningKey{})
+	encryption.SetKey(nil)
+	t.Setenv("GIN_MODE", "release")
+
+	if _, err := newDatabaseKeyManager(); err == nil {
+		t.Fatal("newDatabaseKeyManager stored keys without DB_ENCRYPTION_KEY in release mode")
+	}
+
+	var count int64
+	database.DB.Model(&models.SigningKey{}).Count(&count)
+	if count != 0 {
+		t.Errorf("got %d stored keys, want none", count)
+	}
+}
+
+func TestDatabaseKeysAlgorithmMismatch(t *testing.T) {
+	database.DB = testdb.Open(t, &models.SigningKey{})
+	encryption.SetKey(nil)
+
+	t.Setenv("JWT_ALGORITHM", AlgorithmRS256)
+	km, err := newDatabaseKeyManager()
+	if err != nil {
+		t.Fatalf("newDatabaseKeyManager: %v", err)
+	}
+	active, _ := km.signingKey()
+
+	// Another algorithm is refused instead of replacing the shared key
+	t.Setenv("JWT_ALGORITHM", AlgorithmEdDSA)
+	if _, err := newDatabaseKeyManager(); err == nil || !strings.Contains(err.Error(), "JWT_ALGORITHM is EdDSA") {
+		t.Fatalf("err = %v, want an algorithm mismatch", err)
+	}
+	var records []models.SigningKey
+	database.DB.Find(&records)
+	if len(records) != 1 || records[0].ID != active.id || records[0].RetiredAt != nil {
+		t.Fatalf("stored keys %+v, want only the RS256 key %s", records, active.id)
+	}
+
+	// Retiring the key switches the algorithm on the next start
+	database.DB.Model(&records[0]).Update("retired_at", time.Now())
+	km, err = newDatabaseKeyManager()
+	if err != nil {
+		t.Fatalf("newDatabaseKeyManager after retiring the key: %v", err)
+	}
+	if active, err := km.signingKey(); err != nil || active.algorithm != AlgorithmEdDSA {
+		t.Errorf("active key = %+v, %v, want EdDSA", active, err)
+	}
+}
+
+func TestRotateOnlyOnceWhenNeeded(t *testing.T) {
+	database.DB = testdb.Open(t, &models.SigningKey{})
+	encryption.SetKey(nil)
+	t.Setenv("JWT_ALGORITHM", AlgorithmHS256)
+
+	// Two replicas starting against an empty table share the first key
+	first, err := newDatabaseKeyManager()
+	if err != nil {
+		t.Fatalf("newDatabaseKeyManager: %v", err)
+	}
+	second, err := newDatabaseKeyManager()
+	if err != nil {
+		t.Fatalf("newDatabaseKeyManager: %v", err)
+	}
+	a, _ := first.signingKey()
+	b, _ := second.signingKey()
+	if a.id != b.id {
+		t.Fatalf("replicas use keys %s and %s, want one shared key", a.id, b.id)
+	}
+
+	// A key that's too old is rotated by the first replica only
+	database.DB.Model(&models.SigningKey{}).Where("id = ?", a.id).Update("created_at", time.Now().Add(-48*time.Hour))
+	expired := func(active *models.SigningKey) bool {
+		return active != nil && time.Since(active.CreatedAt) > 24*time.Hour
+	}
+	if err := first.rotate(expired); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if err := second.rotate(expired); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	var count int64
+	database.DB.Model(&models.SigningKey{}).Where("retired_at IS NULL").Count(&count)
+	if count != 1 {
+		t.Errorf("got %d active keys, want 1", count)
+	}
+	database.DB.Model(&models.SigningKey{}).Count(&count)
+	if count != 2 {
+		t.Errorf("got %d stored keys, want the expired key and one new key", count)
+	}
+}
+
+func TestJWTSecretMinimumLength(t *testing.T) {
+	t.Setenv("JWT_PRIVATE_KEY_FILE", "")
+	t.Setenv("JWT_PREVIOUS_SECRETS", "")
+	t.Setenv("JWT_PREVIOUS_PUBLIC_KEY_FILES", "")
+
+	t.Setenv("JWT_SECRET", "too-short")
+	if _, err := NewKeyManagerFromEnv(); err == nil {
+		t.Error("NewKeyManagerFromEnv accepted a 9 byte JWT_SECRET")
+	}
+
+	t.Setenv("JWT_SECRET", strings.Repeat("s", minSecretLength))
+	if _, err := NewKeyManagerFromEnv(); err != nil {
+		t.Errorf("NewKeyManagerFromEnv: %v", err)
+	}
+}
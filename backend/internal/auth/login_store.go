@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/encryption"
+	"meet-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// loginAttemptTTL is how long a user has to complete the login at the provider
+	loginAttemptTTL = 10 * time.Minute
+	// loginCodeTTL is how long the SPA has to exchange the one-time code
+	loginCodeTTL = time.Minute
+)
+
+var errLoginExpired = errors.New("login expired or already used")
+
+// loginStore keeps login attempts and one-time codes in the database, so a
+// login can start and finish on different replicas
+type loginStore struct {
+	db *gorm.DB
+}
+
+func newLoginStore() *loginStore {
+	return &loginStore{
+		db: database.GetDatabase(),
+	}
+}
+
+// createAttempt stores a new login attempt with fresh state, nonce and PKCE verifier
+func (ls *loginStore) createAttempt(codeVerifier, returnTo string) (*models.LoginAttempt, error) {
+	attempt := &models.LoginAttempt{
+		State:        generateRandomString(32),
+		CodeVerifier: codeVerifier,
+		Nonce:        generateRandomString(32),
+		ReturnTo:     returnTo,
+		ExpiresAt:    time.Now().Add(loginAttemptTTL),
+	}
+
+	if err := ls.db.Create(attempt).Error; err != nil {
+		return nil, fmt.Errorf("failed to store login attempt: %w", err)
+	}
+
+	return attempt, nil
+}
+
+// consumeAttempt removes and returns the login attempt for a state, so each
+// state can only be used once
+func (ls *loginStore) consumeAttempt(state string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	result := ls.db.Clauses(clause.Returning{}).
+		Where("state = ?", state).
+		Delete(&attempt)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to load login attempt: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || time.Now().After(attempt.ExpiresAt) {
+		return nil, errLoginExpired
+	}
+
+	return &attempt, nil
+}
+
+// createCode stores the tokens of a finished login behind a one-time code,
+// encrypted with DB_ENCRYPTION_KEY when it is set
+func (ls *loginStore) createCode(response *models.AuthResponse) (string, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := encryption.Encrypt(string(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to store login code: %w", err)
+	}
+
+	code := generateRandomString(43)
+	record := &models.LoginCode{
+		CodeHash:  hashLoginCode(code),
+		Response:  encrypted,
+		ExpiresAt: time.Now().Add(loginCodeTTL),
+	}
+
+	if err := ls.db.Create(record).Error; err != nil {
+		return "", fmt.Errorf("failed to store login code: %w", err)
+	}
+
+	return code, nil
+}
+
+// consumeCode removes a one-time code and returns the tokens stored behind it
+func (ls *loginStore) consumeCode(code string) (*models.AuthResponse, error) {
+	var record models.LoginCode
+	result := ls.db.Clauses(clause.Returning{}).
+		Where("code_hash = ?", hashLoginCode(code)).
+		Delete(&record)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to load login code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || time.Now().After(record.ExpiresAt) {
+		return nil, errLoginExpired
+	}
+
+	data, err := encryption.Decrypt(record.Response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read login code: %w", err)
+	}
+
+	var response models.AuthResponse
+	if err := json.Unmarshal([]byte(data), &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// startCleanupRoutine periodically removes expired login attempts and codes
+func (ls *loginStore) startCleanupRoutine() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		if err := ls.db.Where("expires_at < ?", now).Delete(&models.LoginAttempt{}).Error; err != nil {
+			log.Printf("Error removing expired login attempts: %v", err)
+		}
+		if err := ls.db.Where("expires_at < ?", now).Delete(&models.LoginCode{}).Error; err != nil {
+			log.Printf("Error removing expired login codes: %v", err)
+		}
+	}
+}
+
+// hashLoginCode hashes a one-time code for storage
+func hashLoginCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
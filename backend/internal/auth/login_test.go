@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/encryption"
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestLoginStore(t *testing.T) *loginStore {
+	t.Helper()
+	return &loginStore{db: testdb.Open(t, &models.LoginAttempt{}, &models.LoginCode{})}
+}
+
+func TestLoginAttemptIsSingleUse(t *testing.T) {
+	ls := newTestLoginStore(t)
+
+	attempt, err := ls.createAttempt("verifier", "/rooms/abc")
+	if err != nil {
+		t.Fatalf("createAttempt: %v", err)
+	}
+	if attempt.State == "" || attempt.Nonce == "" || attempt.State == attempt.Nonce {
+		t.Fatalf("attempt %+v, want a random state and nonce", attempt)
+	}
+
+	consumed, err := ls.consumeAttempt(attempt.State)
+	if err != nil || consumed.CodeVerifier != "verifier" || consumed.ReturnTo != "/rooms/abc" {
+		t.Fatalf("consumeAttempt = %+v, %v", consumed, err)
+	}
+	if _, err := ls.consumeAttempt(attempt.State); err != errLoginExpired {
+		t.Errorf("second use: err = %v, want %v", err, errLoginExpired)
+	}
+
+	expired, _ := ls.createAttempt("verifier", "")
+	ls.db.Model(&models.LoginAttempt{}).Where("state = ?", expired.State).Update("expires_at", time.Now().Add(-time.Second))
+	if _, err := ls.consumeAttempt(expired.State); err != errLoginExpired {
+		t.Errorf("expired attempt: err = %v, want %v", err, errLoginExpired)
+	}
+}
+
+func TestLoginCodeIsSingleUseAndEncrypted(t *testing.T) {
+	encryption.SetKey(bytes.Repeat([]byte{7}, 32))
+	defer encryption.SetKey(nil)
+
+	ls := newTestLoginStore(t)
+	response := &models.AuthResponse{AccessToken: "access-token", RefreshToken: "refresh-token", User: models.User{ID: "user-1"}}
+
+	code, err := ls.createCode(response)
+	if err != nil {
+		t.Fatalf("createCode: %v", err)
+	}
+
+	var stored models.LoginCode
+	ls.db.First(&stored)
+	if stored.CodeHash == code || !encryption.IsEncrypted(stored.Response) || strings.Contains(stored.Response, "refresh-token") {
+		t.Errorf("login code stored as %+v, want a hash and encrypted tokens", stored)
+	}
+
+	consumed, err := ls.consumeCode(code)
+	if err != nil || consumed.AccessToken != "access-token" || consumed.RefreshToken != "refresh-token" || consumed.User.ID != "user-1" {
+		t.Fatalf("consumeCode = %+v, %v", consumed, err)
+	}
+	if _, err := ls.consumeCode(code); err != errLoginExpired {
+		t.Errorf("second use: err = %v, want %v", err, errLoginExpired)
+	}
+
+	expired, _ := ls.createCode(response)
+	ls.db.Model(&models.LoginCode{}).Where("code_hash = ?", hashLoginCode(expired)).Update("expires_at", time.Now().Add(-time.Second))
+	if _, err := ls.consumeCode(expired); err != errLoginExpired {
+		t.Errorf("expired code: err = %v, want %v", err, errLoginExpired)
+	}
+}
+
+func TestLoginWithPKCE(t *testing.T) {
+	fake := newFakeProvider(t)
+	database.DB = testdb.Open(t,
+		&models.LoginAttempt{},
+		&models.LoginCode{},
+		&models.User{},
+		&models.Session{},
+		&models.RefreshToken{},
+	)
+
+	key := newHMACKey([]byte("a-test-secret-of-at-least-32-bytes"))
+	keys := &KeyManager{active: key, keys: map[string]*signingKey{key.id: key}}
+	t.Setenv("FRONTEND_URL", "https://meet.example.com")
+	a := NewAuthService(testClientID, "client-secret", "https://api.example.com/auth/callback", fake.server.URL, keys)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/login", a.Login)
+	router.GET("/auth/callback", a.Callback)
+	router.POST("/auth/exchange", a.Exchange)
+
+	// Login sends the browser to the provider with a PKCE challenge
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/auth/login?return_to=/rooms/abc-defg-hij", nil))
+	if recorder.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("login status = %d, want %d", recorder.Code, http.StatusTemporaryRedirect)
+	}
+	authURL, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(authURL.String(), fake.server.URL+"/authorize") {
+		t.Fatalf("login redirects to %q, want the provider", recorder.Header().Get("Location"))
+	}
+	query := authURL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("nonce") == "" {
+		t.Fatalf("authorize URL %s lacks PKCE or a nonce", authURL)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "oauth_state" || cookies[0].Value != query.Get("state") {
+		t.Fatalf("cookies %v, want the state", cookies)
+	}
+
+	callback := func(cookie *http.Cookie) *url.URL {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodGet, "/auth/callback?code=auth-code&state="+url.QueryEscape(query.Get("state")), nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		location, err := url.Parse(recorder.Header().Get("Location"))
+		if recorder.Code != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), "https://meet.example.com/auth/callback?") {
+			t.Fatalf("callback status %d to %q, want a redirect to the frontend", recorder.Code, recorder.Header().Get("Location"))
+		}
+		return location
+	}
+
+	// The callback only works in the browser that started the login
+	if location := callback(nil); location.Query().Get("error") != "invalid_state" {
+		t.Errorf("callback without the state cookie redirects to %s, want invalid_state", location)
+	}
+
+	fake.mu.Lock()
+	fake.nonce = query.Get("nonce")
+	fake.mu.Unlock()
+
+	location := callback(cookies[0])
+	code := location.Query().Get("code")
+	if code == "" || location.Query().Get("return_to") != "/rooms/abc-defg-hij" || strings.Contains(location.RawQuery, "token") {
+		t.Fatalf("callback redirects to %s, want a code and return_to without tokens", location)
+	}
+
+	// The provider got the verifier of the challenge
+	fake.mu.Lock()
+	verifier := fake.codeVerifier
+	fake.mu.Unlock()
+	sum := sha256.Sum256([]byte(verifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != query.Get("code_challenge") {
+		t.Errorf("code verifier %q does not match the challenge %q", verifier, query.Get("code_challenge"))
+	}
+
+	// The state is used up
+	if location := callback(cookies[0]); location.Query().Get("error") != "invalid_state" {
+		t.Errorf("second callback redirects to %s, want invalid_state", location)
+	}
+
+	exchange := func() (int, models.AuthResponse) {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/auth/exchange", strings.NewReader(`{"code": "`+code+`"}`))
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(recorder, request)
+		var response models.AuthResponse
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response
+	}
+
+	status, response := exchange()
+	if status != http.StatusOK || response.RefreshToken == "" || response.User.ID != "user-1" {
+		t.Fatalf("exchange = %d %+v, want the tokens of user-1", status, response)
+	}
+	claims, err := a.ValidateToken(response.AccessToken)
+	if err != nil || claims.UserID != "user-1" {
+		t.Errorf("access token claims %+v, %v", claims, err)
+	}
+
+	if status, _ := exchange(); status != http.StatusBadRequest {
+		t.Errorf("second exchange status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
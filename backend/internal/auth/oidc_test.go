@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "meet-backend"
+
+// fakeProvider is an OpenID provider serving discovery and a JWKS whose
+// signing key can be rotated
+type fakeProvider struct {
+	server *httptest.Server
+	issuer string // published in discovery, defaults to the server URL
+
+	mu         sync.Mutex
+	kid        string
+	key        *ecdsa.PrivateKey
+	jwksHits   int
+	generation int
+	// nonce is put in the ID tokens of the token endpoint, which records the
+	// PKCE verifier it receives
+	nonce        string
+	codeVerifier string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+
+	p := &fakeProvider{}
+	p.rotate(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.issuer,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"userinfo_endpoint":      p.server.URL + "/userinfo",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.jwksHits++
+
+		public := p.key.PublicKey
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{
+					"kty": "EC",
+					"kid": p.kid,
+					"use": "sig",
+					"crv": "P-256",
+					"x":   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+					"y":   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+				},
+				// Encryption keys are not used to verify tokens
+				{"kty": "EC", "kid": "enc", "use": "enc", "crv": "P-256"},
+			},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "authorization_code" || r.FormValue("code") != "auth-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		p.mu.Lock()
+		p.codeVerifier = r.FormValue("code_verifier")
+		nonce := p.nonce
+		p.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "upstream-access",
+			"token_type":    "Bearer",
+			"refresh_token": "upstream-refresh",
+			"expires_in":    300,
+			"id_token":      p.sign(t, p.claims(func(c jwt.MapClaims) { c["nonce"] = nonce })),
+		})
+	})
+
+	p.server = httptest.NewServer(mux)
+	p.issuer = p.server.URL
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// rotate replaces the signing key, like a provider rotating its keys
+func (p *fakeProvider) rotate(t *testing.T) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.generation++
+	p.kid = fmt.Sprintf("key-%d", p.generation)
+	p.key = key
+}
+
+func (p *fakeProvider) hits() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.jwksHits
+}
+
+// claims returns valid ID token claims, changed by the given function
+func (p *fakeProvider) claims(change func(jwt.MapClaims)) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                p.server.URL,
+		"sub":                "user-1",
+		"aud":                testClientID,
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              "nonce-1",
+		"email":              "user@example.com",
+		"name":               "User One",
+		"preferred_username": "user1",
+		"groups":             []string{"staff", "admins"},
+	}
+	if change != nil {
+		change(claims)
+	}
+	return claims
+}
+
+// sign signs claims with the current key
+func (p *fakeProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = p.kid
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func discoverFake(t *testing.T, p *fakeProvider) *oidcProvider {
+	t.Helper()
+
+	provider, err := discoverProvider(context.Background(), p.server.URL)
+	if err != nil {
+		t.Fatalf("discoverProvider: %v", err)
+	}
+	return provider
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := discoverFake(t, fake)
+
+	claims, err := provider.verifyIDToken(context.Background(), fake.sign(t, fake.claims(nil)), testClientID, "nonce-1", "groups")
+	if err != nil {
+		t.Fatalf("verifyIDToken: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "user@example.com" || claims.Name != "User One" || claims.Username != "user1" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if strings.Join(claims.Groups, ",") != "staff,admins" {
+		t.Errorf("groups = %v, want staff, admins", claims.Groups)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := discoverFake(t, fake)
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+		nonce  string
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, "nonce-1"},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }, "nonce-1"},
+		{"several audiences without azp", func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "another-client"} }, "nonce-1"},
+		{"several audiences with another azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = "another-client"
+		}, "nonce-1"},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }, "nonce-1"},
+		{"without expiry", func(c jwt.MapClaims) { delete(c, "exp") }, "nonce-1"},
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "nonce-2" }, "nonce-1"},
+		{"missing nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, "nonce-1"},
+		{"missing subject", func(c jwt.MapClaims) { delete(c, "sub") }, "nonce-1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := fake.sign(t, fake.claims(test.change))
+			if _, err := provider.verifyIDToken(context.Background(), token, testClientID, test.nonce, "groups"); err == nil {
+				t.Error("verifyIDToken accepted the token")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenAccepts(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := discoverFake(t, fake)
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+		nonce  string
+	}{
+		{"several audiences with our azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = testClientID
+		}, "nonce-1"},
+		{"expired within the leeway", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() }, "nonce-1"},
+		// Tokens from a refresh carry no nonce
+		{"refresh without nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := fake.sign(t, fake.claims(test.change))
+			if _, err := provider.verifyIDToken(context.Background(), token, testClientID, test.nonce, "groups"); err != nil {
+				t.Errorf("verifyIDToken: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsHMAC(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := discoverFake(t, fake)
+
+	// Signed with the client secret, which anyone with the secret could do
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, fake.claims(nil))
+	signed, err := token.SignedString([]byte("client-secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	if _, err := provider.verifyIDToken(context.Background(), signed, testClientID, "nonce-1", "groups"); err == nil {
+		t.Error("verifyIDToken accepted an HS256 token")
+	}
+}
+
+func TestVerifyIDTokenRefetchesRotatedKeys(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := discoverFake(t, fake)
+
+	if _, err := provider.verifyIDToken(context.Background(), fake.sign(t, fake.claims(nil)), testClientID, "nonce-1", "groups"); err != nil {
+		t.Fatalf("verifyIDToken: %v", err)
+	}
+	if fake.hits() != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", fake.hits())
+	}
+
+	fake.rotate(t)
+	rotated := fake.sign(t, fake.claims(nil))
+
+	// Unknown keys refetch the JWKS at most once a minute
+	if _, err := provider.verifyIDToken(context.Background(), rotated, testClientID, "nonce-1", "groups"); err == nil {
+		t.Fatal("verifyIDToken accepted a token with an unknown key right after a fetch")
+	}
+	if fake.hits() != 1 {
+		t.Fatalf("JWKS fetched %d times within a minute, want 1", fake.hits())
+	}
+
+	provider.mu.Lock()
+	provider.keysFetched = time.Now().Add(-2 * time.Minute)
+	provider.mu.Unlock()
+
+	if _, err := provider.verifyIDToken(context.Background(), rotated, testClientID, "nonce-1", "groups"); err != nil {
+		t.Fatalf("verifyIDToken after rotation: %v", err)
+	}
+	if fake.hits() != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", fake.hits())
+	}
+}
+
+func TestDiscoverProviderRejectsIssuerMismatch(t *testing.T) {
+	fake := newFakeProvider(t)
+	fake.issuer = "https://evil.example.com"
+
+	if _, err := discoverProvider(context.Background(), fake.server.URL); err == nil {
+		t.Error("discoverProvider accepted a document for another issuer")
+	}
+}
@@ -0,0 +1,267 @@
+// Package calendar writes iCalendar (RFC 5545) files for scheduled meetings
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// StatusConfirmed marks an event that takes place
+	StatusConfirmed = "CONFIRMED"
+	// StatusCancelled marks a cancelled event
+	StatusCancelled = "CANCELLED"
+
+	prodID = "-//Lazentis//Meet//EN"
+
+	dateTimeFormat    = "20060102T150405"
+	utcDateTimeFormat = "20060102T150405Z"
+
+	// timezoneYears is how far ahead the daylight saving transitions of a
+	// timezone are written out
+	timezoneYears = 10
+)
+
+// now is replaced in tests to write the same output every time
+var now = time.Now
+
+// Calendar is an iCalendar object with one or more events
+type Calendar struct {
+	Name   string // shown by clients subscribing to a feed
+	Method string // iTIP method, e.g. REQUEST for invitations; empty for plain exports and feeds
+	Events []Event
+}
+
+// Event is a VEVENT. Start and End are written in Location; a nil or UTC
+// location writes UTC times.
+type Event struct {
+	UID          string
+	Sequence     int
+	Summary      string
+	Description  string
+	URL          string
+	Start        time.Time
+	End          time.Time
+	Location     *time.Location
+	RRule        string      // RRULE value without the RRULE: prefix
+	ExDates      []time.Time // starts of occurrences left out of the RRULE
+	Status       string
+	Organizer    *Person
+	Attendees    []Person
+	Created      time.Time
+	LastModified time.Time
+}
+
+// Person is an organizer or attendee
+type Person struct {
+	Name  string
+	Email string
+}
+
+// String encodes the calendar
+func (c *Calendar) String() string {
+	w := &writer{}
+
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:" + prodID)
+	w.line("CALSCALE:GREGORIAN")
+	if c.Method != "" {
+		w.line("METHOD:" + c.Method)
+	}
+	if c.Name != "" {
+		w.line("X-WR-CALNAME:" + escapeText(c.Name))
+	}
+
+	// Every timezone used by an event needs a VTIMEZONE
+	zones := make(map[string]time.Time)
+	locations := make(map[string]*time.Location)
+	for _, event := range c.Events {
+		if isUTC(event.Location) {
+			continue
+		}
+		name := event.Location.String()
+		if from, ok := zones[name]; !ok || event.Start.Before(from) {
+			zones[name] = event.Start
+		}
+		locations[name] = event.Location
+	}
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.timezone(locations[name], zones[name])
+	}
+
+	for _, event := range c.Events {
+		w.event(&event)
+	}
+
+	w.line("END:VCALENDAR")
+	return w.String()
+}
+
+// writer builds folded, CRLF terminated content lines
+type writer struct {
+	strings.Builder
+}
+
+// line writes a content line, folded at 75 octets without splitting characters
+func (w *writer) line(content string) {
+	limit := 75
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.WriteString(content[:cut])
+		w.WriteString("\r\n ")
+		content = content[cut:]
+		limit = 74 // the leading space counts towards the next line
+	}
+	w.WriteString(content)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) event(event *Event) {
+	w.line("BEGIN:VEVENT")
+	w.line("UID:" + event.UID)
+	stamp := event.LastModified
+	if stamp.IsZero() {
+		stamp = now()
+	}
+	w.line("DTSTAMP:" + stamp.UTC().Format(utcDateTimeFormat))
+	w.line("DTSTART" + formatDateTime(event.Start, event.Location))
+	w.line("DTEND" + formatDateTime(event.End, event.Location))
+	if event.RRule != "" {
+		w.line("RRULE:" + event.RRule)
+	}
+	for _, exDate := range event.ExDates {
+		w.line("EXDATE" + formatDateTime(exDate, event.Location))
+	}
+	w.line("SUMMARY:" + escapeText(event.Summary))
+	if event.Description != "" {
+		w.line("DESCRIPTION:" + escapeText(event.Description))
+	}
+	if event.URL != "" {
+		w.line("URL:" + event.URL)
+		w.line("LOCATION:" + escapeText(event.URL))
+	}
+	if event.Organizer != nil && event.Organizer.Email != "" {
+		w.line("ORGANIZER" + commonName(event.Organizer.Name) + ":mailto:" + event.Organizer.Email)
+	}
+	for _, attendee := range event.Attendees {
+		if attendee.Email == "" {
+			continue
+		}
+		w.line("ATTENDEE" + commonName(attendee.Name) + ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:" + attendee.Email)
+	}
+	status := event.Status
+	if status == "" {
+		status = StatusConfirmed
+	}
+	w.line("STATUS:" + status)
+	w.line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+	if !event.Created.IsZero() {
+		w.line("CREATED:" + event.Created.UTC().Format(utcDateTimeFormat))
+	}
+	if !event.LastModified.IsZero() {
+		w.line("LAST-MODIFIED:" + event.LastModified.UTC().Format(utcDateTimeFormat))
+	}
+	w.line("END:VEVENT")
+}
+
+// timezone writes a VTIMEZONE with every offset change of a location from
+// the start of the first event until timezoneYears from now
+func (w *writer) timezone(location *time.Location, from time.Time) {
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + location.String())
+
+	t := from.In(location)
+	until := now().AddDate(timezoneYears, 0, 0)
+	if until.Before(t) {
+		until = t.AddDate(timezoneYears, 0, 0)
+	}
+
+	// The period the first event starts in
+	name, offset := t.Zone()
+	w.observance(t.IsDST(), t, name, offset, offset)
+
+	for {
+		_, end := t.ZoneBounds()
+		if end.IsZero() || end.After(until) {
+			break
+		}
+		_, previous := t.Zone()
+		t = end
+		name, offset := t.Zone()
+		// DTSTART is the wall clock time of the transition in the old offset
+		w.observance(t.IsDST(), end.UTC().Add(time.Duration(previous)*time.Second), name, previous, offset)
+	}
+
+	w.line("END:VTIMEZONE")
+}
+
+// observance writes a STANDARD or DAYLIGHT period; start is formatted as wall clock time
+func (w *writer) observance(dst bool, start time.Time, name string, offsetFrom, offsetTo int) {
+	component := "STANDARD"
+	if dst {
+		component = "DAYLIGHT"
+	}
+
+	w.line("BEGIN:" + component)
+	w.line("DTSTART:" + start.Format(dateTimeFormat))
+	w.line("TZOFFSETFROM:" + formatOffset(offsetFrom))
+	w.line("TZOFFSETTO:" + formatOffset(offsetTo))
+	if name != "" {
+		w.line("TZNAME:" + escapeText(name))
+	}
+	w.line("END:" + component)
+}
+
+// formatDateTime formats a DTSTART or DTEND value including its parameters
+func formatDateTime(t time.Time, location *time.Location) string {
+	if isUTC(location) {
+		return ":" + t.UTC().Format(utcDateTimeFormat)
+	}
+	return ";TZID=" + location.String() + ":" + t.In(location).Format(dateTimeFormat)
+}
+
+// formatOffset formats a UTC offset in seconds as +HHMM
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// commonName returns the CN parameter for a name
+func commonName(name string) string {
+	if name == "" {
+		return ""
+	}
+	// Parameter values can't contain quotes; quoting allows ; : and ,
+	return `;CN="` + strings.ReplaceAll(name, `"`, "'") + `"`
+}
+
+// escapeText escapes a TEXT value
+func escapeText(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+func isUTC(location *time.Location) bool {
+	return location == nil || location == time.UTC || location.String() == "UTC"
+}
@@ -0,0 +1,204 @@
+package calendar
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // the golden timezones must not depend on the system database
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixedNow pins DTSTAMP and the VTIMEZONE range for golden output
+func fixedNow(t *testing.T) {
+	t.Helper()
+	previous := now
+	now = func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = previous })
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return location
+}
+
+// assertGolden compares output with testdata/<name>.ics, or rewrites it with -update
+func assertGolden(t *testing.T, name, output string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".ics")
+	if *update {
+		if err := os.WriteFile(path, []byte(output), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if output != string(golden) {
+		t.Errorf("output differs from %s (run with -update to rewrite):\n%s", path, output)
+	}
+}
+
+func TestCalendarGolden(t *testing.T) {
+	fixedNow(t)
+
+	amsterdam := loadLocation(t, "Europe/Amsterdam")
+	created := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		calendar Calendar
+	}{
+		{
+			name: "invitation",
+			calendar: Calendar{
+				Method: "REQUEST",
+				Events: []Event{{
+					UID:          "meeting-1@meet.example.com",
+					Sequence:     2,
+					Summary:      "Weekly sync; planning, review",
+					Description:  "Agenda:\n1. Status\\updates\n2. Ëën lange regel met tekens die over meerdere regels gevouwen moet worden",
+					URL:          "https://meet.example.com/abc-defg-hij",
+					Start:        time.Date(2026, 3, 23, 10, 0, 0, 0, amsterdam),
+					End:          time.Date(2026, 3, 23, 10, 30, 0, 0, amsterdam),
+					Location:     amsterdam,
+					RRule:        "FREQ=WEEKLY;BYDAY=MO;COUNT=10",
+					ExDates:      []time.Time{time.Date(2026, 4, 6, 10, 0, 0, 0, amsterdam)},
+					Organizer:    &Person{Name: "Anne \"Host\" de Vries", Email: "anne@example.com"},
+					Attendees:    []Person{{Name: "Bob", Email: "bob@example.com"}, {Name: "No address"}},
+					Created:      created,
+					LastModified: created,
+				}},
+			},
+		},
+		{
+			name: "cancellation",
+			calendar: Calendar{
+				Method: "CANCEL",
+				Events: []Event{{
+					UID:      "meeting-1@meet.example.com",
+					Sequence: 3,
+					Summary:  "Weekly sync",
+					Start:    time.Date(2026, 3, 23, 9, 0, 0, 0, time.UTC),
+					End:      time.Date(2026, 3, 23, 9, 30, 0, 0, time.UTC),
+					Status:   StatusCancelled,
+				}},
+			},
+		},
+		{
+			name: "feed",
+			calendar: Calendar{
+				Name: "Meetings, Anne",
+				Events: []Event{
+					{
+						UID:      "meeting-2@meet.example.com",
+						Summary:  "New York standup",
+						Start:    time.Date(2026, 11, 2, 9, 0, 0, 0, loadLocation(t, "America/New_York")),
+						End:      time.Date(2026, 11, 2, 9, 15, 0, 0, loadLocation(t, "America/New_York")),
+						Location: loadLocation(t, "America/New_York"),
+					},
+					{
+						UID:      "meeting-3@meet.example.com",
+						Summary:  "UTC review",
+						Start:    time.Date(2026, 11, 3, 15, 0, 0, 0, time.UTC),
+						End:      time.Date(2026, 11, 3, 16, 0, 0, 0, time.UTC),
+						Location: time.UTC,
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertGolden(t, test.name, test.calendar.String())
+		})
+	}
+}
+
+func TestCalendarCancellation(t *testing.T) {
+	fixedNow(t)
+
+	calendar := Calendar{
+		Method: "CANCEL",
+		Events: []Event{{UID: "meeting-1", Summary: "Sync", Start: now(), End: now().Add(time.Hour), Status: StatusCancelled}},
+	}
+	output := calendar.String()
+
+	for _, line := range []string{"METHOD:CANCEL\r\n", "STATUS:CANCELLED\r\n"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("output is missing %q", line)
+		}
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	tests := []string{
+		strings.Repeat("a", 75),
+		strings.Repeat("a", 76),
+		strings.Repeat("a", 300),
+		// Multi-byte characters straddling the fold
+		strings.Repeat("a", 73) + strings.Repeat("ë", 40),
+		strings.Repeat("€", 60),
+	}
+
+	for _, content := range tests {
+		w := &writer{}
+		w.line(content)
+		output := w.String()
+
+		if !strings.HasSuffix(output, "\r\n") {
+			t.Fatalf("line %q is not CRLF terminated", output)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(output, "\r\n"), "\r\n")
+		for i, line := range lines {
+			if len(line) > 75 {
+				t.Errorf("line %d is %d octets, want at most 75", i, len(line))
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("line %d splits a character: %q", i, line)
+			}
+			if i > 0 && !strings.HasPrefix(line, " ") {
+				t.Errorf("continuation line %d does not start with a space", i)
+			}
+		}
+		if len(content) <= 75 && len(lines) != 1 {
+			t.Errorf("%d octets folded into %d lines, want 1", len(content), len(lines))
+		}
+
+		// Unfolding removes CRLF followed by a space
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(output, "\r\n"), "\r\n ", ""); unfolded != content {
+			t.Errorf("unfolded %q, want %q", unfolded, content)
+		}
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := map[string]string{
+		"plain":               "plain",
+		"a;b,c":               `a\;b\,c`,
+		`back\slash`:          `back\\slash`,
+		"two\nlines":          `two\nlines`,
+		"windows\r\nnewline":  `windows\nnewline`,
+		`\n is not a newline`: `\\n is not a newline`,
+	}
+
+	for input, want := range tests {
+		if got := escapeText(input); got != want {
+			t.Errorf("escapeText(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// Package config holds helpers for reading settings from the environment
+package config
+
+import "strings"
+
+// SplitList splits a comma-separated setting, dropping empty items and the
+// spaces around items
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -84,9 +84,6 @@ func InitDatabase() error {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 	
-	// Start cleanup routine
-	go startCleanupRoutine()
-	
 	return nil
 }
 
@@ -97,6 +94,27 @@ func runMigrations() error {
 	err := DB.AutoMigrate(
 		&models.Room{},
 		&models.RoomParticipant{},
+		&models.Recording{},
+		&models.SigningKey{},
+		&models.LoginAttempt{},
+		&models.LoginCode{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.User{},
+		&models.RoomMember{},
+		&models.RoomPolicy{},
+		&models.LobbyEntry{},
+		&models.PasscodeAttempt{},
+		&models.Invite{},
+		&models.Meeting{},
+		&models.CalendarFeed{},
+		&models.OutboxEmail{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.ModerationAction{},
+		&models.Ban{},
+		&models.BreakoutAssignment{},
+		&models.ChatMessage{},
 	)
 	
 	if err != nil {
@@ -107,54 +125,6 @@ func runMigrations() error {
 	return nil
 }
 
-// startCleanupRoutine starts a background routine to clean up expired rooms
-func startCleanupRoutine() {
-	ticker := time.NewTicker(5 * time.Minute) // Check every 5 minutes
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-ticker.C:
-			cleanupExpiredRooms()
-		}
-	}
-}
-
-// cleanupExpiredRooms removes expired rooms and their participants
-func cleanupExpiredRooms() {
-	log.Println("Running expired rooms cleanup...")
-	
-	// Find expired rooms
-	var expiredRooms []models.Room
-	result := DB.Where("expires_at IS NOT NULL AND expires_at < ? AND is_active = ?", 
-		time.Now(), true).Find(&expiredRooms)
-	
-	if result.Error != nil {
-		log.Printf("Error finding expired rooms: %v", result.Error)
-		return
-	}
-	
-	if len(expiredRooms) == 0 {
-		return
-	}
-	
-	log.Printf("Found %d expired rooms to cleanup", len(expiredRooms))
-	
-	// Mark rooms as inactive and remove participants
-	for _, room := range expiredRooms {
-		// Mark room as inactive
-		DB.Model(&room).Update("is_active", false)
-		
-		// Mark participants as left
-		now := time.Now()
-		DB.Model(&models.RoomParticipant{}).
-			Where("room_id = ? AND left_at IS NULL", room.ID).
-			Update("left_at", now)
-		
-		log.Printf("Cleaned up expired room: %s", room.Name)
-	}
-}
-
 // GetDatabase returns the database instance
 func GetDatabase() *gorm.DB {
 	return DB
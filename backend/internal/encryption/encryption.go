@@ -0,0 +1,121 @@
+// Package encryption encrypts secrets the backend stores in the database,
+// such as JWT signing keys, with AES-256-GCM and the key in DB_ENCRYPTION_KEY.
+// Without that key secrets are stored as they are.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// prefix marks encrypted values; values without it were stored before
+// encryption was enabled and are returned as they are
+const prefix = "enc:v1:"
+
+var (
+	mu   sync.RWMutex
+	aead cipher.AEAD
+)
+
+// ErrNoKey is returned when an encrypted value is read without DB_ENCRYPTION_KEY
+var ErrNoKey = errors.New("DB_ENCRYPTION_KEY is not set")
+
+// LoadKeyFromEnv reads the key from DB_ENCRYPTION_KEY: 32 bytes, base64
+// encoded, e.g. from `openssl rand -base64 32`. An empty variable disables
+// encryption.
+func LoadKeyFromEnv() error {
+	value := strings.TrimSpace(os.Getenv("DB_ENCRYPTION_KEY"))
+	if value == "" {
+		SetKey(nil)
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return errors.New("DB_ENCRYPTION_KEY must be 32 bytes, base64 encoded")
+	}
+	SetKey(key)
+	return nil
+}
+
+// SetKey replaces the 32 byte key; nil disables encryption
+func SetKey(key []byte) {
+	var next cipher.AEAD
+	if key != nil {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			panic(fmt.Sprintf("invalid encryption key: %v", err))
+		}
+		if next, err = cipher.NewGCM(block); err != nil {
+			panic(fmt.Sprintf("invalid encryption key: %v", err))
+		}
+	}
+
+	mu.Lock()
+	aead = next
+	mu.Unlock()
+}
+
+// Enabled checks if secrets are encrypted
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return aead != nil
+}
+
+// IsEncrypted checks if a stored value was encrypted by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt encrypts a secret for storage, or returns it as it is when
+// encryption is disabled. Empty values stay empty.
+func Encrypt(plaintext string) (string, error) {
+	mu.RLock()
+	current := aead
+	mu.RUnlock()
+
+	if current == nil || plaintext == "" {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, current.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	sealed := current.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the secret of a stored value. Values stored before
+// encryption was enabled are returned as they are.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	mu.RLock()
+	current := aead
+	mu.RUnlock()
+
+	if current == nil {
+		return "", ErrNoKey
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil || len(sealed) < current.NonceSize() {
+		return "", errors.New("failed to decrypt: malformed value")
+	}
+	plaintext, err := current.Open(nil, sealed[:current.NonceSize()], sealed[current.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt: wrong key or tampered value")
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,74 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	SetKey(bytes.Repeat([]byte{1}, 32))
+	defer SetKey(nil)
+
+	encrypted, err := Encrypt("secret value")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "secret value") {
+		t.Fatalf("Encrypt returned %q", encrypted)
+	}
+
+	again, _ := Encrypt("secret value")
+	if again == encrypted {
+		t.Error("encrypting twice gave the same value, nonce is not random")
+	}
+
+	decrypted, err := Decrypt(encrypted)
+	if err != nil || decrypted != "secret value" {
+		t.Errorf("Decrypt = %q, %v", decrypted, err)
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	SetKey(bytes.Repeat([]byte{1}, 32))
+	encrypted, _ := Encrypt("secret value")
+
+	SetKey(bytes.Repeat([]byte{2}, 32))
+	if _, err := Decrypt(encrypted); err == nil {
+		t.Error("Decrypt with the wrong key succeeded")
+	}
+
+	SetKey(nil)
+	if _, err := Decrypt(encrypted); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Decrypt without key = %v, want ErrNoKey", err)
+	}
+}
+
+func TestPlaintextPassesThrough(t *testing.T) {
+	SetKey(nil)
+	if value, _ := Encrypt("plain"); value != "plain" {
+		t.Errorf("Encrypt without key = %q, want it unchanged", value)
+	}
+
+	// Values stored before encryption was enabled stay readable
+	SetKey(bytes.Repeat([]byte{1}, 32))
+	defer SetKey(nil)
+	if value, err := Decrypt("plain"); err != nil || value != "plain" {
+		t.Errorf("Decrypt of a plaintext value = %q, %v", value, err)
+	}
+}
+
+func TestLoadKeyFromEnv(t *testing.T) {
+	defer SetKey(nil)
+
+	t.Setenv("DB_ENCRYPTION_KEY", "too-short")
+	if err := LoadKeyFromEnv(); err == nil {
+		t.Error("LoadKeyFromEnv accepted a short key")
+	}
+
+	t.Setenv("DB_ENCRYPTION_KEY", "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+	if err := LoadKeyFromEnv(); err != nil || !Enabled() {
+		t.Errorf("LoadKeyFromEnv = %v, enabled %v", err, Enabled())
+	}
+}
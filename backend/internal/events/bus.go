@@ -0,0 +1,108 @@
+package events
+
+import "sync"
+
+// subscriptionBuffer is how many events a subscriber can fall behind
+const subscriptionBuffer = 64
+
+// Bus carries events to subscribers of a room. The in-memory bus only
+// reaches subscribers on the same replica; a shared backend such as Redis
+// pub/sub can implement the same interface so replicas see each other's events.
+type Bus interface {
+	// Publish sends an event to the current subscribers of its room
+	Publish(event Event) error
+	// Subscribe starts receiving the events of a room
+	Subscribe(room string) (Subscription, error)
+}
+
+// Subscription receives the events of one room until it is closed
+type Subscription interface {
+	// Events returns the channel events arrive on. It is closed when the
+	// subscription is closed, or when the subscriber fell too far behind and
+	// should subscribe again.
+	Events() <-chan Event
+	// Close stops the subscription
+	Close()
+}
+
+// MemoryBus is a Bus within a single process
+type MemoryBus struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*memorySubscription]struct{}
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		subscribers: make(map[string]map[*memorySubscription]struct{}),
+	}
+}
+
+// Publish sends an event to the subscribers of its room. Subscribers whose
+// buffer is full are dropped instead of slowing down the publisher.
+func (b *MemoryBus) Publish(event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscription := range b.subscribers[event.Room] {
+		select {
+		case subscription.events <- event:
+		default:
+			b.remove(subscription)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe starts receiving the events of a room
+func (b *MemoryBus) Subscribe(room string) (Subscription, error) {
+	subscription := &memorySubscription{
+		bus:    b,
+		room:   room,
+		events: make(chan Event, subscriptionBuffer),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[room] == nil {
+		b.subscribers[room] = make(map[*memorySubscription]struct{})
+	}
+	b.subscribers[room][subscription] = struct{}{}
+
+	return subscription, nil
+}
+
+// remove drops a subscription and closes its channel; b.mu must be held
+func (b *MemoryBus) remove(subscription *memorySubscription) {
+	subscribers, ok := b.subscribers[subscription.room]
+	if !ok {
+		return
+	}
+	if _, ok := subscribers[subscription]; !ok {
+		return
+	}
+
+	delete(subscribers, subscription)
+	if len(subscribers) == 0 {
+		delete(b.subscribers, subscription.room)
+	}
+	close(subscription.events)
+}
+
+type memorySubscription struct {
+	bus    *MemoryBus
+	room   string
+	events chan Event
+}
+
+func (s *memorySubscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *memorySubscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.remove(s)
+}
@@ -0,0 +1,166 @@
+// Package events defines the room events of the backend and the pub/sub bus
+// that carries them to clients streaming a room. Webhook subscribers get the
+// same events through the webhooks package.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"meet-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	EventRoomState         = "room.state" // sent to a stream when it connects
+	EventRoomCreated       = "room.created"
+	EventRoomExpiring      = "room.expiring"
+	EventRoomExtended      = "room.extended"
+	EventRoomExpired       = "room.expired"
+	EventRoomDeactivated   = "room.deactivated"
+	EventParticipantJoined = "participant.joined"
+	EventParticipantLeft   = "participant.left"
+	EventRecordingStarted  = "recording.started"
+	EventRecordingFinished = "recording.finished"
+	EventBreakoutsOpened   = "breakouts.opened" // sent to the main room
+	EventBreakoutsClosed   = "breakouts.closed" // sent to the main room and each breakout
+	EventChatMessage       = "chat.message"
+	EventChatEdited        = "chat.edited"
+	EventChatDeleted       = "chat.deleted"
+)
+
+// Event is something that happened in a room
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Room      string          `json:"room"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// RoomData describes the room of a room event
+type RoomData struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	CreatedBy   *string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	IsGuestRoom bool       `json:"is_guest_room"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"` // set for breakout rooms
+}
+
+// ParticipantData describes the participant of a participant event
+type ParticipantData struct {
+	RoomID   uuid.UUID  `json:"room_id"`
+	RoomName string     `json:"room_name"`
+	Identity string     `json:"identity"`
+	Name     string     `json:"name"`
+	UserID   *string    `json:"user_id,omitempty"`
+	IsGuest  bool       `json:"is_guest"`
+	JoinedAt time.Time  `json:"joined_at"`
+	LeftAt   *time.Time `json:"left_at,omitempty"`
+}
+
+// NewRoomData returns the event data of a room
+func NewRoomData(room *models.Room) *RoomData {
+	return &RoomData{
+		ID:          room.ID,
+		Name:        room.Name,
+		CreatedBy:   room.CreatedBy,
+		CreatedAt:   room.CreatedAt,
+		ExpiresAt:   room.ExpiresAt,
+		IsGuestRoom: room.CreatedBy == nil,
+		ParentID:    room.ParentID,
+	}
+}
+
+// NewParticipantData returns the event data of a participant in a room
+func NewParticipantData(room *models.Room, participant *models.RoomParticipant) *ParticipantData {
+	return &ParticipantData{
+		RoomID:   room.ID,
+		RoomName: room.Name,
+		Identity: participant.Identity,
+		Name:     participant.Name,
+		UserID:   participant.UserID,
+		IsGuest:  participant.IsGuest,
+		JoinedAt: participant.JoinedAt,
+		LeftAt:   participant.LeftAt,
+	}
+}
+
+// NewEvent creates an event with its data encoded as JSON
+func NewEvent(room, eventType string, data interface{}) (Event, error) {
+	event := Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Room:      room,
+		CreatedAt: time.Now().UTC(),
+	}
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return Event{}, err
+		}
+		event.Data = encoded
+	}
+	return event, nil
+}
+
+// bus is the bus events are published on; see SetBus
+var bus Bus = NewMemoryBus()
+
+// SetBus replaces the bus, e.g. with one shared by all replicas. It must be
+// called before the server starts handling requests.
+func SetBus(b Bus) {
+	bus = b
+}
+
+// GetBus returns the bus events are published on
+func GetBus() Bus {
+	return bus
+}
+
+// Publish sends an event to the clients streaming a room. Failures are
+// logged rather than returned, like webhooks.Emit.
+func Publish(room, eventType string, data interface{}) {
+	event, err := NewEvent(room, eventType, data)
+	if err == nil {
+		err = bus.Publish(event)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event for room %s: %v", eventType, room, err)
+	}
+}
+
+// ExpiryWarningsFromEnv returns when streams warn that a room is about to
+// expire, longest first. ROOM_EXPIRY_WARNINGS is a comma separated list of
+// minutes before expiry and defaults to 10,5,1; "none" disables the warnings.
+func ExpiryWarningsFromEnv() ([]time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv("ROOM_EXPIRY_WARNINGS"))
+	if value == "" {
+		value = "10,5,1"
+	}
+	if value == "none" {
+		return nil, nil
+	}
+
+	var warnings []time.Duration
+	for _, field := range strings.Split(value, ",") {
+		minutes, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || minutes < 1 {
+			return nil, fmt.Errorf("invalid ROOM_EXPIRY_WARNINGS value %q", field)
+		}
+		warnings = append(warnings, time.Duration(minutes)*time.Minute)
+	}
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i] > warnings[j] })
+
+	return warnings, nil
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// BanHandler manages the bans of rooms and the org-wide bans of admins
+type BanHandler struct {
+	roomService       *services.RoomService
+	banService        *services.BanService
+	moderationService *services.ModerationService
+}
+
+func NewBanHandler(apiKey, apiSecret, serverURL string) *BanHandler {
+	roomClient := lksdk.NewRoomServiceClient(serverURL, apiKey, apiSecret)
+
+	return &BanHandler{
+		roomService:       services.NewRoomService(),
+		banService:        services.NewBanService(),
+		moderationService: services.NewModerationService(database.GetDatabase(), roomClient, services.NewTokenIssuer(apiKey, apiSecret, serverURL)),
+	}
+}
+
+// BanFromRoom bans someone from a room and removes them if they are in it
+// (owner, moderator or admin)
+func (bh *BanHandler) BanFromRoom(c *gin.Context) {
+	room, err := bh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	bh.createBan(c, room)
+}
+
+// ListRoomBans returns the bans in effect for a room (owner or admin)
+func (bh *BanHandler) ListRoomBans(c *gin.Context) {
+	room, err := bh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	bh.listBans(c, &room.ID)
+}
+
+// LiftRoomBan lifts a ban of a room (owner or admin)
+func (bh *BanHandler) LiftRoomBan(c *gin.Context) {
+	room, err := bh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	bh.liftBan(c, room)
+}
+
+// CreateBan bans someone from every room (admin)
+func (bh *BanHandler) CreateBan(c *gin.Context) {
+	bh.createBan(c, nil)
+}
+
+// ListBans returns the org-wide bans in effect (admin)
+func (bh *BanHandler) ListBans(c *gin.Context) {
+	bh.listBans(c, nil)
+}
+
+// LiftBan lifts an org-wide ban (admin)
+func (bh *BanHandler) LiftBan(c *gin.Context) {
+	bh.liftBan(c, nil)
+}
+
+// createBan bans someone from a room, or from every room when room is nil
+func (bh *BanHandler) createBan(c *gin.Context, room *models.Room) {
+	var request models.BanRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ban, removed, err := bh.moderationService.Ban(c.Request.Context(), room, c.GetString("user_id"), request)
+	if err != nil {
+		respondBanError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ban":     ban,
+		"removed": removed,
+	})
+}
+
+// listBans responds with the bans of a room, or the org-wide bans when roomID is nil
+func (bh *BanHandler) listBans(c *gin.Context, roomID *uuid.UUID) {
+	bans, err := bh.banService.ListBans(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bans":  bans,
+		"count": len(bans),
+	})
+}
+
+// liftBan lifts the ban from the :id parameter, which must belong to the
+// room, or be org-wide when room is nil
+func (bh *BanHandler) liftBan(c *gin.Context, room *models.Room) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ban ID"})
+		return
+	}
+
+	ban, err := bh.banService.GetBan(id)
+	if err != nil {
+		respondBanError(c, err)
+		return
+	}
+
+	if (room == nil) != (ban.RoomID == nil) || (room != nil && *ban.RoomID != room.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrBanNotFound.Error()})
+		return
+	}
+
+	if err := bh.moderationService.LiftBan(room, c.GetString("user_id"), ban); err != nil {
+		respondBanError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ban lifted successfully"})
+}
+
+// respondBanError responds to an error of the ban service
+func respondBanError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidBan):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// checkBan refuses someone banned from the room or from every room, writing
+// the error response when they are. Guests are also checked by IP address.
+func checkBan(c *gin.Context, banService *services.BanService, room *models.Room, tokenRequest services.TokenRequest) bool {
+	subject := services.BanSubject{
+		UserID:   tokenRequest.UserID,
+		Identity: tokenRequest.Identity,
+	}
+	if tokenRequest.UserID == nil {
+		subject.IPAddress = c.ClientIP()
+	}
+
+	ban, err := banService.FindBan(room.ID, subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if ban != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":      services.ErrBanned.Error(),
+			"banned":     true,
+			"expires_at": ban.ExpiresAt,
+		})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGuestIPBanUsesTrustedProxies(t *testing.T) {
+	db, room := newTokenTest(t)
+	db.Model(room).Update("lobby_enabled", false)
+	if _, err := services.NewBanService().CreateBan(nil, models.BanRequest{IPAddress: "203.0.113.9"}, "admin"); err != nil {
+		t.Fatalf("CreateBan: %v", err)
+	}
+	handler := NewRoomManagementHandler(testAPIKey, testAPISecret, "http://localhost:7880", nil)
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		want           int
+	}{
+		// A forged X-Forwarded-For doesn't hide the address of the banned guest
+		{"banned guest, untrusted header", nil, "203.0.113.9:1234", "198.51.100.1", http.StatusForbidden},
+		{"other guest, untrusted header", nil, "198.51.100.1:1234", "203.0.113.9", http.StatusOK},
+		// Behind a trusted proxy the forwarded address is the guest's
+		{"banned guest behind a proxy", []string{"192.0.2.0/24"}, "192.0.2.1:1234", "203.0.113.9", http.StatusForbidden},
+		{"other guest behind a proxy", []string{"192.0.2.0/24"}, "192.0.2.1:1234", "198.51.100.1", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			if err := router.SetTrustedProxies(test.trustedProxies); err != nil {
+				t.Fatalf("SetTrustedProxies: %v", err)
+			}
+			router.POST("/api/public/rooms/:roomName/join", handler.JoinRoom)
+
+			request := httptest.NewRequest(http.MethodPost, "/api/public/rooms/"+room.Name+"/join", bytes.NewBufferString(`{"name": "Guest"}`))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("X-Forwarded-For", test.forwardedFor)
+			request.RemoteAddr = test.remoteAddr
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.want {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.want, recorder.Body.String())
+			}
+		})
+	}
+}
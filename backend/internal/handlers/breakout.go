@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// BreakoutHandler opens, fills and closes the breakout rooms of a room
+type BreakoutHandler struct {
+	roomService     *services.RoomService
+	memberService   *services.RoomMemberService
+	policyService   *services.RoomPolicyService
+	banService      *services.BanService
+	breakoutService *services.BreakoutService
+	tokenIssuer     *services.TokenIssuer
+}
+
+func NewBreakoutHandler(apiKey, apiSecret, serverURL string) *BreakoutHandler {
+	roomClient := lksdk.NewRoomServiceClient(serverURL, apiKey, apiSecret)
+	tokenIssuer := services.NewTokenIssuer(apiKey, apiSecret, serverURL)
+
+	return &BreakoutHandler{
+		roomService:     services.NewRoomService(),
+		memberService:   services.NewRoomMemberService(),
+		policyService:   services.NewRoomPolicyService(),
+		banService:      services.NewBanService(),
+		breakoutService: services.NewBreakoutService(services.NewModerationService(database.GetDatabase(), roomClient, tokenIssuer)),
+		tokenIssuer:     tokenIssuer,
+	}
+}
+
+// OpenBreakouts creates breakout rooms and sends the participants of the room
+// to them (owner, moderator or admin)
+func (bh *BreakoutHandler) OpenBreakouts(c *gin.Context) {
+	room, err := bh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request models.OpenBreakoutsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	breakouts, err := bh.breakoutService.OpenBreakouts(c.Request.Context(), room, c.GetString("user_id"), request)
+	if err != nil {
+		respondBreakoutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"breakouts": breakouts,
+		"count":     len(breakouts),
+	})
+}
+
+// ListBreakouts returns the open breakout rooms of a room with who is
+// assigned to and present in each of them (owner, moderator or admin)
+func (bh *BreakoutHandler) ListBreakouts(c *gin.Context) {
+	room, err := bh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	breakouts, err := bh.breakoutService.ListBreakouts(room)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"breakouts": breakouts,
+		"count":     len(breakouts),
+	})
+}
+
+// AssignBreakouts moves participants between the room and its breakout
+// rooms (owner, moderator or admin)
+func (bh *BreakoutHandler) AssignBreakouts(c *gin.Context) {
+	room, err := bh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request models.BreakoutAssignmentsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	breakouts, err := bh.breakoutService.Assign(c.Request.Context(), room, c.GetString("user_id"), request)
+	if err != nil {
+		respondBreakoutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"breakouts": breakouts,
+		"count":     len(breakouts),
+	})
+}
+
+// CloseBreakouts closes the breakout rooms and sends everyone back to the
+// room (owner, moderator or admin)
+func (bh *BreakoutHandler) CloseBreakouts(c *gin.Context) {
+	room, err := bh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bh.breakoutService.CloseBreakouts(c.Request.Context(), room, c.GetString("user_id")); err != nil {
+		respondBreakoutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Breakout rooms closed"})
+}
+
+// BreakoutToken issues a token for the breakout room the current user is
+// assigned to, e.g. to rejoin it after losing the connection
+func (bh *BreakoutHandler) BreakoutToken(c *gin.Context) {
+	room, err := bh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The request body is optional
+	var request models.RoomTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	breakout, err := bh.breakoutService.GetAssignment(room, c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrNoBreakouts) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "You are not assigned to a breakout room"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenRequest, err := userTokenRequest(c, bh.memberService, breakout, request.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tokenRequest.Hidden = request.Hidden
+
+	if !checkBan(c, bh.banService, breakout, tokenRequest) {
+		return
+	}
+
+	policy, err := bh.policyService.GetPolicy(breakout.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := bh.tokenIssuer.IssueToken(breakout, policy, tokenRequest)
+	if err != nil {
+		if errors.Is(err, services.ErrRoomExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":           token.Token,
+		"server_url":      bh.tokenIssuer.ServerURL(),
+		"room_name":       breakout.Name,
+		"breakout_number": breakout.BreakoutNumber,
+		"identity":        token.Identity,
+		"name":            token.Name,
+		"expires_at":      token.ExpiresAt,
+	})
+}
+
+// StartBreakoutTimerRoutine closes breakout rooms when their time is up and
+// sends their participants back to the main room
+func (bh *BreakoutHandler) StartBreakoutTimerRoutine(interval time.Duration) {
+	bh.breakoutService.StartTimerRoutine(interval)
+}
+
+// checkBreakout keeps everyone except hosts out of breakout rooms they aren't
+// assigned to, writing the error response when it returns false
+func checkBreakout(c *gin.Context, roomService *services.RoomService, room *models.Room, tokenRequest services.TokenRequest) bool {
+	if room.ParentID == nil || tokenRequest.IsModerator() {
+		return true
+	}
+
+	assigned, err := roomService.HasBreakoutAssignment(room.ID, tokenRequest.Identity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !assigned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Breakout rooms are joined through their main room"})
+		return false
+	}
+
+	return true
+}
+
+// respondBreakoutError responds to an error of the breakout service
+func respondBreakoutError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidBreakout):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNoBreakouts), errors.Is(err, services.ErrParticipantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBreakoutsOpen):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
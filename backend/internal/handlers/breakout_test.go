@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBreakoutRoomTokenRequiresAssignment(t *testing.T) {
+	db, room := newTokenTest(t)
+
+	// abc-defg-hij becomes a breakout room of another room, with alice assigned to it
+	parent := models.CreateAuthenticatedRoom("klm-nopq-rst", "owner")
+	if err := db.Create(parent).Error; err != nil {
+		t.Fatalf("failed to create main room: %v", err)
+	}
+	db.Model(room).Updates(map[string]interface{}{"parent_id": parent.ID, "breakout_number": 1, "lobby_enabled": false})
+	db.Create(&models.BreakoutAssignment{ParentID: parent.ID, RoomID: room.ID, Identity: "alice", Name: "Alice"})
+
+	handler := NewRoomHandler(testAPIKey, testAPISecret, "http://localhost:7880", nil)
+
+	tests := []struct {
+		name        string
+		userID      string
+		permissions permissions.Set
+		want        int
+	}{
+		{"assigned participant", "alice", permissions.Set{}, http.StatusOK},
+		{"participant of another breakout room", "bob", permissions.Set{}, http.StatusForbidden},
+		{"guest", "", nil, http.StatusForbidden},
+		// Hosts visit every breakout room
+		{"owner", "owner", permissions.Set{}, http.StatusOK},
+		{"moderator", "moderator", permissions.Set{permissions.Moderate: true}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := requestToken(t, "/api/rooms/:roomName/token", handler.GenerateToken, test.userID, test.permissions, gin.H{"name": "Someone"})
+			if status != test.want {
+				t.Errorf("status = %d, want %d: %v", status, test.want, response)
+			}
+			if status == http.StatusForbidden && response["error"] != "Breakout rooms are joined through their main room" {
+				t.Errorf("refused with %v, want the breakout assignment check", response)
+			}
+		})
+	}
+}
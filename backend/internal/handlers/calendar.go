@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const calendarContentType = "text/calendar; charset=utf-8"
+
+type CalendarHandler struct {
+	calendarService *services.CalendarService
+}
+
+func NewCalendarHandler() *CalendarHandler {
+	return &CalendarHandler{
+		calendarService: services.NewCalendarService(),
+	}
+}
+
+// CreateFeed creates the current user's calendar subscription URL. An
+// existing URL stops working.
+func (ch *CalendarHandler) CreateFeed(c *gin.Context) {
+	token, err := ch.calendarService.CreateFeedToken(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token": token,
+		"path":  "/calendar/" + token + "/feed.ics",
+	})
+}
+
+// RevokeFeed disables the current user's calendar subscription URL
+func (ch *CalendarHandler) RevokeFeed(c *gin.Context) {
+	if err := ch.calendarService.RevokeFeedToken(c.GetString("user_id")); err != nil {
+		if errors.Is(err, services.ErrCalendarFeedNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed revoked successfully"})
+}
+
+// Feed serves the calendar of the user a secret feed token belongs to
+func (ch *CalendarHandler) Feed(c *gin.Context) {
+	userID, err := ch.calendarService.FeedUser(c.Param("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrCalendarFeedNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	feed, err := ch.calendarService.UserFeed(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, calendarContentType, []byte(feed.String()))
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"meet-backend/internal/middleware"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ChatHandler serves the chat history of rooms
+type ChatHandler struct {
+	roomService   *services.RoomService
+	memberService *services.RoomMemberService
+	policyService *services.RoomPolicyService
+	chatService   *services.ChatService
+}
+
+func NewChatHandler() *ChatHandler {
+	return &ChatHandler{
+		roomService:   services.NewRoomService(),
+		memberService: services.NewRoomMemberService(),
+		policyService: services.NewRoomPolicyService(),
+		chatService:   services.NewChatService(),
+	}
+}
+
+// SendMessage posts a message to the chat of a room. Only participants in
+// the call and hosts can post, and only hosts when the room policy turns the
+// chat off.
+func (ch *ChatHandler) SendMessage(c *gin.Context) {
+	room, err := ch.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request models.SendChatMessageRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	host, err := ch.isHost(c, room)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !host {
+		present, err := ch.chatService.IsPresent(room.ID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !present {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only participants in the call can chat"})
+			return
+		}
+
+		policy, err := ch.policyService.GetPolicy(room.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if policy.ChatEnabled != nil && !*policy.ChatEnabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Chat is disabled in this room"})
+			return
+		}
+	}
+
+	sender := services.ChatSender{
+		Identity: userID,
+		Name:     c.GetString("user_name"),
+		UserID:   &userID,
+	}
+	message, err := ch.chatService.Send(room, sender, request)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, message)
+}
+
+// ListMessages returns a page of the chat of a room, also after the
+// meeting. Without a cursor it returns the latest messages; ?before= pages
+// back and ?after= forward, with ?limit (default 50, at most 200).
+func (ch *ChatHandler) ListMessages(c *gin.Context) {
+	room, ok := ch.loadReadableRoom(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = parsed
+	}
+
+	before, after := c.Query("before"), c.Query("after")
+	if before != "" && after != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use either before or after"})
+		return
+	}
+	cursor := before
+	if after != "" {
+		cursor = after
+	}
+
+	page, err := ch.chatService.ListMessages(room.ID, cursor, after != "", limit)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// EditMessage changes a message of the current user
+func (ch *ChatHandler) EditMessage(c *gin.Context) {
+	room, message, ok := ch.loadMessage(c)
+	if !ok {
+		return
+	}
+
+	var request models.UpdateChatMessageRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if message.SenderUserID == nil || *message.SenderUserID != c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own messages"})
+		return
+	}
+
+	message, err := ch.chatService.Edit(room, message, request.Content)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+// DeleteMessage deletes a message of the current user, or any message for
+// hosts
+func (ch *ChatHandler) DeleteMessage(c *gin.Context) {
+	room, message, ok := ch.loadMessage(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if message.SenderUserID == nil || *message.SenderUserID != userID {
+		host, err := ch.isHost(c, room)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !host {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own messages"})
+			return
+		}
+	}
+
+	if err := ch.chatService.Delete(room, message, userID); err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+// ExportMessages returns the whole chat of a room as JSON or, with
+// ?format=markdown, as a Markdown transcript
+func (ch *ChatHandler) ExportMessages(c *gin.Context) {
+	room, ok := ch.loadReadableRoom(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "markdown" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or markdown"})
+		return
+	}
+
+	messages, err := ch.chatService.Transcript(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if format == "markdown" {
+		c.Header("Content-Disposition", `attachment; filename="chat-`+room.Name+`.md"`)
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(ch.chatService.MarkdownTranscript(room, messages)))
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="chat-`+room.Name+`.json"`)
+	c.JSON(http.StatusOK, gin.H{
+		"room":        room.Name,
+		"room_id":     room.ID,
+		"exported_at": time.Now().UTC(),
+		"messages":    messages,
+		"count":       len(messages),
+	})
+}
+
+// loadReadableRoom loads the room of the request, active or not, when the
+// current user may read its chat. It responds itself when it returns false.
+func (ch *ChatHandler) loadReadableRoom(c *gin.Context) (*models.Room, bool) {
+	room, err := ch.roomService.FindRoom(c.Param("roomName"))
+	if err != nil {
+		if errors.Is(err, services.ErrRoomNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if !middleware.HasPermission(c, permissions.Moderate) {
+		allowed, err := ch.chatService.CanRead(room.ID, c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only members and participants of the room can read its chat"})
+			return nil, false
+		}
+	}
+
+	return room, true
+}
+
+// loadMessage loads the message of the request in an active room. It
+// responds itself when it returns false.
+func (ch *ChatHandler) loadMessage(c *gin.Context) (*models.Room, *models.ChatMessage, bool) {
+	room, err := ch.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return nil, nil, false
+	}
+
+	message, err := ch.chatService.GetMessage(room.ID, id)
+	if err != nil {
+		respondChatError(c, err)
+		return nil, nil, false
+	}
+
+	return room, message, true
+}
+
+// isHost checks if the current user manages the room
+func (ch *ChatHandler) isHost(c *gin.Context, room *models.Room) (bool, error) {
+	if middleware.HasPermission(c, permissions.Moderate) {
+		return true, nil
+	}
+
+	member, err := ch.memberService.GetMember(room.ID, c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrRoomMemberNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return member.CanManageRoom(), nil
+}
+
+// respondChatError responds to an error of the chat service
+func respondChatError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidChatMessage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrChatMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
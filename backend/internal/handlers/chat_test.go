@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newChatTest returns a chat handler with one room in which alice and bob
+// are in the call and carol is a moderator of the room
+func newChatTest(t *testing.T) (*ChatHandler, *gorm.DB, *models.Room) {
+	t.Helper()
+
+	db := testdb.Open(t,
+		&models.Room{},
+		&models.RoomParticipant{},
+		&models.RoomMember{},
+		&models.RoomPolicy{},
+		&models.ChatMessage{},
+	)
+	database.DB = db
+
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	if err := db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	db.Create(&models.RoomMember{RoomID: room.ID, UserID: "owner", Role: models.RoomRoleOwner})
+	db.Create(&models.RoomMember{RoomID: room.ID, UserID: "carol", Role: models.RoomRoleModerator})
+	for _, userID := range []string{"alice", "bob"} {
+		userID := userID
+		db.Create(&models.RoomParticipant{RoomID: room.ID, UserID: &userID, Identity: userID, Name: userID, JoinedAt: time.Now()})
+	}
+
+	return NewChatHandler(), db, room
+}
+
+// serveChat calls a chat endpoint as a user and returns the response
+func serveChat(t *testing.T, method, route, target string, handler gin.HandlerFunc, userID string, set permissions.Set, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, route, func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("user_name", userID)
+		c.Set("user_permissions", set)
+	}, handler)
+
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(method, target, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// sendChat posts a message as a user and returns the status and message ID
+func sendChat(t *testing.T, handler *ChatHandler, userID string, set permissions.Set) (int, string) {
+	t.Helper()
+
+	recorder := serveChat(t, http.MethodPost, "/rooms/:roomName/messages", "/rooms/abc-defg-hij/messages", handler.SendMessage, userID, set, gin.H{"content": "Hello from " + userID})
+	var message models.ChatMessage
+	json.Unmarshal(recorder.Body.Bytes(), &message)
+	return recorder.Code, message.ID.String()
+}
+
+func TestChatSendRequiresPresence(t *testing.T) {
+	handler, db, room := newChatTest(t)
+
+	tests := []struct {
+		name        string
+		userID      string
+		permissions permissions.Set
+		want        int
+	}{
+		{"participant in the call", "alice", permissions.Set{}, http.StatusCreated},
+		{"someone not in the call", "dave", permissions.Set{}, http.StatusForbidden},
+		// Hosts chat without joining the call
+		{"owner", "owner", permissions.Set{}, http.StatusCreated},
+		{"room moderator", "carol", permissions.Set{}, http.StatusCreated},
+		{"global moderator", "moderator", permissions.Set{permissions.Moderate: true}, http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status, _ := sendChat(t, handler, test.userID, test.permissions); status != test.want {
+				t.Errorf("status = %d, want %d", status, test.want)
+			}
+		})
+	}
+
+	// With the chat turned off only hosts post
+	off := false
+	db.Create(&models.RoomPolicy{RoomID: room.ID, ChatEnabled: &off})
+	if status, _ := sendChat(t, handler, "alice", permissions.Set{}); status != http.StatusForbidden {
+		t.Errorf("participant with the chat off: status = %d, want %d", status, http.StatusForbidden)
+	}
+	if status, _ := sendChat(t, handler, "carol", permissions.Set{}); status != http.StatusCreated {
+		t.Errorf("room moderator with the chat off: status = %d, want %d", status, http.StatusCreated)
+	}
+}
+
+func TestChatEditAndDeleteOwnership(t *testing.T) {
+	handler, _, _ := newChatTest(t)
+
+	edit := func(id, userID string) int {
+		return serveChat(t, http.MethodPut, "/rooms/:roomName/messages/:messageId", "/rooms/abc-defg-hij/messages/"+id, handler.EditMessage, userID, permissions.Set{}, gin.H{"content": "Edited"}).Code
+	}
+	remove := func(id, userID string, set permissions.Set) int {
+		return serveChat(t, http.MethodDelete, "/rooms/:roomName/messages/:messageId", "/rooms/abc-defg-hij/messages/"+id, handler.DeleteMessage, userID, set, nil).Code
+	}
+
+	_, id := sendChat(t, handler, "alice", permissions.Set{})
+
+	// Only the sender edits a message, hosts included
+	if status := edit(id, "bob"); status != http.StatusForbidden {
+		t.Errorf("edit by another participant: status = %d, want %d", status, http.StatusForbidden)
+	}
+	if status := edit(id, "carol"); status != http.StatusForbidden {
+		t.Errorf("edit by a room moderator: status = %d, want %d", status, http.StatusForbidden)
+	}
+	if status := edit(id, "alice"); status != http.StatusOK {
+		t.Errorf("edit by the sender: status = %d, want %d", status, http.StatusOK)
+	}
+
+	// Hosts delete any message, others only their own
+	if status := remove(id, "bob", permissions.Set{}); status != http.StatusForbidden {
+		t.Errorf("delete by another participant: status = %d, want %d", status, http.StatusForbidden)
+	}
+	if status := remove(id, "carol", permissions.Set{}); status != http.StatusOK {
+		t.Errorf("delete by a room moderator: status = %d, want %d", status, http.StatusOK)
+	}
+
+	_, id = sendChat(t, handler, "bob", permissions.Set{})
+	if status := remove(id, "moderator", permissions.Set{permissions.Moderate: true}); status != http.StatusOK {
+		t.Errorf("delete by a global moderator: status = %d, want %d", status, http.StatusOK)
+	}
+	_, id = sendChat(t, handler, "bob", permissions.Set{})
+	if status := remove(id, "bob", permissions.Set{}); status != http.StatusOK {
+		t.Errorf("delete by the sender: status = %d, want %d", status, http.StatusOK)
+	}
+
+	if status := edit("not-a-uuid", "alice"); status != http.StatusBadRequest {
+		t.Errorf("edit of an invalid ID: status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestChatExport(t *testing.T) {
+	handler, db, room := newChatTest(t)
+	sendChat(t, handler, "alice", permissions.Set{})
+	sendChat(t, handler, "bob", permissions.Set{})
+
+	// Participants keep reading the chat after the meeting
+	db.Model(room).Update("is_active", false)
+
+	export := func(userID, format string) *httptest.ResponseRecorder {
+		return serveChat(t, http.MethodGet, "/rooms/:roomName/messages/export", "/rooms/abc-defg-hij/messages/export?format="+format, handler.ExportMessages, userID, permissions.Set{}, nil)
+	}
+
+	recorder := export("alice", "json")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("JSON export: status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+	var response struct {
+		Room     string               `json:"room"`
+		Count    int                  `json:"count"`
+		Messages []models.ChatMessage `json:"messages"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.Room != room.Name || response.Count != 2 || len(response.Messages) != 2 || response.Messages[0].SenderIdentity != "alice" {
+		t.Errorf("JSON export %+v, want both messages oldest first", response)
+	}
+	if disposition := recorder.Header().Get("Content-Disposition"); !strings.Contains(disposition, "chat-abc-defg-hij.json") {
+		t.Errorf("Content-Disposition = %q, want a JSON attachment", disposition)
+	}
+
+	recorder = export("owner", "markdown")
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/markdown") {
+		t.Fatalf("Markdown export: status = %d, type %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "> Hello from alice") || !strings.Contains(body, "> Hello from bob") {
+		t.Errorf("Markdown export lacks the messages:\n%s", body)
+	}
+
+	if recorder := export("dave", "json"); recorder.Code != http.StatusForbidden {
+		t.Errorf("export by an outsider: status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+	if recorder := export("alice", "pdf"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("export as pdf: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateInvite creates a shareable invite link for a room (owner or admin)
+func (rmh *RoomManagementHandler) CreateInvite(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		Role             string `json:"role"`                                         // member (default) or moderator
+		ExpiresInMinutes int    `json:"expires_in_minutes" binding:"omitempty,min=1"` // default 7 days
+		MaxUses          int    `json:"max_uses" binding:"omitempty,min=0"`           // 0 for unlimited
+	}
+
+	// The request body is optional
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch request.Role {
+	case "":
+		request.Role = models.RoomRoleMember
+	case models.RoomRoleMember, models.RoomRoleModerator:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be member or moderator"})
+		return
+	}
+
+	lifetime := 7 * 24 * time.Hour
+	if request.ExpiresInMinutes > 0 {
+		lifetime = time.Duration(request.ExpiresInMinutes) * time.Minute
+	}
+	if lifetime > services.MaxInviteLifetime {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invites can be valid for at most 30 days"})
+		return
+	}
+
+	// An invite never outlives the room
+	expiresAt := time.Now().Add(lifetime)
+	if room.ExpiresAt != nil && room.ExpiresAt.Before(expiresAt) {
+		expiresAt = *room.ExpiresAt
+	}
+
+	invite, token, err := rmh.inviteService.CreateInvite(room, request.Role, c.GetString("user_id"), expiresAt, request.MaxUses)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invite": invite,
+		"token":  token,
+	})
+}
+
+// ListInvites returns the invites of a room (owner or admin)
+func (rmh *RoomManagementHandler) ListInvites(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	invites, err := rmh.inviteService.ListInvites(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_name": room.Name,
+		"invites":   invites,
+		"count":     len(invites),
+	})
+}
+
+// RevokeInvite revokes an invite of a room (owner or admin)
+func (rmh *RoomManagementHandler) RevokeInvite(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	if err := rmh.inviteService.RevokeInvite(room.ID, id); err != nil {
+		if errors.Is(err, services.ErrInviteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
+}
+
+// RedeemInvite joins the room of an invite and returns a LiveKit token.
+// The invite stands in for the passcode and the lobby: the host already let
+// its holder in.
+func (rmh *RoomManagementHandler) RedeemInvite(c *gin.Context) {
+	var request struct {
+		Name string `json:"name"` // required for guests
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invite, err := rmh.inviteService.ParseInvite(c.Param("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrInviteUnavailable) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := rmh.roomService.GetRoomByID(invite.RoomID)
+	if err != nil || !room.IsActive || room.IsExpired() {
+		c.JSON(http.StatusGone, gin.H{"error": "The room of this invite is no longer active"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	// A moderator invite makes its holder a room admin, which a guest can't
+	// be held accountable for
+	if userID == "" && invite.Role != models.RoomRoleMember {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in to redeem a moderator invite"})
+		return
+	}
+	if userID == "" && request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	// Checked before redeeming so a banned guest doesn't use up the invite
+	subject := services.TokenRequest{Identity: userID}
+	if userID != "" {
+		subject.UserID = &userID
+	}
+	if !checkBan(c, rmh.banService, room, subject) {
+		return
+	}
+	subject.RoomRole = invite.Role
+	if !checkBreakout(c, rmh.roomService, room, subject) {
+		return
+	}
+
+	if err := rmh.inviteService.Redeem(invite); err != nil {
+		if errors.Is(err, services.ErrInviteUnavailable) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tokenRequest services.TokenRequest
+	if userID == "" {
+		identity, err := services.NewGuestIdentity()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate identity"})
+			return
+		}
+		tokenRequest = services.TokenRequest{Identity: identity, Name: request.Name, RoomRole: models.RoomRoleMember}
+	} else {
+		// Signed-in users keep the role the invite gave them
+		if invite.Role == models.RoomRoleModerator {
+			_, err := rmh.memberService.GrantModerator(room.ID, userID, invite.CreatedBy)
+			if err != nil && !errors.Is(err, services.ErrOwnerRoleImmutable) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		tokenRequest, err = userTokenRequest(c, rmh.memberService, room, request.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	policy, err := rmh.policyService.GetPolicy(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, status, err := rmh.admitParticipant(c, room, policy, tokenRequest)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	response["room_name"] = room.Name
+	response["role"] = invite.Role
+	c.JSON(http.StatusOK, response)
+}
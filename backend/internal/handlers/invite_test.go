@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newInviteTest returns a handler for a room that the owner can create invites for
+func newInviteTest(t *testing.T) (*gorm.DB, *models.Room, *RoomManagementHandler) {
+	t.Helper()
+
+	db, room := newTokenTest(t)
+	return db, room, NewRoomManagementHandler(testAPIKey, testAPISecret, "http://localhost:7880", nil)
+}
+
+// serveInvite calls an invite endpoint as a user, or as a guest without a
+// user ID, and returns the status and decoded body
+func serveInvite(t *testing.T, method, route, target string, handler gin.HandlerFunc, userID string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, route, func(c *gin.Context) {
+		if userID != "" {
+			c.Set("user_id", userID)
+			c.Set("user_name", userID)
+			c.Set("user_permissions", permissions.Set{})
+		}
+	}, handler)
+
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(method, target, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	var response map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+// createInvite creates an invite as the room owner and returns its ID and token
+func createInvite(t *testing.T, handler *RoomManagementHandler, body gin.H) (string, string) {
+	t.Helper()
+
+	status, response := serveInvite(t, http.MethodPost, "/rooms/:roomName/invites", "/rooms/abc-defg-hij/invites", handler.CreateInvite, "owner", body)
+	if status != http.StatusCreated {
+		t.Fatalf("CreateInvite: status = %d, want %d: %v", status, http.StatusCreated, response)
+	}
+	invite, _ := response["invite"].(map[string]interface{})
+	id, _ := invite["id"].(string)
+	token, _ := response["token"].(string)
+	if id == "" || token == "" {
+		t.Fatalf("CreateInvite: response %v, want an invite and a token", response)
+	}
+	return id, token
+}
+
+func redeem(t *testing.T, handler *RoomManagementHandler, token, userID string) (int, map[string]interface{}) {
+	t.Helper()
+	return serveInvite(t, http.MethodPost, "/invites/:token/redeem", "/invites/"+token+"/redeem", handler.RedeemInvite, userID, gin.H{"name": "Guest"})
+}
+
+func TestCreateInviteValidatesRole(t *testing.T) {
+	_, _, handler := newInviteTest(t)
+
+	status, response := serveInvite(t, http.MethodPost, "/rooms/:roomName/invites", "/rooms/abc-defg-hij/invites", handler.CreateInvite, "owner", gin.H{"role": models.RoomRoleOwner})
+	if status != http.StatusBadRequest {
+		t.Errorf("owner invite: status = %d, want %d: %v", status, http.StatusBadRequest, response)
+	}
+
+	status, response = serveInvite(t, http.MethodPost, "/rooms/:roomName/invites", "/rooms/abc-defg-hij/invites", handler.CreateInvite, "owner", gin.H{"expires_in_minutes": 31 * 24 * 60})
+	if status != http.StatusBadRequest {
+		t.Errorf("invite valid for 31 days: status = %d, want %d: %v", status, http.StatusBadRequest, response)
+	}
+}
+
+func TestRedeemInvite(t *testing.T) {
+	db, room, handler := newInviteTest(t)
+	_, token := createInvite(t, handler, gin.H{"max_uses": 2})
+
+	// The invite stands in for the lobby
+	status, response := redeem(t, handler, token, "")
+	if status != http.StatusOK || response["token"] == nil || response["is_guest"] != true {
+		t.Fatalf("guest: status = %d, want %d with a token: %v", status, http.StatusOK, response)
+	}
+	if response["role"] != models.RoomRoleMember {
+		t.Errorf("guest role = %v, want %s", response["role"], models.RoomRoleMember)
+	}
+
+	status, response = redeem(t, handler, token, "alice")
+	if status != http.StatusOK {
+		t.Fatalf("signed-in user: status = %d, want %d: %v", status, http.StatusOK, response)
+	}
+	var member models.RoomMember
+	if err := db.Where("room_id = ? AND user_id = ?", room.ID, "alice").First(&member).Error; err != nil || member.Role != models.RoomRoleMember {
+		t.Errorf("alice is %q (%v), want a member of the room", member.Role, err)
+	}
+
+	// The third use is beyond max_uses
+	if status, response := redeem(t, handler, token, "bob"); status != http.StatusGone {
+		t.Errorf("used up invite: status = %d, want %d: %v", status, http.StatusGone, response)
+	}
+
+	if status, response := redeem(t, handler, "not-a-token", ""); status != http.StatusNotFound {
+		t.Errorf("unknown token: status = %d, want %d: %v", status, http.StatusNotFound, response)
+	}
+}
+
+func TestRedeemModeratorInviteRequiresSignIn(t *testing.T) {
+	db, room, handler := newInviteTest(t)
+	id, token := createInvite(t, handler, gin.H{"role": models.RoomRoleModerator, "max_uses": 1})
+
+	status, response := redeem(t, handler, token, "")
+	if status != http.StatusUnauthorized {
+		t.Fatalf("guest: status = %d, want %d: %v", status, http.StatusUnauthorized, response)
+	}
+	var invite models.Invite
+	if db.Where("id = ?", id).First(&invite); invite.Uses != 0 {
+		t.Errorf("refused guest used up the invite: %d uses", invite.Uses)
+	}
+
+	status, response = redeem(t, handler, token, "alice")
+	if status != http.StatusOK || response["role"] != models.RoomRoleModerator {
+		t.Fatalf("signed-in user: status = %d, want %d as moderator: %v", status, http.StatusOK, response)
+	}
+	var member models.RoomMember
+	if err := db.Where("room_id = ? AND user_id = ?", room.ID, "alice").First(&member).Error; err != nil || member.Role != models.RoomRoleModerator {
+		t.Errorf("alice is %q (%v), want a moderator of the room", member.Role, err)
+	}
+}
+
+func TestRevokeInviteHandler(t *testing.T) {
+	_, _, handler := newInviteTest(t)
+	id, token := createInvite(t, handler, nil)
+
+	route := "/rooms/:roomName/invites/:id"
+	target := "/rooms/abc-defg-hij/invites/" + id
+	if status, response := serveInvite(t, http.MethodDelete, route, target, handler.RevokeInvite, "owner", nil); status != http.StatusOK {
+		t.Fatalf("RevokeInvite: status = %d, want %d: %v", status, http.StatusOK, response)
+	}
+	if status, response := serveInvite(t, http.MethodDelete, route, target, handler.RevokeInvite, "owner", nil); status != http.StatusNotFound {
+		t.Errorf("revoking twice: status = %d, want %d: %v", status, http.StatusNotFound, response)
+	}
+
+	if status, response := redeem(t, handler, token, ""); status != http.StatusGone {
+		t.Errorf("revoked invite: status = %d, want %d: %v", status, http.StatusGone, response)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLobbyWait is the longest a lobby status request is held open
+const maxLobbyWait = 30 * time.Second
+
+// LobbyStatus tells someone in the lobby whether they were admitted. With
+// ?wait=N the request is held open up to N seconds until a host decides.
+// Admitted participants receive their LiveKit token in the response, once;
+// later requests get 410 Gone.
+func (rmh *RoomManagementHandler) LobbyStatus(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := c.GetHeader("X-Lobby-Token")
+	if secret == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "X-Lobby-Token header required"})
+		return
+	}
+
+	wait := time.Duration(0)
+	if value := c.Query("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wait"})
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > maxLobbyWait {
+			wait = maxLobbyWait
+		}
+	}
+
+	entry, err := rmh.lobbyService.WaitForDecision(c.Request.Context(), room.ID, c.Param("identity"), secret, wait)
+	if err != nil {
+		if errors.Is(err, services.ErrLobbyEntryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch entry.Status {
+	case models.LobbyStatusPending:
+		c.JSON(http.StatusOK, gin.H{"status": entry.Status})
+		return
+	case models.LobbyStatusDenied:
+		c.JSON(http.StatusForbidden, gin.H{"status": entry.Status, "error": "Entry to the room was denied"})
+		return
+	}
+
+	if entry.ClaimedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"status": entry.Status, "error": services.ErrLobbyEntryClaimed.Error()})
+		return
+	}
+
+	// Admitted: signed-in users have to collect their token as themselves
+	tokenRequest := services.TokenRequest{Identity: entry.Identity, Name: entry.Name}
+	if entry.UserID != nil {
+		if c.GetString("user_id") != *entry.UserID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Sign in as the user who entered the lobby"})
+			return
+		}
+
+		tokenRequest, err = userTokenRequest(c, rmh.memberService, room, entry.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// A ban made while waiting still applies
+	if !checkBan(c, rmh.banService, room, tokenRequest) {
+		return
+	}
+
+	policy, err := rmh.policyService.GetPolicy(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Concurrent polls race for the one token
+	if err := rmh.lobbyService.ClaimAdmission(entry.ID); err != nil {
+		if errors.Is(err, services.ErrLobbyEntryClaimed) {
+			c.JSON(http.StatusGone, gin.H{"status": entry.Status, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, status, err := rmh.admitParticipant(c, room, policy, tokenRequest)
+	if err != nil {
+		if releaseErr := rmh.lobbyService.ReleaseAdmission(entry.ID); releaseErr != nil {
+			log.Printf("Failed to release lobby admission of %s: %v", entry.Identity, releaseErr)
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	response["status"] = entry.Status
+	c.JSON(http.StatusOK, response)
+}
+
+// checkLobby places everyone except the hosts in the lobby of a room that
+// has it enabled, answering with 202 Accepted and the secret to poll
+// LobbyStatus with. It returns true when the request may get a token.
+func checkLobby(c *gin.Context, lobbyService *services.LobbyService, room *models.Room, tokenRequest services.TokenRequest) bool {
+	if !room.LobbyEnabled || tokenRequest.IsModerator() {
+		return true
+	}
+
+	// Guests are recognised by IP address, their identity is new on every join
+	ipAddress := ""
+	if tokenRequest.UserID == nil {
+		ipAddress = c.ClientIP()
+	}
+	entry, secret, err := lobbyService.Enqueue(room.ID, tokenRequest.Identity, tokenRequest.Name, tokenRequest.UserID, ipAddress)
+	if err != nil {
+		if errors.Is(err, services.ErrLobbyEntryDenied) {
+			c.Header("Retry-After", strconv.Itoa(int(services.LobbyDenyCooldown.Seconds())))
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":      entry.Status,
+		"room_id":     room.ID,
+		"identity":    entry.Identity,
+		"name":        entry.Name,
+		"lobby_token": secret,
+	})
+	return false
+}
+
+// ListLobby returns the people waiting in the lobby (owner, moderator or admin)
+func (rmh *RoomManagementHandler) ListLobby(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := rmh.lobbyService.ListPending(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_id":       room.ID,
+		"room_name":     room.Name,
+		"lobby_enabled": room.LobbyEnabled,
+		"waiting":       entries,
+		"count":         len(entries),
+	})
+}
+
+// AdmitFromLobby lets someone from the lobby into the room (owner, moderator or admin)
+func (rmh *RoomManagementHandler) AdmitFromLobby(c *gin.Context) {
+	rmh.decideLobbyEntry(c, models.LobbyStatusAdmitted)
+}
+
+// DenyFromLobby refuses someone in the lobby (owner, moderator or admin)
+func (rmh *RoomManagementHandler) DenyFromLobby(c *gin.Context) {
+	rmh.decideLobbyEntry(c, models.LobbyStatusDenied)
+}
+
+// UpdateLobby turns the lobby of a room on or off (owner, moderator or admin)
+func (rmh *RoomManagementHandler) UpdateLobby(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rmh.lobbyService.SetLobbyEnabled(room.ID, *request.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_name": room.Name, "lobby_enabled": *request.Enabled})
+}
+
+// decideLobbyEntry admits or denies the lobby entry from the :identity parameter
+func (rmh *RoomManagementHandler) decideLobbyEntry(c *gin.Context, status string) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity := c.Param("identity")
+	if err := rmh.lobbyService.Decide(room.ID, identity, status, c.GetString("user_id")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrLobbyEntryNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrLobbyEntryDecided):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identity": identity, "status": status})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newTokenTest returns an empty database for the token endpoints with one
+// room that has the lobby enabled
+func newTokenTest(t *testing.T) (*gorm.DB, *models.Room) {
+	t.Helper()
+
+	db := testdb.Open(t,
+		&models.Room{},
+		&models.RoomParticipant{},
+		&models.RoomMember{},
+		&models.RoomPolicy{},
+		&models.LobbyEntry{},
+		&models.Ban{},
+		&models.PasscodeAttempt{},
+		&models.BreakoutAssignment{},
+		&models.Invite{},
+		&models.Meeting{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+	)
+	database.DB = db
+
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	room.LobbyEnabled = true
+	if err := db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	db.Create(&models.RoomMember{RoomID: room.ID, UserID: "owner", Role: models.RoomRoleOwner})
+
+	return db, room
+}
+
+// requestToken calls a token endpoint as a user, or as a guest without a user
+// ID, and returns the status and decoded body
+func requestToken(t *testing.T, path string, handler gin.HandlerFunc, userID string, set permissions.Set, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST(path, func(c *gin.Context) {
+		if userID != "" {
+			c.Set("user_id", userID)
+			c.Set("user_name", userID)
+			c.Set("user_permissions", set)
+		}
+	}, handler)
+
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(http.MethodPost, strings.Replace(path, ":roomName", "abc-defg-hij", 1), bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	var response map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+func TestGenerateTokenWaitsInLobby(t *testing.T) {
+	db, room := newTokenTest(t)
+	handler := NewRoomHandler(testAPIKey, testAPISecret, "http://localhost:7880", nil)
+
+	tests := []struct {
+		name        string
+		userID      string
+		permissions permissions.Set
+		want        int
+	}{
+		{"signed-in user", "someone", permissions.Set{}, http.StatusAccepted},
+		{"owner", "owner", permissions.Set{}, http.StatusOK},
+		{"moderator", "moderator", permissions.Set{permissions.Moderate: true}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := requestToken(t, "/api/rooms/:roomName/token", handler.GenerateToken, test.userID, test.permissions, gin.H{})
+			if status != test.want {
+				t.Fatalf("status = %d, want %d: %v", status, test.want, response)
+			}
+
+			_, hasToken := response["token"]
+			if hasToken != (test.want == http.StatusOK) {
+				t.Errorf("token in response = %v, want %v", hasToken, test.want == http.StatusOK)
+			}
+			if test.want == http.StatusAccepted && (response["status"] != models.LobbyStatusPending || response["lobby_token"] == "") {
+				t.Errorf("response %v, want a pending lobby entry", response)
+			}
+		})
+	}
+
+	var entries []models.LobbyEntry
+	db.Find(&entries)
+	if len(entries) != 1 || entries[0].RoomID != room.ID || entries[0].Identity != "someone" {
+		t.Errorf("lobby %+v, want only the signed-in user waiting", entries)
+	}
+}
+
+func TestJoinRoomWaitsInLobby(t *testing.T) {
+	db, _ := newTokenTest(t)
+	handler := NewRoomManagementHandler(testAPIKey, testAPISecret, "http://localhost:7880", nil)
+
+	status, response := requestToken(t, "/api/rooms/:roomName/join", handler.JoinRoom, "", nil, gin.H{"name": "Guest"})
+	if status != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %v", status, http.StatusAccepted, response)
+	}
+	if _, hasToken := response["token"]; hasToken {
+		t.Error("guest got a token without being admitted")
+	}
+
+	var entry models.LobbyEntry
+	if err := db.First(&entry).Error; err != nil || entry.UserID != nil || entry.IPAddress == "" {
+		t.Errorf("lobby entry %+v (%v), want the guest with their IP address", entry, err)
+	}
+}
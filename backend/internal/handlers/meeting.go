@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"meet-backend/internal/middleware"
+	"meet-backend/internal/models"
+	"meet-backend/internal/notifications"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type MeetingHandler struct {
+	meetingService    *services.MeetingService
+	calendarService   *services.CalendarService
+	invitationService *services.InvitationService
+}
+
+func NewMeetingHandler(outbox *notifications.Outbox) *MeetingHandler {
+	return &MeetingHandler{
+		meetingService:    services.NewMeetingService(),
+		calendarService:   services.NewCalendarService(),
+		invitationService: services.NewInvitationService(outbox),
+	}
+}
+
+// meetingRequest holds the editable fields of a meeting; fields left out of
+// an update keep their value
+type meetingRequest struct {
+	Title            *string      `json:"title"`
+	Description      *string      `json:"description"`
+	StartsAt         *time.Time   `json:"starts_at"` // RFC 3339, start of the first occurrence
+	EndsAt           *time.Time   `json:"ends_at"`   // RFC 3339, end of the first occurrence
+	Timezone         *string      `json:"timezone"`  // IANA zone, defaults to UTC
+	Recurrence       *string      `json:"recurrence"`
+	ExcludedDates    *[]time.Time `json:"excluded_dates"` // RFC 3339, starts of skipped occurrences
+	EarlyJoinMinutes *int         `json:"early_join_minutes"`
+	Invitees         *[]string    `json:"invitees"` // email addresses, invited when added
+}
+
+// apply copies the fields that were sent onto a meeting
+func (r *meetingRequest) apply(meeting *models.Meeting) {
+	if r.Title != nil {
+		meeting.Title = *r.Title
+	}
+	if r.Description != nil {
+		meeting.Description = *r.Description
+	}
+	if r.StartsAt != nil {
+		meeting.StartsAt = *r.StartsAt
+	}
+	if r.EndsAt != nil {
+		meeting.EndsAt = *r.EndsAt
+	}
+	if r.Timezone != nil {
+		meeting.Timezone = *r.Timezone
+	}
+	if r.Recurrence != nil {
+		meeting.Recurrence = *r.Recurrence
+	}
+	if r.ExcludedDates != nil {
+		meeting.ExcludedDates = *r.ExcludedDates
+	}
+	if r.EarlyJoinMinutes != nil {
+		meeting.EarlyJoinMinutes = *r.EarlyJoinMinutes
+	}
+}
+
+// CreateMeeting schedules a meeting organized by the current user
+func (mh *MeetingHandler) CreateMeeting(c *gin.Context) {
+	var request meetingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.StartsAt == nil || request.EndsAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "starts_at and ends_at are required"})
+		return
+	}
+
+	meeting := &models.Meeting{
+		OrganizerID:      c.GetString("user_id"),
+		EarlyJoinMinutes: mh.meetingService.DefaultEarlyJoinMinutes(),
+	}
+	request.apply(meeting)
+
+	if request.Invitees != nil {
+		invitees, err := services.NormalizeInvitees(*request.Invitees)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		meeting.Invitees = invitees
+	}
+
+	if err := mh.meetingService.CreateMeeting(meeting); err != nil {
+		respondMeetingError(c, err)
+		return
+	}
+
+	mh.notifyMeeting(meeting, notifications.InvitationNew, meeting.Invitees)
+
+	c.JSON(http.StatusCreated, meetingResponse(meeting))
+}
+
+// ListMeetings returns the current user's meetings with their occurrences in
+// the next ?days days (default 14, at most 90)
+func (mh *MeetingHandler) ListMeetings(c *gin.Context) {
+	days := 14
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 90 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 90"})
+			return
+		}
+		days = parsed
+	}
+
+	until := time.Now().AddDate(0, 0, days)
+	meetings, err := mh.meetingService.ListUpcoming(c.GetString("user_id"), until)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"meetings": meetings,
+		"count":    len(meetings),
+	})
+}
+
+// GetMeeting returns a meeting and its next occurrence, or with an .ics
+// suffix the meeting as an iCalendar file (organizer or admin)
+func (mh *MeetingHandler) GetMeeting(c *gin.Context) {
+	meeting, ok := mh.loadMeeting(c)
+	if !ok {
+		return
+	}
+
+	if strings.HasSuffix(c.Param("id"), ".ics") {
+		cal, err := mh.calendarService.MeetingCalendar(meeting)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="meeting-`+meeting.ID.String()+`.ics"`)
+		c.Data(http.StatusOK, calendarContentType, []byte(cal.String()))
+		return
+	}
+
+	c.JSON(http.StatusOK, meetingResponse(meeting))
+}
+
+// UpdateMeeting changes the details or schedule of a meeting (organizer or admin)
+func (mh *MeetingHandler) UpdateMeeting(c *gin.Context) {
+	meeting, ok := mh.loadMeeting(c)
+	if !ok {
+		return
+	}
+
+	if meeting.IsCancelled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cancelled meetings cannot be changed"})
+		return
+	}
+
+	var request meetingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.apply(meeting)
+
+	// Invitees that stay get the update, new ones an invitation and removed ones a cancellation
+	previous := meeting.Invitees
+	if request.Invitees != nil {
+		invitees, err := services.NormalizeInvitees(*request.Invitees)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		meeting.Invitees = invitees
+	}
+	kept, added := splitInvitees(previous, meeting.Invitees)
+	_, removed := splitInvitees(meeting.Invitees, previous)
+
+	if err := mh.meetingService.UpdateMeeting(meeting); err != nil {
+		respondMeetingError(c, err)
+		return
+	}
+
+	mh.notifyMeeting(meeting, notifications.InvitationUpdated, kept)
+	mh.notifyMeeting(meeting, notifications.InvitationNew, added)
+	if len(removed) > 0 {
+		cancelled := *meeting
+		now := time.Now()
+		cancelled.CancelledAt = &now
+		mh.notifyMeeting(&cancelled, notifications.InvitationCancelled, removed)
+	}
+
+	c.JSON(http.StatusOK, meetingResponse(meeting))
+}
+
+// CancelMeeting cancels a meeting and closes its room (organizer or admin)
+func (mh *MeetingHandler) CancelMeeting(c *gin.Context) {
+	meeting, ok := mh.loadMeeting(c)
+	if !ok {
+		return
+	}
+
+	if !meeting.IsCancelled() {
+		if err := mh.meetingService.CancelMeeting(meeting); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		mh.notifyMeeting(meeting, notifications.InvitationCancelled, meeting.Invitees)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Meeting cancelled successfully"})
+}
+
+// notifyMeeting queues meeting emails; the change itself is already saved,
+// so failures are only logged
+func (mh *MeetingHandler) notifyMeeting(meeting *models.Meeting, kind string, emails []string) {
+	if err := mh.invitationService.NotifyMeeting(meeting, kind, emails); err != nil {
+		log.Printf("Failed to queue %s invitations for meeting %s: %v", kind, meeting.ID, err)
+	}
+}
+
+// loadMeeting loads the meeting of the request and checks that the current
+// user may manage it. It responds itself when it returns false.
+func (mh *MeetingHandler) loadMeeting(c *gin.Context) (*models.Meeting, bool) {
+	id, err := uuid.Parse(strings.TrimSuffix(c.Param("id"), ".ics"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meeting ID"})
+		return nil, false
+	}
+
+	meeting, err := mh.meetingService.GetMeeting(id.String())
+	if err != nil {
+		respondMeetingError(c, err)
+		return nil, false
+	}
+
+	if meeting.OrganizerID != c.GetString("user_id") && !middleware.HasPermission(c, permissions.Admin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the organizer can manage this meeting"})
+		return nil, false
+	}
+
+	return meeting, true
+}
+
+// splitInvitees splits the addresses in next into those already in previous and new ones
+func splitInvitees(previous, next []string) (kept, added []string) {
+	known := make(map[string]bool, len(previous))
+	for _, email := range previous {
+		known[email] = true
+	}
+	for _, email := range next {
+		if known[email] {
+			kept = append(kept, email)
+		} else {
+			added = append(added, email)
+		}
+	}
+	return kept, added
+}
+
+// meetingResponse returns a meeting with its running or next occurrence
+func meetingResponse(meeting *models.Meeting) gin.H {
+	response := gin.H{"meeting": meeting}
+	if !meeting.IsCancelled() {
+		if occurrence, err := services.NextOccurrence(meeting, time.Now()); err == nil && occurrence != nil {
+			response["next_occurrence"] = occurrence
+		}
+	}
+	return response
+}
+
+// respondMeetingError responds to an error of the meeting service
+func respondMeetingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMeeting):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMeetingNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// respondRoomUnavailable responds to a room that can't be joined; rooms of
+// scheduled meetings report when their join window opens
+func respondRoomUnavailable(c *gin.Context, err error) {
+	var closed *services.MeetingClosedError
+	if errors.As(err, &closed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "opens_at": closed.OpensAt})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+}
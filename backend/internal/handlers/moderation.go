@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"meet-backend/internal/middleware"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MuteParticipant mutes one track of a participant, or all their audio
+// and/or video tracks (owner, moderator or admin)
+func (h *RoomHandler) MuteParticipant(c *gin.Context) {
+	room, ok := h.loadModeratedRoom(c)
+	if !ok {
+		return
+	}
+
+	// The request body is optional; without one all audio is muted
+	var request models.MuteParticipantRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sids, err := h.moderationService.MuteParticipant(c.Request.Context(), room, c.GetString("user_id"), c.Param("participantId"), request)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"identity":   c.Param("participantId"),
+		"track_sids": sids,
+		"count":      len(sids),
+	})
+}
+
+// MuteAll mutes everyone in the room except the current user (owner,
+// moderator or admin)
+func (h *RoomHandler) MuteAll(c *gin.Context) {
+	room, ok := h.loadModeratedRoom(c)
+	if !ok {
+		return
+	}
+
+	// The request body is optional; without one all audio is muted
+	var request models.MuteAllRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	participants, tracks, err := h.moderationService.MuteAll(c.Request.Context(), room, c.GetString("user_id"), request)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"participants": participants,
+		"tracks":       tracks,
+	})
+}
+
+// UpdateParticipantPermissions changes what a participant may publish or
+// subscribe to during the call (owner, moderator or admin)
+func (h *RoomHandler) UpdateParticipantPermissions(c *gin.Context) {
+	room, ok := h.loadModeratedRoom(c)
+	if !ok {
+		return
+	}
+
+	var request models.ParticipantPermissionsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	participant, err := h.moderationService.UpdatePermissions(c.Request.Context(), room, c.GetString("user_id"), c.Param("participantId"), request)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"participant": participant})
+}
+
+// UpdateParticipantMetadata changes the metadata or display name of a
+// participant (owner, moderator or admin)
+func (h *RoomHandler) UpdateParticipantMetadata(c *gin.Context) {
+	room, ok := h.loadModeratedRoom(c)
+	if !ok {
+		return
+	}
+
+	var request models.ParticipantMetadataRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	participant, err := h.moderationService.UpdateMetadata(c.Request.Context(), room, c.GetString("user_id"), c.Param("participantId"), request)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"participant": participant})
+}
+
+// MoveParticipant moves a participant to another room. The current user
+// must manage both rooms.
+func (h *RoomHandler) MoveParticipant(c *gin.Context) {
+	room, ok := h.loadModeratedRoom(c)
+	if !ok {
+		return
+	}
+
+	var request models.MoveParticipantRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, err := h.roomService.GetRoom(request.Room)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.HasPermission(c, permissions.Moderate) {
+		member, err := h.memberService.GetMember(target.ID, c.GetString("user_id"))
+		if err != nil && !errors.Is(err, services.ErrRoomMemberNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if member == nil || (member.Role != models.RoomRoleOwner && member.Role != models.RoomRoleModerator) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only move participants to rooms you manage"})
+			return
+		}
+	}
+
+	if err := h.moderationService.MoveParticipant(c.Request.Context(), room, target, c.GetString("user_id"), c.Param("participantId")); err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"identity":  c.Param("participantId"),
+		"room_name": target.Name,
+	})
+}
+
+// ListModerationActions returns the moderation audit log of a room, newest
+// first, limited with ?limit (default 50, at most 200)
+func (h *RoomHandler) ListModerationActions(c *gin.Context) {
+	room, ok := h.loadModeratedRoom(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = parsed
+	}
+
+	actions, err := h.moderationService.ListActions(room.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"actions": actions,
+		"count":   len(actions),
+	})
+}
+
+// loadModeratedRoom loads the room of the request; access is checked by the
+// room role middleware. It responds itself when it returns false.
+func (h *RoomHandler) loadModeratedRoom(c *gin.Context) (*models.Room, bool) {
+	room, err := h.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return room, true
+}
+
+// respondModerationError responds to an error of the moderation service
+func respondModerationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidModeration):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrParticipantNotFound), errors.Is(err, services.ErrTrackNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBanned):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRoomExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
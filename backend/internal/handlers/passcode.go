@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkPasscode verifies the passcode of a protected room for the caller's
+// IP address, writing the error response when it fails
+func checkPasscode(c *gin.Context, passcodeService *services.PasscodeService, room *models.Room, passcode string) bool {
+	retryAfter, err := passcodeService.CheckPasscode(room, c.ClientIP(), passcode)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrPasscodeRequired), errors.Is(err, services.ErrInvalidPasscode):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "passcode_required": true})
+	case errors.Is(err, services.ErrPasscodeLocked):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "retry_after": int(math.Ceil(retryAfter.Seconds()))})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return false
+}
+
+// SetRoomPasscode sets or, with an empty passcode, removes the passcode of a room (owner or admin)
+func (rmh *RoomManagementHandler) SetRoomPasscode(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		Passcode *string `json:"passcode" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rmh.passcodeService.SetPasscode(room, *request.Passcode); err != nil {
+		if errors.Is(err, services.ErrInvalidPasscodeFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_name":          room.Name,
+		"passcode_protected": room.HasPasscode(),
+	})
+}
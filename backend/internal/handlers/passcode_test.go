@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPasscodeLockoutIgnoresForwardedFor(t *testing.T) {
+	db, room := newTokenTest(t)
+	db.Model(room).Update("lobby_enabled", false)
+	if err := services.NewPasscodeService().SetPasscode(room, "1234"); err != nil {
+		t.Fatalf("SetPasscode: %v", err)
+	}
+	handler := NewRoomManagementHandler(testAPIKey, testAPISecret, "http://localhost:7880", nil)
+
+	join := func(router *gin.Engine, remoteAddr, forwardedFor, passcode string) int {
+		body := bytes.NewBufferString(`{"name": "Guest", "passcode": "` + passcode + `"}`)
+		request := httptest.NewRequest(http.MethodPost, "/api/public/rooms/"+room.Name+"/join", body)
+		request.Header.Set("Content-Type", "application/json")
+		request.RemoteAddr = remoteAddr
+		request.Header.Set("X-Forwarded-For", forwardedFor)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		// forwarded returns the X-Forwarded-For header of attempt i
+		forwarded func(i int) string
+		want      int
+	}{
+		// Without trusted proxies a new X-Forwarded-For on every try does not help
+		{"untrusted", nil, func(i int) string { return fmt.Sprintf("203.0.113.%d", i+1) }, http.StatusTooManyRequests},
+		// Behind a trusted proxy each forwarded client has its own attempts
+		{"trusted proxy", []string{"192.0.2.0/24"}, func(i int) string { return fmt.Sprintf("203.0.113.%d", i+1) }, http.StatusOK},
+		{"trusted proxy, same client", []string{"192.0.2.0/24"}, func(int) string { return "203.0.113.100" }, http.StatusTooManyRequests},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			if err := router.SetTrustedProxies(test.trustedProxies); err != nil {
+				t.Fatalf("SetTrustedProxies: %v", err)
+			}
+			router.POST("/api/public/rooms/:roomName/join", handler.JoinRoom)
+
+			// Each case comes from its own proxy address
+			remoteAddr := fmt.Sprintf("192.0.2.%d:1234", i+1)
+			for attempt := 0; attempt < 5; attempt++ {
+				if status := join(router, remoteAddr, test.forwarded(attempt), "0000"); status != http.StatusForbidden {
+					t.Fatalf("attempt %d: status = %d, want %d", attempt+1, status, http.StatusForbidden)
+				}
+			}
+			if status := join(router, remoteAddr, test.forwarded(5), "1234"); status != test.want {
+				t.Errorf("right passcode after 5 wrong ones: status = %d, want %d", status, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RecordingHandler struct {
+	recordingService *services.RecordingService
+}
+
+func NewRecordingHandler() *RecordingHandler {
+	return &RecordingHandler{
+		recordingService: services.NewRecordingService(),
+	}
+}
+
+// ListRoomRecordings returns every recording made of a room
+func (rh *RecordingHandler) ListRoomRecordings(c *gin.Context) {
+	roomName := c.Param("roomName")
+	if roomName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room name is required"})
+		return
+	}
+
+	recordings, err := rh.recordingService.ListRoomRecordings(roomName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_name":  roomName,
+		"recordings": recordings,
+		"count":      len(recordings),
+	})
+}
+
+// GetRecording returns a single recording
+func (rh *RecordingHandler) GetRecording(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording ID"})
+		return
+	}
+
+	recording, err := rh.recordingService.GetRecording(id)
+	if err != nil {
+		if errors.Is(err, services.ErrRecordingNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, recording)
+}
@@ -1,41 +1,70 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"time"
 
+	"meet-backend/internal/database"
 	"meet-backend/internal/models"
+	"meet-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/livekit/protocol/auth"
 	"github.com/livekit/protocol/livekit"
 	lksdk "github.com/livekit/server-sdk-go/v2"
 )
 
 type RoomHandler struct {
-	roomClient   *lksdk.RoomServiceClient
-	egressClient *lksdk.EgressClient
-	apiKey       string
-	apiSecret    string
-	serverURL    string
+	roomClient        *lksdk.RoomServiceClient
+	egressClient      *lksdk.EgressClient
+	recordingService  *services.RecordingService
+	recordingConfig   *services.RecordingConfig
+	roomService       *services.RoomService
+	memberService     *services.RoomMemberService
+	policyService     *services.RoomPolicyService
+	passcodeService   *services.PasscodeService
+	lobbyService      *services.LobbyService
+	meetingService    *services.MeetingService
+	moderationService *services.ModerationService
+	banService        *services.BanService
+	tokenIssuer       *services.TokenIssuer
+	apiKey            string
+	apiSecret         string
+	serverURL         string
 }
 
 // NewRoomHandler creates a new room handler
-func NewRoomHandler(apiKey, apiSecret, serverURL string) *RoomHandler {
+func NewRoomHandler(apiKey, apiSecret, serverURL string, recordingConfig *services.RecordingConfig) *RoomHandler {
 	roomClient := lksdk.NewRoomServiceClient(serverURL, apiKey, apiSecret)
 	egressClient := lksdk.NewEgressClient(serverURL, apiKey, apiSecret)
+	tokenIssuer := services.NewTokenIssuer(apiKey, apiSecret, serverURL)
 
 	return &RoomHandler{
-		roomClient:   roomClient,
-		egressClient: egressClient,
-		apiKey:       apiKey,
-		apiSecret:    apiSecret,
-		serverURL:    serverURL,
+		roomClient:        roomClient,
+		egressClient:      egressClient,
+		recordingService:  services.NewRecordingService(),
+		recordingConfig:   recordingConfig,
+		roomService:       services.NewRoomService(),
+		memberService:     services.NewRoomMemberService(),
+		policyService:     services.NewRoomPolicyService(),
+		passcodeService:   services.NewPasscodeService(),
+		lobbyService:      services.NewLobbyService(),
+		meetingService:    services.NewMeetingService(),
+		moderationService: services.NewModerationService(database.GetDatabase(), roomClient, tokenIssuer),
+		banService:        services.NewBanService(),
+		tokenIssuer:       tokenIssuer,
+		apiKey:            apiKey,
+		apiSecret:         apiSecret,
+		serverURL:         serverURL,
 	}
 }
 
-// GenerateToken generates a LiveKit access token for a room
+// GenerateToken generates a LiveKit access token for the current user.
+// Identity and grants are decided by the server from the user's room role,
+// permissions and the room policy.
 func (h *RoomHandler) GenerateToken(c *gin.Context) {
 	roomName := c.Param("roomName")
 	if roomName == "" {
@@ -43,76 +72,67 @@ func (h *RoomHandler) GenerateToken(c *gin.Context) {
 		return
 	}
 
+	// The request body is optional
 	var request models.RoomTokenRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get user info from context
-	userID, _ := c.Get("user_id")
-	userName, _ := c.Get("user_name")
-	userEmail, _ := c.Get("user_email")
+	// Only issue tokens for rooms that exist and are active, or meetings whose window is open
+	room, err := h.meetingService.ResolveRoom(roomName)
+	if err != nil {
+		respondRoomUnavailable(c, err)
+		return
+	}
 
-	// Use provided identity or generate from user info
-	identity := request.Identity
-	if identity == "" {
-		identity = fmt.Sprintf("%s", userID)
+	policy, err := h.policyService.GetPolicy(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Use provided name or user's name
-	participantName := request.Name
-	if participantName == "" {
-		participantName = fmt.Sprintf("%s", userName)
+	tokenRequest, err := userTokenRequest(c, h.memberService, room, request.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	tokenRequest.Hidden = request.Hidden
 
-	// Create access token
-	at := auth.NewAccessToken(h.apiKey, h.apiSecret)
-	grant := &auth.VideoGrant{
-		RoomJoin:     true,
-		Room:         roomName,
-		CanPublish:   &request.CanPublish,
-		CanSubscribe: &request.CanSubscribe,
+	if !checkBan(c, h.banService, room, tokenRequest) {
+		return
 	}
 
-	// Add recording permission if requested and user has admin rights
-	if request.CanRecord {
-		userGroups, _ := c.Get("user_groups")
-		if groups, ok := userGroups.([]string); ok {
-			hasRecordingAccess := false
-			for _, group := range groups {
-				if group == "admin" || group == "meet-admin" || group == "recording" {
-					hasRecordingAccess = true
-					break
-				}
-			}
-			if hasRecordingAccess {
-				grant.CanPublishData = &request.CanRecord
-			}
-		}
+	if !checkBreakout(c, h.roomService, room, tokenRequest) {
+		return
 	}
 
-	at.AddGrant(grant).
-		SetIdentity(identity).
-		SetName(participantName).
-		SetValidFor(time.Hour * 6) // Token valid for 6 hours
+	// Hosts don't need the passcode of their own room
+	if !tokenRequest.IsModerator() && !checkPasscode(c, h.passcodeService, room, request.Passcode) {
+		return
+	}
 
-	// Add metadata with user info
-	metadata := fmt.Sprintf(`{"user_id":"%s","email":"%s"}`, userID, userEmail)
-	at.SetMetadata(metadata)
+	if !checkLobby(c, h.lobbyService, room, tokenRequest) {
+		return
+	}
 
-	token, err := at.ToJWT()
+	token, err := h.tokenIssuer.IssueToken(room, policy, tokenRequest)
 	if err != nil {
+		if errors.Is(err, services.ErrRoomExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	response := gin.H{
-		"token":      token,
+		"token":      token.Token,
 		"server_url": h.serverURL,
 		"room_name":  roomName,
-		"identity":   identity,
-		"name":       participantName,
+		"identity":   token.Identity,
+		"name":       token.Name,
+		"expires_at": token.ExpiresAt,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -141,40 +161,15 @@ func (h *RoomHandler) GetParticipants(c *gin.Context) {
 	})
 }
 
-// RemoveParticipant removes a participant from a room
+// RemoveParticipant removes a participant from a room (owner, moderator or admin)
 func (h *RoomHandler) RemoveParticipant(c *gin.Context) {
-	roomName := c.Param("roomName")
-	participantID := c.Param("participantId")
-
-	if roomName == "" || participantID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Room name and participant ID are required"})
+	room, ok := h.loadModeratedRoom(c)
+	if !ok {
 		return
 	}
 
-	// Check if user has admin rights
-	userGroups, _ := c.Get("user_groups")
-	hasAdminAccess := false
-	if groups, ok := userGroups.([]string); ok {
-		for _, group := range groups {
-			if group == "admin" || group == "meet-admin" {
-				hasAdminAccess = true
-				break
-			}
-		}
-	}
-
-	if !hasAdminAccess {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-		return
-	}
-
-	_, err := h.roomClient.RemoveParticipant(c.Request.Context(), &livekit.RoomParticipantIdentity{
-		Room:     roomName,
-		Identity: participantID,
-	})
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove participant"})
+	if err := h.moderationService.RemoveParticipant(c.Request.Context(), room, c.GetString("user_id"), c.Param("participantId")); err != nil {
+		respondModerationError(c, err)
 		return
 	}
 
@@ -189,23 +184,6 @@ func (h *RoomHandler) StartRecording(c *gin.Context) {
 		return
 	}
 
-	// Check if user has recording rights
-	userGroups, _ := c.Get("user_groups")
-	hasRecordingAccess := false
-	if groups, ok := userGroups.([]string); ok {
-		for _, group := range groups {
-			if group == "admin" || group == "meet-admin" || group == "recording" {
-				hasRecordingAccess = true
-				break
-			}
-		}
-	}
-
-	if !hasRecordingAccess {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Recording access required"})
-		return
-	}
-
 	// Check if recording is already active
 	egresses, err := h.egressClient.ListEgress(c.Request.Context(), &livekit.ListEgressRequest{
 		RoomName: roomName,
@@ -224,15 +202,18 @@ func (h *RoomHandler) StartRecording(c *gin.Context) {
 		}
 	}
 
+	// The request body is optional; without it a default file recording is made
+	var recordingRequest models.StartRecordingRequest
+	if err := c.ShouldBindJSON(&recordingRequest); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Start room composite recording
-	request := &livekit.RoomCompositeEgressRequest{
-		RoomName: roomName,
-		Layout:   "speaker-light",
-		Output: &livekit.RoomCompositeEgressRequest_File{
-			File: &livekit.EncodedFileOutput{
-				Filepath: fmt.Sprintf("%s-%d.mp4", roomName, time.Now().Unix()),
-			},
-		},
+	request, filePath, err := h.recordingConfig.BuildEgressRequest(roomName, recordingRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	info, err := h.egressClient.StartRoomCompositeEgress(c.Request.Context(), request)
@@ -241,11 +222,23 @@ func (h *RoomHandler) StartRecording(c *gin.Context) {
 		return
 	}
 
+	// Store the recording for the audit trail
+	userID := c.GetString("user_id")
+	recording, err := h.recordingService.CreateRecording(info, recordingRequest.OutputType(), filePath, userID)
+	if err != nil {
+		log.Printf("Failed to store recording %s for room %s: %v", info.EgressId, roomName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Recording started but could not be stored"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Recording started successfully",
-		"egress_id":  info.EgressId,
-		"status":     info.Status.String(),
-		"started_at": info.StartedAt,
+		"message":      "Recording started successfully",
+		"recording_id": recording.ID,
+		"output_type":  recording.OutputType,
+		"file_path":    recording.FilePath,
+		"egress_id":    info.EgressId,
+		"status":       info.Status.String(),
+		"started_at":   info.StartedAt,
 	})
 }
 
@@ -257,23 +250,6 @@ func (h *RoomHandler) StopRecording(c *gin.Context) {
 		return
 	}
 
-	// Check if user has recording rights
-	userGroups, _ := c.Get("user_groups")
-	hasRecordingAccess := false
-	if groups, ok := userGroups.([]string); ok {
-		for _, group := range groups {
-			if group == "admin" || group == "meet-admin" || group == "recording" {
-				hasRecordingAccess = true
-				break
-			}
-		}
-	}
-
-	if !hasRecordingAccess {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Recording access required"})
-		return
-	}
-
 	// Find active recordings
 	egresses, err := h.egressClient.ListEgress(c.Request.Context(), &livekit.ListEgressRequest{
 		RoomName: roomName,
@@ -307,6 +283,14 @@ func (h *RoomHandler) StopRecording(c *gin.Context) {
 		return
 	}
 
+	// Record who stopped the recording and its latest state
+	if err := h.recordingService.MarkStopped(info.EgressId, c.GetString("user_id")); err != nil {
+		log.Printf("Failed to mark recording %s as stopped: %v", info.EgressId, err)
+	}
+	if _, err := h.recordingService.UpdateFromEgressInfo(info); err != nil && !errors.Is(err, services.ErrRecordingNotFound) {
+		log.Printf("Failed to update recording %s: %v", info.EgressId, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Recording stopped successfully",
 		"egress_id": info.EgressId,
@@ -314,3 +298,43 @@ func (h *RoomHandler) StopRecording(c *gin.Context) {
 		"ended_at":  info.EndedAt,
 	})
 }
+
+// StartRecordingStatusRoutine periodically polls LiveKit for the status of
+// unfinished recordings, so the catalogue stays correct even when a webhook
+// is missed
+func (h *RoomHandler) StartRecordingStatusRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.syncRecordingStatus()
+	}
+}
+
+// syncRecordingStatus refreshes every unfinished recording from LiveKit
+func (h *RoomHandler) syncRecordingStatus() {
+	recordings, err := h.recordingService.ListUnfinishedRecordings()
+	if err != nil {
+		log.Printf("Error listing unfinished recordings: %v", err)
+		return
+	}
+
+	for _, recording := range recordings {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		egresses, err := h.egressClient.ListEgress(ctx, &livekit.ListEgressRequest{
+			EgressId: recording.EgressID,
+		})
+		cancel()
+
+		if err != nil {
+			log.Printf("Error polling egress %s: %v", recording.EgressID, err)
+			continue
+		}
+
+		for _, info := range egresses.Items {
+			if _, err := h.recordingService.UpdateFromEgressInfo(info); err != nil {
+				log.Printf("Error updating recording %s: %v", recording.EgressID, err)
+			}
+		}
+	}
+}
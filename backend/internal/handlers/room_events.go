@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"meet-backend/internal/events"
+	"meet-backend/internal/middleware"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// streamHeartbeat keeps proxies from closing idle streams
+	streamHeartbeat = 25 * time.Second
+	// streamWriteTimeout is how long a slow client can block a write
+	streamWriteTimeout = 10 * time.Second
+)
+
+// RoomEventHandler streams the events of a room over Server-Sent Events or
+// WebSocket, so clients don't have to poll for participants and time remaining
+type RoomEventHandler struct {
+	roomService *services.RoomService
+	warnings    []time.Duration // before expiry, longest first
+	upgrader    websocket.Upgrader
+}
+
+func NewRoomEventHandler(warnings []time.Duration) *RoomEventHandler {
+	return &RoomEventHandler{
+		roomService: services.NewRoomService(),
+		warnings:    warnings,
+		upgrader: websocket.Upgrader{
+			// Streams are authenticated with a bearer token rather than
+			// cookies, so any origin is allowed like in the CORS middleware
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// eventWriter sends events to a connected client
+type eventWriter interface {
+	Send(event events.Event) error
+	Ping() error
+}
+
+// Stream sends the state of a room followed by its events until the room
+// expires or is deactivated. Only members and participants of the room and
+// moderators can follow it. WebSocket upgrade requests get a WebSocket,
+// everything else a text/event-stream.
+func (h *RoomEventHandler) Stream(c *gin.Context) {
+	room, err := h.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.HasPermission(c, permissions.Moderate) {
+		allowed, err := h.roomService.IsMemberOrParticipant(room.ID, c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only members and participants of the room can follow its events"})
+			return
+		}
+	}
+
+	// Subscribe before taking the snapshot so no event falls in between
+	subscription, err := events.GetBus().Subscribe(room.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer subscription.Close()
+
+	state, err := h.stateEvent(room)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	var writer eventWriter
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return // the upgrader has responded
+		}
+		defer conn.Close()
+		writer = newWebSocketWriter(conn, cancel)
+	} else {
+		writer = newSSEWriter(c)
+	}
+
+	if err := writer.Send(state); err != nil {
+		return
+	}
+	h.run(ctx, writer, subscription, room)
+}
+
+// run forwards events and expiry warnings until the stream ends
+func (h *RoomEventHandler) run(ctx context.Context, writer eventWriter, subscription events.Subscription, room *models.Room) {
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	expiresAt := room.ExpiresAt
+	alarm := time.NewTimer(time.Hour)
+	defer alarm.Stop()
+	remaining, hasAlarm := h.scheduleAlarm(alarm, expiresAt)
+
+	for {
+		var alarmC <-chan time.Time
+		if hasAlarm {
+			alarmC = alarm.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// Fell behind; the client reconnects and gets a fresh state
+				return
+			}
+			if err := writer.Send(event); err != nil {
+				return
+			}
+
+			switch event.Type {
+			case events.EventRoomExtended:
+				var data events.RoomData
+				if err := json.Unmarshal(event.Data, &data); err == nil {
+					expiresAt = data.ExpiresAt
+					remaining, hasAlarm = h.scheduleAlarm(alarm, expiresAt)
+				}
+			case events.EventRoomExpired, events.EventRoomDeactivated:
+				return
+			}
+
+		case <-alarmC:
+			hasAlarm = false
+			if remaining > 0 {
+				if err := h.sendWarning(writer, room.Name, *expiresAt, remaining); err != nil {
+					return
+				}
+				remaining, hasAlarm = h.scheduleAlarm(alarm, expiresAt)
+				continue
+			}
+
+			// Check for an extension this replica didn't hear about
+			current, err := h.roomService.GetRoomByID(room.ID)
+			if err == nil && current.ExpiresAt != nil && current.ExpiresAt.After(time.Now()) {
+				expiresAt = current.ExpiresAt
+				if sendEvent(writer, room.Name, events.EventRoomExtended, events.NewRoomData(current)) != nil {
+					return
+				}
+				remaining, hasAlarm = h.scheduleAlarm(alarm, expiresAt)
+				continue
+			}
+
+			expired := *room
+			expired.ExpiresAt = expiresAt
+			sendEvent(writer, room.Name, events.EventRoomExpired, events.NewRoomData(&expired))
+			return
+
+		case <-heartbeat.C:
+			if err := writer.Ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// scheduleAlarm sets the timer to the next expiry warning, or to the expiry
+// itself once all warnings are past. It returns the time remaining at the
+// alarm, zero for the expiry, and false for rooms without a time limit.
+func (h *RoomEventHandler) scheduleAlarm(alarm *time.Timer, expiresAt *time.Time) (time.Duration, bool) {
+	if !alarm.Stop() {
+		// Drop a pending alarm that was never received
+		select {
+		case <-alarm.C:
+		default:
+		}
+	}
+	if expiresAt == nil {
+		return 0, false
+	}
+
+	now := time.Now()
+	for _, warning := range h.warnings {
+		if at := expiresAt.Add(-warning); at.After(now) {
+			alarm.Reset(at.Sub(now))
+			return warning, true
+		}
+	}
+
+	alarm.Reset(expiresAt.Sub(now))
+	return 0, true
+}
+
+// sendWarning tells the client the room expires soon
+func (h *RoomEventHandler) sendWarning(writer eventWriter, roomName string, expiresAt time.Time, remaining time.Duration) error {
+	return sendEvent(writer, roomName, events.EventRoomExpiring, gin.H{
+		"expires_at":        expiresAt,
+		"minutes_remaining": int(remaining.Minutes()),
+	})
+}
+
+// stateEvent returns the room.state event a stream starts with
+func (h *RoomEventHandler) stateEvent(room *models.Room) (events.Event, error) {
+	participants, err := h.roomService.GetActiveParticipants(room.ID)
+	if err != nil {
+		return events.Event{}, err
+	}
+
+	present := make([]*events.ParticipantData, 0, len(participants))
+	for i := range participants {
+		present = append(present, events.NewParticipantData(room, &participants[i]))
+	}
+
+	return events.NewEvent(room.Name, events.EventRoomState, gin.H{
+		"room":           events.NewRoomData(room),
+		"time_remaining": room.TimeRemaining(),
+		"participants":   present,
+	})
+}
+
+// sendEvent sends an event that only this stream gets
+func sendEvent(writer eventWriter, roomName, eventType string, data interface{}) error {
+	event, err := events.NewEvent(roomName, eventType, data)
+	if err != nil {
+		return err
+	}
+	return writer.Send(event)
+}
+
+// sseWriter writes events as Server-Sent Events
+type sseWriter struct {
+	c *gin.Context
+}
+
+func newSSEWriter(c *gin.Context) *sseWriter {
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // don't let nginx buffer the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	return &sseWriter{c: c}
+}
+
+func (w *sseWriter) Send(event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+func (w *sseWriter) Ping() error {
+	if _, err := fmt.Fprint(w.c.Writer, ": ping\n\n"); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// webSocketWriter writes events as JSON text messages
+type webSocketWriter struct {
+	conn *websocket.Conn
+}
+
+// newWebSocketWriter starts reading the connection so pongs and close
+// frames are handled; done is called when the client goes away
+func newWebSocketWriter(conn *websocket.Conn, done func()) *webSocketWriter {
+	conn.SetReadLimit(1024)
+	conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	})
+
+	go func() {
+		defer done()
+		for {
+			// Clients have nothing to send; messages are ignored
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	return &webSocketWriter{conn: conn}
+}
+
+func (w *webSocketWriter) Send(event events.Event) error {
+	w.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return w.conn.WriteJSON(event)
+}
+
+func (w *webSocketWriter) Ping() error {
+	return w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+}
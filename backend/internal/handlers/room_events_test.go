@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+	"meet-backend/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoomEventStreamRequiresMembership(t *testing.T) {
+	db := testdb.Open(t, &models.Room{}, &models.RoomParticipant{}, &models.RoomMember{})
+	database.DB = db
+
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	if err := db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	db.Create(&models.RoomMember{RoomID: room.ID, UserID: "owner", Role: models.RoomRoleOwner})
+	participant := "participant"
+	db.Create(&models.RoomParticipant{RoomID: room.ID, UserID: &participant, Identity: "participant", Name: "Participant"})
+
+	handler := NewRoomEventHandler(nil)
+	chatService := services.NewChatService()
+
+	tests := []struct {
+		name        string
+		userID      string
+		permissions permissions.Set
+		want        int
+	}{
+		{"stranger", "stranger", permissions.Set{}, http.StatusForbidden},
+		{"member", "owner", permissions.Set{}, http.StatusOK},
+		{"participant", "participant", permissions.Set{}, http.StatusOK},
+		{"moderator", "stranger", permissions.Set{permissions.Moderate: true}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/api/rooms/:roomName/events", func(c *gin.Context) {
+				c.Set("user_id", test.userID)
+				c.Set("user_permissions", test.permissions)
+			}, handler.Stream)
+
+			// The stream runs until the client goes away
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			request := httptest.NewRequest(http.MethodGet, "/api/rooms/"+room.Name+"/events", nil).WithContext(ctx)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.want {
+				t.Fatalf("status = %d, want %d", recorder.Code, test.want)
+			}
+
+			// The stream carries the chat, so it is open to the readers of the chat
+			canRead, err := chatService.CanRead(room.ID, test.userID)
+			if err != nil {
+				t.Fatalf("CanRead: %v", err)
+			}
+			if canRead := canRead || test.permissions.Has(permissions.Moderate); canRead != (test.want == http.StatusOK) {
+				t.Errorf("can read the chat = %v, but stream status = %d", canRead, recorder.Code)
+			}
+			hasState := strings.Contains(recorder.Body.String(), "event: "+events.EventRoomState)
+			if hasState != (test.want == http.StatusOK) {
+				t.Errorf("room state sent = %v, want %v", hasState, test.want == http.StatusOK)
+			}
+		})
+	}
+}
@@ -1,34 +1,81 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"time"
 
+	"meet-backend/internal/middleware"
+	"meet-backend/internal/models"
+	"meet-backend/internal/notifications"
+	"meet-backend/internal/permissions"
 	"meet-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type RoomManagementHandler struct {
-	roomService *services.RoomService
+	roomService       *services.RoomService
+	memberService     *services.RoomMemberService
+	policyService     *services.RoomPolicyService
+	lobbyService      *services.LobbyService
+	passcodeService   *services.PasscodeService
+	inviteService     *services.InviteService
+	meetingService    *services.MeetingService
+	invitationService *services.InvitationService
+	banService        *services.BanService
+	tokenIssuer       *services.TokenIssuer
 }
 
-func NewRoomManagementHandler() *RoomManagementHandler {
+func NewRoomManagementHandler(apiKey, apiSecret, serverURL string, outbox *notifications.Outbox) *RoomManagementHandler {
 	return &RoomManagementHandler{
-		roomService: services.NewRoomService(),
+		roomService:       services.NewRoomService(),
+		memberService:     services.NewRoomMemberService(),
+		policyService:     services.NewRoomPolicyService(),
+		lobbyService:      services.NewLobbyService(),
+		passcodeService:   services.NewPasscodeService(),
+		inviteService:     services.NewInviteService(),
+		meetingService:    services.NewMeetingService(),
+		invitationService: services.NewInvitationService(outbox),
+		banService:        services.NewBanService(),
+		tokenIssuer:       services.NewTokenIssuer(apiKey, apiSecret, serverURL),
 	}
 }
 
 // CreateRoom creates a new room
 func (rmh *RoomManagementHandler) CreateRoom(c *gin.Context) {
 	var request struct {
-		Name string `json:"name" binding:"required"`
+		Name     string   `json:"name"`     // generated as abc-defg-hij when empty
+		Passcode string   `json:"passcode"` // optional passcode or PIN
+		Invitees []string `json:"invitees"` // email addresses to send the join link to
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if request.Name == "" {
+		name, err := rmh.roomService.GenerateRoomName()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		request.Name = name
+	}
+
+	var passcodeHash string
+	if request.Passcode != "" {
+		var err error
+		passcodeHash, err = services.HashPasscode(request.Passcode)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Check if user is authenticated
 	var userID *string
 	if userIDValue, exists := c.Get("user_id"); exists {
@@ -37,20 +84,40 @@ func (rmh *RoomManagementHandler) CreateRoom(c *gin.Context) {
 		}
 	}
 
+	// Only signed-in users can send email invitations
+	invitees, err := services.NormalizeInvitees(request.Invitees)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(invitees) > 0 && userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in to invite people by email"})
+		return
+	}
+
 	// Create room
-	room, err := rmh.roomService.CreateRoom(request.Name, userID)
+	unlimited := middleware.HasPermission(c, permissions.CreateUnlimitedRoom)
+	room, err := rmh.roomService.CreateRoom(request.Name, userID, unlimited, passcodeHash)
 	if err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The room exists either way, a failed invitation is only logged
+	if len(invitees) > 0 {
+		if err := rmh.invitationService.InviteToRoom(room, *userID, request.Passcode, invitees); err != nil {
+			log.Printf("Failed to queue invitations for room %s: %v", room.Name, err)
+		}
+	}
+
 	response := gin.H{
-		"room_id":       room.ID,
-		"name":          room.Name,
-		"created_at":    room.CreatedAt,
-		"expires_at":    room.ExpiresAt,
-		"max_duration":  room.MaxDuration,
-		"is_guest_room": room.CreatedBy == nil,
+		"room_id":            room.ID,
+		"name":               room.Name,
+		"created_at":         room.CreatedAt,
+		"expires_at":         room.ExpiresAt,
+		"max_duration":       room.MaxDuration,
+		"is_guest_room":      room.CreatedBy == nil,
+		"passcode_protected": room.HasPasscode(),
 	}
 
 	if room.ExpiresAt != nil {
@@ -84,7 +151,8 @@ func (rmh *RoomManagementHandler) GetRoom(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
-// JoinRoom handles participant joining a room
+// JoinRoom handles participant joining a room and returns a LiveKit token.
+// Guests get a generated identity, signed-in users join as themselves.
 func (rmh *RoomManagementHandler) JoinRoom(c *gin.Context) {
 	roomName := c.Param("roomName")
 	if roomName == "" {
@@ -93,8 +161,8 @@ func (rmh *RoomManagementHandler) JoinRoom(c *gin.Context) {
 	}
 
 	var request struct {
-		Identity string `json:"identity" binding:"required"`
 		Name     string `json:"name" binding:"required"`
+		Passcode string `json:"passcode"` // required for protected rooms
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -102,37 +170,109 @@ func (rmh *RoomManagementHandler) JoinRoom(c *gin.Context) {
 		return
 	}
 
-	// Get room
-	room, err := rmh.roomService.GetRoom(roomName)
+	// Get room; the room of a scheduled meeting opens with its join window
+	room, err := rmh.meetingService.ResolveRoom(roomName)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondRoomUnavailable(c, err)
 		return
 	}
 
 	// Check if user is authenticated
-	var userID *string
 	isGuest := true
 	if userIDValue, exists := c.Get("user_id"); exists {
-		if uid, ok := userIDValue.(string); ok {
-			userID = &uid
+		if _, ok := userIDValue.(string); ok {
 			isGuest = false
 		}
 	}
 
-	// Add participant
-	participant, err := rmh.roomService.AddParticipant(room.ID, userID, request.Identity, request.Name, isGuest)
+	policy, err := rmh.policyService.GetPolicy(room.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The identity is chosen by the server so nobody can impersonate another participant
+	var tokenRequest services.TokenRequest
+	if isGuest {
+		identity, err := services.NewGuestIdentity()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate identity"})
+			return
+		}
+		tokenRequest = services.TokenRequest{Identity: identity, Name: request.Name}
+	} else {
+		tokenRequest, err = userTokenRequest(c, rmh.memberService, room, request.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !checkBan(c, rmh.banService, room, tokenRequest) {
+		return
+	}
+
+	if !checkBreakout(c, rmh.roomService, room, tokenRequest) {
+		return
+	}
+
+	// Hosts don't need the passcode of their own room
+	if !tokenRequest.IsModerator() && !checkPasscode(c, rmh.passcodeService, room, request.Passcode) {
+		return
+	}
+
+	if !checkLobby(c, rmh.lobbyService, room, tokenRequest) {
+		return
+	}
+
+	response, status, err := rmh.admitParticipant(c, room, policy, tokenRequest)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// admitParticipant issues a LiveKit token and records the participant.
+// On failure it returns the HTTP status to respond with.
+func (rmh *RoomManagementHandler) admitParticipant(c *gin.Context, room *models.Room, policy *models.RoomPolicy, tokenRequest services.TokenRequest) (gin.H, int, error) {
+	token, err := rmh.tokenIssuer.IssueToken(room, policy, tokenRequest)
+	if err != nil {
+		if errors.Is(err, services.ErrRoomExpired) {
+			return nil, http.StatusGone, err
+		}
+		return nil, http.StatusInternalServerError, errors.New("failed to generate token")
+	}
+
+	// Add participant; the IP address of guests is kept for IP bans
+	isGuest := tokenRequest.UserID == nil
+	ipAddress := ""
+	if isGuest {
+		ipAddress = c.ClientIP()
+	}
+	participant, err := rmh.roomService.AddParticipant(room.ID, tokenRequest.UserID, token.Identity, token.Name, isGuest, ipAddress)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// Signed-in users become members of the room
+	if !isGuest {
+		if err := rmh.memberService.EnsureMember(room.ID, *tokenRequest.UserID); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
 	response := gin.H{
-		"participant_id": participant.ID,
-		"room_id":        room.ID,
-		"identity":       participant.Identity,
-		"name":           participant.Name,
-		"joined_at":      participant.JoinedAt,
-		"is_guest":       participant.IsGuest,
+		"participant_id":   participant.ID,
+		"room_id":          room.ID,
+		"identity":         participant.Identity,
+		"name":             participant.Name,
+		"joined_at":        participant.JoinedAt,
+		"is_guest":         participant.IsGuest,
+		"token":            token.Token,
+		"token_expires_at": token.ExpiresAt,
+		"server_url":       rmh.tokenIssuer.ServerURL(),
 	}
 
 	if room.ExpiresAt != nil {
@@ -140,7 +280,7 @@ func (rmh *RoomManagementHandler) JoinRoom(c *gin.Context) {
 		response["time_remaining"] = room.TimeRemaining()
 	}
 
-	c.JSON(http.StatusOK, response)
+	return response, http.StatusOK, nil
 }
 
 // LeaveRoom handles participant leaving a room
@@ -199,7 +339,7 @@ func (rmh *RoomManagementHandler) GetRoomParticipants(c *gin.Context) {
 	})
 }
 
-// ExtendRoom extends the expiration time for guest rooms
+// ExtendRoom extends the expiration time for guest rooms (owner, moderator or admin)
 func (rmh *RoomManagementHandler) ExtendRoom(c *gin.Context) {
 	roomName := c.Param("roomName")
 	if roomName == "" {
@@ -223,9 +363,9 @@ func (rmh *RoomManagementHandler) ExtendRoom(c *gin.Context) {
 		return
 	}
 
-	// Only allow extension for guest rooms
-	if room.CreatedBy != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot extend authenticated user rooms"})
+	// Only allow extension for rooms with a time limit
+	if room.ExpiresAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot extend rooms without a time limit"})
 		return
 	}
 
@@ -245,7 +385,7 @@ func (rmh *RoomManagementHandler) ExtendRoom(c *gin.Context) {
 	})
 }
 
-// DeactivateRoom deactivates a room (admin only)
+// DeactivateRoom deactivates a room (owner, moderator or admin)
 func (rmh *RoomManagementHandler) DeactivateRoom(c *gin.Context) {
 	roomName := c.Param("roomName")
 	if roomName == "" {
@@ -293,3 +433,101 @@ func (rmh *RoomManagementHandler) GetRoomStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+// GetAttendance returns who attended a room and for how long, also after the
+// meeting, as JSON or, with ?format=csv, as a CSV file (owner, moderator or
+// admin)
+func (rmh *RoomManagementHandler) GetAttendance(c *gin.Context) {
+	// RequireRoomRole only finds active rooms, so access is checked here
+	room, err := rmh.roomService.FindRoom(c.Param("roomName"))
+	if err != nil {
+		if errors.Is(err, services.ErrRoomNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.HasPermission(c, permissions.Moderate) {
+		member, err := rmh.memberService.GetMember(room.ID, c.GetString("user_id"))
+		if err != nil && !errors.Is(err, services.ErrRoomMemberNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil || !member.CanManageRoom() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner or a moderator of the room can see its attendance"})
+			return
+		}
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	report, err := rmh.roomService.GetAttendance(room)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	data, err := report.CSV()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="attendance-`+room.Name+`.csv"`)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+// GetRoomPolicy returns the grant overrides of a room
+func (rmh *RoomManagementHandler) GetRoomPolicy(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := rmh.policyService.GetPolicy(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateRoomPolicy replaces the grant overrides of a room (owner, moderator or admin).
+// Fields that are left out fall back to the server defaults.
+func (rmh *RoomManagementHandler) UpdateRoomPolicy(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request models.RoomPolicy
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request.RoomID = room.ID
+	request.UpdatedBy = c.GetString("user_id")
+	request.UpdatedAt = time.Now()
+
+	if err := rmh.policyService.SetPolicy(&request); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoomMemberHandler struct {
+	roomService   *services.RoomService
+	memberService *services.RoomMemberService
+	userService   *services.UserService
+}
+
+func NewRoomMemberHandler() *RoomMemberHandler {
+	return &RoomMemberHandler{
+		roomService:   services.NewRoomService(),
+		memberService: services.NewRoomMemberService(),
+		userService:   services.NewUserService(),
+	}
+}
+
+// ListMembers returns the owner, moderators and members of a room
+func (rmh *RoomMemberHandler) ListMembers(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	members, err := rmh.memberService.ListMembers(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_id":   room.ID,
+		"room_name": room.Name,
+		"members":   members,
+		"count":     len(members),
+	})
+}
+
+// GrantModerator makes a user moderator of a room (owner only)
+func (rmh *RoomMemberHandler) GrantModerator(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.Param("userId")
+	if _, err := rmh.userService.GetUser(userID); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := rmh.memberService.GrantModerator(room.ID, userID, c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrOwnerRoleImmutable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RevokeModerator turns a moderator back into a regular member (owner only)
+func (rmh *RoomMemberHandler) RevokeModerator(c *gin.Context) {
+	room, err := rmh.roomService.GetRoom(c.Param("roomName"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rmh.memberService.RevokeModerator(room.ID, c.Param("userId")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrRoomMemberNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrOwnerRoleImmutable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Moderator revoked successfully"})
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+
+	"meet-backend/internal/middleware"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userTokenRequest describes the signed-in user of a request to the token
+// issuer. The identity is always the user's ID.
+func userTokenRequest(c *gin.Context, memberService *services.RoomMemberService, room *models.Room, name string) (services.TokenRequest, error) {
+	userID := c.GetString("user_id")
+	if name == "" {
+		name = c.GetString("user_name")
+	}
+
+	request := services.TokenRequest{
+		Identity: userID,
+		Name:     name,
+		UserID:   &userID,
+		Moderate: middleware.HasPermission(c, permissions.Moderate),
+		Record:   middleware.HasPermission(c, permissions.Record),
+	}
+
+	member, err := memberService.GetMember(room.ID, userID)
+	if err != nil && !errors.Is(err, services.ErrRoomMemberNotFound) {
+		return request, err
+	}
+	if member != nil {
+		request.RoomRole = member.Role
+	}
+
+	return request, nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/webhook"
+)
+
+// ChatRecorder joins and leaves calls to record their chat; implemented by
+// services.ChatRecorder
+type ChatRecorder interface {
+	Start(roomName string) error
+	Stop(roomName string)
+}
+
+type WebhookHandler struct {
+	keyProvider      auth.KeyProvider
+	roomService      *services.RoomService
+	recordingService *services.RecordingService
+	chatRecorder     ChatRecorder
+
+	mu       sync.Mutex
+	starting map[string]bool // rooms the chat recorder is joining
+}
+
+// NewWebhookHandler creates a handler for LiveKit webhooks signed with the
+// given API key/secret; the chat recorder follows the calls that start and end
+func NewWebhookHandler(apiKey, apiSecret string, chatRecorder ChatRecorder) *WebhookHandler {
+	return &WebhookHandler{
+		keyProvider:      auth.NewSimpleKeyProvider(apiKey, apiSecret),
+		roomService:      services.NewRoomService(),
+		recordingService: services.NewRecordingService(),
+		chatRecorder:     chatRecorder,
+		starting:         make(map[string]bool),
+	}
+}
+
+// LiveKit verifies and applies a LiveKit webhook event
+func (wh *WebhookHandler) LiveKit(c *gin.Context) {
+	event, err := webhook.ReceiveWebhookEvent(c.Request, wh.keyProvider)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+		return
+	}
+
+	if err := wh.applyEvent(event); err != nil {
+		log.Printf("Failed to apply LiveKit webhook %s (%s): %v", event.Event, event.Id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event processed"})
+}
+
+// applyEvent updates the database for a single LiveKit webhook event
+func (wh *WebhookHandler) applyEvent(event *livekit.WebhookEvent) error {
+	at := time.Now()
+	if event.CreatedAt > 0 {
+		at = time.Unix(event.CreatedAt, 0)
+	}
+
+	roomName := event.GetRoom().GetName()
+
+	switch event.Event {
+	case webhook.EventRoomStarted:
+		wh.startChatRecorder(roomName)
+		return ignoreUnknownRoom(wh.roomService.MarkRoomStarted(roomName, at))
+
+	case webhook.EventRoomFinished:
+		wh.chatRecorder.Stop(roomName)
+		return ignoreUnknownRoom(wh.roomService.MarkRoomFinished(roomName, at))
+
+	case webhook.EventParticipantJoined:
+		participant := event.GetParticipant()
+		if participant.GetKind() == livekit.ParticipantInfo_EGRESS || participant.GetIdentity() == services.ChatRecorderIdentity {
+			return nil
+		}
+		// The recorder leaves calls that empty out, which LiveKit keeps open
+		// for a while, so it joins again when someone comes back
+		wh.startChatRecorder(roomName)
+		if participant.GetJoinedAt() > 0 {
+			at = time.Unix(participant.GetJoinedAt(), 0)
+		}
+		return ignoreUnknownRoom(wh.roomService.SyncParticipantJoined(
+			roomName,
+			userIDFromMetadata(participant.GetMetadata()),
+			participant.GetIdentity(),
+			participant.GetName(),
+			at,
+		))
+
+	case webhook.EventParticipantLeft:
+		participant := event.GetParticipant()
+		if participant.GetKind() == livekit.ParticipantInfo_EGRESS || participant.GetIdentity() == services.ChatRecorderIdentity {
+			return nil
+		}
+		return ignoreUnknownRoom(wh.roomService.SyncParticipantLeft(roomName, participant.GetIdentity(), at))
+
+	case webhook.EventEgressStarted, webhook.EventEgressUpdated, webhook.EventEgressEnded:
+		_, err := wh.recordingService.UpdateFromEgressInfo(event.GetEgressInfo())
+		if errors.Is(err, services.ErrRecordingNotFound) {
+			// Egress not started through this backend
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// startChatRecorder joins the call of a room to record its chat. Joining
+// takes a while, so it doesn't hold up the webhook response; participants
+// joining meanwhile don't start another join.
+func (wh *WebhookHandler) startChatRecorder(roomName string) {
+	wh.mu.Lock()
+	if wh.starting[roomName] {
+		wh.mu.Unlock()
+		return
+	}
+	wh.starting[roomName] = true
+	wh.mu.Unlock()
+
+	go func() {
+		defer func() {
+			wh.mu.Lock()
+			delete(wh.starting, roomName)
+			wh.mu.Unlock()
+		}()
+
+		if err := wh.chatRecorder.Start(roomName); err != nil {
+			log.Printf("Failed to start recording the chat of room %s: %v", roomName, err)
+		}
+	}()
+}
+
+// ignoreUnknownRoom drops "not found" errors for rooms that were created
+// directly on the LiveKit server and therefore have no database record
+func ignoreUnknownRoom(err error) error {
+	if errors.Is(err, services.ErrRoomNotFound) {
+		return nil
+	}
+	return err
+}
+
+// userIDFromMetadata extracts the user ID that GenerateToken stores in the
+// participant metadata; guests have no user ID
+func userIDFromMetadata(metadata string) *string {
+	if metadata == "" {
+		return nil
+	}
+
+	var data struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal([]byte(metadata), &data); err != nil || data.UserID == "" {
+		return nil
+	}
+
+	return &data.UserID
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"meet-backend/internal/middleware"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+	"meet-backend/internal/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WebhookSubscriptionHandler manages outbound webhooks; incoming LiveKit
+// webhooks are handled by WebhookHandler
+type WebhookSubscriptionHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookSubscriptionHandler() *WebhookSubscriptionHandler {
+	return &WebhookSubscriptionHandler{
+		webhookService: services.NewWebhookService(),
+	}
+}
+
+// webhookRequest holds the editable fields of a subscription; fields left
+// out of an update keep their value
+type webhookRequest struct {
+	URL         *string   `json:"url"`
+	Secret      *string   `json:"secret"` // generated when left out on create
+	Events      *[]string `json:"events"` // empty for all events
+	AllRooms    *bool     `json:"all_rooms"`
+	Active      *bool     `json:"active"`
+	Description *string   `json:"description"`
+}
+
+// apply copies the fields that were sent onto a subscription
+func (r *webhookRequest) apply(subscription *models.WebhookSubscription) {
+	if r.URL != nil {
+		subscription.URL = *r.URL
+	}
+	if r.Secret != nil {
+		subscription.Secret = *r.Secret
+	}
+	if r.Events != nil {
+		subscription.Events = *r.Events
+	}
+	if r.AllRooms != nil {
+		subscription.AllRooms = *r.AllRooms
+	}
+	if r.Active != nil {
+		subscription.Active = *r.Active
+	}
+	if r.Description != nil {
+		subscription.Description = *r.Description
+	}
+}
+
+// ListEventTypes returns the events a subscription can filter on
+func (wh *WebhookSubscriptionHandler) ListEventTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"events": webhooks.EventTypes})
+}
+
+// CreateWebhook registers a webhook for the current user. Only admins can
+// subscribe to events of all rooms.
+func (wh *WebhookSubscriptionHandler) CreateWebhook(c *gin.Context) {
+	var request webhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.URL == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+	if request.AllRooms != nil && *request.AllRooms && !middleware.HasPermission(c, permissions.Admin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can subscribe to all rooms"})
+		return
+	}
+
+	subscription := &models.WebhookSubscription{UserID: c.GetString("user_id")}
+	request.apply(subscription)
+
+	secret, err := wh.webhookService.CreateSubscription(subscription)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	// The secret is only ever shown here
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": subscription,
+		"secret":  secret,
+	})
+}
+
+// ListWebhooks returns the webhooks of the current user
+func (wh *WebhookSubscriptionHandler) ListWebhooks(c *gin.Context) {
+	subscriptions, err := wh.webhookService.ListSubscriptions(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": subscriptions,
+		"count":    len(subscriptions),
+	})
+}
+
+// GetWebhook returns a single webhook (owner or admin)
+func (wh *WebhookSubscriptionHandler) GetWebhook(c *gin.Context) {
+	subscription, ok := wh.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": subscription})
+}
+
+// UpdateWebhook changes the URL, secret, events or state of a webhook (owner or admin)
+func (wh *WebhookSubscriptionHandler) UpdateWebhook(c *gin.Context) {
+	subscription, ok := wh.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	var request webhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.AllRooms != nil && *request.AllRooms && !subscription.AllRooms && !middleware.HasPermission(c, permissions.Admin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can subscribe to all rooms"})
+		return
+	}
+
+	request.apply(subscription)
+
+	if err := wh.webhookService.UpdateSubscription(subscription); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": subscription})
+}
+
+// DeleteWebhook removes a webhook and its delivery log (owner or admin)
+func (wh *WebhookSubscriptionHandler) DeleteWebhook(c *gin.Context) {
+	subscription, ok := wh.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := wh.webhookService.DeleteSubscription(subscription); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// ListDeliveries returns the delivery log of a webhook, newest first. It can
+// be filtered with ?status=pending|delivered|failed and limited with ?limit
+// (default 50, at most 200).
+func (wh *WebhookSubscriptionHandler) ListDeliveries(c *gin.Context) {
+	subscription, ok := wh.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := wh.webhookService.ListDeliveries(subscription.ID, c.Query("status"), limit)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// GetDelivery returns a delivery with the payload that was sent
+func (wh *WebhookSubscriptionHandler) GetDelivery(c *gin.Context) {
+	delivery, ok := wh.loadDelivery(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"delivery": delivery,
+		"payload":  json.RawMessage(delivery.Payload),
+	})
+}
+
+// Redeliver sends the event of a delivery again
+func (wh *WebhookSubscriptionHandler) Redeliver(c *gin.Context) {
+	delivery, ok := wh.loadDelivery(c)
+	if !ok {
+		return
+	}
+
+	redelivery, err := wh.webhookService.Redeliver(delivery)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"delivery": redelivery})
+}
+
+// loadWebhook loads the webhook of the request and checks that the current
+// user may manage it. It responds itself when it returns false.
+func (wh *WebhookSubscriptionHandler) loadWebhook(c *gin.Context) (*models.WebhookSubscription, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+
+	subscription, err := wh.webhookService.GetSubscription(id)
+	if err != nil {
+		respondWebhookError(c, err)
+		return nil, false
+	}
+
+	if subscription.UserID != c.GetString("user_id") && !middleware.HasPermission(c, permissions.Admin) {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrWebhookNotFound.Error()})
+		return nil, false
+	}
+
+	return subscription, true
+}
+
+// loadDelivery loads a delivery of a webhook the current user may manage
+func (wh *WebhookSubscriptionHandler) loadDelivery(c *gin.Context) (*models.WebhookDelivery, bool) {
+	subscription, ok := wh.loadWebhook(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("deliveryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return nil, false
+	}
+
+	delivery, err := wh.webhookService.GetDelivery(subscription.ID, id)
+	if err != nil {
+		respondWebhookError(c, err)
+		return nil, false
+	}
+
+	return delivery, true
+}
+
+// respondWebhookError responds to an error of the webhook service
+func respondWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+	"meet-backend/internal/services"
+	"meet-backend/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/webhook"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/gorm"
+)
+
+const (
+	testAPIKey    = "test-key"
+	testAPISecret = "test-secret-that-is-long-enough"
+)
+
+// fakeChatRecorder reports the calls it is asked to join on started instead
+// of joining them. Start blocks until release is closed, when set.
+type fakeChatRecorder struct {
+	release chan struct{}
+	started chan string
+}
+
+func newFakeChatRecorder() *fakeChatRecorder {
+	return &fakeChatRecorder{started: make(chan string, 100)}
+}
+
+func (r *fakeChatRecorder) Start(roomName string) error {
+	if r.release != nil {
+		<-r.release
+	}
+	r.started <- roomName
+	return nil
+}
+
+func (r *fakeChatRecorder) Stop(string) {}
+
+// newWebhookTest returns a router serving the LiveKit webhook against an
+// empty database with one room
+func newWebhookTest(t *testing.T) (*gin.Engine, *gorm.DB, *models.Room) {
+	t.Helper()
+	return newWebhookTestWithRecorder(t, newFakeChatRecorder())
+}
+
+// newWebhookTestWithRecorder is newWebhookTest with the given chat recorder
+func newWebhookTestWithRecorder(t *testing.T, chatRecorder ChatRecorder) (*gin.Engine, *gorm.DB, *models.Room) {
+	t.Helper()
+
+	db := testdb.Open(t,
+		&models.Room{},
+		&models.RoomParticipant{},
+		&models.RoomMember{},
+		&models.Recording{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+	)
+	database.DB = db
+
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	if err := db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+
+	handler := NewWebhookHandler(testAPIKey, testAPISecret, chatRecorder)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/webhooks/livekit", handler.LiveKit)
+
+	return router, db, room
+}
+
+// postWebhook posts an event signed like LiveKit signs it and returns the
+// response status
+func postWebhook(t *testing.T, router *gin.Engine, secret string, event *livekit.WebhookEvent) int {
+	t.Helper()
+
+	body, err := protojson.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+
+	sum := sha256.Sum256(body)
+	token, err := auth.NewAccessToken(testAPIKey, secret).
+		SetValidFor(time.Minute).
+		SetSha256(base64.StdEncoding.EncodeToString(sum[:])).
+		ToJWT()
+	if err != nil {
+		t.Fatalf("failed to sign event: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/webhooks/livekit", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/webhook+json")
+	request.Header.Set("Authorization", token)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+// countEvents returns how many events of each type are waiting on a subscription
+func countEvents(subscription events.Subscription) map[string]int {
+	counts := make(map[string]int)
+	for {
+		select {
+		case event := <-subscription.Events():
+			counts[event.Type]++
+		default:
+			return counts
+		}
+	}
+}
+
+func TestLiveKitWebhookRejectsBadSignature(t *testing.T) {
+	router, _, room := newWebhookTest(t)
+
+	event := &livekit.WebhookEvent{
+		Event: webhook.EventRoomStarted,
+		Id:    "EV_bad",
+		Room:  &livekit.Room{Name: room.Name},
+	}
+	if status := postWebhook(t, router, "another-secret-that-is-long-enough", event); status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/webhooks/livekit", bytes.NewReader([]byte(`{"event":"room_started"}`)))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestLiveKitWebhookReplaysAreIdempotent(t *testing.T) {
+	router, db, room := newWebhookTest(t)
+
+	subscription, err := events.GetBus().Subscribe(room.Name)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer subscription.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	participant := &livekit.ParticipantInfo{
+		Sid:      "PA_alice",
+		Identity: "alice",
+		Name:     "Alice",
+		Metadata: `{"user_id":"user-alice"}`,
+		JoinedAt: start.Add(time.Minute).Unix(),
+	}
+	guest := &livekit.ParticipantInfo{
+		Sid:      "PA_guest",
+		Identity: "guest-1",
+		Name:     "Guest",
+		JoinedAt: start.Add(2 * time.Minute).Unix(),
+	}
+	livekitRoom := &livekit.Room{Sid: "RM_test", Name: room.Name}
+
+	fixtures := []*livekit.WebhookEvent{
+		{Event: webhook.EventRoomStarted, Id: "EV_started", Room: livekitRoom, CreatedAt: start.Unix()},
+		{Event: webhook.EventParticipantJoined, Id: "EV_alice_joined", Room: livekitRoom, Participant: participant, CreatedAt: participant.JoinedAt},
+		{Event: webhook.EventParticipantJoined, Id: "EV_guest_joined", Room: livekitRoom, Participant: guest, CreatedAt: guest.JoinedAt},
+		{Event: webhook.EventParticipantLeft, Id: "EV_alice_left", Room: livekitRoom, Participant: participant, CreatedAt: start.Add(30 * time.Minute).Unix()},
+		{Event: webhook.EventRoomFinished, Id: "EV_finished", Room: livekitRoom, CreatedAt: start.Add(45 * time.Minute).Unix()},
+	}
+
+	// LiveKit retries deliveries, so every event arrives twice
+	for round := 0; round < 2; round++ {
+		for _, event := range fixtures {
+			if status := postWebhook(t, router, testAPISecret, event); status != http.StatusOK {
+				t.Fatalf("round %d: %s status = %d, want %d", round, event.Event, status, http.StatusOK)
+			}
+		}
+	}
+
+	var stored models.Room
+	if err := db.First(&stored, "id = ?", room.ID).Error; err != nil {
+		t.Fatalf("failed to load room: %v", err)
+	}
+	if stored.StartedAt == nil || !stored.StartedAt.Equal(start) {
+		t.Errorf("started_at = %v, want %v", stored.StartedAt, start)
+	}
+	if stored.EndedAt == nil || !stored.EndedAt.Equal(start.Add(45*time.Minute)) {
+		t.Errorf("ended_at = %v, want %v", stored.EndedAt, start.Add(45*time.Minute))
+	}
+
+	var participants []models.RoomParticipant
+	if err := db.Where("room_id = ?", room.ID).Order("joined_at").Find(&participants).Error; err != nil {
+		t.Fatalf("failed to load participants: %v", err)
+	}
+	if len(participants) != 2 {
+		t.Fatalf("got %d participants, want 2", len(participants))
+	}
+
+	alice := participants[0]
+	if alice.Identity != "alice" || alice.UserID == nil || *alice.UserID != "user-alice" || alice.IsGuest {
+		t.Errorf("alice = %+v, want signed-in user-alice", alice)
+	}
+	if alice.LeftAt == nil || !alice.LeftAt.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("alice left_at = %v, want %v", alice.LeftAt, start.Add(30*time.Minute))
+	}
+
+	// Still present when the room finished
+	if guest := participants[1]; !guest.IsGuest || guest.LeftAt == nil || !guest.LeftAt.Equal(start.Add(45*time.Minute)) {
+		t.Errorf("guest = %+v, want a guest that left when the room finished", guest)
+	}
+
+	counts := countEvents(subscription)
+	if counts[events.EventParticipantJoined] != 2 {
+		t.Errorf("got %d participant.joined events, want 2", counts[events.EventParticipantJoined])
+	}
+	// Alice leaving and the guest leaving when the room finished
+	if counts[events.EventParticipantLeft] != 2 {
+		t.Errorf("got %d participant.left events, want 2", counts[events.EventParticipantLeft])
+	}
+}
+
+func TestLiveKitWebhookIgnoresUnknownRoomsAndRecorder(t *testing.T) {
+	router, db, room := newWebhookTest(t)
+
+	fixtures := []*livekit.WebhookEvent{
+		{Event: webhook.EventRoomStarted, Id: "EV_unknown", Room: &livekit.Room{Name: "not-in-the-database"}},
+		{
+			Event:       webhook.EventParticipantJoined,
+			Id:          "EV_recorder",
+			Room:        &livekit.Room{Name: room.Name},
+			Participant: &livekit.ParticipantInfo{Identity: services.ChatRecorderIdentity},
+		},
+		{
+			Event:       webhook.EventParticipantJoined,
+			Id:          "EV_egress",
+			Room:        &livekit.Room{Name: room.Name},
+			Participant: &livekit.ParticipantInfo{Identity: "EG_recording", Kind: livekit.ParticipantInfo_EGRESS},
+		},
+	}
+	for _, event := range fixtures {
+		if status := postWebhook(t, router, testAPISecret, event); status != http.StatusOK {
+			t.Errorf("%s status = %d, want %d", event.Id, status, http.StatusOK)
+		}
+	}
+
+	var count int64
+	db.Model(&models.RoomParticipant{}).Count(&count)
+	if count != 0 {
+		t.Errorf("got %d participants, want none", count)
+	}
+}
+
+func TestLiveKitWebhookStartsOneChatRecorderPerRoom(t *testing.T) {
+	chatRecorder := newFakeChatRecorder()
+	chatRecorder.release = make(chan struct{})
+	router, _, room := newWebhookTestWithRecorder(t, chatRecorder)
+
+	livekitRoom := &livekit.Room{Name: room.Name}
+	post := func(event *livekit.WebhookEvent) {
+		t.Helper()
+		if status := postWebhook(t, router, testAPISecret, event); status != http.StatusOK {
+			t.Fatalf("%s status = %d, want %d", event.Id, status, http.StatusOK)
+		}
+	}
+	joined := func(id, identity string) *livekit.WebhookEvent {
+		return &livekit.WebhookEvent{Event: webhook.EventParticipantJoined, Id: id, Room: livekitRoom, Participant: &livekit.ParticipantInfo{Identity: identity}}
+	}
+
+	// Everyone joining while the recorder is still joining the call
+	post(&livekit.WebhookEvent{Event: webhook.EventRoomStarted, Id: "EV_started", Room: livekitRoom})
+	post(joined("EV_alice", "alice"))
+	post(joined("EV_bob", "bob"))
+	close(chatRecorder.release)
+	<-chatRecorder.started
+
+	select {
+	case <-chatRecorder.started:
+		t.Error("the chat recorder joined the call more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
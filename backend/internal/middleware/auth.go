@@ -1,16 +1,20 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"meet-backend/internal/auth"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AuthRequired middleware validates JWT tokens
-func AuthRequired(authService *auth.AuthService) gin.HandlerFunc {
+func AuthRequired(authService *auth.AuthService, policy *permissions.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -19,61 +23,52 @@ func AuthRequired(authService *auth.AuthService) gin.HandlerFunc {
 			return
 		}
 
-		// Extract token from "Bearer <token>"
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		if !authenticate(c, authService, policy, authHeader) {
 			c.Abort()
 			return
 		}
 
-		// Validate token
-		claims, err := authService.ValidateToken(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
-
-		// Store user claims in context
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
-		c.Set("user_name", claims.Name)
-		c.Set("user_username", claims.Username)
-		c.Set("user_groups", claims.Groups)
-
 		c.Next()
 	}
 }
 
-// AdminRequired middleware checks if user has admin privileges
-func AdminRequired() gin.HandlerFunc {
+// OptionalAuth middleware validates a JWT token when one is sent, so public
+// routes can treat signed-in users differently from guests
+func OptionalAuth(authService *auth.AuthService, policy *permissions.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		groups, exists := c.Get("user_groups")
-		if !exists {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User groups not found"})
+		authHeader := c.GetHeader("Authorization")
+		if authHeader != "" && !authenticate(c, authService, policy, authHeader) {
 			c.Abort()
 			return
 		}
 
-		userGroups, ok := groups.([]string)
-		if !ok {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid user groups"})
-			c.Abort()
-			return
-		}
+		c.Next()
+	}
+}
 
-		// Check if user has admin group
-		hasAdminAccess := false
-		for _, group := range userGroups {
-			if group == "admin" || group == "meet-admin" {
-				hasAdminAccess = true
-				break
+// TokenFromQuery lets clients that can't set headers, like EventSource and
+// browser WebSockets, send the access token as ?access_token=. The token is
+// removed from the URL so it doesn't end up in the request log.
+func TokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if token := query.Get("access_token"); token != "" {
+			if c.GetHeader("Authorization") == "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
 			}
+			query.Del("access_token")
+			c.Request.URL.RawQuery = query.Encode()
 		}
 
-		if !hasAdminAccess {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		c.Next()
+	}
+}
+
+// RequirePermission middleware checks if the user has a permission
+func RequirePermission(perm permissions.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission required: " + string(perm)})
 			c.Abort()
 			return
 		}
@@ -81,3 +76,53 @@ func AdminRequired() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// HasPermission checks if the authenticated user has a permission
+func HasPermission(c *gin.Context, perm permissions.Permission) bool {
+	value, exists := c.Get("user_permissions")
+	if !exists {
+		return false
+	}
+
+	set, ok := value.(permissions.Set)
+	return ok && set.Has(perm)
+}
+
+// authenticate validates the bearer token and stores the user in the context,
+// writing an error response if it is not valid
+func authenticate(c *gin.Context, authService *auth.AuthService, policy *permissions.Policy, authHeader string) bool {
+	// Extract token from "Bearer <token>"
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		return false
+	}
+
+	// Validate token
+	claims, err := authService.ValidateToken(tokenString)
+	if err != nil {
+		if errors.Is(err, services.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is disabled"})
+			return false
+		}
+		if errors.Is(err, auth.ErrValidationUnavailable) {
+			log.Printf("Token validation failed: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication temporarily unavailable"})
+			return false
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return false
+	}
+
+	// Store user claims in context
+	c.Set("user_id", claims.UserID)
+	c.Set("user_email", claims.Email)
+	c.Set("user_name", claims.Name)
+	c.Set("user_username", claims.Username)
+	c.Set("user_groups", claims.Groups)
+	c.Set("user_roles", policy.Roles(claims.Groups))
+	c.Set("user_permissions", policy.Resolve(claims.Groups))
+	c.Set("session_id", claims.SessionID)
+
+	return true
+}
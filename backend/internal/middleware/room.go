@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRoomRole middleware checks if the user has one of the roles in the
+// room from the :roomName parameter. Users with the global moderate
+// permission may manage every room.
+func RequireRoomRole(roles ...string) gin.HandlerFunc {
+	roomService := services.NewRoomService()
+	memberService := services.NewRoomMemberService()
+
+	return func(c *gin.Context) {
+		if HasPermission(c, permissions.Moderate) {
+			c.Next()
+			return
+		}
+
+		room, err := roomService.GetRoom(c.Param("roomName"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		member, err := memberService.GetMember(room.ID, c.GetString("user_id"))
+		if err != nil && !errors.Is(err, services.ErrRoomMemberNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if member != nil {
+			for _, role := range roles {
+				if member.Role == role {
+					c.Set("room_role", member.Role)
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Room role required: " + strings.Join(roles, " or ")})
+		c.Abort()
+	}
+}
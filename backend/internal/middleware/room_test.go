@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+	"meet-backend/internal/permissions"
+	"meet-backend/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireRoomRole(t *testing.T) {
+	db := testdb.Open(t, &models.Room{}, &models.RoomMember{})
+	database.DB = db
+
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	if err := db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	db.Create(&models.RoomMember{RoomID: room.ID, UserID: "owner", Role: models.RoomRoleOwner})
+	db.Create(&models.RoomMember{RoomID: room.ID, UserID: "carol", Role: models.RoomRoleModerator})
+	db.Create(&models.RoomMember{RoomID: room.ID, UserID: "alice", Role: models.RoomRoleMember})
+
+	closed := models.CreateAuthenticatedRoom("klm-nopq-rst", "owner")
+	closed.IsActive = false
+	db.Create(closed)
+	db.Model(closed).Update("is_active", false)
+
+	managers := RequireRoomRole(models.RoomRoleOwner, models.RoomRoleModerator)
+	owner := RequireRoomRole(models.RoomRoleOwner)
+
+	tests := []struct {
+		name        string
+		middleware  gin.HandlerFunc
+		roomName    string
+		userID      string
+		permissions permissions.Set
+		want        int
+		roomRole    string
+	}{
+		{"owner managing", managers, room.Name, "owner", permissions.Set{}, http.StatusOK, models.RoomRoleOwner},
+		{"moderator managing", managers, room.Name, "carol", permissions.Set{}, http.StatusOK, models.RoomRoleModerator},
+		{"member managing", managers, room.Name, "alice", permissions.Set{}, http.StatusForbidden, ""},
+		{"stranger managing", managers, room.Name, "dave", permissions.Set{}, http.StatusForbidden, ""},
+		{"owner only, as owner", owner, room.Name, "owner", permissions.Set{}, http.StatusOK, models.RoomRoleOwner},
+		{"owner only, as moderator", owner, room.Name, "carol", permissions.Set{}, http.StatusForbidden, ""},
+		{"unknown room", managers, "xyz-abcd-efg", "owner", permissions.Set{}, http.StatusNotFound, ""},
+		{"inactive room", managers, closed.Name, "owner", permissions.Set{}, http.StatusNotFound, ""},
+		// Global moderators manage every room without a role in it
+		{"global moderator", owner, room.Name, "moderator", permissions.Set{permissions.Moderate: true}, http.StatusOK, ""},
+		{"global moderator, unknown room", owner, "xyz-abcd-efg", "moderator", permissions.Set{permissions.Moderate: true}, http.StatusOK, ""},
+		{"admin", owner, room.Name, "admin", permissions.Set{permissions.Admin: true}, http.StatusOK, ""},
+		{"recorder", managers, room.Name, "dave", permissions.Set{permissions.Record: true}, http.StatusForbidden, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			var roomRole string
+			router.GET("/rooms/:roomName", func(c *gin.Context) {
+				c.Set("user_id", test.userID)
+				c.Set("user_permissions", test.permissions)
+			}, test.middleware, func(c *gin.Context) {
+				roomRole = c.GetString("room_role")
+				c.Status(http.StatusOK)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/rooms/"+test.roomName, nil))
+
+			if recorder.Code != test.want {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.want, recorder.Body.String())
+			}
+			if roomRole != test.roomRole {
+				t.Errorf("room_role = %q, want %q", roomRole, test.roomRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Ban keeps someone out of a room, or out of every room when RoomID is nil.
+// A ban matches on any of the user ID, identity and IP address it has.
+type Ban struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RoomID    *uuid.UUID `json:"room_id,omitempty" gorm:"type:uuid;index"` // nil for org-wide bans
+	UserID    string     `json:"user_id,omitempty" gorm:"index"`
+	Identity  string     `json:"identity,omitempty"`
+	IPAddress string     `json:"-" gorm:"index"` // only applies to guests
+	IPBanned  bool       `json:"ip_banned" gorm:"-"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedBy string     `json:"created_by" gorm:"not null"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil for permanent bans
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AfterFind shows that a ban covers an IP address without revealing it
+func (b *Ban) AfterFind(tx *gorm.DB) error {
+	b.IPBanned = b.IPAddress != ""
+	return nil
+}
+
+// BanRequest creates a ban. Room bans take a user ID or the identity of a
+// participant; banning a guest's identity bans their IP address too.
+type BanRequest struct {
+	UserID           string `json:"user_id"`
+	Identity         string `json:"identity"`
+	IPAddress        string `json:"ip_address"` // org-wide bans only
+	Reason           string `json:"reason"`
+	ExpiresInMinutes int    `json:"expires_in_minutes"` // 0 for a permanent ban
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Breakout assignment modes
+const (
+	BreakoutAssignAuto   = "auto"   // participants are spread over the breakouts
+	BreakoutAssignManual = "manual" // hosts assign participants themselves
+)
+
+// BreakoutAssignment puts a participant of a room in one of its breakout rooms
+type BreakoutAssignment struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ParentID  uuid.UUID `json:"parent_id" gorm:"type:uuid;not null;index"`
+	RoomID    uuid.UUID `json:"room_id" gorm:"type:uuid;not null;uniqueIndex:idx_breakout_assignment"`
+	Identity  string    `json:"identity" gorm:"not null;uniqueIndex:idx_breakout_assignment"`
+	UserID    *string   `json:"user_id,omitempty"` // nil for guests
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpenBreakoutsRequest opens breakout rooms for a room
+type OpenBreakoutsRequest struct {
+	Count           int            `json:"count" binding:"required,min=1,max=50"`
+	DurationMinutes int            `json:"duration_minutes" binding:"omitempty,min=1"` // runs until closed when left out
+	Assignment      string         `json:"assignment"`                                 // auto (default) or manual
+	Assignments     map[string]int `json:"assignments"`                                // identity to breakout number, for manual assignment
+}
+
+// BreakoutAssignmentsRequest moves participants between the main room and
+// its breakouts; breakout number 0 is the main room
+type BreakoutAssignmentsRequest struct {
+	Assignments map[string]int `json:"assignments" binding:"required"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// CalendarFeed is a user's secret calendar subscription URL. Only the
+// SHA-256 hash of the token is stored.
+type CalendarFeed struct {
+	UserID    string `gorm:"primaryKey"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time
+}
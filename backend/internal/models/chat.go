@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Chat message sources
+const (
+	ChatSourceAPI     = "api"     // posted through the REST API
+	ChatSourceLiveKit = "livekit" // recorded from the chat of a call
+)
+
+// ChatMessage is a message in the chat of a room. Deleted messages keep
+// their place in the history without their content.
+type ChatMessage struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RoomID         uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;index:idx_chat_messages_room_created,priority:1;uniqueIndex:idx_chat_messages_client,priority:1"`
+	ClientID       *string    `json:"client_id,omitempty" gorm:"uniqueIndex:idx_chat_messages_client,priority:2"` // message ID in the LiveKit chat
+	SenderIdentity string     `json:"sender_identity" gorm:"not null"`
+	SenderName     string     `json:"sender_name"`
+	SenderUserID   *string    `json:"sender_user_id,omitempty"` // nil for guests
+	Content        string     `json:"content" gorm:"type:text;not null"`
+	ReplyToID      *uuid.UUID `json:"reply_to_id,omitempty" gorm:"type:uuid"`
+	Source         string     `json:"source" gorm:"not null"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"index:idx_chat_messages_room_created,priority:2"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy      *string    `json:"deleted_by,omitempty"`
+}
+
+// IsDeleted checks if the message was deleted
+func (m *ChatMessage) IsDeleted() bool {
+	return m.DeletedAt != nil
+}
+
+// SendChatMessageRequest posts a message to the chat of a room
+type SendChatMessageRequest struct {
+	Content   string     `json:"content" binding:"required,max=4000"`
+	ReplyToID *uuid.UUID `json:"reply_to_id"`
+}
+
+// UpdateChatMessageRequest edits a chat message
+type UpdateChatMessageRequest struct {
+	Content string `json:"content" binding:"required,max=4000"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Invite is a shareable link into a room. The link is a JWT signed with the
+// invite's own secret, so it keeps working across key rotations and can be
+// revoked on its own.
+type Invite struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RoomID    uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;index"`
+	Role      string     `json:"role" gorm:"not null"` // room role granted by the invite: member or moderator
+	Secret    string     `json:"-" gorm:"not null"`    // HMAC key of the invite's token
+	CreatedBy string     `json:"created_by" gorm:"not null"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	MaxUses   int        `json:"max_uses"` // 0 for unlimited
+	Uses      int        `json:"uses" gorm:"default:0"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// BeforeCreate sets default values
+func (i *Invite) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsUsable checks if the invite can still be redeemed
+func (i *Invite) IsUsable() bool {
+	return i.RevokedAt == nil && time.Now().Before(i.ExpiresAt) && (i.MaxUses == 0 || i.Uses < i.MaxUses)
+}
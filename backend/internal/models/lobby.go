@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Lobby entry states
+const (
+	LobbyStatusPending  = "pending"
+	LobbyStatusAdmitted = "admitted"
+	LobbyStatusDenied   = "denied"
+)
+
+// LobbyEntry is someone waiting in the lobby of a room for a host to admit them
+type LobbyEntry struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RoomID     uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;uniqueIndex:idx_lobby_entries_room_identity"`
+	Identity   string     `json:"identity" gorm:"not null;uniqueIndex:idx_lobby_entries_room_identity"`
+	Name       string     `json:"name" gorm:"not null"`
+	UserID     *string    `json:"user_id,omitempty"` // nil for guests
+	SecretHash string     `json:"-" gorm:"not null"` // hash of the secret the waiting client polls with
+	Status     string     `json:"status" gorm:"not null;index"`
+	DecidedBy  *string    `json:"decided_by,omitempty"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+	IPAddress  string     `json:"-"`                    // of guests, to refuse denied guests knocking again
+	ClaimedAt  *time.Time `json:"claimed_at,omitempty"` // when the admitted client collected its LiveKit token
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BeforeCreate sets default values
+func (le *LobbyEntry) BeforeCreate(tx *gorm.DB) error {
+	if le.ID == uuid.Nil {
+		le.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsPending checks if the entry is still waiting for a host
+func (le *LobbyEntry) IsPending() bool {
+	return le.Status == LobbyStatusPending
+}
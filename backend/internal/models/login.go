@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// LoginAttempt is an OAuth2 login in progress, keyed by its state parameter
+type LoginAttempt struct {
+	State        string    `gorm:"primaryKey"`
+	CodeVerifier string    `gorm:"not null"` // PKCE verifier for the authorization code exchange
+	Nonce        string    `gorm:"not null"`
+	ReturnTo     string    // validated location to send the user after login
+	ExpiresAt    time.Time `gorm:"index;not null"`
+	CreatedAt    time.Time
+}
+
+// LoginCode is a one-time code the SPA exchanges for the tokens of a finished login
+type LoginCode struct {
+	CodeHash  string    `gorm:"primaryKey"`         // SHA-256 of the code, the code itself is never stored
+	Response  string    `gorm:"type:text;not null"` // JSON encoded AuthResponse, encrypted with DB_ENCRYPTION_KEY when set
+	ExpiresAt time.Time `gorm:"index;not null"`
+	CreatedAt time.Time
+}
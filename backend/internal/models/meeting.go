@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Meeting is a meeting booked for later, optionally repeating. Its room is
+// only created when the first join window opens and is reused by every
+// occurrence.
+type Meeting struct {
+	ID               uuid.UUID   `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Title            string      `json:"title" gorm:"not null"`
+	Description      string      `json:"description"`
+	OrganizerID      string      `json:"organizer_id" gorm:"index;not null"`
+	StartsAt         time.Time   `json:"starts_at"`                                       // start of the first occurrence
+	EndsAt           time.Time   `json:"ends_at"`                                         // end of the first occurrence
+	Timezone         string      `json:"timezone" gorm:"not null"`                        // IANA zone the recurrence is expanded in
+	Recurrence       string      `json:"recurrence,omitempty"`                            // RFC 5545 RRULE, empty for a single meeting
+	ExcludedDates    []time.Time `json:"excluded_dates,omitempty" gorm:"serializer:json"` // RFC 5545 EXDATE, starts of skipped occurrences
+	EarlyJoinMinutes int         `json:"early_join_minutes"`                              // how long before the start joining is allowed
+	RoomName         string      `json:"room_name" gorm:"uniqueIndex;not null"`
+	Invitees         []string    `json:"invitees" gorm:"serializer:json"` // email addresses invited by the organizer
+	Sequence         int         `json:"sequence" gorm:"default:0"`       // revision, raised on every change so calendars pick it up
+	CancelledAt      *time.Time  `json:"cancelled_at,omitempty"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+}
+
+// MeetingOccurrence is a single start and end of a meeting
+type MeetingOccurrence struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// BeforeCreate sets default values
+func (m *Meeting) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// Duration returns the length of every occurrence
+func (m *Meeting) Duration() time.Duration {
+	return m.EndsAt.Sub(m.StartsAt)
+}
+
+// IsCancelled checks if the meeting was cancelled
+func (m *Meeting) IsCancelled() bool {
+	return m.CancelledAt != nil
+}
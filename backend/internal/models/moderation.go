@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Moderation actions
+const (
+	ModerationMute              = "mute"
+	ModerationUnmute            = "unmute"
+	ModerationMuteAll           = "mute_all"
+	ModerationUpdatePermissions = "update_permissions"
+	ModerationUpdateMetadata    = "update_metadata"
+	ModerationRemove            = "remove"
+	ModerationMove              = "move"
+	ModerationBan               = "ban"
+	ModerationUnban             = "unban"
+	ModerationOpenBreakouts     = "open_breakouts"
+	ModerationAssignBreakouts   = "assign_breakouts"
+	ModerationCloseBreakouts    = "close_breakouts"
+)
+
+// ModerationAction is an entry in the audit log of a room. Failed actions are
+// logged too, with the error LiveKit returned.
+type ModerationAction struct {
+	ID             uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RoomID         uuid.UUID              `json:"room_id" gorm:"type:uuid;not null;index"`
+	RoomName       string                 `json:"room_name" gorm:"not null"`
+	ActorID        string                 `json:"actor_id" gorm:"not null"`
+	Action         string                 `json:"action" gorm:"not null"`
+	TargetIdentity string                 `json:"target_identity,omitempty"` // empty for actions on the whole room
+	Details        map[string]interface{} `json:"details,omitempty" gorm:"serializer:json"`
+	Error          string                 `json:"error,omitempty"`
+	CreatedAt      time.Time              `json:"created_at" gorm:"index"`
+}
+
+// MuteParticipantRequest selects the tracks to mute: one track, or every
+// track of a kind
+type MuteParticipantRequest struct {
+	TrackSID string `json:"track_sid"`
+	Kind     string `json:"kind"`  // audio (default), video or all; ignored with track_sid
+	Muted    *bool  `json:"muted"` // defaults to true
+}
+
+// MuteAllRequest selects the tracks muted for everyone in a room
+type MuteAllRequest struct {
+	Kind string `json:"kind"` // audio (default), video or all
+}
+
+// ParticipantPermissionsRequest changes what a participant may do. Fields
+// left out keep their current value.
+type ParticipantPermissionsRequest struct {
+	CanPublish        *bool     `json:"can_publish"`
+	CanSubscribe      *bool     `json:"can_subscribe"`
+	CanPublishData    *bool     `json:"can_publish_data"`
+	CanPublishSources *[]string `json:"can_publish_sources"` // camera, microphone, screen_share, screen_share_audio
+}
+
+// ParticipantMetadataRequest merges keys into the metadata of a participant;
+// keys set to null are removed
+type ParticipantMetadataRequest struct {
+	Metadata map[string]interface{} `json:"metadata"`
+	Name     *string                `json:"name"`
+}
+
+// MoveParticipantRequest names the room a participant is moved to
+type MoveParticipantRequest struct {
+	Room string `json:"room" binding:"required"`
+}
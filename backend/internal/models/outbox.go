@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxEmail is an email waiting to be sent. Each row has one recipient so
+// a failing address doesn't hold up the others.
+type OutboxEmail struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Recipient     string    `gorm:"not null"`
+	Subject       string    `gorm:"not null"`
+	Text          string
+	HTML          string
+	Attachments   []EmailAttachment `gorm:"serializer:json"`
+	Attempts      int               `gorm:"default:0"`
+	NextAttemptAt time.Time         `gorm:"index"`
+	LastError     string
+	SentAt        *time.Time
+	FailedAt      *time.Time // set when the email was given up on
+	CreatedAt     time.Time
+}
+
+// EmailAttachment is a file attached to an email
+type EmailAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// BeforeCreate sets default values
+func (e *OutboxEmail) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PasscodeAttempt tracks passcode attempts for a room from one IP address
+type PasscodeAttempt struct {
+	RoomID         uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	IPAddress      string     `gorm:"primaryKey"`
+	WindowStart    time.Time  // start of the current rate limit window
+	WindowAttempts int        // attempts within the current window
+	Failures       int        // consecutive wrong passcodes
+	LockedUntil    *time.Time // set after too many wrong passcodes
+	UpdatedAt      time.Time  `gorm:"index"`
+}
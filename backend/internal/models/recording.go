@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Recording status values, mirroring the LiveKit egress lifecycle
+const (
+	RecordingStatusStarting = "starting"
+	RecordingStatusActive   = "active"
+	RecordingStatusEnding   = "ending"
+	RecordingStatusComplete = "complete"
+	RecordingStatusFailed   = "failed"
+	RecordingStatusAborted  = "aborted"
+)
+
+// Recording output types
+const (
+	RecordingOutputFile   = "file"
+	RecordingOutputHLS    = "hls"
+	RecordingOutputStream = "stream"
+)
+
+// Recording is the audit record of a single egress started for a room
+type Recording struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RoomID      *uuid.UUID     `json:"room_id,omitempty" gorm:"type:uuid;index"` // nil if the room has no database record
+	RoomName    string         `json:"room_name" gorm:"index;not null"`
+	EgressID    string         `json:"egress_id" gorm:"uniqueIndex;not null"`
+	RequestedBy string         `json:"requested_by" gorm:"not null"`
+	StoppedBy   *string        `json:"stopped_by,omitempty"`
+	Status      string         `json:"status" gorm:"index;not null"`
+	OutputType  string         `json:"output_type" gorm:"default:file"`
+	FilePath    string         `json:"file_path"`
+	Size        int64          `json:"size"`     // in bytes
+	Duration    int64          `json:"duration"` // in seconds
+	Error       string         `json:"error,omitempty"`
+	StartedAt   *time.Time     `json:"started_at,omitempty"`
+	EndedAt     *time.Time     `json:"ended_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// BeforeCreate sets default values
+func (r *Recording) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsFinished reports whether the recording has reached a final status
+func (r *Recording) IsFinished() bool {
+	switch r.Status {
+	case RecordingStatusComplete, RecordingStatusFailed, RecordingStatusAborted:
+		return true
+	}
+	return false
+}
+
+// StartRecordingRequest selects the output and encoding of a new recording.
+// All fields are optional; the server configuration provides the defaults.
+type StartRecordingRequest struct {
+	Output     string   `json:"output"` // file (default), hls or stream
+	Layout     string   `json:"layout"`
+	Preset     string   `json:"preset"` // LiveKit encoding preset, e.g. H264_1080P_30
+	AudioOnly  bool     `json:"audio_only"`
+	StreamURLs []string `json:"stream_urls"` // RTMP/SRT targets for the stream output
+}
+
+// OutputType returns the requested output, defaulting to a file recording
+func (r *StartRecordingRequest) OutputType() string {
+	if r.Output == "" {
+		return RecordingOutputFile
+	}
+	return r.Output
+}
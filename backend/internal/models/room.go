@@ -9,14 +9,20 @@ import (
 
 // Room represents a meeting room with time limits
 type Room struct {
-	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Name        string         `json:"name" gorm:"uniqueIndex;not null"`
-	CreatedBy   *string        `json:"created_by,omitempty"` // nil for guest users
-	CreatedAt   time.Time      `json:"created_at"`
-	ExpiresAt   *time.Time     `json:"expires_at,omitempty"` // nil for authenticated users (no limit)
-	IsActive    bool           `json:"is_active" gorm:"default:true"`
-	MaxDuration *int           `json:"max_duration,omitempty"` // in minutes, nil for unlimited
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name           string         `json:"name" gorm:"uniqueIndex;not null"`
+	CreatedBy      *string        `json:"created_by,omitempty"` // nil for guest users
+	CreatedAt      time.Time      `json:"created_at"`
+	ExpiresAt      *time.Time     `json:"expires_at,omitempty"` // nil for authenticated users (no limit)
+	IsActive       bool           `json:"is_active" gorm:"default:true"`
+	MaxDuration    *int           `json:"max_duration,omitempty"`                     // in minutes, nil for unlimited
+	LobbyEnabled   bool           `json:"lobby_enabled" gorm:"default:false"`         // joiners wait for a host to admit them
+	PasscodeHash   string         `json:"-"`                                          // argon2id hash, empty for open rooms
+	StartedAt      *time.Time     `json:"started_at,omitempty"`                       // set by LiveKit room_started webhook
+	EndedAt        *time.Time     `json:"ended_at,omitempty"`                         // set by LiveKit room_finished webhook
+	ParentID       *uuid.UUID     `json:"parent_id,omitempty" gorm:"type:uuid;index"` // set for breakout rooms
+	BreakoutNumber int            `json:"breakout_number,omitempty"`                  // 1, 2, ... within the parent
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 // RoomParticipant tracks who joined a room
@@ -30,6 +36,7 @@ type RoomParticipant struct {
 	JoinedAt     time.Time      `json:"joined_at"`
 	LeftAt       *time.Time     `json:"left_at,omitempty"`
 	IsGuest      bool           `json:"is_guest" gorm:"default:false"`
+	IPAddress    string         `json:"-"` // guests only, for IP bans
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
@@ -48,6 +55,11 @@ func (rp *RoomParticipant) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// HasPasscode checks if joining the room requires a passcode
+func (r *Room) HasPasscode() bool {
+	return r.PasscodeHash != ""
+}
+
 // IsExpired checks if the room has expired
 func (r *Room) IsExpired() bool {
 	if r.ExpiresAt == nil {
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Roles a user can have within a single room
+const (
+	RoomRoleOwner     = "owner"
+	RoomRoleModerator = "moderator"
+	RoomRoleMember    = "member"
+)
+
+// RoomMember records the role of a signed-in user in a room
+type RoomMember struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RoomID    uuid.UUID `json:"room_id" gorm:"type:uuid;not null;uniqueIndex:idx_room_members_room_user"`
+	UserID    string    `json:"user_id" gorm:"not null;uniqueIndex:idx_room_members_room_user;index"`
+	Role      string    `json:"role" gorm:"not null"`
+	GrantedBy *string   `json:"granted_by,omitempty"` // nil for the owner and for members who joined
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate sets default values
+func (rm *RoomMember) BeforeCreate(tx *gorm.DB) error {
+	if rm.ID == uuid.Nil {
+		rm.ID = uuid.New()
+	}
+	return nil
+}
+
+// CanManageRoom checks if the role may change the room and its participants
+func (rm *RoomMember) CanManageRoom() bool {
+	return rm.Role == RoomRoleOwner || rm.Role == RoomRoleModerator
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoomPolicy overrides the default LiveKit grants for a room.
+// A nil field means the server default applies.
+type RoomPolicy struct {
+	RoomID                uuid.UUID `json:"room_id" gorm:"type:uuid;primaryKey"`
+	MembersCanPublish     *bool     `json:"members_can_publish"`
+	MembersCanScreenShare *bool     `json:"members_can_screen_share"`
+	GuestsCanPublish      *bool     `json:"guests_can_publish"`
+	GuestsCanScreenShare  *bool     `json:"guests_can_screen_share"`
+	ChatEnabled           *bool     `json:"chat_enabled"` // publishing data for everyone except moderators
+	UpdatedBy             string    `json:"updated_by"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session is a signed-in device. Each session is one refresh token family:
+// its refresh token is rotated on every use and reusing an old one revokes
+// the whole session.
+type Session struct {
+	ID                   uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID               string     `json:"user_id" gorm:"index;not null"`
+	UserAgent            string     `json:"user_agent"`
+	IPAddress            string     `json:"ip_address"`
+	UpstreamRefreshToken string     `json:"-"` // refresh token from the identity provider, never sent to the browser
+	CreatedAt            time.Time  `json:"created_at"`
+	LastUsedAt           time.Time  `json:"last_used_at"`
+	ExpiresAt            time.Time  `json:"expires_at"`
+	RevokedAt            *time.Time `json:"revoked_at,omitempty"`
+}
+
+// RefreshToken is one generation of a session's opaque refresh token.
+// Only the SHA-256 hash is stored.
+type RefreshToken struct {
+	TokenHash string    `gorm:"primaryKey"`
+	SessionID uuid.UUID `gorm:"type:uuid;index;not null"`
+	CreatedAt time.Time
+	UsedAt    *time.Time // set when the token was rotated; using it again is reuse
+}
+
+// BeforeCreate sets default values
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive checks if the session can still be used
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SigningKey is a key used to sign the backend's own JWTs.
+// The newest key without RetiredAt signs new tokens; retired keys keep
+// verifying tokens until those have expired.
+type SigningKey struct {
+	ID         string     `json:"kid" gorm:"primaryKey"`
+	Algorithm  string     `json:"alg" gorm:"not null"`
+	PrivateKey string     `json:"-" gorm:"not null"` // PEM for RS256/EdDSA, base64 secret for HS256; encrypted with DB_ENCRYPTION_KEY
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"`
+}
@@ -2,24 +2,28 @@ package models
 
 import "time"
 
-// User represents a user from the SSO system
+// User represents a user from the SSO system, stored on every login
 type User struct {
-	ID       string   `json:"id"`
-	Email    string   `json:"email"`
-	Name     string   `json:"name"`
-	Username string   `json:"username"`
-	Groups   []string `json:"groups"`
+	ID           string    `json:"id" gorm:"primaryKey"` // subject from the identity provider
+	Email        string    `json:"email" gorm:"index"`
+	Name         string    `json:"name"`
+	Username     string    `json:"username" gorm:"index"`
+	Groups       []string  `json:"groups" gorm:"serializer:json"`
+	FirstLoginAt time.Time `json:"first_login_at"`
+	LastLoginAt  time.Time `json:"last_login_at"`
+	Disabled     bool      `json:"disabled" gorm:"default:false"`
 }
 
 // TokenClaims represents JWT token claims
 type TokenClaims struct {
-	UserID   string   `json:"user_id"`
-	Email    string   `json:"email"`
-	Name     string   `json:"name"`
-	Username string   `json:"username"`
-	Groups   []string `json:"groups"`
-	Exp      int64    `json:"exp"`
-	Iat      int64    `json:"iat"`
+	UserID    string   `json:"user_id"`
+	Email     string   `json:"email"`
+	Name      string   `json:"name"`
+	Username  string   `json:"username"`
+	Groups    []string `json:"groups"`
+	SessionID string   `json:"sid"`
+	Exp       int64    `json:"exp"`
+	Iat       int64    `json:"iat"`
 }
 
 // AuthResponse represents the response after successful authentication
@@ -30,12 +34,10 @@ type AuthResponse struct {
 	User         User      `json:"user"`
 }
 
-// RoomTokenRequest represents a request for a room token
+// RoomTokenRequest represents a request for a room token. Identity and
+// grants are decided by the server.
 type RoomTokenRequest struct {
-	RoomName     string `json:"room_name" binding:"required"`
-	Identity     string `json:"identity"`
-	Name         string `json:"name"`
-	CanPublish   bool   `json:"can_publish"`
-	CanSubscribe bool   `json:"can_subscribe"`
-	CanRecord    bool   `json:"can_record"`
+	Name     string `json:"name"`     // display name, defaults to the user's name
+	Hidden   bool   `json:"hidden"`   // join invisibly, only for moderators
+	Passcode string `json:"passcode"` // required for protected rooms
 }
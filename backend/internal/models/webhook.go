@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebhookSubscription sends room and participant events to a URL. Events
+// are signed with the secret so receivers can verify where they came from.
+type WebhookSubscription struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      string    `json:"user_id" gorm:"not null;index"`
+	URL         string    `json:"url" gorm:"not null"`
+	Secret      string    `json:"-" gorm:"not null"`
+	Events      []string  `json:"events" gorm:"serializer:json"`  // empty for all events
+	AllRooms    bool      `json:"all_rooms" gorm:"default:false"` // admins only; otherwise rooms the user manages
+	Active      bool      `json:"active" gorm:"default:true"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is a single event sent, or waiting to be sent, to a subscription
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	SubscriptionID uuid.UUID  `json:"subscription_id" gorm:"type:uuid;not null;index"`
+	EventID        uuid.UUID  `json:"event_id" gorm:"type:uuid;not null"`
+	EventType      string     `json:"event_type" gorm:"not null"`
+	Payload        []byte     `json:"-" gorm:"not null"`
+	RedeliveryOf   *uuid.UUID `json:"redelivery_of,omitempty" gorm:"type:uuid"`
+	Attempts       int        `json:"attempts" gorm:"default:0"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index"`
+	StatusCode     int        `json:"status_code,omitempty"` // HTTP status of the last attempt
+	LastError      string     `json:"last_error,omitempty"`
+	Duration       int64      `json:"duration_ms,omitempty"` // of the last attempt
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	FailedAt       *time.Time `json:"failed_at,omitempty"` // set when the delivery was given up on
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// BeforeCreate sets default values
+func (s *WebhookSubscription) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets default values
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// Wants checks if the subscription is interested in an event type
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, event := range s.Events {
+		if event == eventType || event == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+// Package notifications sends email through a pluggable Mailer. Emails are
+// queued in a database outbox first, so sends are retried and survive restarts.
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is an email to one or more recipients
+type Message struct {
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer sends messages
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewMailerFromEnv returns an SMTP mailer configured by SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM and SMTP_TLS, or a mailer that only
+// logs messages when SMTP_HOST is not set
+func NewMailerFromEnv() (Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("SMTP_HOST not set, emails are written to the log instead of sent")
+		return &LogMailer{}, nil
+	}
+
+	from, err := mail.ParseAddress(os.Getenv("SMTP_FROM"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+
+	port := 587
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		port, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
+		}
+	}
+
+	// STARTTLS by default, implicit TLS on the submissions port
+	security := strings.ToLower(os.Getenv("SMTP_TLS"))
+	if security == "" {
+		security = SecurityStartTLS
+		if port == 465 {
+			security = SecurityTLS
+		}
+	}
+	switch security {
+	case SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("invalid SMTP_TLS %q, expected starttls, tls or none", security)
+	}
+
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+		security: security,
+		timeout:  30 * time.Second,
+	}, nil
+}
+
+// LogMailer writes messages to the log; it stands in for SMTP during development
+type LogMailer struct{}
+
+// Send logs the message
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.Printf("Email to %s: %s\n%s", strings.Join(msg.To, ", "), msg.Subject, msg.Text)
+	return nil
+}
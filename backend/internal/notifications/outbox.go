@@ -0,0 +1,209 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxSendAttempts is how often an email is tried before it is given up on
+	maxSendAttempts = 8
+	// sendLease keeps other replicas from picking up an email that is being sent
+	sendLease = 5 * time.Minute
+	// outboxBatchSize is the number of emails sent per run
+	outboxBatchSize = 20
+	// outboxRetention is how long sent and failed emails are kept
+	outboxRetention = 30 * 24 * time.Hour
+)
+
+// Outbox queues emails in the database and sends them in the background.
+// Failed sends are retried with exponential backoff.
+type Outbox struct {
+	db     *gorm.DB
+	mailer Mailer
+	wake   chan struct{}
+}
+
+func NewOutbox(mailer Mailer) *Outbox {
+	return &Outbox{
+		db:     database.GetDatabase(),
+		mailer: mailer,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores a message with one email per recipient
+func (o *Outbox) Enqueue(msg *Message) error {
+	attachments := make([]models.EmailAttachment, 0, len(msg.Attachments))
+	for _, attachment := range msg.Attachments {
+		attachments = append(attachments, models.EmailAttachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        attachment.Data,
+		})
+	}
+
+	now := time.Now()
+	emails := make([]models.OutboxEmail, 0, len(msg.To))
+	for _, recipient := range msg.To {
+		emails = append(emails, models.OutboxEmail{
+			Recipient:     recipient,
+			Subject:       msg.Subject,
+			Text:          msg.Text,
+			HTML:          msg.HTML,
+			Attachments:   attachments,
+			NextAttemptAt: now,
+		})
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	if err := o.db.Create(&emails).Error; err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+
+	// Send right away instead of waiting for the next tick
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// StartDeliveryRoutine sends queued emails until the process exits
+func (o *Outbox) StartDeliveryRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+	for {
+		o.deliverDue()
+
+		if time.Since(lastCleanup) > time.Hour {
+			o.cleanup()
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// deliverDue sends the emails whose next attempt is due
+func (o *Outbox) deliverDue() {
+	for {
+		emails, err := o.claimDue()
+		if err != nil {
+			log.Printf("Error loading queued emails: %v", err)
+			return
+		}
+
+		for i := range emails {
+			o.deliver(&emails[i])
+		}
+
+		if len(emails) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// claimDue loads a batch of due emails and leases them, so concurrent
+// replicas don't send the same email twice
+func (o *Outbox) claimDue() ([]models.OutboxEmail, error) {
+	var emails []models.OutboxEmail
+
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+			Order("next_attempt_at").
+			Limit(outboxBatchSize).
+			Find(&emails)
+		if result.Error != nil || len(emails) == 0 {
+			return result.Error
+		}
+
+		ids := make([]interface{}, 0, len(emails))
+		for _, email := range emails {
+			ids = append(ids, email.ID)
+		}
+		return tx.Model(&models.OutboxEmail{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(sendLease)).Error
+	})
+
+	return emails, err
+}
+
+// deliver sends one email and records the outcome
+func (o *Outbox) deliver(email *models.OutboxEmail) {
+	msg := &Message{
+		To:      []string{email.Recipient},
+		Subject: email.Subject,
+		Text:    email.Text,
+		HTML:    email.HTML,
+	}
+	for _, attachment := range email.Attachments {
+		msg.Attachments = append(msg.Attachments, Attachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        attachment.Data,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	err := o.mailer.Send(ctx, msg)
+	cancel()
+
+	now := time.Now()
+	updates := map[string]interface{}{"attempts": email.Attempts + 1}
+	if err == nil {
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+	} else {
+		updates["last_error"] = err.Error()
+		if email.Attempts+1 >= maxSendAttempts {
+			log.Printf("Giving up on email %s to %s: %v", email.ID, email.Recipient, err)
+			updates["failed_at"] = now
+		} else {
+			log.Printf("Failed to send email %s to %s, retrying: %v", email.ID, email.Recipient, err)
+			updates["next_attempt_at"] = now.Add(retryDelay(email.Attempts + 1))
+		}
+	}
+
+	if err := o.db.Model(email).Updates(updates).Error; err != nil {
+		log.Printf("Error updating queued email %s: %v", email.ID, err)
+	}
+}
+
+// cleanup removes sent and failed emails past the retention period
+func (o *Outbox) cleanup() {
+	cutoff := time.Now().Add(-outboxRetention)
+	result := o.db.Where("sent_at < ? OR failed_at < ?", cutoff, cutoff).Delete(&models.OutboxEmail{})
+	if result.Error != nil {
+		log.Printf("Error removing old emails: %v", result.Error)
+	}
+}
+
+// retryDelay returns the backoff after a number of failed attempts:
+// 1, 2, 4, 8 ... minutes, at most 6 hours
+func retryDelay(attempts int) time.Duration {
+	delay := time.Minute << (attempts - 1)
+	if delay > 6*time.Hour || delay <= 0 {
+		return 6 * time.Hour
+	}
+	return delay
+}
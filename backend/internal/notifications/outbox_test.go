@@ -0,0 +1,203 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+// fakeMailer records sent messages and fails while err is set
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []*Message
+	err  error
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestOutbox(t *testing.T, mailer Mailer) *Outbox {
+	t.Helper()
+	return &Outbox{
+		db:     testdb.Open(t, &models.OutboxEmail{}),
+		mailer: mailer,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// loadEmail returns the only queued email
+func loadEmail(t *testing.T, o *Outbox) models.OutboxEmail {
+	t.Helper()
+	var emails []models.OutboxEmail
+	if err := o.db.Find(&emails).Error; err != nil {
+		t.Fatalf("failed to load emails: %v", err)
+	}
+	if len(emails) != 1 {
+		t.Fatalf("got %d emails, want 1", len(emails))
+	}
+	return emails[0]
+}
+
+// makeDue moves the next attempt of every email into the past
+func makeDue(t *testing.T, o *Outbox) {
+	t.Helper()
+	if err := o.db.Model(&models.OutboxEmail{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("failed to update emails: %v", err)
+	}
+}
+
+func assertAround(t *testing.T, name string, got, want time.Time) {
+	t.Helper()
+	if got.Before(want.Add(-5*time.Second)) || got.After(want.Add(5*time.Second)) {
+		t.Errorf("%s = %v, want about %v", name, got, want)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:   time.Minute,
+		2:   2 * time.Minute,
+		3:   4 * time.Minute,
+		7:   64 * time.Minute,
+		9:   256 * time.Minute,
+		10:  6 * time.Hour, // 512 minutes is past the cap
+		100: 6 * time.Hour, // the shift overflows
+	}
+
+	for attempts, want := range tests {
+		if got := retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestOutboxSendsQueuedEmails(t *testing.T) {
+	mailer := &fakeMailer{}
+	o := newTestOutbox(t, mailer)
+
+	msg := &Message{
+		To:          []string{"anne@example.com", "bob@example.com"},
+		Subject:     "Invitation",
+		Text:        "Join us",
+		Attachments: []Attachment{{Filename: "invite.ics", ContentType: "text/calendar", Data: []byte("BEGIN:VCALENDAR")}},
+	}
+	if err := o.Enqueue(msg); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	o.deliverDue()
+
+	// One email per recipient, each with the attachment
+	if len(mailer.sent) != 2 {
+		t.Fatalf("sent %d emails, want 2", len(mailer.sent))
+	}
+	for _, sent := range mailer.sent {
+		if len(sent.To) != 1 || len(sent.Attachments) != 1 || string(sent.Attachments[0].Data) != "BEGIN:VCALENDAR" {
+			t.Errorf("sent %+v, want one recipient and the attachment", sent)
+		}
+	}
+
+	var unsent int64
+	o.db.Model(&models.OutboxEmail{}).Where("sent_at IS NULL").Count(&unsent)
+	if unsent != 0 {
+		t.Errorf("%d emails not marked sent", unsent)
+	}
+}
+
+func TestOutboxRetriesWithBackoff(t *testing.T) {
+	mailer := &fakeMailer{err: errors.New("450 mailbox busy")}
+	o := newTestOutbox(t, mailer)
+
+	if err := o.Enqueue(&Message{To: []string{"anne@example.com"}, Subject: "Invitation"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		o.deliverDue()
+
+		email := loadEmail(t, o)
+		if email.Attempts != attempt {
+			t.Fatalf("attempts = %d, want %d", email.Attempts, attempt)
+		}
+		if email.LastError != "450 mailbox busy" || email.SentAt != nil || email.FailedAt != nil {
+			t.Errorf("attempt %d: email %+v, want a pending retry", attempt, email)
+		}
+		assertAround(t, "next_attempt_at", email.NextAttemptAt, time.Now().Add(retryDelay(attempt)))
+
+		// Not due before the backoff has passed
+		o.deliverDue()
+		if email := loadEmail(t, o); email.Attempts != attempt {
+			t.Fatalf("retried before the backoff passed: attempts = %d", email.Attempts)
+		}
+
+		makeDue(t, o)
+	}
+
+	mailer.err = nil
+	o.deliverDue()
+	if email := loadEmail(t, o); email.SentAt == nil || email.LastError != "" || email.Attempts != 4 {
+		t.Errorf("email %+v, want sent on the fourth attempt", email)
+	}
+}
+
+func TestOutboxGivesUpAfterMaxAttempts(t *testing.T) {
+	mailer := &fakeMailer{err: errors.New("550 no such user")}
+	o := newTestOutbox(t, mailer)
+
+	if err := o.Enqueue(&Message{To: []string{"nobody@example.com"}, Subject: "Invitation"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	for attempt := 1; attempt <= maxSendAttempts; attempt++ {
+		o.deliverDue()
+		makeDue(t, o)
+	}
+
+	email := loadEmail(t, o)
+	if email.Attempts != maxSendAttempts || email.FailedAt == nil || email.SentAt != nil {
+		t.Fatalf("email %+v, want given up after %d attempts", email, maxSendAttempts)
+	}
+
+	// Given up emails are not tried again, even when they look due
+	mailer.err = nil
+	o.deliverDue()
+	if len(mailer.sent) != 0 {
+		t.Error("sent an email that was given up on")
+	}
+}
+
+func TestOutboxLeasesClaimedEmails(t *testing.T) {
+	o := newTestOutbox(t, &fakeMailer{})
+
+	if err := o.Enqueue(&Message{To: []string{"anne@example.com"}, Subject: "Invitation"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	claimed, err := o.claimDue()
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("claimDue = %d emails, %v, want 1", len(claimed), err)
+	}
+	assertAround(t, "leased next_attempt_at", loadEmail(t, o).NextAttemptAt, time.Now().Add(sendLease))
+
+	// Another replica finds nothing while the lease runs
+	if again, err := o.claimDue(); err != nil || len(again) != 0 {
+		t.Errorf("second claimDue = %d emails, %v, want none", len(again), err)
+	}
+
+	// A replica that crashed while sending leaves the email for the next one
+	makeDue(t, o)
+	if again, err := o.claimDue(); err != nil || len(again) != 1 {
+		t.Errorf("claimDue after the lease = %d emails, %v, want 1", len(again), err)
+	}
+}
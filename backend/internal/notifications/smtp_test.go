@@ -0,0 +1,312 @@
+package notifications
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"meet-backend/internal/calendar"
+)
+
+// fakeSMTPServer accepts one message per connection and records the envelope and data
+type fakeSMTPServer struct {
+	listener net.Listener
+	// extensions are advertised in the EHLO response
+	extensions []string
+
+	mu         sync.Mutex
+	auth       string
+	from       string
+	recipients []string
+	data       string
+}
+
+func newFakeSMTPServer(t *testing.T, extensions ...string) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeSMTPServer{listener: listener, extensions: extensions}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+// mailer returns an SMTP mailer without TLS for the server
+func (s *fakeSMTPServer) mailer(t *testing.T, username, password string) *SMTPMailer {
+	t.Helper()
+
+	host, portValue, _ := net.SplitHostPort(s.listener.Addr().String())
+	port, _ := strconv.Atoi(portValue)
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     &mail.Address{Name: "Meet", Address: "meet@example.com"},
+		security: SecurityNone,
+		timeout:  5 * time.Second,
+	}
+}
+
+func (s *fakeSMTPServer) serve(c net.Conn) {
+	defer c.Close()
+	conn := textproto.NewConn(c)
+
+	conn.PrintfLine("220 fake.example.com ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			lines := append([]string{"fake.example.com"}, s.extensions...)
+			for i, extension := range lines {
+				separator := "-"
+				if i == len(lines)-1 {
+					separator = " "
+				}
+				conn.PrintfLine("250%s%s", separator, extension)
+			}
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = argument
+			s.mu.Unlock()
+			conn.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = argument
+			s.mu.Unlock()
+			conn.PrintfLine("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			s.recipients = append(s.recipients, argument)
+			s.mu.Unlock()
+			conn.PrintfLine("250 OK")
+		case "DATA":
+			conn.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(conn.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			conn.PrintfLine("250 OK")
+		case "QUIT":
+			conn.PrintfLine("221 Bye")
+			return
+		default:
+			conn.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newFakeSMTPServer(t, "AUTH PLAIN")
+
+	start := time.Date(2026, 3, 23, 9, 0, 0, 0, time.UTC)
+	invite := (&calendar.Calendar{
+		Method: "REQUEST",
+		Events: []calendar.Event{{UID: "meeting-1", Summary: "Sync", Start: start, End: start.Add(time.Hour)}},
+	}).String()
+
+	msg := &Message{
+		To:      []string{"anne@example.com", "bob@example.com"},
+		Subject: "Uitnodiging: Sync à 10:00",
+		Text:    "Join the meeting at https://meet.example.com/abc-defg-hij\nSee you there",
+		HTML:    `<p>Join the <a href="https://meet.example.com/abc-defg-hij">meeting</a></p>`,
+		Attachments: []Attachment{{
+			Filename:    "invite.ics",
+			ContentType: "text/calendar; charset=utf-8; method=REQUEST",
+			Data:        []byte(invite),
+		}},
+	}
+
+	if err := server.mailer(t, "user", "secret").Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00user\x00secret")); server.auth != want {
+		t.Errorf("AUTH %q, want %q", server.auth, want)
+	}
+	if server.from != "FROM:<meet@example.com>" {
+		t.Errorf("MAIL %q, want FROM:<meet@example.com>", server.from)
+	}
+	if strings.Join(server.recipients, ",") != "TO:<anne@example.com>,TO:<bob@example.com>" {
+		t.Errorf("RCPT %v, want both recipients", server.recipients)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(server.data))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject %q, want %q", subject, msg.Subject)
+	}
+	if from := message.Header.Get("From"); from != `"Meet" <meet@example.com>` {
+		t.Errorf("From %q", from)
+	}
+	if to := message.Header.Get("To"); to != "<anne@example.com>, <bob@example.com>" {
+		t.Errorf("To %q", to)
+	}
+	if id := message.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID %q is not in the sender's domain", id)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type %q, want multipart/mixed", message.Header.Get("Content-Type"))
+	}
+	mixed := multipart.NewReader(message.Body, params["boundary"])
+
+	// The bodies come first as alternatives
+	part, err := mixed.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read the body part: %v", err)
+	}
+	mediaType, params, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("first part is %q, want multipart/alternative", mediaType)
+	}
+	bodies := readParts(t, multipart.NewReader(part, params["boundary"]))
+	if len(bodies) != 2 {
+		t.Fatalf("got %d alternatives, want text and HTML", len(bodies))
+	}
+	if bodies[0].contentType != "text/plain; charset=utf-8" || bodies[0].body != msg.Text {
+		t.Errorf("text part %q: %q", bodies[0].contentType, bodies[0].body)
+	}
+	if bodies[1].contentType != "text/html; charset=utf-8" || bodies[1].body != msg.HTML {
+		t.Errorf("HTML part %q: %q", bodies[1].contentType, bodies[1].body)
+	}
+
+	// Then the invitation
+	part, err = mixed.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read the attachment: %v", err)
+	}
+	mediaType, params, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if mediaType != "text/calendar" || params["method"] != "REQUEST" || params["name"] != "invite.ics" {
+		t.Errorf("attachment Content-Type %q", part.Header.Get("Content-Type"))
+	}
+	if disposition, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disposition != "attachment" || params["filename"] != "invite.ics" {
+		t.Errorf("attachment Content-Disposition %q", part.Header.Get("Content-Disposition"))
+	}
+	if encoding := part.Header.Get("Content-Transfer-Encoding"); encoding != "base64" {
+		t.Fatalf("attachment encoding %q, want base64", encoding)
+	}
+
+	// The dot reader of the fake server turns CRLF into LF
+	encoded, _ := io.ReadAll(part)
+	for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\n") {
+		if len(line) > 76 {
+			t.Errorf("base64 line of %d characters, want at most 76", len(line))
+		}
+	}
+	ics, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\n", ""))
+	if err != nil {
+		t.Fatalf("failed to decode attachment: %v", err)
+	}
+	if string(ics) != invite {
+		t.Errorf("attachment differs from the invitation:\n%s", ics)
+	}
+	if !strings.Contains(string(ics), "METHOD:REQUEST\r\n") || !strings.Contains(string(ics), "UID:meeting-1\r\n") {
+		t.Errorf("attachment is not the invitation:\n%s", ics)
+	}
+
+	if _, err := mixed.NextPart(); err != io.EOF {
+		t.Errorf("got more parts than the bodies and the attachment: %v", err)
+	}
+}
+
+func TestSMTPMailerWithoutAuth(t *testing.T) {
+	server := newFakeSMTPServer(t)
+
+	msg := &Message{To: []string{"anne@example.com"}, Subject: "Plain", Text: "Hello"}
+	if err := server.mailer(t, "", "").Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.auth != "" {
+		t.Errorf("authenticated without a username: %q", server.auth)
+	}
+	if !strings.Contains(server.data, "Hello") {
+		t.Errorf("message was not delivered:\n%s", server.data)
+	}
+}
+
+func TestSMTPMailerRequiresStartTLS(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	mailer := server.mailer(t, "", "")
+	mailer.security = SecurityStartTLS
+
+	msg := &Message{To: []string{"anne@example.com"}, Subject: "Secret", Text: "Hello"}
+	if err := mailer.Send(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("err = %v, want the missing STARTTLS refused", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.data != "" {
+		t.Error("message was sent without TLS")
+	}
+}
+
+type textPart struct {
+	contentType string
+	body        string
+}
+
+// readParts reads the parts of a multipart body; quoted-printable is decoded by the reader
+func readParts(t *testing.T, reader *multipart.Reader) []textPart {
+	t.Helper()
+
+	var parts []textPart
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		body, err := io.ReadAll(bufio.NewReader(part))
+		if err != nil {
+			t.Fatalf("failed to read part body: %v", err)
+		}
+		parts = append(parts, textPart{contentType: part.Header.Get("Content-Type"), body: string(body)})
+	}
+}
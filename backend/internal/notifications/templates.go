@@ -0,0 +1,91 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	// InvitationNew invites someone to a room or meeting
+	InvitationNew = "new"
+	// InvitationUpdated tells invitees the schedule or details of a meeting changed
+	InvitationUpdated = "updated"
+	// InvitationCancelled tells invitees a meeting was cancelled
+	InvitationCancelled = "cancelled"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var templateFuncs = map[string]interface{}{
+	"formatTime": func(t *time.Time) string {
+		return t.Format("Monday 2 January 2006, 15:04 MST")
+	},
+	"formatClock": func(t *time.Time) string {
+		return t.Format("15:04")
+	},
+}
+
+var (
+	invitationText = texttemplate.Must(texttemplate.New("invitation.txt.tmpl").Funcs(templateFuncs).ParseFS(templateFiles, "templates/invitation.txt.tmpl"))
+	invitationHTML = htmltemplate.Must(htmltemplate.New("invitation.html.tmpl").Funcs(templateFuncs).ParseFS(templateFiles, "templates/invitation.html.tmpl"))
+)
+
+// Invitation is an email inviting someone to a room or scheduled meeting
+type Invitation struct {
+	Kind        string
+	InviterName string
+	Title       string
+	Description string
+	JoinURL     string
+	StartsAt    *time.Time // in the meeting's timezone; nil for rooms
+	EndsAt      *time.Time
+	Recurring   bool
+	Passcode    string
+	ExpiresAt   *time.Time // end of a room's time limit
+	Calendar    []byte     // iCalendar object attached as invite.ics
+	Method      string     // iTIP method of the calendar, e.g. REQUEST or CANCEL
+}
+
+// Message renders the invitation for a list of recipients
+func (inv *Invitation) Message(to []string) (*Message, error) {
+	var text, html bytes.Buffer
+	if err := invitationText.Execute(&text, inv); err != nil {
+		return nil, err
+	}
+	if err := invitationHTML.Execute(&html, inv); err != nil {
+		return nil, err
+	}
+
+	subject := "Invitation: " + inv.Title
+	switch inv.Kind {
+	case InvitationUpdated:
+		subject = "Updated invitation: " + inv.Title
+	case InvitationCancelled:
+		subject = "Cancelled: " + inv.Title
+	}
+
+	msg := &Message{
+		To:      to,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}
+
+	if len(inv.Calendar) > 0 {
+		contentType := "text/calendar; charset=utf-8"
+		if inv.Method != "" {
+			contentType += "; method=" + inv.Method
+		}
+		msg.Attachments = append(msg.Attachments, Attachment{
+			Filename:    "invite.ics",
+			ContentType: contentType,
+			Data:        inv.Calendar,
+		})
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,188 @@
+package permissions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Permission is a named capability that can be granted to a role
+type Permission string
+
+const (
+	// Record allows starting and stopping recordings and viewing the recording catalogue
+	Record Permission = "record"
+	// Moderate allows controlling participants in any room
+	Moderate Permission = "moderate"
+	// CreateUnlimitedRoom allows creating rooms without the guest time limit
+	CreateUnlimitedRoom Permission = "create-unlimited-room"
+	// Admin grants every permission, including user administration
+	Admin Permission = "admin"
+)
+
+var knownPermissions = map[Permission]bool{
+	Record:              true,
+	Moderate:            true,
+	CreateUnlimitedRoom: true,
+	Admin:               true,
+}
+
+// Set is the resolved set of permissions of a user
+type Set map[Permission]bool
+
+// Has checks if the set contains a permission; Admin implies every permission
+func (s Set) Has(perm Permission) bool {
+	return s[perm] || s[Admin]
+}
+
+// List returns the permissions in the set
+func (s Set) List() []Permission {
+	list := make([]Permission, 0, len(s))
+	for _, perm := range []Permission{Admin, Moderate, Record, CreateUnlimitedRoom} {
+		if s[perm] {
+			list = append(list, perm)
+		}
+	}
+	return list
+}
+
+// Config describes roles and how identity provider groups map to them
+type Config struct {
+	Roles        map[string][]Permission `json:"roles"`
+	Groups       map[string][]string     `json:"groups"`        // IdP group -> roles
+	DefaultRoles []string                `json:"default_roles"` // roles of every signed-in user
+}
+
+// DefaultConfig matches the group names the application has always used
+func DefaultConfig() Config {
+	return Config{
+		Roles: map[string][]Permission{
+			"admin":     {Admin},
+			"moderator": {Moderate, Record, CreateUnlimitedRoom},
+			"recorder":  {Record, CreateUnlimitedRoom},
+			"member":    {CreateUnlimitedRoom},
+		},
+		Groups: map[string][]string{
+			"admin":      {"admin"},
+			"meet-admin": {"admin"},
+			"recording":  {"recorder"},
+		},
+		DefaultRoles: []string{"member"},
+	}
+}
+
+// Policy resolves the permissions of a user from their groups
+type Policy struct {
+	config Config
+}
+
+// NewPolicy validates a config and creates a policy from it
+func NewPolicy(config Config) (*Policy, error) {
+	for role, perms := range config.Roles {
+		for _, perm := range perms {
+			if !knownPermissions[perm] {
+				return nil, fmt.Errorf("role %q has unknown permission %q", role, perm)
+			}
+		}
+	}
+
+	for group, roles := range config.Groups {
+		for _, role := range roles {
+			if _, ok := config.Roles[role]; !ok {
+				return nil, fmt.Errorf("group %q is mapped to unknown role %q", group, role)
+			}
+		}
+	}
+
+	for _, role := range config.DefaultRoles {
+		if _, ok := config.Roles[role]; !ok {
+			return nil, fmt.Errorf("unknown default role %q", role)
+		}
+	}
+
+	return &Policy{config: config}, nil
+}
+
+// NewPolicyFromEnv loads the policy from RBAC_CONFIG_FILE (JSON) or the
+// built-in defaults, with RBAC_GROUP_ROLES and RBAC_DEFAULT_ROLES overriding
+// the group mapping and default roles
+func NewPolicyFromEnv() (*Policy, error) {
+	config := DefaultConfig()
+
+	if path := os.Getenv("RBAC_CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RBAC config: %w", err)
+		}
+
+		config = Config{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse RBAC config: %w", err)
+		}
+	}
+
+	// RBAC_GROUP_ROLES=group:role,group:role (a group may be listed more than once)
+	if value := os.Getenv("RBAC_GROUP_ROLES"); value != "" {
+		config.Groups = make(map[string][]string)
+		for _, entry := range strings.Split(value, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			group, role, ok := strings.Cut(entry, ":")
+			if !ok || strings.TrimSpace(group) == "" || strings.TrimSpace(role) == "" {
+				return nil, fmt.Errorf("invalid RBAC_GROUP_ROLES entry %q, expected group:role", entry)
+			}
+			group = strings.TrimSpace(group)
+			config.Groups[group] = append(config.Groups[group], strings.TrimSpace(role))
+		}
+	}
+
+	if value, ok := os.LookupEnv("RBAC_DEFAULT_ROLES"); ok {
+		config.DefaultRoles = nil
+		for _, role := range strings.Split(value, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				config.DefaultRoles = append(config.DefaultRoles, role)
+			}
+		}
+	}
+
+	return NewPolicy(config)
+}
+
+// Roles returns the roles granted by a set of groups
+func (p *Policy) Roles(groups []string) []string {
+	seen := make(map[string]bool)
+	var roles []string
+
+	add := func(role string) {
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+
+	for _, role := range p.config.DefaultRoles {
+		add(role)
+	}
+	for _, group := range groups {
+		for _, role := range p.config.Groups[group] {
+			add(role)
+		}
+	}
+
+	return roles
+}
+
+// Resolve returns the permissions granted by a set of groups
+func (p *Policy) Resolve(groups []string) Set {
+	set := make(Set)
+	for _, role := range p.Roles(groups) {
+		for _, perm := range p.config.Roles[role] {
+			set[perm] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,175 @@
+package permissions
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets the RBAC settings for the duration of a test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"RBAC_CONFIG_FILE", "RBAC_GROUP_ROLES", "RBAC_DEFAULT_ROLES"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	clearEnv(t)
+
+	policy, err := NewPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("NewPolicyFromEnv: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   Set
+	}{
+		{"no groups", nil, Set{CreateUnlimitedRoom: true}},
+		{"unknown group", []string{"sales"}, Set{CreateUnlimitedRoom: true}},
+		{"recording", []string{"recording"}, Set{Record: true, CreateUnlimitedRoom: true}},
+		{"admin", []string{"admin"}, Set{Admin: true, CreateUnlimitedRoom: true}},
+		{"meet-admin", []string{"meet-admin", "recording"}, Set{Admin: true, Record: true, CreateUnlimitedRoom: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := policy.Resolve(test.groups); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Resolve(%v) = %v, want %v", test.groups, got.List(), test.want.List())
+			}
+		})
+	}
+}
+
+func TestSetHas(t *testing.T) {
+	admin := Set{Admin: true}
+	for _, perm := range []Permission{Record, Moderate, CreateUnlimitedRoom, Admin} {
+		if !admin.Has(perm) {
+			t.Errorf("admin lacks %s", perm)
+		}
+	}
+
+	recorder := Set{Record: true}
+	if !recorder.Has(Record) || recorder.Has(Moderate) || recorder.Has(Admin) {
+		t.Errorf("recorder has %v, want only %s", recorder.List(), Record)
+	}
+	if (Set{}).Has(Record) {
+		t.Error("empty set has a permission")
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("RBAC_GROUP_ROLES", " staff:moderator, staff:recorder ,,ops:admin")
+	t.Setenv("RBAC_DEFAULT_ROLES", "")
+
+	policy, err := NewPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("NewPolicyFromEnv: %v", err)
+	}
+
+	// The group mapping replaces the defaults, and nobody gets a default role
+	if roles := policy.Roles([]string{"admin"}); len(roles) != 0 {
+		t.Errorf("default group admin got roles %v, want none", roles)
+	}
+	if roles := policy.Roles([]string{"staff"}); !reflect.DeepEqual(roles, []string{"moderator", "recorder"}) {
+		t.Errorf("staff got roles %v, want moderator and recorder", roles)
+	}
+	want := Set{Moderate: true, Record: true, CreateUnlimitedRoom: true}
+	if got := policy.Resolve([]string{"staff"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("staff resolves to %v, want %v", got.List(), want.List())
+	}
+	if got := policy.Resolve([]string{"ops", "ops"}); !reflect.DeepEqual(got, Set{Admin: true}) {
+		t.Errorf("ops resolves to %v, want admin", got.List())
+	}
+	if got := policy.Resolve(nil); len(got) != 0 {
+		t.Errorf("no groups resolve to %v, want nothing", got.List())
+	}
+}
+
+func TestPolicyFromEnvDefaultRoles(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("RBAC_DEFAULT_ROLES", "recorder, member")
+
+	policy, err := NewPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("NewPolicyFromEnv: %v", err)
+	}
+	if roles := policy.Roles(nil); !reflect.DeepEqual(roles, []string{"recorder", "member"}) {
+		t.Errorf("default roles %v, want recorder and member", roles)
+	}
+	// The default group mapping is kept
+	if got := policy.Resolve([]string{"admin"}); !got[Admin] {
+		t.Errorf("admin group resolves to %v, want admin", got.List())
+	}
+}
+
+func TestPolicyFromConfigFile(t *testing.T) {
+	clearEnv(t)
+
+	path := filepath.Join(t.TempDir(), "rbac.json")
+	config := `{
+		"roles": {"host": ["moderate", "record"], "everyone": []},
+		"groups": {"hosts": ["host"]},
+		"default_roles": ["everyone"]
+	}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	t.Setenv("RBAC_CONFIG_FILE", path)
+
+	policy, err := NewPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("NewPolicyFromEnv: %v", err)
+	}
+
+	// The file replaces the built-in roles entirely
+	if got := policy.Resolve([]string{"admin"}); len(got) != 0 {
+		t.Errorf("admin group resolves to %v, want nothing", got.List())
+	}
+	want := Set{Moderate: true, Record: true}
+	if got := policy.Resolve([]string{"hosts"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts resolve to %v, want %v", got.List(), want.List())
+	}
+}
+
+func TestPolicyFromEnvErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalidJSON := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalidJSON, []byte("{"), 0o600)
+	unknownPermission := filepath.Join(dir, "unknown.json")
+	os.WriteFile(unknownPermission, []byte(`{"roles": {"host": ["moderate", "fly"]}}`), 0o600)
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		error string
+	}{
+		{"missing config file", map[string]string{"RBAC_CONFIG_FILE": filepath.Join(dir, "missing.json")}, "failed to read"},
+		{"invalid config file", map[string]string{"RBAC_CONFIG_FILE": invalidJSON}, "failed to parse"},
+		{"unknown permission", map[string]string{"RBAC_CONFIG_FILE": unknownPermission}, `unknown permission "fly"`},
+		{"group without role", map[string]string{"RBAC_GROUP_ROLES": "staff"}, "expected group:role"},
+		{"group with empty role", map[string]string{"RBAC_GROUP_ROLES": "staff: "}, "expected group:role"},
+		{"group with unknown role", map[string]string{"RBAC_GROUP_ROLES": "staff:superuser"}, `unknown role "superuser"`},
+		{"unknown default role", map[string]string{"RBAC_DEFAULT_ROLES": "member,guest"}, `unknown default role "guest"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := NewPolicyFromEnv()
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("err = %v, want an error containing %q", err, test.error)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"meet-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// AttendanceInterval is a stretch of time someone was in a room
+type AttendanceInterval struct {
+	JoinedAt time.Time  `json:"joined_at"`
+	LeftAt   *time.Time `json:"left_at,omitempty"` // nil while still in the room
+	Seconds  int64      `json:"seconds"`
+}
+
+// Attendee is the attendance of one person. Signed-in users are one
+// attendee however often they rejoin; guests get a new identity each time
+// they join through the room link.
+type Attendee struct {
+	Identity     string               `json:"identity"`
+	Name         string               `json:"name"`
+	UserID       *string              `json:"user_id,omitempty"`
+	IsGuest      bool                 `json:"is_guest"`
+	FirstSeen    time.Time            `json:"first_seen"`
+	LastSeen     time.Time            `json:"last_seen"`
+	Present      bool                 `json:"present"`
+	Sessions     int                  `json:"sessions"` // joins, including rejoins
+	TotalSeconds int64                `json:"total_seconds"`
+	Intervals    []AttendanceInterval `json:"intervals"`
+}
+
+// AttendanceReport is the attendance of everyone who joined a room
+type AttendanceReport struct {
+	RoomID          uuid.UUID  `json:"room_id"`
+	RoomName        string     `json:"room_name"`
+	IsActive        bool       `json:"is_active"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"` // nil while the meeting runs
+	DurationSeconds int64      `json:"duration_seconds"`
+	PeakConcurrency int        `json:"peak_concurrency"`
+	PeakAt          *time.Time `json:"peak_at,omitempty"`
+	TotalAttendees  int        `json:"total_attendees"`
+	Guests          int        `json:"guests"`
+	Authenticated   int        `json:"authenticated"`
+	GeneratedAt     time.Time  `json:"generated_at"`
+	Attendees       []Attendee `json:"attendees"`
+}
+
+// GetAttendance computes the attendance report of the latest meeting in a
+// room from its participant records, also for rooms that are no longer
+// active. Overlapping sessions of one person, e.g. from a second tab, are
+// counted once.
+func (rs *RoomService) GetAttendance(room *models.Room) (*AttendanceReport, error) {
+	query := rs.db.Where("room_id = ?", room.ID)
+	if room.StartedAt != nil {
+		// Meeting rooms are reopened for every occurrence, so earlier
+		// occurrences are left out. Sessions that were still open when the
+		// call started count, as participants join just before LiveKit
+		// reports it.
+		query = query.Where("left_at IS NULL OR left_at >= ?", *room.StartedAt)
+	}
+
+	var participants []models.RoomParticipant
+	if err := query.Order("joined_at").Find(&participants).Error; err != nil {
+		return nil, fmt.Errorf("failed to get participants: %w", err)
+	}
+
+	now := time.Now()
+	// Sessions still open in a room that ended are closed at its end
+	openEnd := now
+	if !room.IsActive && room.EndedAt != nil {
+		openEnd = *room.EndedAt
+	}
+
+	report := &AttendanceReport{
+		RoomID:      room.ID,
+		RoomName:    room.Name,
+		IsActive:    room.IsActive,
+		StartedAt:   room.StartedAt,
+		EndedAt:     room.EndedAt,
+		GeneratedAt: now,
+		Attendees:   []Attendee{},
+	}
+
+	index := make(map[string]int)
+	var lastLeft *time.Time
+	for _, participant := range participants {
+		key := participant.Identity
+		if participant.UserID != nil {
+			key = "user:" + *participant.UserID
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(report.Attendees)
+			index[key] = i
+			report.Attendees = append(report.Attendees, Attendee{
+				Identity:  participant.Identity,
+				Name:      participant.Name,
+				UserID:    participant.UserID,
+				IsGuest:   participant.IsGuest,
+				FirstSeen: participant.JoinedAt,
+			})
+		}
+		attendee := &report.Attendees[i]
+		attendee.Sessions++
+		attendee.Name = participant.Name // the latest name
+
+		interval := AttendanceInterval{JoinedAt: participant.JoinedAt, LeftAt: participant.LeftAt}
+		if participant.LeftAt == nil && !room.IsActive {
+			interval.LeftAt = &openEnd
+		}
+		attendee.Intervals = append(attendee.Intervals, interval)
+
+		if interval.LeftAt != nil && (lastLeft == nil || interval.LeftAt.After(*lastLeft)) {
+			lastLeft = interval.LeftAt
+		}
+	}
+
+	for i := range report.Attendees {
+		attendee := &report.Attendees[i]
+		attendee.Intervals = mergeIntervals(attendee.Intervals, now)
+
+		last := attendee.Intervals[len(attendee.Intervals)-1]
+		attendee.Present = last.LeftAt == nil
+		attendee.LastSeen = now
+		if last.LeftAt != nil {
+			attendee.LastSeen = *last.LeftAt
+		}
+		for _, interval := range attendee.Intervals {
+			attendee.TotalSeconds += interval.Seconds
+		}
+
+		if attendee.IsGuest {
+			report.Guests++
+		} else {
+			report.Authenticated++
+		}
+	}
+	report.TotalAttendees = len(report.Attendees)
+
+	// Without the LiveKit webhooks the participants tell when it ran
+	if report.StartedAt == nil && len(participants) > 0 {
+		report.StartedAt = &participants[0].JoinedAt
+	}
+	if report.EndedAt == nil && !room.IsActive {
+		report.EndedAt = lastLeft
+	}
+	if report.StartedAt != nil {
+		end := now
+		if report.EndedAt != nil {
+			end = *report.EndedAt
+		}
+		if end.After(*report.StartedAt) {
+			report.DurationSeconds = int64(end.Sub(*report.StartedAt).Seconds())
+		}
+	}
+
+	report.PeakConcurrency, report.PeakAt = peakConcurrency(report.Attendees, now)
+
+	return report, nil
+}
+
+// mergeIntervals sorts intervals and joins the overlapping ones, filling in
+// their length; open intervals run until now
+func mergeIntervals(intervals []AttendanceInterval, now time.Time) []AttendanceInterval {
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].JoinedAt.Before(intervals[j].JoinedAt) })
+
+	merged := []AttendanceInterval{intervals[0]}
+	for _, interval := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if last.LeftAt != nil && interval.JoinedAt.After(*last.LeftAt) {
+			merged = append(merged, interval)
+			continue
+		}
+		if last.LeftAt != nil && (interval.LeftAt == nil || interval.LeftAt.After(*last.LeftAt)) {
+			last.LeftAt = interval.LeftAt
+		}
+	}
+
+	for i := range merged {
+		end := now
+		if merged[i].LeftAt != nil {
+			end = *merged[i].LeftAt
+		}
+		if end.After(merged[i].JoinedAt) {
+			merged[i].Seconds = int64(end.Sub(merged[i].JoinedAt).Seconds())
+		}
+	}
+
+	return merged
+}
+
+// peakConcurrency returns the most attendees in the room at the same time
+// and when that was first reached
+func peakConcurrency(attendees []Attendee, now time.Time) (int, *time.Time) {
+	type change struct {
+		at    time.Time
+		delta int
+	}
+
+	var changes []change
+	for _, attendee := range attendees {
+		for _, interval := range attendee.Intervals {
+			end := now
+			if interval.LeftAt != nil {
+				end = *interval.LeftAt
+			}
+			changes = append(changes, change{interval.JoinedAt, 1}, change{end, -1})
+		}
+	}
+
+	// Someone leaving at the moment another joins doesn't overlap with them
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].at.Equal(changes[j].at) {
+			return changes[i].delta < changes[j].delta
+		}
+		return changes[i].at.Before(changes[j].at)
+	})
+
+	peak, current := 0, 0
+	var peakAt *time.Time
+	for i := range changes {
+		current += changes[i].delta
+		if current > peak {
+			peak = current
+			peakAt = &changes[i].at
+		}
+	}
+
+	return peak, peakAt
+}
+
+// CSV returns the report with one row per attendee; the meeting itself is in
+// the last columns of every row
+func (report *AttendanceReport) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	writer.Write([]string{
+		"identity", "name", "user_id", "guest", "first_seen", "last_seen", "present", "sessions", "total_seconds", "intervals",
+		"meeting_started_at", "meeting_ended_at", "meeting_duration_seconds", "peak_concurrency", "peak_at",
+	})
+	for _, attendee := range report.Attendees {
+		userID := ""
+		if attendee.UserID != nil {
+			userID = *attendee.UserID
+		}
+
+		// Intervals as joined/left, with an empty left while still present
+		intervals := make([]string, 0, len(attendee.Intervals))
+		for _, interval := range attendee.Intervals {
+			intervals = append(intervals, formatCSVTime(&interval.JoinedAt)+"/"+formatCSVTime(interval.LeftAt))
+		}
+
+		writer.Write([]string{
+			csvCell(attendee.Identity),
+			csvCell(attendee.Name),
+			csvCell(userID),
+			strconv.FormatBool(attendee.IsGuest),
+			formatCSVTime(&attendee.FirstSeen),
+			formatCSVTime(&attendee.LastSeen),
+			strconv.FormatBool(attendee.Present),
+			strconv.Itoa(attendee.Sessions),
+			strconv.FormatInt(attendee.TotalSeconds, 10),
+			strings.Join(intervals, "; "),
+			formatCSVTime(report.StartedAt),
+			formatCSVTime(report.EndedAt),
+			strconv.FormatInt(report.DurationSeconds, 10),
+			strconv.Itoa(report.PeakConcurrency),
+			formatCSVTime(report.PeakAt),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write attendance: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// formatCSVTime formats a time for the CSV report, empty when unset
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// csvCell quotes a value that a spreadsheet would run as a formula, such as
+// a guest named "=HYPERLINK(...)"
+func csvCell(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
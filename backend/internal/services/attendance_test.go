@@ -0,0 +1,108 @@
+package services
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"meet-backend/internal/models"
+)
+
+func TestAttendanceOfLatestOccurrence(t *testing.T) {
+	rs := newTestRoomService(t)
+
+	room := models.CreateAuthenticatedRoom("att-ende-nce", "owner")
+	if err := rs.db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+
+	base := time.Date(2026, 3, 23, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		t := base.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+	anne, bob := "anne", "bob"
+	participants := []models.RoomParticipant{
+		// Last week's occurrence
+		{UserID: &anne, Identity: "anne", Name: "Anne", JoinedAt: *at(-7 * 24 * 60), LeftAt: at(-7*24*60 + 30)},
+		// Joined just before LiveKit reported the call started
+		{UserID: &anne, Identity: "anne", Name: "Anne", JoinedAt: *at(-1), LeftAt: at(20)},
+		{UserID: &anne, Identity: "anne", Name: "Anne", JoinedAt: *at(30), LeftAt: at(60)},
+		{UserID: &bob, Identity: "bob", Name: "Bob", JoinedAt: *at(10), LeftAt: at(40)},
+		{Identity: "guest-1", Name: "=HYPERLINK(\"https://evil.example.com\")", IsGuest: true, JoinedAt: *at(15), LeftAt: at(35)},
+	}
+	for i := range participants {
+		participants[i].RoomID = room.ID
+		if err := rs.db.Create(&participants[i]).Error; err != nil {
+			t.Fatalf("failed to create participant: %v", err)
+		}
+	}
+
+	room.IsActive = false
+	room.StartedAt = at(0)
+	room.EndedAt = at(60)
+
+	report, err := rs.GetAttendance(room)
+	if err != nil {
+		t.Fatalf("GetAttendance: %v", err)
+	}
+
+	if report.TotalAttendees != 3 || report.Guests != 1 || report.Authenticated != 2 {
+		t.Errorf("attendees %d (%d guests, %d authenticated), want 3 (1, 2)", report.TotalAttendees, report.Guests, report.Authenticated)
+	}
+	anneReport := report.Attendees[0]
+	if anneReport.Sessions != 2 || anneReport.TotalSeconds != 51*60 || !anneReport.FirstSeen.Equal(*at(-1)) {
+		t.Errorf("Anne %+v, want two sessions of this occurrence", anneReport)
+	}
+	if report.DurationSeconds != 3600 || report.PeakConcurrency != 3 || !report.PeakAt.Equal(*at(15)) {
+		t.Errorf("duration %d, peak %d at %v, want 3600 and 3 at %v", report.DurationSeconds, report.PeakConcurrency, report.PeakAt, at(15))
+	}
+
+	data, err := report.CSV()
+	if err != nil {
+		t.Fatalf("CSV: %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse CSV: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d rows, want a header and 3 attendees", len(records))
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	for _, record := range records[1:] {
+		if record[columns["meeting_started_at"]] != "2026-03-23T09:00:00Z" ||
+			record[columns["meeting_ended_at"]] != "2026-03-23T10:00:00Z" ||
+			record[columns["peak_concurrency"]] != "3" {
+			t.Errorf("row %v lacks the meeting", record)
+		}
+	}
+	if name := records[3][columns["name"]]; name != "'=HYPERLINK(\"https://evil.example.com\")" {
+		t.Errorf("guest name %q is not escaped", name)
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"Anne":        "Anne",
+		"=1+1":        "'=1+1",
+		"+31 6":       "'+31 6",
+		"-2":          "'-2",
+		"@SUM(A1)":    "'@SUM(A1)",
+		"\tcmd":       "'\tcmd",
+		"Anne = Bob":  "Anne = Bob",
+		"guest-a1b2c": "guest-a1b2c",
+	}
+
+	for value, want := range tests {
+		if got := csvCell(value); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBanNotFound = errors.New("ban not found")
+	ErrInvalidBan  = errors.New("invalid ban")
+	// ErrBanned is returned when someone banned from a room tries to join it
+	ErrBanned = errors.New("banned from this room")
+)
+
+// BanSubject is someone joining a room, checked against the bans
+type BanSubject struct {
+	UserID    *string // nil for guests
+	Identity  string
+	IPAddress string // only checked for guests
+}
+
+type BanService struct {
+	db *gorm.DB
+}
+
+func NewBanService() *BanService {
+	return &BanService{
+		db: database.GetDatabase(),
+	}
+}
+
+// CreateBan bans someone from a room, or from every room when room is nil.
+// Banning the identity of someone who was in the room also bans their user
+// ID, or for guests their IP address, so a fresh identity doesn't get them back in.
+func (bs *BanService) CreateBan(room *models.Room, request models.BanRequest, createdBy string) (*models.Ban, error) {
+	ban := &models.Ban{
+		UserID:    strings.TrimSpace(request.UserID),
+		Identity:  strings.TrimSpace(request.Identity),
+		Reason:    strings.TrimSpace(request.Reason),
+		CreatedBy: createdBy,
+	}
+
+	if request.ExpiresInMinutes < 0 {
+		return nil, fmt.Errorf("%w: expires_in_minutes cannot be negative", ErrInvalidBan)
+	}
+	if request.ExpiresInMinutes > 0 {
+		expiresAt := time.Now().Add(time.Duration(request.ExpiresInMinutes) * time.Minute)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	if room != nil {
+		if request.IPAddress != "" {
+			return nil, fmt.Errorf("%w: IP addresses can only be banned from every room", ErrInvalidBan)
+		}
+		ban.RoomID = &room.ID
+
+		if ban.Identity != "" {
+			if err := bs.resolveIdentity(room.ID, ban); err != nil {
+				return nil, err
+			}
+		}
+		if room.CreatedBy != nil && ban.UserID == *room.CreatedBy {
+			return nil, fmt.Errorf("%w: the room owner cannot be banned", ErrInvalidBan)
+		}
+	} else if request.IPAddress != "" {
+		ip := net.ParseIP(strings.TrimSpace(request.IPAddress))
+		if ip == nil {
+			return nil, fmt.Errorf("%w: invalid IP address", ErrInvalidBan)
+		}
+		ban.IPAddress = ip.String()
+	}
+
+	if ban.UserID == "" && ban.Identity == "" && ban.IPAddress == "" {
+		return nil, fmt.Errorf("%w: user_id, identity or ip_address is required", ErrInvalidBan)
+	}
+	if ban.UserID == createdBy || ban.Identity == createdBy {
+		return nil, fmt.Errorf("%w: you cannot ban yourself", ErrInvalidBan)
+	}
+
+	if err := bs.db.Create(ban).Error; err != nil {
+		return nil, fmt.Errorf("failed to create ban: %w", err)
+	}
+	ban.IPBanned = ban.IPAddress != ""
+
+	return ban, nil
+}
+
+// resolveIdentity adds the user ID or IP address of the last participant
+// with the ban's identity in the room
+func (bs *BanService) resolveIdentity(roomID uuid.UUID, ban *models.Ban) error {
+	var participant models.RoomParticipant
+	result := bs.db.Where("room_id = ? AND identity = ?", roomID, ban.Identity).
+		Order("joined_at DESC").
+		First(&participant)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to find participant: %w", result.Error)
+	}
+
+	if participant.UserID != nil {
+		if ban.UserID == "" {
+			ban.UserID = *participant.UserID
+		}
+	} else {
+		ban.IPAddress = participant.IPAddress
+	}
+
+	return nil
+}
+
+// GetBan retrieves a ban by ID
+func (bs *BanService) GetBan(id uuid.UUID) (*models.Ban, error) {
+	var ban models.Ban
+	result := bs.db.Where("id = ?", id).First(&ban)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrBanNotFound
+		}
+		return nil, fmt.Errorf("failed to get ban: %w", result.Error)
+	}
+
+	return &ban, nil
+}
+
+// ListBans returns the bans in effect for a room, or the org-wide bans when
+// roomID is nil, newest first
+func (bs *BanService) ListBans(roomID *uuid.UUID) ([]models.Ban, error) {
+	query := bs.db.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	if roomID != nil {
+		query = query.Where("room_id = ?", *roomID)
+	} else {
+		query = query.Where("room_id IS NULL")
+	}
+
+	var bans []models.Ban
+	if err := query.Order("created_at DESC").Find(&bans).Error; err != nil {
+		return nil, fmt.Errorf("failed to list bans: %w", err)
+	}
+
+	return bans, nil
+}
+
+// DeleteBan lifts a ban
+func (bs *BanService) DeleteBan(ban *models.Ban) error {
+	if err := bs.db.Delete(ban).Error; err != nil {
+		return fmt.Errorf("failed to delete ban: %w", err)
+	}
+	return nil
+}
+
+// FindBan returns the ban keeping someone out of a room, the longest one if
+// there are several, or nil when they may join
+func (bs *BanService) FindBan(roomID uuid.UUID, subject BanSubject) (*models.Ban, error) {
+	userID := ""
+	ipAddress := subject.IPAddress
+	if subject.UserID != nil {
+		userID = *subject.UserID
+		ipAddress = ""
+	}
+
+	condition, args := banCondition(userID, subject.Identity, ipAddress)
+	if condition == "" {
+		return nil, nil
+	}
+
+	var ban models.Ban
+	result := bs.db.Where("room_id = ? OR room_id IS NULL", roomID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Where(condition, args...).
+		Order("expires_at DESC NULLS FIRST").
+		First(&ban)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to check bans: %w", result.Error)
+	}
+
+	return &ban, nil
+}
+
+// ActiveParticipants returns the participants a ban applies to that are
+// still in a room, with their room
+func (bs *BanService) ActiveParticipants(ban *models.Ban) ([]models.RoomParticipant, error) {
+	condition, args := banCondition(ban.UserID, ban.Identity, "")
+	if ban.IPAddress != "" {
+		ipCondition := "(is_guest = ? AND ip_address = ?)"
+		if condition == "" {
+			condition = ipCondition
+		} else {
+			condition = "(" + condition + " OR " + ipCondition + ")"
+		}
+		args = append(args, true, ban.IPAddress)
+	}
+	if condition == "" {
+		return nil, nil
+	}
+
+	query := bs.db.Preload("Room").Where("left_at IS NULL").Where(condition, args...)
+	if ban.RoomID != nil {
+		query = query.Where("room_id = ?", *ban.RoomID)
+	}
+
+	var participants []models.RoomParticipant
+	if err := query.Find(&participants).Error; err != nil {
+		return nil, fmt.Errorf("failed to find banned participants: %w", err)
+	}
+
+	return participants, nil
+}
+
+// banCondition matches any of the user ID, identity and IP address that are set
+func banCondition(userID, identity, ipAddress string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if userID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, userID)
+	}
+	if identity != "" {
+		conditions = append(conditions, "identity = ?")
+		args = append(args, identity)
+	}
+	if ipAddress != "" {
+		conditions = append(conditions, "ip_address = ?")
+		args = append(args, ipAddress)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func newTestBanService(t *testing.T) (*BanService, *models.Room, *models.Room) {
+	t.Helper()
+	bs := &BanService{db: testdb.Open(t, &models.Room{}, &models.RoomParticipant{}, &models.Ban{})}
+
+	rooms := []*models.Room{
+		models.CreateAuthenticatedRoom("abc-defg-hij", "owner"),
+		models.CreateAuthenticatedRoom("klm-nopq-rst", "other-owner"),
+	}
+	for _, room := range rooms {
+		if err := bs.db.Create(room).Error; err != nil {
+			t.Fatalf("failed to create room: %v", err)
+		}
+	}
+	return bs, rooms[0], rooms[1]
+}
+
+func mustBan(t *testing.T, bs *BanService, room *models.Room, request models.BanRequest) *models.Ban {
+	t.Helper()
+	ban, err := bs.CreateBan(room, request, "moderator")
+	if err != nil {
+		t.Fatalf("CreateBan(%+v): %v", request, err)
+	}
+	return ban
+}
+
+func TestFindBan(t *testing.T) {
+	bs, room, other := newTestBanService(t)
+
+	mustBan(t, bs, room, models.BanRequest{UserID: "alice"})
+	mustBan(t, bs, room, models.BanRequest{Identity: "guest-x"})
+	mustBan(t, bs, nil, models.BanRequest{IPAddress: "192.0.2.1"})
+	mustBan(t, bs, nil, models.BanRequest{UserID: "mallory"})
+	expired := mustBan(t, bs, room, models.BanRequest{UserID: "carol", ExpiresInMinutes: 10})
+	bs.db.Model(expired).Update("expires_at", time.Now().Add(-time.Minute))
+
+	userID := func(id string) *string { return &id }
+
+	tests := []struct {
+		name    string
+		room    *models.Room
+		subject BanSubject
+		banned  bool
+	}{
+		{"user in the room", room, BanSubject{UserID: userID("alice"), Identity: "alice"}, true},
+		{"user with another identity", room, BanSubject{UserID: userID("alice"), Identity: "alice-laptop"}, true},
+		{"user in another room", other, BanSubject{UserID: userID("alice"), Identity: "alice"}, false},
+		{"guest identity", room, BanSubject{Identity: "guest-x", IPAddress: "198.51.100.1"}, true},
+		{"guest identity in another room", other, BanSubject{Identity: "guest-x", IPAddress: "198.51.100.1"}, false},
+		{"guest IP address in any room", other, BanSubject{Identity: "guest-y", IPAddress: "192.0.2.1"}, true},
+		{"user at a banned IP address", room, BanSubject{UserID: userID("bob"), Identity: "bob", IPAddress: "192.0.2.1"}, false},
+		{"user banned everywhere", other, BanSubject{UserID: userID("mallory"), Identity: "mallory"}, true},
+		{"expired ban", room, BanSubject{UserID: userID("carol"), Identity: "carol"}, false},
+		{"someone else", room, BanSubject{UserID: userID("dave"), Identity: "dave"}, false},
+		{"nothing to match", room, BanSubject{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ban, err := bs.FindBan(test.room.ID, test.subject)
+			if err != nil {
+				t.Fatalf("FindBan: %v", err)
+			}
+			if (ban != nil) != test.banned {
+				t.Errorf("ban = %+v, want banned = %v", ban, test.banned)
+			}
+		})
+	}
+}
+
+func TestFindBanReturnsLongestBan(t *testing.T) {
+	bs, room, _ := newTestBanService(t)
+
+	mustBan(t, bs, room, models.BanRequest{UserID: "alice", ExpiresInMinutes: 10})
+	permanent := mustBan(t, bs, nil, models.BanRequest{UserID: "alice"})
+	mustBan(t, bs, room, models.BanRequest{UserID: "alice", ExpiresInMinutes: 60})
+
+	userID := "alice"
+	ban, err := bs.FindBan(room.ID, BanSubject{UserID: &userID, Identity: userID})
+	if err != nil {
+		t.Fatalf("FindBan: %v", err)
+	}
+	if ban == nil || ban.ID != permanent.ID {
+		t.Errorf("ban = %+v, want the permanent ban %s", ban, permanent.ID)
+	}
+}
+
+func TestCreateBanResolvesIdentity(t *testing.T) {
+	bs, room, _ := newTestBanService(t)
+
+	alice := "alice"
+	bs.db.Create(&models.RoomParticipant{RoomID: room.ID, UserID: &alice, Identity: "alice", Name: "Alice", JoinedAt: time.Now()})
+	bs.db.Create(&models.RoomParticipant{RoomID: room.ID, Identity: "guest-1", Name: "Guest", IsGuest: true, IPAddress: "192.0.2.7", JoinedAt: time.Now()})
+
+	ban := mustBan(t, bs, room, models.BanRequest{Identity: "alice"})
+	if ban.UserID != "alice" || ban.IPBanned {
+		t.Errorf("ban of a signed-in participant %+v, want their user ID and no IP address", ban)
+	}
+
+	// A guest who rejoins with a new identity is kept out by their IP address
+	ban = mustBan(t, bs, room, models.BanRequest{Identity: "guest-1"})
+	if ban.IPAddress != "192.0.2.7" || !ban.IPBanned {
+		t.Errorf("ban of a guest %+v, want their IP address", ban)
+	}
+	found, err := bs.FindBan(room.ID, BanSubject{Identity: "guest-2", IPAddress: "192.0.2.7"})
+	if err != nil || found == nil {
+		t.Errorf("guest with a new identity: ban = %v (%v), want banned", found, err)
+	}
+}
+
+func TestCreateBanValidation(t *testing.T) {
+	bs, room, _ := newTestBanService(t)
+
+	owner := "owner"
+	bs.db.Create(&models.RoomParticipant{RoomID: room.ID, UserID: &owner, Identity: "owner-phone", Name: "Owner", JoinedAt: time.Now()})
+
+	tests := []struct {
+		name    string
+		global  bool
+		request models.BanRequest
+	}{
+		{"owner by user ID", false, models.BanRequest{UserID: "owner"}},
+		{"owner by identity", false, models.BanRequest{Identity: "owner-phone"}},
+		{"yourself", false, models.BanRequest{UserID: "moderator"}},
+		{"nobody", false, models.BanRequest{Reason: "spam"}},
+		{"negative expiry", false, models.BanRequest{UserID: "alice", ExpiresInMinutes: -1}},
+		{"IP address from one room", false, models.BanRequest{IPAddress: "192.0.2.1"}},
+		{"invalid IP address", true, models.BanRequest{IPAddress: "not-an-ip"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			banRoom := room
+			if test.global {
+				banRoom = nil
+			}
+			if _, err := bs.CreateBan(banRoom, test.request, "moderator"); !errors.Is(err, ErrInvalidBan) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidBan)
+			}
+		})
+	}
+
+	var count int64
+	bs.db.Model(&models.Ban{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d bans were stored, want none", count)
+	}
+
+	// The owner of one room can still be banned everywhere by an admin
+	if _, err := bs.CreateBan(nil, models.BanRequest{UserID: "owner"}, "admin"); err != nil {
+		t.Errorf("org-wide ban of a room owner: %v", err)
+	}
+}
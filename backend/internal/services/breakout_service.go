@@ -0,0 +1,564 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/livekit/protocol/livekit"
+	"gorm.io/gorm"
+)
+
+// Types of the moderation messages that send participants between a room
+// and its breakout rooms
+const (
+	BreakoutMessage       = "breakout"        // join the breakout room in the message
+	BreakoutReturnMessage = "breakout_return" // go back to the main room
+)
+
+var (
+	ErrBreakoutsOpen   = errors.New("breakout rooms are already open")
+	ErrNoBreakouts     = errors.New("no breakout rooms are open")
+	ErrInvalidBreakout = errors.New("invalid breakout request")
+)
+
+// BreakoutRoom is an open breakout room with the participants assigned to it
+// and the identities of those who are in it
+type BreakoutRoom struct {
+	Room        models.Room                 `json:"room"`
+	Assignments []models.BreakoutAssignment `json:"assignments"`
+	Present     []string                    `json:"present"`
+}
+
+// BreakoutService opens breakout rooms for a room, sends participants to
+// them and brings everyone back when they close
+type BreakoutService struct {
+	db            *gorm.DB
+	roomService   *RoomService
+	memberService *RoomMemberService
+	policyService *RoomPolicyService
+	moderation    *ModerationService
+}
+
+func NewBreakoutService(moderation *ModerationService) *BreakoutService {
+	return &BreakoutService{
+		db:            database.GetDatabase(),
+		roomService:   NewRoomService(),
+		memberService: NewRoomMemberService(),
+		policyService: NewRoomPolicyService(),
+		moderation:    moderation,
+	}
+}
+
+// OpenBreakouts creates the breakout rooms of a room and sends the assigned
+// participants to them. Breakout rooms share the owner, moderators and policy
+// of their main room and never outlive it. Hosts aren't assigned
+// automatically so they can visit every breakout room.
+func (bs *BreakoutService) OpenBreakouts(ctx context.Context, parent *models.Room, actorID string, request models.OpenBreakoutsRequest) ([]BreakoutRoom, error) {
+	if parent.ParentID != nil {
+		return nil, fmt.Errorf("%w: breakout rooms cannot have breakout rooms", ErrInvalidBreakout)
+	}
+
+	open, err := bs.openBreakouts(parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(open) > 0 {
+		return nil, ErrBreakoutsOpen
+	}
+
+	participants, err := bs.roomService.GetActiveParticipants(parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	numbers, err := bs.assign(parent, participants, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt *time.Time
+	var maxDuration *int
+	if request.DurationMinutes > 0 {
+		at := time.Now().Add(time.Duration(request.DurationMinutes) * time.Minute)
+		expiresAt = &at
+		maxDuration = &request.DurationMinutes
+	}
+	if parent.ExpiresAt != nil && (expiresAt == nil || parent.ExpiresAt.Before(*expiresAt)) {
+		expiresAt = parent.ExpiresAt
+	}
+
+	members, err := bs.memberService.ListMembers(parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := bs.policyService.GetPolicy(parent.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := make([]models.Room, request.Count)
+	for i := range rooms {
+		name, err := bs.roomService.GenerateRoomName()
+		if err != nil {
+			return nil, err
+		}
+		rooms[i] = models.Room{
+			Name:           name,
+			CreatedBy:      parent.CreatedBy,
+			ExpiresAt:      expiresAt,
+			MaxDuration:    maxDuration,
+			IsActive:       true,
+			ParentID:       &parent.ID,
+			BreakoutNumber: i + 1,
+		}
+	}
+
+	var assignments []models.BreakoutAssignment
+	err = bs.db.Transaction(func(tx *gorm.DB) error {
+		for i := range rooms {
+			room := &rooms[i]
+			if err := tx.Create(room).Error; err != nil {
+				return err
+			}
+			for _, member := range members {
+				if !member.CanManageRoom() {
+					continue
+				}
+				if err := tx.Create(&models.RoomMember{
+					RoomID:    room.ID,
+					UserID:    member.UserID,
+					Role:      member.Role,
+					GrantedBy: member.GrantedBy,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			roomPolicy := *policy
+			roomPolicy.RoomID = room.ID
+			if err := tx.Create(&roomPolicy).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, participant := range participants {
+			number := numbers[participant.Identity]
+			if number == 0 {
+				continue
+			}
+			assignments = append(assignments, models.BreakoutAssignment{
+				ParentID: parent.ID,
+				RoomID:   rooms[number-1].ID,
+				Identity: participant.Identity,
+				UserID:   participant.UserID,
+				Name:     participant.Name,
+			})
+		}
+		if len(assignments) == 0 {
+			return nil
+		}
+		return tx.Create(&assignments).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breakout rooms: %w", err)
+	}
+
+	for i := range rooms {
+		emitRoomEvent(bs.db, events.EventRoomCreated, &rooms[i], events.NewRoomData(&rooms[i]))
+	}
+	breakouts := bs.breakoutRooms(rooms, assignments, nil)
+	events.Publish(parent.Name, events.EventBreakoutsOpened, map[string]interface{}{
+		"breakouts":  breakouts,
+		"expires_at": expiresAt,
+	})
+
+	// Participants who left in the meantime get their token when they ask for it
+	for _, assignment := range assignments {
+		target := &rooms[numbers[assignment.Identity]-1]
+		if err := bs.moderation.sendRoomToken(ctx, parent, target, assignment.Identity, assignment.Name, assignment.UserID, BreakoutMessage); err != nil {
+			log.Printf("Failed to send %s to breakout room %s: %v", assignment.Identity, target.Name, err)
+		}
+	}
+
+	bs.moderation.record(parent, actorID, models.ModerationOpenBreakouts, "", map[string]interface{}{
+		"count":            request.Count,
+		"assignment":       request.Assignment,
+		"assigned":         len(assignments),
+		"duration_minutes": request.DurationMinutes,
+	}, nil)
+
+	return breakouts, nil
+}
+
+// assign returns the breakout number of each participant of the main room;
+// participants who stay in the main room are left out
+func (bs *BreakoutService) assign(parent *models.Room, participants []models.RoomParticipant, request models.OpenBreakoutsRequest) (map[string]int, error) {
+	numbers := make(map[string]int)
+
+	switch request.Assignment {
+	case "", models.BreakoutAssignAuto:
+		if len(request.Assignments) > 0 {
+			return nil, fmt.Errorf("%w: assignments are only used with manual assignment", ErrInvalidBreakout)
+		}
+
+		var guests []models.RoomParticipant
+		for _, participant := range participants {
+			host, err := bs.isHost(parent.ID, participant.UserID)
+			if err != nil {
+				return nil, err
+			}
+			if !host {
+				guests = append(guests, participant)
+			}
+		}
+
+		rand.Shuffle(len(guests), func(i, j int) { guests[i], guests[j] = guests[j], guests[i] })
+		for i, participant := range guests {
+			numbers[participant.Identity] = i%request.Count + 1
+		}
+
+	case models.BreakoutAssignManual:
+		present := make(map[string]bool, len(participants))
+		for _, participant := range participants {
+			present[participant.Identity] = true
+		}
+		for identity, number := range request.Assignments {
+			if !present[identity] {
+				return nil, fmt.Errorf("%w: %s is not in the room", ErrInvalidBreakout, identity)
+			}
+			if number < 0 || number > request.Count {
+				return nil, fmt.Errorf("%w: breakout number of %s must be between 0 and %d", ErrInvalidBreakout, identity, request.Count)
+			}
+			if number > 0 {
+				numbers[identity] = number
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: assignment must be auto or manual", ErrInvalidBreakout)
+	}
+
+	return numbers, nil
+}
+
+// isHost checks if a participant manages the room
+func (bs *BreakoutService) isHost(roomID uuid.UUID, userID *string) (bool, error) {
+	if userID == nil {
+		return false, nil
+	}
+	member, err := bs.memberService.GetMember(roomID, *userID)
+	if err != nil {
+		if errors.Is(err, ErrRoomMemberNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return member.CanManageRoom(), nil
+}
+
+// ListBreakouts returns the open breakout rooms of a room in order, with who
+// is assigned to and present in each of them
+func (bs *BreakoutService) ListBreakouts(parent *models.Room) ([]BreakoutRoom, error) {
+	rooms, err := bs.openBreakouts(parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return []BreakoutRoom{}, nil
+	}
+
+	var assignments []models.BreakoutAssignment
+	if err := bs.db.Where("parent_id = ?", parent.ID).Order("created_at").Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list breakout assignments: %w", err)
+	}
+
+	roomIDs := make([]uuid.UUID, len(rooms))
+	for i := range rooms {
+		roomIDs[i] = rooms[i].ID
+	}
+	var participants []models.RoomParticipant
+	if err := bs.db.Where("room_id IN ? AND left_at IS NULL", roomIDs).Find(&participants).Error; err != nil {
+		return nil, fmt.Errorf("failed to get breakout participants: %w", err)
+	}
+
+	return bs.breakoutRooms(rooms, assignments, participants), nil
+}
+
+// GetAssignment returns the open breakout room an identity is assigned to
+func (bs *BreakoutService) GetAssignment(parent *models.Room, identity string) (*models.Room, error) {
+	var assignment models.BreakoutAssignment
+	result := bs.db.Where("parent_id = ? AND identity = ?", parent.ID, identity).First(&assignment)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNoBreakouts
+		}
+		return nil, fmt.Errorf("failed to get breakout assignment: %w", result.Error)
+	}
+
+	room, err := bs.roomService.GetRoomByID(assignment.RoomID)
+	if err != nil || room.IsExpired() {
+		return nil, ErrNoBreakouts
+	}
+	return room, nil
+}
+
+// Assign moves participants between a room and its open breakout rooms and
+// sends the ones who are in a call to their new room. Breakout number 0 is
+// the main room.
+func (bs *BreakoutService) Assign(ctx context.Context, parent *models.Room, actorID string, request models.BreakoutAssignmentsRequest) ([]BreakoutRoom, error) {
+	rooms, err := bs.openBreakouts(parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return nil, ErrNoBreakouts
+	}
+
+	roomIDs := []uuid.UUID{parent.ID}
+	byID := map[uuid.UUID]*models.Room{parent.ID: parent}
+	for i := range rooms {
+		roomIDs = append(roomIDs, rooms[i].ID)
+		byID[rooms[i].ID] = &rooms[i]
+	}
+
+	// Check the whole request before moving anyone
+	current := make(map[string]*models.RoomParticipant, len(request.Assignments))
+	for identity, number := range request.Assignments {
+		if number < 0 || number > len(rooms) {
+			return nil, fmt.Errorf("%w: breakout number of %s must be between 0 and %d", ErrInvalidBreakout, identity, len(rooms))
+		}
+
+		var participant models.RoomParticipant
+		result := bs.db.Where("room_id IN ? AND identity = ? AND left_at IS NULL", roomIDs, identity).
+			Order("joined_at DESC").
+			First(&participant)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrParticipantNotFound, identity)
+			}
+			return nil, fmt.Errorf("failed to get participant: %w", result.Error)
+		}
+		current[identity] = &participant
+	}
+
+	for identity, number := range request.Assignments {
+		participant := current[identity]
+		target := parent
+		if number > 0 {
+			target = &rooms[number-1]
+		}
+
+		err := bs.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("parent_id = ? AND identity = ?", parent.ID, identity).Delete(&models.BreakoutAssignment{}).Error; err != nil {
+				return err
+			}
+			if number == 0 {
+				return nil
+			}
+			return tx.Create(&models.BreakoutAssignment{
+				ParentID: parent.ID,
+				RoomID:   target.ID,
+				Identity: identity,
+				UserID:   participant.UserID,
+				Name:     participant.Name,
+			}).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to assign %s: %w", identity, err)
+		}
+
+		if participant.RoomID == target.ID {
+			continue
+		}
+		messageType := BreakoutMessage
+		if number == 0 {
+			messageType = BreakoutReturnMessage
+		}
+		if err := bs.moderation.sendRoomToken(ctx, byID[participant.RoomID], target, identity, participant.Name, participant.UserID, messageType); err != nil {
+			log.Printf("Failed to send %s to room %s: %v", identity, target.Name, err)
+		}
+	}
+
+	bs.moderation.record(parent, actorID, models.ModerationAssignBreakouts, "", map[string]interface{}{
+		"assignments": request.Assignments,
+	}, nil)
+
+	return bs.ListBreakouts(parent)
+}
+
+// CloseBreakouts closes the open breakout rooms of a room and sends their
+// participants back to it
+func (bs *BreakoutService) CloseBreakouts(ctx context.Context, parent *models.Room, actorID string) error {
+	rooms, err := bs.openBreakouts(parent.ID)
+	if err != nil {
+		return err
+	}
+	if len(rooms) == 0 {
+		return ErrNoBreakouts
+	}
+
+	closed := bs.closeRooms(ctx, parent, rooms, events.EventRoomDeactivated)
+
+	bs.moderation.record(parent, actorID, models.ModerationCloseBreakouts, "", map[string]interface{}{
+		"count": closed,
+	}, nil)
+
+	return nil
+}
+
+// StartTimerRoutine closes breakout rooms whose time is up, sending their
+// participants back to the main room
+func (bs *BreakoutService) StartTimerRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		bs.closeExpired()
+	}
+}
+
+// closeExpired closes the breakout rooms that have expired
+func (bs *BreakoutService) closeExpired() {
+	var rooms []models.Room
+	result := bs.db.Where("parent_id IS NOT NULL AND is_active = ? AND expires_at IS NOT NULL AND expires_at <= ?", true, time.Now()).
+		Order("breakout_number").
+		Find(&rooms)
+	if result.Error != nil {
+		log.Printf("Error finding expired breakout rooms: %v", result.Error)
+		return
+	}
+
+	byParent := make(map[uuid.UUID][]models.Room)
+	for _, room := range rooms {
+		byParent[*room.ParentID] = append(byParent[*room.ParentID], room)
+	}
+
+	for parentID, expired := range byParent {
+		// Participants of a main room that has ended have nowhere to go back to
+		parent, err := bs.roomService.GetRoomByID(parentID)
+		if err != nil {
+			parent = nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		bs.closeRooms(ctx, parent, expired, events.EventRoomExpired)
+		cancel()
+	}
+}
+
+// closeRooms marks breakout rooms as inactive, sends the participants in
+// their calls back to the main room when it's still open, and returns how
+// many rooms it closed
+func (bs *BreakoutService) closeRooms(ctx context.Context, parent *models.Room, rooms []models.Room, eventType string) int {
+	returning := parent != nil && !parent.IsExpired()
+
+	var closed []models.Room
+	for i := range rooms {
+		room := &rooms[i]
+
+		// Another replica or the main room may have closed it already
+		result := bs.db.Model(room).Where("is_active = ?", true).Update("is_active", false)
+		if result.Error != nil {
+			log.Printf("Failed to close breakout room %s: %v", room.Name, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		closed = append(closed, *room)
+
+		if returning {
+			bs.sendBack(ctx, parent, room)
+		}
+
+		events.Publish(room.Name, events.EventBreakoutsClosed, map[string]interface{}{
+			"room":      events.NewRoomData(room),
+			"main_room": room.ParentID,
+		})
+		emitRoomEvent(bs.db, eventType, room, events.NewRoomData(room))
+
+		closeRoom(bs.db, room, time.Now())
+		bs.db.Where("room_id = ?", room.ID).Delete(&models.BreakoutAssignment{})
+	}
+
+	if parent != nil && len(closed) > 0 {
+		data := make([]*events.RoomData, len(closed))
+		for i := range closed {
+			data[i] = events.NewRoomData(&closed[i])
+		}
+		events.Publish(parent.Name, events.EventBreakoutsClosed, map[string]interface{}{
+			"breakouts": data,
+		})
+	}
+
+	return len(closed)
+}
+
+// sendBack sends everyone in the call of a breakout room a token for the
+// main room
+func (bs *BreakoutService) sendBack(ctx context.Context, parent, room *models.Room) {
+	response, err := bs.moderation.client.ListParticipants(ctx, &livekit.ListParticipantsRequest{Room: room.Name})
+	if err != nil {
+		if !errors.Is(liveKitError(err), ErrParticipantNotFound) {
+			log.Printf("Failed to list participants of breakout room %s: %v", room.Name, err)
+		}
+		return
+	}
+
+	for _, participant := range response.Participants {
+		if participant.Kind == livekit.ParticipantInfo_EGRESS || participant.Identity == ChatRecorderIdentity {
+			continue
+		}
+		err := bs.moderation.sendRoomToken(ctx, room, parent, participant.Identity, participant.Name, metadataUserID(participant.Metadata), BreakoutReturnMessage)
+		if err != nil {
+			log.Printf("Failed to send %s back to room %s: %v", participant.Identity, parent.Name, err)
+		}
+	}
+}
+
+// openBreakouts returns the active breakout rooms of a room in order
+func (bs *BreakoutService) openBreakouts(parentID uuid.UUID) ([]models.Room, error) {
+	var rooms []models.Room
+	if err := bs.db.Where("parent_id = ? AND is_active = ?", parentID, true).Order("breakout_number").Find(&rooms).Error; err != nil {
+		return nil, fmt.Errorf("failed to list breakout rooms: %w", err)
+	}
+	return rooms, nil
+}
+
+// breakoutRooms groups assignments and present participants by room
+func (bs *BreakoutService) breakoutRooms(rooms []models.Room, assignments []models.BreakoutAssignment, participants []models.RoomParticipant) []BreakoutRoom {
+	breakouts := make([]BreakoutRoom, len(rooms))
+	index := make(map[uuid.UUID]int, len(rooms))
+	for i := range rooms {
+		breakouts[i] = BreakoutRoom{
+			Room:        rooms[i],
+			Assignments: []models.BreakoutAssignment{},
+			Present:     []string{},
+		}
+		index[rooms[i].ID] = i
+	}
+
+	for _, assignment := range assignments {
+		if i, ok := index[assignment.RoomID]; ok {
+			breakouts[i].Assignments = append(breakouts[i].Assignments, assignment)
+		}
+	}
+	for _, participant := range participants {
+		if i, ok := index[participant.RoomID]; ok {
+			breakouts[i].Present = append(breakouts[i].Present, participant.Identity)
+		}
+	}
+	for i := range breakouts {
+		sort.Strings(breakouts[i].Present)
+	}
+
+	return breakouts
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// newTestBreakoutService returns a service for a main room with its owner
+// "host", a signed-in participant "alice" and two guests in it
+func newTestBreakoutService(t *testing.T, client *fakeRoomClient) (*BreakoutService, *models.Room) {
+	t.Helper()
+
+	db := testdb.Open(t,
+		&models.Room{},
+		&models.RoomParticipant{},
+		&models.RoomMember{},
+		&models.RoomPolicy{},
+		&models.BreakoutAssignment{},
+		&models.Meeting{},
+		&models.ModerationAction{},
+		&models.Ban{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+	)
+	tokenIssuer := NewTokenIssuer("devkey", "breakout-test-secret-of-32-bytes!", "ws://localhost:7880")
+	bs := &BreakoutService{
+		db:            db,
+		roomService:   &RoomService{db: db},
+		memberService: &RoomMemberService{db: db},
+		policyService: &RoomPolicyService{db: db},
+		moderation:    NewModerationService(db, client, tokenIssuer),
+	}
+
+	parent := models.CreateAuthenticatedRoom("abc-defg-hij", "host")
+	if err := db.Create(parent).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	db.Create(&models.RoomMember{RoomID: parent.ID, UserID: "host", Role: models.RoomRoleOwner})
+
+	host, alice := "host", "alice"
+	for _, participant := range []models.RoomParticipant{
+		{UserID: &host, Identity: "host", Name: "Host"},
+		{UserID: &alice, Identity: "alice", Name: "Alice"},
+		{Identity: "guest-1", Name: "Guest 1", IsGuest: true},
+		{Identity: "guest-2", Name: "Guest 2", IsGuest: true},
+	} {
+		participant.RoomID = parent.ID
+		participant.JoinedAt = time.Now()
+		if err := db.Create(&participant).Error; err != nil {
+			t.Fatalf("failed to create participant: %v", err)
+		}
+	}
+
+	return bs, parent
+}
+
+// sentMessages returns the identity and message type of everything sent
+func sentMessages(t *testing.T, client *fakeRoomClient) map[string]string {
+	t.Helper()
+	messages := make(map[string]string)
+	for _, request := range client.sent {
+		var message struct {
+			Type     string `json:"type"`
+			RoomName string `json:"room_name"`
+			Token    string `json:"token"`
+		}
+		if err := json.Unmarshal(request.Data, &message); err != nil {
+			t.Fatalf("failed to decode message: %v", err)
+		}
+		if message.Token == "" {
+			t.Errorf("message to %v has no token", request.DestinationIdentities)
+		}
+		for _, identity := range request.DestinationIdentities {
+			messages[identity] = message.Type + ":" + message.RoomName
+		}
+	}
+	return messages
+}
+
+func assignedIdentities(breakout BreakoutRoom) []string {
+	identities := make([]string, 0, len(breakout.Assignments))
+	for _, assignment := range breakout.Assignments {
+		identities = append(identities, assignment.Identity)
+	}
+	sort.Strings(identities)
+	return identities
+}
+
+func TestOpenBreakoutsAutoAssignment(t *testing.T) {
+	client := newFakeRoomClient()
+	bs, parent := newTestBreakoutService(t, client)
+
+	breakouts, err := bs.OpenBreakouts(context.Background(), parent, "host", models.OpenBreakoutsRequest{Count: 2, DurationMinutes: 15})
+	if err != nil {
+		t.Fatalf("OpenBreakouts: %v", err)
+	}
+	if len(breakouts) != 2 {
+		t.Fatalf("got %d breakout rooms, want 2", len(breakouts))
+	}
+
+	// The three participants who aren't hosts are spread over the rooms
+	assigned := make(map[string]*models.Room)
+	for i := range breakouts {
+		breakout := &breakouts[i]
+		if breakout.Room.ParentID == nil || *breakout.Room.ParentID != parent.ID || breakout.Room.BreakoutNumber != i+1 {
+			t.Errorf("breakout %d is %+v, want breakout %d of the main room", i, breakout.Room, i+1)
+		}
+		if breakout.Room.ExpiresAt == nil || time.Until(*breakout.Room.ExpiresAt) > 15*time.Minute {
+			t.Errorf("breakout %d expires at %v, want within 15 minutes", i, breakout.Room.ExpiresAt)
+		}
+		if n := len(breakout.Assignments); n < 1 || n > 2 {
+			t.Errorf("breakout %d has %d participants, want 1 or 2", i, n)
+		}
+		for _, assignment := range breakout.Assignments {
+			assigned[assignment.Identity] = &breakout.Room
+		}
+
+		// Breakout rooms share the hosts of their main room
+		if member, err := bs.memberService.GetMember(breakout.Room.ID, "host"); err != nil || member.Role != models.RoomRoleOwner {
+			t.Errorf("breakout %d: host is %v (%v), want the owner", i, member, err)
+		}
+	}
+	if _, ok := assigned["host"]; ok || len(assigned) != 3 {
+		t.Errorf("assigned %v, want alice and both guests", assigned)
+	}
+
+	for identity, room := range assigned {
+		if ok, err := bs.roomService.HasBreakoutAssignment(room.ID, identity); err != nil || !ok {
+			t.Errorf("%s: HasBreakoutAssignment = %v (%v), want true", identity, ok, err)
+		}
+		if ok, _ := bs.roomService.HasBreakoutAssignment(parent.ID, identity); ok {
+			t.Errorf("%s is assigned to the main room", identity)
+		}
+		if got, err := bs.GetAssignment(parent, identity); err != nil || got.ID != room.ID {
+			t.Errorf("%s: GetAssignment = %v (%v), want %s", identity, got, err, room.Name)
+		}
+	}
+	if _, err := bs.GetAssignment(parent, "host"); !errors.Is(err, ErrNoBreakouts) {
+		t.Errorf("host: GetAssignment err = %v, want %v", err, ErrNoBreakouts)
+	}
+
+	// Everyone assigned is sent a token for their breakout room
+	messages := sentMessages(t, client)
+	for identity, room := range assigned {
+		if messages[identity] != BreakoutMessage+":"+room.Name {
+			t.Errorf("%s was sent %q, want %s:%s", identity, messages[identity], BreakoutMessage, room.Name)
+		}
+	}
+
+	if _, err := bs.OpenBreakouts(context.Background(), parent, "host", models.OpenBreakoutsRequest{Count: 2}); !errors.Is(err, ErrBreakoutsOpen) {
+		t.Errorf("opening twice: err = %v, want %v", err, ErrBreakoutsOpen)
+	}
+	if _, err := bs.OpenBreakouts(context.Background(), &breakouts[0].Room, "host", models.OpenBreakoutsRequest{Count: 2}); !errors.Is(err, ErrInvalidBreakout) {
+		t.Errorf("breakouts of a breakout room: err = %v, want %v", err, ErrInvalidBreakout)
+	}
+}
+
+func TestOpenBreakoutsManualAssignment(t *testing.T) {
+	client := newFakeRoomClient()
+	bs, parent := newTestBreakoutService(t, client)
+
+	invalid := map[string]models.OpenBreakoutsRequest{
+		"not in the room":         {Count: 2, Assignment: models.BreakoutAssignManual, Assignments: map[string]int{"nobody": 1}},
+		"number out of range":     {Count: 2, Assignment: models.BreakoutAssignManual, Assignments: map[string]int{"alice": 3}},
+		"assignments with auto":   {Count: 2, Assignments: map[string]int{"alice": 1}},
+		"unknown assignment mode": {Count: 2, Assignment: "random"},
+	}
+	for name, request := range invalid {
+		if _, err := bs.OpenBreakouts(context.Background(), parent, "host", request); !errors.Is(err, ErrInvalidBreakout) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidBreakout)
+		}
+	}
+
+	request := models.OpenBreakoutsRequest{
+		Count:       2,
+		Assignment:  models.BreakoutAssignManual,
+		Assignments: map[string]int{"alice": 1, "guest-1": 2, "guest-2": 0},
+	}
+	breakouts, err := bs.OpenBreakouts(context.Background(), parent, "host", request)
+	if err != nil {
+		t.Fatalf("OpenBreakouts: %v", err)
+	}
+	if got := assignedIdentities(breakouts[0]); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("breakout 1 has %v, want alice", got)
+	}
+	if got := assignedIdentities(breakouts[1]); len(got) != 1 || got[0] != "guest-1" {
+		t.Errorf("breakout 2 has %v, want guest-1", got)
+	}
+	if _, sent := sentMessages(t, client)["guest-2"]; sent {
+		t.Error("guest-2 stays in the main room but was sent to a breakout room")
+	}
+}
+
+func TestAssignBreakouts(t *testing.T) {
+	client := newFakeRoomClient()
+	bs, parent := newTestBreakoutService(t, client)
+
+	if _, err := bs.Assign(context.Background(), parent, "host", models.BreakoutAssignmentsRequest{Assignments: map[string]int{"alice": 1}}); !errors.Is(err, ErrNoBreakouts) {
+		t.Errorf("without breakout rooms: err = %v, want %v", err, ErrNoBreakouts)
+	}
+
+	request := models.OpenBreakoutsRequest{Count: 2, Assignment: models.BreakoutAssignManual, Assignments: map[string]int{"alice": 1}}
+	breakouts, err := bs.OpenBreakouts(context.Background(), parent, "host", request)
+	if err != nil {
+		t.Fatalf("OpenBreakouts: %v", err)
+	}
+	first, second := breakouts[0].Room, breakouts[1].Room
+
+	// Alice is in her breakout room's call when she is moved on
+	bs.db.Model(&models.RoomParticipant{}).Where("identity = ?", "alice").Update("room_id", first.ID)
+	client.sent = nil
+
+	breakouts, err = bs.Assign(context.Background(), parent, "host", models.BreakoutAssignmentsRequest{Assignments: map[string]int{"alice": 2, "guest-1": 1}})
+	if err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	if got := assignedIdentities(breakouts[1]); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("breakout 2 has %v, want alice", got)
+	}
+	if ok, _ := bs.roomService.HasBreakoutAssignment(first.ID, "alice"); ok {
+		t.Error("alice is still assigned to her first breakout room")
+	}
+	messages := sentMessages(t, client)
+	if messages["alice"] != BreakoutMessage+":"+second.Name || messages["guest-1"] != BreakoutMessage+":"+first.Name {
+		t.Errorf("sent %v, want alice to %s and guest-1 to %s", messages, second.Name, first.Name)
+	}
+
+	// Breakout number 0 brings someone back to the main room
+	client.sent = nil
+	bs.db.Model(&models.RoomParticipant{}).Where("identity = ?", "alice").Update("room_id", second.ID)
+	if _, err := bs.Assign(context.Background(), parent, "host", models.BreakoutAssignmentsRequest{Assignments: map[string]int{"alice": 0}}); err != nil {
+		t.Fatalf("Assign to the main room: %v", err)
+	}
+	if ok, _ := bs.roomService.HasBreakoutAssignment(second.ID, "alice"); ok {
+		t.Error("alice is still assigned after returning to the main room")
+	}
+	if messages := sentMessages(t, client); messages["alice"] != BreakoutReturnMessage+":"+parent.Name {
+		t.Errorf("sent %v, want alice back to %s", messages, parent.Name)
+	}
+
+	invalid := map[string]map[string]int{
+		"number out of range": {"alice": 3},
+		"negative number":     {"alice": -1},
+	}
+	for name, assignments := range invalid {
+		if _, err := bs.Assign(context.Background(), parent, "host", models.BreakoutAssignmentsRequest{Assignments: assignments}); !errors.Is(err, ErrInvalidBreakout) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidBreakout)
+		}
+	}
+	if _, err := bs.Assign(context.Background(), parent, "host", models.BreakoutAssignmentsRequest{Assignments: map[string]int{"nobody": 1}}); !errors.Is(err, ErrParticipantNotFound) {
+		t.Errorf("unknown participant: err = %v, want %v", err, ErrParticipantNotFound)
+	}
+}
+
+func TestCloseBreakoutsSendsEveryoneBack(t *testing.T) {
+	egress := &livekit.ParticipantInfo{Identity: "EG_1", Kind: livekit.ParticipantInfo_EGRESS}
+	client := newFakeRoomClient(egress)
+	bs, parent := newTestBreakoutService(t, client)
+
+	if err := bs.CloseBreakouts(context.Background(), parent, "host"); !errors.Is(err, ErrNoBreakouts) {
+		t.Errorf("without breakout rooms: err = %v, want %v", err, ErrNoBreakouts)
+	}
+
+	request := models.OpenBreakoutsRequest{Count: 1, Assignment: models.BreakoutAssignManual, Assignments: map[string]int{"alice": 1}}
+	breakouts, err := bs.OpenBreakouts(context.Background(), parent, "host", request)
+	if err != nil {
+		t.Fatalf("OpenBreakouts: %v", err)
+	}
+	breakout := breakouts[0].Room
+
+	// Alice joined the breakout room's call
+	alice := "alice"
+	bs.db.Create(&models.RoomParticipant{RoomID: breakout.ID, UserID: &alice, Identity: "alice", Name: "Alice", JoinedAt: time.Now()})
+	client.participants["alice"] = &livekit.ParticipantInfo{Identity: "alice", Name: "Alice", Metadata: `{"user_id":"alice"}`}
+	client.sent = nil
+
+	if err := bs.CloseBreakouts(context.Background(), parent, "host"); err != nil {
+		t.Fatalf("CloseBreakouts: %v", err)
+	}
+
+	var stored models.Room
+	bs.db.Where("id = ?", breakout.ID).First(&stored)
+	if stored.IsActive {
+		t.Error("breakout room is still active")
+	}
+	if ok, _ := bs.roomService.HasBreakoutAssignment(breakout.ID, "alice"); ok {
+		t.Error("assignment outlived the breakout room")
+	}
+	var present int64
+	bs.db.Model(&models.RoomParticipant{}).Where("room_id = ? AND left_at IS NULL", breakout.ID).Count(&present)
+	if present != 0 {
+		t.Errorf("%d participants are still in the closed breakout room", present)
+	}
+
+	// Egress isn't sent anywhere
+	messages := sentMessages(t, client)
+	if len(messages) != 1 || messages["alice"] != BreakoutReturnMessage+":"+parent.Name {
+		t.Errorf("sent %v, want only alice back to %s", messages, parent.Name)
+	}
+
+	if err := bs.CloseBreakouts(context.Background(), parent, "host"); !errors.Is(err, ErrNoBreakouts) {
+		t.Errorf("closing twice: err = %v, want %v", err, ErrNoBreakouts)
+	}
+	if breakouts, err := bs.ListBreakouts(parent); err != nil || len(breakouts) != 0 {
+		t.Errorf("ListBreakouts = %v (%v), want none open", breakouts, err)
+	}
+}
+
+func TestBreakoutsCloseWithMainRoom(t *testing.T) {
+	bs, parent := newTestBreakoutService(t, newFakeRoomClient())
+
+	breakouts, err := bs.OpenBreakouts(context.Background(), parent, "host", models.OpenBreakoutsRequest{Count: 2})
+	if err != nil {
+		t.Fatalf("OpenBreakouts: %v", err)
+	}
+
+	if err := bs.roomService.DeactivateRoom(parent.ID); err != nil {
+		t.Fatalf("DeactivateRoom: %v", err)
+	}
+	for _, breakout := range breakouts {
+		var stored models.Room
+		bs.db.Where("id = ?", breakout.Room.ID).First(&stored)
+		if stored.IsActive {
+			t.Errorf("breakout %d is still active after its main room closed", breakout.Room.BreakoutNumber)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"meet-backend/internal/calendar"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+)
+
+// calendarFeedHistory is how long past and cancelled meetings stay in a feed
+const calendarFeedHistory = 30 * 24 * time.Hour
+
+// ErrCalendarFeedNotFound is returned for unknown or revoked feed tokens
+var ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+
+type CalendarService struct {
+	db             *gorm.DB
+	meetingService *MeetingService
+	frontendURL    string
+	uidDomain      string
+}
+
+func NewCalendarService() *CalendarService {
+	frontendURL := strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+
+	uidDomain := "meet"
+	if parsed, err := url.Parse(frontendURL); err == nil && parsed.Hostname() != "" {
+		uidDomain = parsed.Hostname()
+	}
+
+	return &CalendarService{
+		db:             database.GetDatabase(),
+		meetingService: NewMeetingService(),
+		frontendURL:    frontendURL,
+		uidDomain:      uidDomain,
+	}
+}
+
+// JoinURL returns the frontend URL of a room
+func (cs *CalendarService) JoinURL(roomName string) string {
+	return cs.frontendURL + "/rooms/" + url.PathEscape(roomName)
+}
+
+// MeetingCalendar returns a calendar with a single meeting
+func (cs *CalendarService) MeetingCalendar(meeting *models.Meeting) (*calendar.Calendar, error) {
+	event, err := cs.meetingEvent(meeting)
+	if err != nil {
+		return nil, err
+	}
+
+	return &calendar.Calendar{Events: []calendar.Event{*event}}, nil
+}
+
+// UserFeed returns the calendar feed of a user: the meetings they organize or
+// attend, with recently past and cancelled meetings kept for a while
+func (cs *CalendarService) UserFeed(userID string) (*calendar.Calendar, error) {
+	meetings, err := cs.meetingService.ListForUser(userID, time.Now().Add(-calendarFeedHistory))
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &calendar.Calendar{
+		Name:   "Meet",
+		Events: make([]calendar.Event, 0, len(meetings)),
+	}
+	for i := range meetings {
+		event, err := cs.meetingEvent(&meetings[i])
+		if err != nil {
+			return nil, err
+		}
+		feed.Events = append(feed.Events, *event)
+	}
+
+	return feed, nil
+}
+
+// CreateFeedToken creates a new feed token for a user, replacing the old one
+func (cs *CalendarService) CreateFeedToken(userID string) (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(data)
+
+	feed := &models.CalendarFeed{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		CreatedAt: time.Now(),
+	}
+	result := cs.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"token_hash", "created_at"}),
+	}).Create(feed)
+	if result.Error != nil {
+		return "", fmt.Errorf("failed to create calendar feed: %w", result.Error)
+	}
+
+	return token, nil
+}
+
+// RevokeFeedToken disables the calendar feed of a user
+func (cs *CalendarService) RevokeFeedToken(userID string) error {
+	result := cs.db.Where("user_id = ?", userID).Delete(&models.CalendarFeed{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke calendar feed: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrCalendarFeedNotFound
+	}
+
+	return nil
+}
+
+// FeedUser returns the ID of the user a feed token belongs to. Feeds of
+// disabled users are not served.
+func (cs *CalendarService) FeedUser(token string) (string, error) {
+	var feed models.CalendarFeed
+	result := cs.db.Where("token_hash = ?", hashToken(token)).First(&feed)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return "", ErrCalendarFeedNotFound
+		}
+		return "", fmt.Errorf("failed to get calendar feed: %w", result.Error)
+	}
+
+	var user models.User
+	if err := cs.db.Where("id = ?", feed.UserID).First(&user).Error; err != nil || user.Disabled {
+		return "", ErrCalendarFeedNotFound
+	}
+
+	return feed.UserID, nil
+}
+
+// meetingEvent converts a meeting into a VEVENT with its organizer and the
+// members of its room as attendees
+func (cs *CalendarService) meetingEvent(meeting *models.Meeting) (*calendar.Event, error) {
+	location, err := time.LoadLocation(meeting.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	joinURL := cs.JoinURL(meeting.RoomName)
+	description := "Join: " + joinURL
+	if meeting.Description != "" {
+		description = meeting.Description + "\n\n" + description
+	}
+
+	event := &calendar.Event{
+		UID:          meeting.ID.String() + "@" + cs.uidDomain,
+		Sequence:     meeting.Sequence,
+		Summary:      meeting.Title,
+		Description:  description,
+		URL:          joinURL,
+		Start:        meeting.StartsAt,
+		End:          meeting.EndsAt,
+		Location:     location,
+		RRule:        meeting.Recurrence,
+		ExDates:      meeting.ExcludedDates,
+		Status:       calendar.StatusConfirmed,
+		Created:      meeting.CreatedAt,
+		LastModified: meeting.UpdatedAt,
+	}
+	if meeting.IsCancelled() {
+		event.Status = calendar.StatusCancelled
+	}
+
+	var organizer models.User
+	if err := cs.db.Where("id = ?", meeting.OrganizerID).First(&organizer).Error; err == nil {
+		event.Organizer = &calendar.Person{Name: organizer.Name, Email: organizer.Email}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get organizer: %w", err)
+	}
+
+	// Room members are only known once the room was opened
+	var attendees []models.User
+	result := cs.db.Model(&models.User{}).
+		Joins("JOIN room_members ON room_members.user_id = users.id").
+		Joins("JOIN rooms ON rooms.id = room_members.room_id").
+		Where("rooms.name = ? AND users.id <> ?", meeting.RoomName, meeting.OrganizerID).
+		Order("users.name").
+		Find(&attendees)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get attendees: %w", result.Error)
+	}
+	listed := make(map[string]bool)
+	for _, attendee := range attendees {
+		event.Attendees = append(event.Attendees, calendar.Person{Name: attendee.Name, Email: attendee.Email})
+		listed[strings.ToLower(attendee.Email)] = true
+	}
+
+	// People invited by email who haven't joined yet
+	for _, email := range meeting.Invitees {
+		if !listed[email] && (event.Organizer == nil || !strings.EqualFold(event.Organizer.Email, email)) {
+			event.Attendees = append(event.Attendees, calendar.Person{Email: email})
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"meet-backend/internal/models"
+
+	"github.com/livekit/protocol/auth"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// ChatRecorderIdentity is the identity the chat recorder joins calls with
+const ChatRecorderIdentity = "chat-recorder"
+
+// Data topics of the chat in the LiveKit components
+const (
+	chatTopic       = "lk-chat-topic"
+	chatUpdateTopic = "lk-chat-update-topic"
+)
+
+// liveKitChatMessage is a chat message as sent by the LiveKit components
+type liveKitChatMessage struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// ChatRecorder joins calls as a hidden participant and stores their chat, so
+// messages sent in the call end up in the chat history too. It leaves when
+// the last participant does or the room closes. The calls it is in are kept
+// in memory, so it assumes a single replica.
+type ChatRecorder struct {
+	enabled     bool
+	apiKey      string
+	apiSecret   string
+	serverURL   string
+	roomService *RoomService
+	chatService *ChatService
+
+	mu    sync.Mutex
+	rooms map[string]*lksdk.Room
+}
+
+// NewChatRecorder creates a chat recorder; it only joins calls when
+// CHAT_RECORD_CALLS=true
+func NewChatRecorder(apiKey, apiSecret, serverURL string) *ChatRecorder {
+	enabled, _ := strconv.ParseBool(os.Getenv("CHAT_RECORD_CALLS"))
+
+	return &ChatRecorder{
+		enabled:     enabled,
+		apiKey:      apiKey,
+		apiSecret:   apiSecret,
+		serverURL:   serverURL,
+		roomService: NewRoomService(),
+		chatService: NewChatService(),
+		rooms:       make(map[string]*lksdk.Room),
+	}
+}
+
+// Start joins the call of a room, unless the recorder is disabled or
+// already in it
+func (cr *ChatRecorder) Start(roomName string) error {
+	if !cr.enabled {
+		return nil
+	}
+
+	room, err := cr.roomService.GetRoom(roomName)
+	if err != nil {
+		// Rooms created directly on the LiveKit server aren't recorded
+		return nil
+	}
+
+	// Claim the room so a repeated webhook doesn't join twice
+	cr.mu.Lock()
+	if _, ok := cr.rooms[roomName]; ok {
+		cr.mu.Unlock()
+		return nil
+	}
+	cr.rooms[roomName] = nil
+	cr.mu.Unlock()
+
+	token, err := cr.token(roomName)
+	if err != nil {
+		cr.release(roomName)
+		return err
+	}
+
+	callback := &lksdk.RoomCallback{
+		ParticipantCallback: lksdk.ParticipantCallback{
+			OnDataPacket: func(data lksdk.DataPacket, params lksdk.DataReceiveParams) {
+				if packet, ok := data.(*lksdk.UserDataPacket); ok {
+					cr.receive(room, packet, params)
+				}
+			},
+		},
+		OnParticipantDisconnected: func(*lksdk.RemoteParticipant) {
+			cr.leaveIfEmpty(roomName)
+		},
+		OnDisconnected: func() {
+			cr.release(roomName)
+		},
+	}
+
+	call, err := lksdk.ConnectToRoomWithToken(cr.serverURL, token, callback, lksdk.WithAutoSubscribe(false))
+	if err != nil {
+		cr.release(roomName)
+		return err
+	}
+
+	cr.mu.Lock()
+	if _, ok := cr.rooms[roomName]; !ok {
+		// Stopped while joining
+		cr.mu.Unlock()
+		call.Disconnect()
+		return nil
+	}
+	cr.rooms[roomName] = call
+	cr.mu.Unlock()
+
+	// Everyone may have left while joining
+	cr.leaveIfEmpty(roomName)
+
+	return nil
+}
+
+// Stop leaves the call of a room
+func (cr *ChatRecorder) Stop(roomName string) {
+	cr.mu.Lock()
+	call, ok := cr.rooms[roomName]
+	delete(cr.rooms, roomName)
+	cr.mu.Unlock()
+
+	if ok && call != nil {
+		call.Disconnect()
+	}
+}
+
+// leaveIfEmpty leaves the call of a room when nobody but the recorder and
+// egress is in it. LiveKit only finishes a room once it is empty, so staying
+// would keep it open.
+func (cr *ChatRecorder) leaveIfEmpty(roomName string) {
+	cr.mu.Lock()
+	call := cr.rooms[roomName]
+	cr.mu.Unlock()
+	if call == nil {
+		return
+	}
+
+	for _, participant := range call.GetRemoteParticipants() {
+		if participant.Kind() != lksdk.ParticipantEgress && participant.Identity() != ChatRecorderIdentity {
+			return
+		}
+	}
+	cr.Stop(roomName)
+}
+
+// release forgets the call of a room
+func (cr *ChatRecorder) release(roomName string) {
+	cr.mu.Lock()
+	delete(cr.rooms, roomName)
+	cr.mu.Unlock()
+}
+
+// token returns a token to join a call hidden and without publishing
+func (cr *ChatRecorder) token(roomName string) (string, error) {
+	canPublish := false
+	grant := &auth.VideoGrant{
+		RoomJoin:   true,
+		Room:       roomName,
+		Hidden:     true,
+		CanPublish: &canPublish,
+	}
+
+	return auth.NewAccessToken(cr.apiKey, cr.apiSecret).
+		AddGrant(grant).
+		SetIdentity(ChatRecorderIdentity).
+		SetName("Chat recorder").
+		SetValidFor(24 * time.Hour).
+		ToJWT()
+}
+
+// receive stores a chat message or edit sent in a call
+func (cr *ChatRecorder) receive(room *models.Room, packet *lksdk.UserDataPacket, params lksdk.DataReceiveParams) {
+	// Data sent by the server has no sender
+	if params.Sender == nil || (packet.Topic != chatTopic && packet.Topic != chatUpdateTopic) {
+		return
+	}
+
+	var message liveKitChatMessage
+	if err := json.Unmarshal(packet.Payload, &message); err != nil {
+		return
+	}
+
+	var err error
+	if packet.Topic == chatUpdateTopic {
+		err = cr.chatService.IngestEdit(room, params.SenderIdentity, message.ID, message.Message)
+	} else {
+		sender := ChatSender{
+			Identity: params.SenderIdentity,
+			Name:     params.Sender.Name(),
+			UserID:   metadataUserID(params.Sender.Metadata()),
+		}
+		_, err = cr.chatService.Ingest(room, sender, message.ID, message.Message)
+	}
+	if err != nil && !errors.Is(err, ErrInvalidChatMessage) && !errors.Is(err, ErrChatMessageNotFound) {
+		log.Printf("Failed to record chat message in room %s: %v", room.Name, err)
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+
+	"meet-backend/internal/models"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestChatRecorderStopsWhenRoomCloses(t *testing.T) {
+	rs := newTestRoomService(t)
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	createTestRoom(t, rs, room)
+	other := models.CreateAuthenticatedRoom("klm-nopq-rst", "owner")
+	createTestRoom(t, rs, other)
+
+	// The recorder is still joining both calls
+	cr := &ChatRecorder{enabled: true, roomService: rs, rooms: map[string]*lksdk.Room{room.Name: nil, other.Name: nil}}
+	OnRoomClosed(cr.Stop)
+
+	if err := rs.DeactivateRoom(room.ID); err != nil {
+		t.Fatalf("DeactivateRoom: %v", err)
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if _, ok := cr.rooms[room.Name]; ok {
+		t.Error("the recorder is still in the call of the closed room")
+	}
+	if _, ok := cr.rooms[other.Name]; !ok {
+		t.Error("the recorder left the call of a room that is still open")
+	}
+}
+
+func TestChatRecorderStartSkipsDisabledAndUnknownRooms(t *testing.T) {
+	rs := newTestRoomService(t)
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	createTestRoom(t, rs, room)
+
+	disabled := &ChatRecorder{roomService: rs, rooms: make(map[string]*lksdk.Room)}
+	if err := disabled.Start(room.Name); err != nil || len(disabled.rooms) != 0 {
+		t.Errorf("disabled recorder: %v, joined %v, want nothing", err, disabled.rooms)
+	}
+
+	// Rooms created directly on the LiveKit server aren't recorded
+	enabled := &ChatRecorder{enabled: true, roomService: rs, rooms: make(map[string]*lksdk.Room)}
+	if err := enabled.Start("not-in-the-database"); err != nil || len(enabled.rooms) != 0 {
+		t.Errorf("unknown room: %v, joined %v, want nothing", err, enabled.rooms)
+	}
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"meet-backend/internal/database"
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultChatRetention is how long chat messages are kept without CHAT_RETENTION_DAYS
+const defaultChatRetention = 90 * 24 * time.Hour
+
+var (
+	ErrChatMessageNotFound = errors.New("chat message not found")
+	ErrInvalidChatMessage  = errors.New("invalid chat message")
+)
+
+// ChatSender is who sends a chat message
+type ChatSender struct {
+	Identity string
+	Name     string
+	UserID   *string // nil for guests
+}
+
+// ChatPage is a page of chat messages, oldest first. NextCursor continues in
+// the same direction and is empty on the last page.
+type ChatPage struct {
+	Messages   []models.ChatMessage `json:"messages"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// ChatService stores the chat of rooms so it outlives the call
+type ChatService struct {
+	db        *gorm.DB
+	retention time.Duration // zero keeps messages forever
+}
+
+// NewChatService creates a chat service; CHAT_RETENTION_DAYS sets how long
+// messages are kept (default 90, 0 keeps them forever)
+func NewChatService() *ChatService {
+	retention := defaultChatRetention
+	if days, err := strconv.Atoi(os.Getenv("CHAT_RETENTION_DAYS")); err == nil && days >= 0 {
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+
+	return &ChatService{
+		db:        database.GetDatabase(),
+		retention: retention,
+	}
+}
+
+// Send posts a message to the chat of a room
+func (cs *ChatService) Send(room *models.Room, sender ChatSender, request models.SendChatMessageRequest) (*models.ChatMessage, error) {
+	content := strings.TrimSpace(request.Content)
+	if content == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidChatMessage)
+	}
+
+	if request.ReplyToID != nil {
+		if _, err := cs.GetMessage(room.ID, *request.ReplyToID); err != nil {
+			if errors.Is(err, ErrChatMessageNotFound) {
+				return nil, fmt.Errorf("%w: the message replied to is not in this room", ErrInvalidChatMessage)
+			}
+			return nil, err
+		}
+	}
+
+	message := &models.ChatMessage{
+		RoomID:         room.ID,
+		SenderIdentity: sender.Identity,
+		SenderName:     sender.Name,
+		SenderUserID:   sender.UserID,
+		Content:        content,
+		ReplyToID:      request.ReplyToID,
+		Source:         models.ChatSourceAPI,
+	}
+	if err := cs.db.Create(message).Error; err != nil {
+		return nil, fmt.Errorf("failed to store chat message: %w", err)
+	}
+
+	publishChatEvent(room, events.EventChatMessage, message)
+
+	return message, nil
+}
+
+// Ingest stores a message from the chat of a call. Messages are identified
+// by their ID in the call, so one that is received twice is stored once; it
+// returns nil for those.
+func (cs *ChatService) Ingest(room *models.Room, sender ChatSender, clientID, content string) (*models.ChatMessage, error) {
+	content = strings.TrimSpace(content)
+	if content == "" || clientID == "" {
+		return nil, fmt.Errorf("%w: id and message are required", ErrInvalidChatMessage)
+	}
+
+	message := &models.ChatMessage{
+		RoomID:         room.ID,
+		ClientID:       &clientID,
+		SenderIdentity: sender.Identity,
+		SenderName:     sender.Name,
+		SenderUserID:   sender.UserID,
+		Content:        content,
+		Source:         models.ChatSourceLiveKit,
+	}
+	result := cs.db.Clauses(clause.OnConflict{DoNothing: true}).Create(message)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to store chat message: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	publishChatEvent(room, events.EventChatMessage, message)
+
+	return message, nil
+}
+
+// IngestEdit applies an edit from the chat of a call to a message its
+// sender wrote there
+func (cs *ChatService) IngestEdit(room *models.Room, identity, clientID, content string) error {
+	var message models.ChatMessage
+	result := cs.db.Where("room_id = ? AND client_id = ? AND sender_identity = ?", room.ID, clientID, identity).First(&message)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrChatMessageNotFound
+		}
+		return fmt.Errorf("failed to get chat message: %w", result.Error)
+	}
+
+	_, err := cs.Edit(room, &message, content)
+	return err
+}
+
+// GetMessage retrieves a message of a room
+func (cs *ChatService) GetMessage(roomID, id uuid.UUID) (*models.ChatMessage, error) {
+	var message models.ChatMessage
+	result := cs.db.Where("room_id = ? AND id = ?", roomID, id).First(&message)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrChatMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to get chat message: %w", result.Error)
+	}
+
+	return &message, nil
+}
+
+// Edit replaces the content of a message and marks it as edited
+func (cs *ChatService) Edit(room *models.Room, message *models.ChatMessage, content string) (*models.ChatMessage, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidChatMessage)
+	}
+	if message.IsDeleted() {
+		return nil, fmt.Errorf("%w: the message was deleted", ErrInvalidChatMessage)
+	}
+
+	now := time.Now()
+	result := cs.db.Model(message).Updates(map[string]interface{}{
+		"content":   content,
+		"edited_at": now,
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to edit chat message: %w", result.Error)
+	}
+	message.Content = content
+	message.EditedAt = &now
+
+	publishChatEvent(room, events.EventChatEdited, message)
+
+	return message, nil
+}
+
+// Delete removes the content of a message, keeping who deleted it and when
+func (cs *ChatService) Delete(room *models.Room, message *models.ChatMessage, deletedBy string) error {
+	if message.IsDeleted() {
+		return nil
+	}
+
+	now := time.Now()
+	result := cs.db.Model(message).Updates(map[string]interface{}{
+		"content":    "",
+		"deleted_at": now,
+		"deleted_by": deletedBy,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete chat message: %w", result.Error)
+	}
+	message.Content = ""
+	message.DeletedAt = &now
+	message.DeletedBy = &deletedBy
+
+	publishChatEvent(room, events.EventChatDeleted, message)
+
+	return nil
+}
+
+// ListMessages returns a page of the chat of a room. Without a cursor it
+// returns the latest messages; with before it pages back to older messages
+// and with after forward to newer ones.
+func (cs *ChatService) ListMessages(roomID uuid.UUID, cursor string, after bool, limit int) (*ChatPage, error) {
+	query := cs.db.Where("room_id = ?", roomID)
+	if cursor != "" {
+		createdAt, id, err := decodeChatCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if after {
+			query = query.Where("(created_at, id) > (?, ?)", createdAt, id)
+		} else {
+			query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+		}
+	}
+
+	order := "created_at DESC, id DESC"
+	if after {
+		order = "created_at, id"
+	}
+
+	var messages []models.ChatMessage
+	if err := query.Order(order).Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to list chat messages: %w", err)
+	}
+
+	page := &ChatPage{Messages: messages}
+	if len(messages) > limit {
+		page.Messages = messages[:limit]
+		page.NextCursor = encodeChatCursor(&page.Messages[limit-1])
+	}
+	if !after {
+		for i, j := 0, len(page.Messages)-1; i < j; i, j = i+1, j-1 {
+			page.Messages[i], page.Messages[j] = page.Messages[j], page.Messages[i]
+		}
+	}
+
+	return page, nil
+}
+
+// Transcript returns the whole chat of a room, oldest first
+func (cs *ChatService) Transcript(roomID uuid.UUID) ([]models.ChatMessage, error) {
+	var messages []models.ChatMessage
+	if err := cs.db.Where("room_id = ?", roomID).Order("created_at, id").Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get chat transcript: %w", err)
+	}
+	return messages, nil
+}
+
+// MarkdownTranscript formats the chat of a room as Markdown
+func (cs *ChatService) MarkdownTranscript(room *models.Room, messages []models.ChatMessage) string {
+	names := make(map[uuid.UUID]string, len(messages))
+	for _, message := range messages {
+		names[message.ID] = message.SenderName
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Chat %s\n\n", room.Name)
+	fmt.Fprintf(&b, "Exported %s, %d messages\n\n", time.Now().UTC().Format("2006-01-02 15:04 MST"), len(messages))
+
+	for _, message := range messages {
+		name := message.SenderName
+		if name == "" {
+			name = message.SenderIdentity
+		}
+		fmt.Fprintf(&b, "**%s** %s", name, message.CreatedAt.UTC().Format("2006-01-02 15:04:05"))
+		if message.ReplyToID != nil {
+			fmt.Fprintf(&b, ", reply to %s", names[*message.ReplyToID])
+		}
+		if message.EditedAt != nil && !message.IsDeleted() {
+			b.WriteString(" (edited)")
+		}
+		b.WriteString("\n\n")
+
+		if message.IsDeleted() {
+			b.WriteString("_Message deleted_\n\n")
+			continue
+		}
+		for _, line := range strings.Split(message.Content, "\n") {
+			fmt.Fprintf(&b, "> %s\n", line)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// publishChatEvent sends a chat message to the room event stream. Events
+// carry the message, so this relies on the stream only being open to the
+// readers of the chat (see CanRead).
+func publishChatEvent(room *models.Room, eventType string, message *models.ChatMessage) {
+	events.Publish(room.Name, eventType, message)
+}
+
+// CanRead checks if a user may read the chat of a room: members of the room
+// and everyone who joined it, also after the meeting. The room event stream,
+// which carries the chat events, is open to the same users.
+func (cs *ChatService) CanRead(roomID uuid.UUID, userID string) (bool, error) {
+	return isMemberOrParticipant(cs.db, roomID, userID)
+}
+
+// IsPresent checks if a user is in the call of a room
+func (cs *ChatService) IsPresent(roomID uuid.UUID, userID string) (bool, error) {
+	var count int64
+	if err := cs.db.Model(&models.RoomParticipant{}).Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check participants: %w", err)
+	}
+	return count > 0, nil
+}
+
+// StartRetentionRoutine deletes chat messages older than the retention period
+func (cs *ChatService) StartRetentionRoutine() {
+	if cs.retention == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cs.purgeExpired()
+	}
+}
+
+// purgeExpired deletes chat messages older than the retention period
+func (cs *ChatService) purgeExpired() {
+	result := cs.db.Where("created_at < ?", time.Now().Add(-cs.retention)).Delete(&models.ChatMessage{})
+	if result.Error != nil {
+		log.Printf("Error removing old chat messages: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d chat messages past retention", result.RowsAffected)
+	}
+}
+
+// encodeChatCursor returns the cursor of the position of a message
+func encodeChatCursor(message *models.ChatMessage) string {
+	value := message.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + message.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// decodeChatCursor returns the position a cursor points at
+func decodeChatCursor(cursor string) (time.Time, uuid.UUID, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalidChatMessage)
+
+	value, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	parts := strings.SplitN(string(value), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+
+	return createdAt, id, nil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func newTestChatService(t *testing.T) (*ChatService, *models.Room) {
+	t.Helper()
+	cs := &ChatService{
+		db:        testdb.Open(t, &models.Room{}, &models.RoomParticipant{}, &models.RoomMember{}, &models.ChatMessage{}),
+		retention: defaultChatRetention,
+	}
+
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	if err := cs.db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	return cs, room
+}
+
+func mustSend(t *testing.T, cs *ChatService, room *models.Room, userID, content string) *models.ChatMessage {
+	t.Helper()
+	message, err := cs.Send(room, ChatSender{Identity: userID, Name: userID, UserID: &userID}, models.SendChatMessageRequest{Content: content})
+	if err != nil {
+		t.Fatalf("Send(%q): %v", content, err)
+	}
+	return message
+}
+
+func TestChatSend(t *testing.T) {
+	cs, room := newTestChatService(t)
+	subscription := subscribeRoom(t, room.Name)
+
+	message := mustSend(t, cs, room, "alice", "  Hello  ")
+	if message.Content != "Hello" || message.Source != models.ChatSourceAPI || *message.SenderUserID != "alice" {
+		t.Errorf("message = %+v, want a trimmed API message of alice", message)
+	}
+
+	reply, err := cs.Send(room, ChatSender{Identity: "guest-1", Name: "Guest"}, models.SendChatMessageRequest{Content: "Hi", ReplyToID: &message.ID})
+	if err != nil || reply.SenderUserID != nil || *reply.ReplyToID != message.ID {
+		t.Errorf("reply = %+v, %v, want a guest reply to %s", reply, err, message.ID)
+	}
+
+	other := models.CreateAuthenticatedRoom("klm-nopq-rst", "owner")
+	cs.db.Create(other)
+	elsewhere := mustSend(t, cs, other, "alice", "Elsewhere")
+
+	invalid := []models.SendChatMessageRequest{
+		{Content: "   "},
+		{Content: "Reply", ReplyToID: &elsewhere.ID},
+	}
+	for _, request := range invalid {
+		if _, err := cs.Send(room, ChatSender{Identity: "alice"}, request); !errors.Is(err, ErrInvalidChatMessage) {
+			t.Errorf("Send(%+v): err = %v, want %v", request, err, ErrInvalidChatMessage)
+		}
+	}
+
+	if types := eventTypes(subscription); countEventType(types, events.EventChatMessage) != 2 {
+		t.Errorf("events %v, want two %s", types, events.EventChatMessage)
+	}
+}
+
+func TestChatEditAndDelete(t *testing.T) {
+	cs, room := newTestChatService(t)
+	message := mustSend(t, cs, room, "alice", "Helo")
+
+	edited, err := cs.Edit(room, message, "Hello")
+	if err != nil || edited.Content != "Hello" || edited.EditedAt == nil {
+		t.Fatalf("Edit: %+v, %v, want edited content", edited, err)
+	}
+	if _, err := cs.Edit(room, message, " "); !errors.Is(err, ErrInvalidChatMessage) {
+		t.Errorf("empty edit: err = %v, want %v", err, ErrInvalidChatMessage)
+	}
+
+	if err := cs.Delete(room, message, "moderator"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	stored, err := cs.GetMessage(room.ID, message.ID)
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	if !stored.IsDeleted() || stored.Content != "" || *stored.DeletedBy != "moderator" {
+		t.Errorf("deleted message = %+v, want it without content, deleted by moderator", stored)
+	}
+
+	// A deleted message stays deleted
+	if _, err := cs.Edit(room, stored, "Back"); !errors.Is(err, ErrInvalidChatMessage) {
+		t.Errorf("editing a deleted message: err = %v, want %v", err, ErrInvalidChatMessage)
+	}
+	if err := cs.Delete(room, stored, "alice"); err != nil || *stored.DeletedBy != "moderator" {
+		t.Errorf("deleting again: %v, deleted by %s, want the first deletion kept", err, *stored.DeletedBy)
+	}
+}
+
+func TestChatIngest(t *testing.T) {
+	cs, room := newTestChatService(t)
+	alice := "alice"
+	sender := ChatSender{Identity: "alice", Name: "Alice", UserID: &alice}
+
+	message, err := cs.Ingest(room, sender, "msg-1", "From the call")
+	if err != nil || message == nil || message.Source != models.ChatSourceLiveKit {
+		t.Fatalf("Ingest: %+v, %v", message, err)
+	}
+	// The same message received twice is stored once
+	if again, err := cs.Ingest(room, sender, "msg-1", "From the call"); err != nil || again != nil {
+		t.Errorf("Ingest again: %+v, %v, want nothing stored", again, err)
+	}
+
+	// Only the sender edits their message from the call
+	if err := cs.IngestEdit(room, "mallory", "msg-1", "Changed"); !errors.Is(err, ErrChatMessageNotFound) {
+		t.Errorf("edit by someone else: err = %v, want %v", err, ErrChatMessageNotFound)
+	}
+	if err := cs.IngestEdit(room, "alice", "msg-1", "Edited in the call"); err != nil {
+		t.Fatalf("IngestEdit: %v", err)
+	}
+
+	messages, err := cs.Transcript(room.ID)
+	if err != nil {
+		t.Fatalf("Transcript: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Content != "Edited in the call" {
+		t.Errorf("transcript %+v, want the one edited message", messages)
+	}
+}
+
+func TestChatListMessages(t *testing.T) {
+	cs, room := newTestChatService(t)
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		cs.db.Create(&models.ChatMessage{RoomID: room.ID, SenderIdentity: "alice", Content: string(rune('a' + i)), Source: models.ChatSourceAPI, CreatedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	contents := func(page *ChatPage) string {
+		var b strings.Builder
+		for _, message := range page.Messages {
+			b.WriteString(message.Content)
+		}
+		return b.String()
+	}
+
+	latest, err := cs.ListMessages(room.ID, "", false, 2)
+	if err != nil || contents(latest) != "de" || latest.NextCursor == "" {
+		t.Fatalf("latest page %q, %v, want de and a cursor", contents(latest), err)
+	}
+	older, err := cs.ListMessages(room.ID, latest.NextCursor, false, 2)
+	if err != nil || contents(older) != "bc" {
+		t.Fatalf("older page %q, %v, want bc", contents(older), err)
+	}
+	oldest, err := cs.ListMessages(room.ID, older.NextCursor, false, 2)
+	if err != nil || contents(oldest) != "a" || oldest.NextCursor != "" {
+		t.Fatalf("oldest page %q (cursor %q), %v, want a as the last page", contents(oldest), oldest.NextCursor, err)
+	}
+
+	first, _ := cs.ListMessages(room.ID, "", true, 5)
+	newer, err := cs.ListMessages(room.ID, encodeChatCursor(&first.Messages[1]), true, 2)
+	if err != nil || contents(newer) != "cd" {
+		t.Errorf("newer page %q, %v, want cd", contents(newer), err)
+	}
+
+	if _, err := cs.ListMessages(room.ID, "not-a-cursor", false, 2); !errors.Is(err, ErrInvalidChatMessage) {
+		t.Errorf("invalid cursor: err = %v, want %v", err, ErrInvalidChatMessage)
+	}
+}
+
+func TestChatPurgeExpired(t *testing.T) {
+	cs, room := newTestChatService(t)
+	cs.retention = 24 * time.Hour
+
+	old := models.ChatMessage{RoomID: room.ID, SenderIdentity: "alice", Content: "Old", Source: models.ChatSourceAPI, CreatedAt: time.Now().Add(-48 * time.Hour)}
+	cs.db.Create(&old)
+	recent := mustSend(t, cs, room, "alice", "Recent")
+
+	cs.purgeExpired()
+
+	messages, err := cs.Transcript(room.ID)
+	if err != nil {
+		t.Fatalf("Transcript: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != recent.ID {
+		t.Errorf("messages %+v, want only the recent one", messages)
+	}
+}
+
+func TestChatMarkdownTranscript(t *testing.T) {
+	cs, room := newTestChatService(t)
+
+	question := mustSend(t, cs, room, "alice", "Line one\nLine two")
+	bob := "bob"
+	answer, err := cs.Send(room, ChatSender{Identity: "bob", Name: "Bob", UserID: &bob}, models.SendChatMessageRequest{Content: "Answer", ReplyToID: &question.ID})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	cs.Edit(room, answer, "Better answer")
+	removed := mustSend(t, cs, room, "alice", "Secret")
+	cs.Delete(room, removed, "alice")
+
+	messages, err := cs.Transcript(room.ID)
+	if err != nil {
+		t.Fatalf("Transcript: %v", err)
+	}
+	markdown := cs.MarkdownTranscript(room, messages)
+
+	for _, want := range []string{
+		"# Chat abc-defg-hij",
+		"3 messages",
+		"> Line one\n> Line two",
+		"reply to alice (edited)",
+		"> Better answer",
+		"_Message deleted_",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("transcript lacks %q:\n%s", want, markdown)
+		}
+	}
+	if strings.Contains(markdown, "Secret") {
+		t.Errorf("transcript contains a deleted message:\n%s", markdown)
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+	"meet-backend/internal/notifications"
+)
+
+// MaxInvitees is the most people that can be invited by email at once
+const MaxInvitees = 50
+
+// ErrInvalidInvitees is returned for malformed or too many email addresses
+var ErrInvalidInvitees = errors.New("invalid invitees")
+
+// InvitationService emails invitations to rooms and scheduled meetings
+type InvitationService struct {
+	db              *gorm.DB
+	outbox          *notifications.Outbox
+	calendarService *CalendarService
+}
+
+func NewInvitationService(outbox *notifications.Outbox) *InvitationService {
+	return &InvitationService{
+		db:              database.GetDatabase(),
+		outbox:          outbox,
+		calendarService: NewCalendarService(),
+	}
+}
+
+// NormalizeInvitees validates email addresses and returns them lowercased
+// and without duplicates
+func NormalizeInvitees(addresses []string) ([]string, error) {
+	seen := make(map[string]bool)
+	invitees := make([]string, 0, len(addresses))
+
+	for _, address := range addresses {
+		parsed, err := mail.ParseAddress(strings.TrimSpace(address))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not an email address", ErrInvalidInvitees, address)
+		}
+
+		email := strings.ToLower(parsed.Address)
+		if !seen[email] {
+			seen[email] = true
+			invitees = append(invitees, email)
+		}
+	}
+
+	if len(invitees) > MaxInvitees {
+		return nil, fmt.Errorf("%w: at most %d people can be invited", ErrInvalidInvitees, MaxInvitees)
+	}
+
+	return invitees, nil
+}
+
+// InviteToRoom emails the join link and passcode of a room
+func (is *InvitationService) InviteToRoom(room *models.Room, inviterID, passcode string, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	invitation := &notifications.Invitation{
+		Kind:        notifications.InvitationNew,
+		InviterName: is.inviterName(inviterID),
+		Title:       room.Name,
+		JoinURL:     is.calendarService.JoinURL(room.Name),
+		Passcode:    passcode,
+		ExpiresAt:   room.ExpiresAt,
+	}
+
+	return is.send(invitation, emails)
+}
+
+// NotifyMeeting emails a new, updated or cancelled meeting with an
+// iCalendar attachment that adds or updates it in the invitee's calendar
+func (is *InvitationService) NotifyMeeting(meeting *models.Meeting, kind string, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	cal, err := is.calendarService.MeetingCalendar(meeting)
+	if err != nil {
+		return err
+	}
+	cal.Method = "REQUEST"
+	if kind == notifications.InvitationCancelled {
+		cal.Method = "CANCEL"
+	}
+
+	// Show the next occurrence, in the meeting's timezone
+	location, err := time.LoadLocation(meeting.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	startsAt, endsAt := meeting.StartsAt.In(location), meeting.EndsAt.In(location)
+	if occurrence, err := NextOccurrence(meeting, time.Now()); err == nil && occurrence != nil {
+		startsAt, endsAt = occurrence.StartsAt.In(location), occurrence.EndsAt.In(location)
+	}
+
+	invitation := &notifications.Invitation{
+		Kind:        kind,
+		InviterName: is.inviterName(meeting.OrganizerID),
+		Title:       meeting.Title,
+		Description: meeting.Description,
+		JoinURL:     is.calendarService.JoinURL(meeting.RoomName),
+		StartsAt:    &startsAt,
+		EndsAt:      &endsAt,
+		Recurring:   meeting.Recurrence != "",
+		Calendar:    []byte(cal.String()),
+		Method:      cal.Method,
+	}
+
+	return is.send(invitation, emails)
+}
+
+// send renders an invitation and queues it for every recipient
+func (is *InvitationService) send(invitation *notifications.Invitation, emails []string) error {
+	msg, err := invitation.Message(emails)
+	if err != nil {
+		return fmt.Errorf("failed to render invitation: %w", err)
+	}
+
+	return is.outbox.Enqueue(msg)
+}
+
+// inviterName returns the name invitations are sent on behalf of
+func (is *InvitationService) inviterName(userID string) string {
+	var user models.User
+	if err := is.db.Where("id = ?", userID).First(&user).Error; err == nil {
+		if user.Name != "" {
+			return user.Name
+		}
+		if user.Email != "" {
+			return user.Email
+		}
+	}
+	return "Someone"
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+)
+
+// MaxInviteLifetime is the longest an invite link can stay valid
+const MaxInviteLifetime = 30 * 24 * time.Hour
+
+var (
+	// ErrInviteNotFound is returned for invite tokens that are malformed or not signed by us
+	ErrInviteNotFound = errors.New("invite not found")
+	// ErrInviteUnavailable is returned for invites that are revoked, expired or used up
+	ErrInviteUnavailable = errors.New("invite is revoked, expired or used up")
+)
+
+type InviteService struct {
+	db *gorm.DB
+}
+
+func NewInviteService() *InviteService {
+	return &InviteService{
+		db: database.GetDatabase(),
+	}
+}
+
+// CreateInvite stores an invite for a room and returns it with its signed token
+func (is *InviteService) CreateInvite(room *models.Room, role, createdBy string, expiresAt time.Time, maxUses int) (*models.Invite, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	invite := &models.Invite{
+		RoomID:    room.ID,
+		Role:      role,
+		Secret:    base64.RawURLEncoding.EncodeToString(secret),
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+		MaxUses:   maxUses,
+	}
+
+	if err := is.db.Create(invite).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	token, err := signInvite(invite, room.Name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return invite, token, nil
+}
+
+// ParseInvite verifies an invite token and returns the invite it belongs to
+func (is *InviteService) ParseInvite(tokenString string) (*models.Invite, error) {
+	var invite models.Invite
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		id, err := uuid.Parse(kid)
+		if err != nil {
+			return nil, ErrInviteNotFound
+		}
+		if err := is.db.Where("id = ?", id).First(&invite).Error; err != nil {
+			return nil, ErrInviteNotFound
+		}
+		return []byte(invite.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrInviteUnavailable
+		}
+		return nil, ErrInviteNotFound
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["room_id"] != invite.RoomID.String() {
+		return nil, ErrInviteNotFound
+	}
+
+	return &invite, nil
+}
+
+// Redeem counts a use of an invite, failing when it can no longer be used
+func (is *InviteService) Redeem(invite *models.Invite) error {
+	result := is.db.Model(&models.Invite{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)", invite.ID, time.Now()).
+		Update("uses", gorm.Expr("uses + 1"))
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to redeem invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteUnavailable
+	}
+
+	invite.Uses++
+	return nil
+}
+
+// ListInvites returns the invites of a room, newest first
+func (is *InviteService) ListInvites(roomID uuid.UUID) ([]models.Invite, error) {
+	var invites []models.Invite
+	result := is.db.Where("room_id = ?", roomID).Order("created_at DESC").Find(&invites)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list invites: %w", result.Error)
+	}
+
+	return invites, nil
+}
+
+// RevokeInvite revokes an invite of a room
+func (is *InviteService) RevokeInvite(roomID, id uuid.UUID) error {
+	result := is.db.Model(&models.Invite{}).
+		Where("id = ? AND room_id = ? AND revoked_at IS NULL", id, roomID).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+
+	return nil
+}
+
+// signInvite creates the token of an invite, signed with the invite's secret
+func signInvite(invite *models.Invite, roomName string) (string, error) {
+	claims := jwt.MapClaims{
+		"room_id":  invite.RoomID.String(),
+		"room":     roomName,
+		"role":     invite.Role,
+		"max_uses": invite.MaxUses,
+		"exp":      invite.ExpiresAt.Unix(),
+		"iat":      invite.CreatedAt.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = invite.ID.String()
+	tokenString, err := token.SignedString([]byte(invite.Secret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign invite: %w", err)
+	}
+
+	return tokenString, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func newTestInviteService(t *testing.T) (*InviteService, *models.Room) {
+	t.Helper()
+	is := &InviteService{db: testdb.Open(t, &models.Room{}, &models.Invite{})}
+
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	if err := is.db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	return is, room
+}
+
+func TestParseInvite(t *testing.T) {
+	is, room := newTestInviteService(t)
+
+	invite, token, err := is.CreateInvite(room, models.RoomRoleModerator, "owner", time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+
+	parsed, err := is.ParseInvite(token)
+	if err != nil {
+		t.Fatalf("ParseInvite: %v", err)
+	}
+	if parsed.ID != invite.ID || parsed.Role != models.RoomRoleModerator || parsed.RoomID != room.ID {
+		t.Errorf("parsed invite %+v, want %+v", parsed, invite)
+	}
+
+	// A token only verifies with the secret of the invite it names
+	other, otherToken, err := is.CreateInvite(room, models.RoomRoleMember, "owner", time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	parts := strings.Split(token, ".")
+	otherParts := strings.Split(otherToken, ".")
+	forged := otherParts[0] + "." + parts[1] + "." + otherParts[2]
+	if _, err := is.ParseInvite(forged); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("claims of one invite with the signature of %s: err = %v, want %v", other.ID, err, ErrInviteNotFound)
+	}
+	if _, err := is.ParseInvite(token[:len(token)-2] + "xx"); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("tampered signature: err = %v, want %v", err, ErrInviteNotFound)
+	}
+	if _, err := is.ParseInvite("not-a-token"); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("malformed token: err = %v, want %v", err, ErrInviteNotFound)
+	}
+
+	// A token for a room it wasn't created for is refused
+	invite.RoomID = uuid.New()
+	moved, err := signInvite(invite, "other-room")
+	if err != nil {
+		t.Fatalf("signInvite: %v", err)
+	}
+	if _, err := is.ParseInvite(moved); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("token for another room: err = %v, want %v", err, ErrInviteNotFound)
+	}
+
+	expired, expiredToken, err := is.CreateInvite(room, models.RoomRoleMember, "owner", time.Now().Add(-time.Minute), 0)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	if _, err := is.ParseInvite(expiredToken); !errors.Is(err, ErrInviteUnavailable) {
+		t.Errorf("expired invite %s: err = %v, want %v", expired.ID, err, ErrInviteUnavailable)
+	}
+}
+
+func TestRedeemInviteUseLimit(t *testing.T) {
+	is, room := newTestInviteService(t)
+
+	invite, _, err := is.CreateInvite(room, models.RoomRoleMember, "owner", time.Now().Add(time.Hour), 2)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := is.Redeem(invite); err != nil {
+			t.Fatalf("use %d: %v", i+1, err)
+		}
+	}
+	if err := is.Redeem(invite); !errors.Is(err, ErrInviteUnavailable) {
+		t.Errorf("use beyond max_uses: err = %v, want %v", err, ErrInviteUnavailable)
+	}
+
+	var stored models.Invite
+	is.db.Where("id = ?", invite.ID).First(&stored)
+	if stored.Uses != 2 || stored.IsUsable() {
+		t.Errorf("stored invite has %d uses and usable = %v, want 2 uses and used up", stored.Uses, stored.IsUsable())
+	}
+
+	// Invites without a limit keep working
+	unlimited, _, err := is.CreateInvite(room, models.RoomRoleMember, "owner", time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := is.Redeem(unlimited); err != nil {
+			t.Fatalf("unlimited use %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestRevokeInvite(t *testing.T) {
+	is, room := newTestInviteService(t)
+
+	invite, _, err := is.CreateInvite(room, models.RoomRoleMember, "owner", time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+
+	if err := is.RevokeInvite(uuid.New(), invite.ID); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("revoking through another room: err = %v, want %v", err, ErrInviteNotFound)
+	}
+	if err := is.RevokeInvite(room.ID, invite.ID); err != nil {
+		t.Fatalf("RevokeInvite: %v", err)
+	}
+	if err := is.RevokeInvite(room.ID, invite.ID); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("revoking twice: err = %v, want %v", err, ErrInviteNotFound)
+	}
+	if err := is.Redeem(invite); !errors.Is(err, ErrInviteUnavailable) {
+		t.Errorf("redeeming a revoked invite: err = %v, want %v", err, ErrInviteUnavailable)
+	}
+}
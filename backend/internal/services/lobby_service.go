@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+)
+
+// lobbyPollInterval is how often a waiting request checks for a decision
+const lobbyPollInterval = time.Second
+
+// LobbyDenyCooldown is how long someone who was denied cannot knock again
+const LobbyDenyCooldown = 10 * time.Minute
+
+// LobbyAdmissionTTL is how long an admitted entry is kept, during which its
+// LiveKit token can be collected
+const LobbyAdmissionTTL = 10 * time.Minute
+
+var (
+	// ErrLobbyEntryNotFound is returned for unknown lobby entries or wrong secrets
+	ErrLobbyEntryNotFound = errors.New("lobby entry not found")
+	// ErrLobbyEntryDecided is returned when admitting or denying an entry twice
+	ErrLobbyEntryDecided = errors.New("lobby entry already admitted or denied")
+	// ErrLobbyEntryDenied is returned when someone who was denied knocks again within the cooldown
+	ErrLobbyEntryDenied = errors.New("entry to the room was denied, try again later")
+	// ErrLobbyEntryClaimed is returned when an admission was already used to collect a token
+	ErrLobbyEntryClaimed = errors.New("admission already used")
+)
+
+type LobbyService struct {
+	db *gorm.DB
+}
+
+func NewLobbyService() *LobbyService {
+	return &LobbyService{
+		db: database.GetDatabase(),
+	}
+}
+
+// Enqueue places someone in the lobby of a room and returns the secret they
+// use to check their admission status. Someone denied within the cooldown,
+// by identity or for guests by IP address, is refused with ErrLobbyEntryDenied.
+func (ls *LobbyService) Enqueue(roomID uuid.UUID, identity, name string, userID *string, ipAddress string) (*models.LobbyEntry, string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(data)
+
+	entry := &models.LobbyEntry{
+		RoomID:     roomID,
+		Identity:   identity,
+		Name:       name,
+		UserID:     userID,
+		SecretHash: hashToken(secret),
+		Status:     models.LobbyStatusPending,
+		IPAddress:  ipAddress,
+	}
+
+	err := ls.db.Transaction(func(tx *gorm.DB) error {
+		// Denied entries are kept for the cooldown, then removed
+		if err := expiredLobbyEntries(tx.Where("room_id = ?", roomID)).Delete(&models.LobbyEntry{}).Error; err != nil {
+			return err
+		}
+
+		query := tx.Model(&models.LobbyEntry{}).Where("room_id = ? AND status = ?", roomID, models.LobbyStatusDenied)
+		if ipAddress != "" {
+			query = query.Where("identity = ? OR ip_address = ?", identity, ipAddress)
+		} else {
+			query = query.Where("identity = ?", identity)
+		}
+		var denied int64
+		if err := query.Count(&denied).Error; err != nil {
+			return err
+		}
+		if denied > 0 {
+			return ErrLobbyEntryDenied
+		}
+
+		// A signed-in user knocking again replaces their earlier entry
+		if err := tx.Where("room_id = ? AND identity = ?", roomID, identity).Delete(&models.LobbyEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrLobbyEntryDenied) {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("failed to enter lobby: %w", err)
+	}
+
+	return entry, secret, nil
+}
+
+// PurgeExpired removes denied entries after the cooldown and admitted entries
+// after the admission TTL
+func (ls *LobbyService) PurgeExpired() error {
+	if err := expiredLobbyEntries(ls.db).Delete(&models.LobbyEntry{}).Error; err != nil {
+		return fmt.Errorf("failed to purge lobby entries: %w", err)
+	}
+	return nil
+}
+
+// StartCleanupRoutine periodically removes lobby entries that no longer admit or refuse anyone
+func (ls *LobbyService) StartCleanupRoutine() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := ls.PurgeExpired(); err != nil {
+			log.Printf("Error removing old lobby entries: %v", err)
+		}
+	}
+}
+
+// expiredLobbyEntries limits a query to the entries PurgeExpired removes
+func expiredLobbyEntries(db *gorm.DB) *gorm.DB {
+	now := time.Now()
+	return db.Where("(status = ? AND decided_at < ?) OR (status = ? AND decided_at < ?)",
+		models.LobbyStatusDenied, now.Add(-LobbyDenyCooldown),
+		models.LobbyStatusAdmitted, now.Add(-LobbyAdmissionTTL))
+}
+
+// GetEntry retrieves a lobby entry, checking the secret its owner received
+func (ls *LobbyService) GetEntry(roomID uuid.UUID, identity, secret string) (*models.LobbyEntry, error) {
+	var entry models.LobbyEntry
+	result := ls.db.Where("room_id = ? AND identity = ?", roomID, identity).First(&entry)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrLobbyEntryNotFound
+		}
+		return nil, fmt.Errorf("failed to get lobby entry: %w", result.Error)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(entry.SecretHash), []byte(hashToken(secret))) != 1 {
+		return nil, ErrLobbyEntryNotFound
+	}
+
+	return &entry, nil
+}
+
+// WaitForDecision returns the lobby entry once a host decided on it, or when
+// the wait time is over or the request is cancelled
+func (ls *LobbyService) WaitForDecision(ctx context.Context, roomID uuid.UUID, identity, secret string, wait time.Duration) (*models.LobbyEntry, error) {
+	entry, err := ls.GetEntry(roomID, identity, secret)
+	if err != nil || !entry.IsPending() || wait <= 0 {
+		return entry, err
+	}
+
+	ticker := time.NewTicker(lobbyPollInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return entry, nil
+		case <-timeout.C:
+			return entry, nil
+		case <-ticker.C:
+			entry, err = ls.GetEntry(roomID, identity, secret)
+			if err != nil || !entry.IsPending() {
+				return entry, err
+			}
+		}
+	}
+}
+
+// ClaimAdmission marks an admitted entry as used, so its LiveKit token is
+// issued once. It returns ErrLobbyEntryClaimed when it was already used or
+// the admission expired.
+func (ls *LobbyService) ClaimAdmission(entryID uuid.UUID) error {
+	result := ls.db.Model(&models.LobbyEntry{}).
+		Where("id = ? AND status = ? AND claimed_at IS NULL AND decided_at >= ?", entryID, models.LobbyStatusAdmitted, time.Now().Add(-LobbyAdmissionTTL)).
+		Update("claimed_at", time.Now())
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to claim admission: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrLobbyEntryClaimed
+	}
+
+	return nil
+}
+
+// ReleaseAdmission makes a claimed admission usable again after issuing its
+// token failed
+func (ls *LobbyService) ReleaseAdmission(entryID uuid.UUID) error {
+	result := ls.db.Model(&models.LobbyEntry{}).Where("id = ?", entryID).Update("claimed_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to release admission: %w", result.Error)
+	}
+	return nil
+}
+
+// ListPending returns the people waiting in the lobby of a room, longest waiting first
+func (ls *LobbyService) ListPending(roomID uuid.UUID) ([]models.LobbyEntry, error) {
+	var entries []models.LobbyEntry
+	result := ls.db.Where("room_id = ? AND status = ?", roomID, models.LobbyStatusPending).
+		Order("created_at").
+		Find(&entries)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list lobby: %w", result.Error)
+	}
+
+	return entries, nil
+}
+
+// Decide admits or denies a pending lobby entry
+func (ls *LobbyService) Decide(roomID uuid.UUID, identity, status, decidedBy string) error {
+	now := time.Now()
+	result := ls.db.Model(&models.LobbyEntry{}).
+		Where("room_id = ? AND identity = ? AND status = ?", roomID, identity, models.LobbyStatusPending).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"decided_by": decidedBy,
+			"decided_at": now,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update lobby entry: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		var count int64
+		ls.db.Model(&models.LobbyEntry{}).Where("room_id = ? AND identity = ?", roomID, identity).Count(&count)
+		if count > 0 {
+			return ErrLobbyEntryDecided
+		}
+		return ErrLobbyEntryNotFound
+	}
+
+	return nil
+}
+
+// SetLobbyEnabled turns the lobby of a room on or off
+func (ls *LobbyService) SetLobbyEnabled(roomID uuid.UUID, enabled bool) error {
+	result := ls.db.Model(&models.Room{}).Where("id = ?", roomID).Update("lobby_enabled", enabled)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update lobby: %w", result.Error)
+	}
+	return nil
+}
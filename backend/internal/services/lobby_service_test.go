@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func TestLobbyRefusesDeniedGuestsDuringCooldown(t *testing.T) {
+	ls := &LobbyService{db: testdb.Open(t, &models.LobbyEntry{})}
+	roomID := uuid.New()
+
+	if _, _, err := ls.Enqueue(roomID, "guest-1", "Guest", nil, "192.0.2.1"); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := ls.Decide(roomID, "guest-1", models.LobbyStatusDenied, "host"); err != nil {
+		t.Fatalf("Decide: %v", err)
+	}
+
+	// Guests get a new identity on every join, so the IP address is checked too
+	if _, _, err := ls.Enqueue(roomID, "guest-2", "Guest", nil, "192.0.2.1"); !errors.Is(err, ErrLobbyEntryDenied) {
+		t.Errorf("same IP address: err = %v, want %v", err, ErrLobbyEntryDenied)
+	}
+	if _, _, err := ls.Enqueue(roomID, "guest-1", "Guest", nil, "198.51.100.1"); !errors.Is(err, ErrLobbyEntryDenied) {
+		t.Errorf("same identity: err = %v, want %v", err, ErrLobbyEntryDenied)
+	}
+	if _, _, err := ls.Enqueue(roomID, "guest-3", "Other", nil, "198.51.100.1"); err != nil {
+		t.Errorf("another guest: %v", err)
+	}
+
+	// After the cooldown the denied entry is removed and they may knock again
+	ls.db.Model(&models.LobbyEntry{}).Where("identity = ?", "guest-1").
+		Update("decided_at", time.Now().Add(-LobbyDenyCooldown-time.Minute))
+	if _, _, err := ls.Enqueue(roomID, "guest-4", "Guest", nil, "192.0.2.1"); err != nil {
+		t.Errorf("after the cooldown: %v", err)
+	}
+
+	var count int64
+	ls.db.Model(&models.LobbyEntry{}).Where("identity = ?", "guest-1").Count(&count)
+	if count != 0 {
+		t.Error("denied entry was not removed after the cooldown")
+	}
+}
+
+func TestLobbyAdmissionIsClaimedOnce(t *testing.T) {
+	ls := &LobbyService{db: testdb.Open(t, &models.LobbyEntry{})}
+	roomID := uuid.New()
+
+	entry, _, err := ls.Enqueue(roomID, "guest-1", "Guest", nil, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	if err := ls.ClaimAdmission(entry.ID); !errors.Is(err, ErrLobbyEntryClaimed) {
+		t.Errorf("claiming a pending entry: err = %v, want %v", err, ErrLobbyEntryClaimed)
+	}
+
+	if err := ls.Decide(roomID, "guest-1", models.LobbyStatusAdmitted, "host"); err != nil {
+		t.Fatalf("Decide: %v", err)
+	}
+	if err := ls.ClaimAdmission(entry.ID); err != nil {
+		t.Fatalf("ClaimAdmission: %v", err)
+	}
+	if err := ls.ClaimAdmission(entry.ID); !errors.Is(err, ErrLobbyEntryClaimed) {
+		t.Errorf("second claim: err = %v, want %v", err, ErrLobbyEntryClaimed)
+	}
+
+	// A failed token issue gives the admission back
+	if err := ls.ReleaseAdmission(entry.ID); err != nil {
+		t.Fatalf("ReleaseAdmission: %v", err)
+	}
+	if err := ls.ClaimAdmission(entry.ID); err != nil {
+		t.Errorf("claim after release: %v", err)
+	}
+}
+
+func TestLobbyPurgesExpiredEntries(t *testing.T) {
+	ls := &LobbyService{db: testdb.Open(t, &models.LobbyEntry{})}
+	roomID := uuid.New()
+
+	for _, identity := range []string{"pending", "admitted", "old-admitted", "denied", "old-denied"} {
+		if _, _, err := ls.Enqueue(roomID, identity, identity, nil, ""); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for identity, status := range map[string]string{
+		"admitted":     models.LobbyStatusAdmitted,
+		"old-admitted": models.LobbyStatusAdmitted,
+		"denied":       models.LobbyStatusDenied,
+		"old-denied":   models.LobbyStatusDenied,
+	} {
+		if err := ls.Decide(roomID, identity, status, "host"); err != nil {
+			t.Fatalf("Decide: %v", err)
+		}
+	}
+	ls.db.Model(&models.LobbyEntry{}).Where("identity = ?", "old-admitted").
+		Update("decided_at", time.Now().Add(-LobbyAdmissionTTL-time.Minute))
+	ls.db.Model(&models.LobbyEntry{}).Where("identity = ?", "old-denied").
+		Update("decided_at", time.Now().Add(-LobbyDenyCooldown-time.Minute))
+
+	// An expired admission can no longer be used to collect a token
+	var expired models.LobbyEntry
+	ls.db.First(&expired, "identity = ?", "old-admitted")
+	if err := ls.ClaimAdmission(expired.ID); !errors.Is(err, ErrLobbyEntryClaimed) {
+		t.Errorf("claiming an expired admission: err = %v, want %v", err, ErrLobbyEntryClaimed)
+	}
+
+	if err := ls.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired: %v", err)
+	}
+
+	var remaining []string
+	ls.db.Model(&models.LobbyEntry{}).Order("identity").Pluck("identity", &remaining)
+	if strings.Join(remaining, ",") != "admitted,denied,pending" {
+		t.Errorf("remaining entries %v, want admitted, denied and pending", remaining)
+	}
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // meeting timezones must resolve in minimal containers too
+
+	"github.com/teambition/rrule-go"
+	"gorm.io/gorm"
+	"meet-backend/internal/database"
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+)
+
+const (
+	// DefaultEarlyJoinMinutes is used when neither the meeting nor MEETING_EARLY_JOIN_MINUTES sets it
+	DefaultEarlyJoinMinutes = 10
+	// MaxEarlyJoinMinutes is the longest a meeting room can open before the start
+	MaxEarlyJoinMinutes = 120
+	// MaxMeetingDuration is the longest a single occurrence can last
+	MaxMeetingDuration = 24 * time.Hour
+)
+
+var (
+	// ErrMeetingNotFound is returned for unknown meetings
+	ErrMeetingNotFound = errors.New("meeting not found")
+	// ErrMeetingCancelled is returned when joining a cancelled meeting
+	ErrMeetingCancelled = errors.New("meeting was cancelled")
+	// ErrInvalidMeeting wraps validation errors of a meeting's schedule
+	ErrInvalidMeeting = errors.New("invalid meeting")
+	// ErrMeetingRoomClosed is returned when a host closed the room of the running occurrence
+	ErrMeetingRoomClosed = errors.New("meeting room was closed by a host")
+)
+
+// MeetingClosedError is returned when a meeting room is joined outside its join window
+type MeetingClosedError struct {
+	OpensAt *time.Time // nil when the meeting has no occurrences left
+}
+
+func (e *MeetingClosedError) Error() string {
+	if e.OpensAt == nil {
+		return "meeting has ended"
+	}
+	return "meeting has not started yet"
+}
+
+// UpcomingMeeting is a meeting with its occurrences in a time range
+type UpcomingMeeting struct {
+	models.Meeting
+	Occurrences []models.MeetingOccurrence `json:"occurrences"`
+}
+
+type MeetingService struct {
+	db               *gorm.DB
+	roomService      *RoomService
+	earlyJoinMinutes int
+}
+
+func NewMeetingService() *MeetingService {
+	earlyJoinMinutes := DefaultEarlyJoinMinutes
+	if minutes, err := strconv.Atoi(os.Getenv("MEETING_EARLY_JOIN_MINUTES")); err == nil && minutes >= 0 && minutes <= MaxEarlyJoinMinutes {
+		earlyJoinMinutes = minutes
+	}
+
+	return &MeetingService{
+		db:               database.GetDatabase(),
+		roomService:      NewRoomService(),
+		earlyJoinMinutes: earlyJoinMinutes,
+	}
+}
+
+// DefaultEarlyJoinMinutes returns the early join minutes of new meetings
+func (ms *MeetingService) DefaultEarlyJoinMinutes() int {
+	return ms.earlyJoinMinutes
+}
+
+// CreateMeeting validates a meeting and reserves a room name for it
+func (ms *MeetingService) CreateMeeting(meeting *models.Meeting) error {
+	if err := ValidateMeeting(meeting); err != nil {
+		return err
+	}
+
+	name, err := ms.roomService.GenerateRoomName()
+	if err != nil {
+		return err
+	}
+	meeting.RoomName = name
+
+	if err := ms.db.Create(meeting).Error; err != nil {
+		return fmt.Errorf("failed to create meeting: %w", err)
+	}
+
+	return nil
+}
+
+// GetMeeting retrieves a meeting by ID, including cancelled ones
+func (ms *MeetingService) GetMeeting(id string) (*models.Meeting, error) {
+	var meeting models.Meeting
+	result := ms.db.Where("id = ?", id).First(&meeting)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrMeetingNotFound
+		}
+		return nil, fmt.Errorf("failed to get meeting: %w", result.Error)
+	}
+
+	return &meeting, nil
+}
+
+// UpdateMeeting saves a changed meeting. An open room follows the new
+// schedule of the running occurrence.
+func (ms *MeetingService) UpdateMeeting(meeting *models.Meeting) error {
+	if err := ValidateMeeting(meeting); err != nil {
+		return err
+	}
+
+	meeting.Sequence++
+	if err := ms.db.Save(meeting).Error; err != nil {
+		return fmt.Errorf("failed to update meeting: %w", err)
+	}
+
+	room, err := ms.roomService.GetRoom(meeting.RoomName)
+	if err != nil {
+		return nil // no open room
+	}
+
+	now := time.Now()
+	occurrence, err := NextOccurrence(meeting, now)
+	if err != nil || occurrence == nil || now.Before(ms.opensAt(meeting, occurrence)) {
+		return nil // the room is left to expire as it was scheduled
+	}
+
+	maxDuration := int(meeting.Duration().Minutes())
+	result := ms.db.Model(room).Updates(map[string]interface{}{
+		"expires_at":   occurrence.EndsAt,
+		"max_duration": maxDuration,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update meeting room: %w", result.Error)
+	}
+	emitRoomEvent(ms.db, events.EventRoomExtended, room, events.NewRoomData(room))
+
+	return nil
+}
+
+// CancelMeeting cancels a meeting and closes its room if it is open
+func (ms *MeetingService) CancelMeeting(meeting *models.Meeting) error {
+	now := time.Now()
+	result := ms.db.Model(meeting).Updates(map[string]interface{}{
+		"cancelled_at": now,
+		"sequence":     gorm.Expr("sequence + 1"),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel meeting: %w", result.Error)
+	}
+	meeting.CancelledAt = &now
+	meeting.Sequence++
+
+	if room, err := ms.roomService.GetRoom(meeting.RoomName); err == nil {
+		return ms.roomService.DeactivateRoom(room.ID)
+	}
+
+	return nil
+}
+
+// ListUpcoming returns the meetings of an organizer with occurrences between
+// now and until, soonest first. Running occurrences are included.
+func (ms *MeetingService) ListUpcoming(organizerID string, until time.Time) ([]UpcomingMeeting, error) {
+	var meetings []models.Meeting
+	result := ms.db.Where("organizer_id = ? AND cancelled_at IS NULL AND starts_at < ?", organizerID, until).
+		Find(&meetings)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list meetings: %w", result.Error)
+	}
+
+	now := time.Now()
+	upcoming := make([]UpcomingMeeting, 0, len(meetings))
+	for _, meeting := range meetings {
+		occurrences, err := Occurrences(&meeting, now, until)
+		if err != nil {
+			return nil, err
+		}
+		if len(occurrences) > 0 {
+			upcoming = append(upcoming, UpcomingMeeting{Meeting: meeting, Occurrences: occurrences})
+		}
+	}
+
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].Occurrences[0].StartsAt.Before(upcoming[j].Occurrences[0].StartsAt)
+	})
+
+	return upcoming, nil
+}
+
+// ListForUser returns the meetings a user organizes or is a member of the
+// room of, including cancelled ones, that have occurrences ending after since
+func (ms *MeetingService) ListForUser(userID string, since time.Time) ([]models.Meeting, error) {
+	memberRooms := ms.db.Model(&models.Room{}).
+		Select("rooms.name").
+		Joins("JOIN room_members ON room_members.room_id = rooms.id").
+		Where("room_members.user_id = ?", userID)
+
+	var meetings []models.Meeting
+	result := ms.db.Where("organizer_id = ? OR room_name IN (?)", userID, memberRooms).
+		Order("starts_at").
+		Find(&meetings)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list meetings: %w", result.Error)
+	}
+
+	relevant := make([]models.Meeting, 0, len(meetings))
+	for _, meeting := range meetings {
+		if occurrence, err := NextOccurrence(&meeting, since); err == nil && occurrence != nil {
+			relevant = append(relevant, meeting)
+		}
+	}
+
+	return relevant, nil
+}
+
+// ResolveRoom returns the active room with a name. The room of a scheduled
+// meeting is opened when its join window has started.
+func (ms *MeetingService) ResolveRoom(name string) (*models.Room, error) {
+	room, err := ms.roomService.GetRoom(name)
+	if err == nil {
+		return room, nil
+	}
+
+	var meeting models.Meeting
+	if result := ms.db.Where("room_name = ?", name).First(&meeting); result.Error != nil {
+		return nil, err
+	}
+
+	return ms.OpenRoom(&meeting)
+}
+
+// OpenRoom opens the room of a meeting for the running or next occurrence.
+// The room expires when the occurrence ends.
+func (ms *MeetingService) OpenRoom(meeting *models.Meeting) (*models.Room, error) {
+	if meeting.IsCancelled() {
+		return nil, ErrMeetingCancelled
+	}
+
+	now := time.Now()
+	occurrence, err := NextOccurrence(meeting, now)
+	if err != nil {
+		return nil, err
+	}
+	if occurrence == nil {
+		return nil, &MeetingClosedError{}
+	}
+	if opensAt := ms.opensAt(meeting, occurrence); now.Before(opensAt) {
+		return nil, &MeetingClosedError{OpensAt: &opensAt}
+	}
+
+	expiresAt := occurrence.EndsAt
+	maxDuration := int(meeting.Duration().Minutes())
+
+	var room models.Room
+	result := ms.db.Where("name = ?", meeting.RoomName).First(&room)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		// The first occurrence creates the room with the organizer as its owner
+		room = models.Room{
+			Name:        meeting.RoomName,
+			CreatedBy:   &meeting.OrganizerID,
+			ExpiresAt:   &expiresAt,
+			MaxDuration: &maxDuration,
+			IsActive:    true,
+		}
+		err := ms.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&room).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.RoomMember{
+				RoomID: room.ID,
+				UserID: meeting.OrganizerID,
+				Role:   models.RoomRoleOwner,
+			}).Error
+		})
+		if err != nil {
+			// Another joiner may have opened the room at the same time
+			if existing, getErr := ms.roomService.GetRoom(meeting.RoomName); getErr == nil {
+				return existing, nil
+			}
+			return nil, fmt.Errorf("failed to open meeting room: %w", err)
+		}
+		emitRoomEvent(ms.db, events.EventRoomCreated, &room, events.NewRoomData(&room))
+		return &room, nil
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get meeting room: %w", result.Error)
+	}
+
+	// A room expires at the end of the occurrence it was opened for. One that
+	// was closed before then was closed by a host, and stays closed for the
+	// rest of that occurrence.
+	if !room.IsActive && (room.ExpiresAt == nil || room.ExpiresAt.After(occurrence.StartsAt)) {
+		return nil, ErrMeetingRoomClosed
+	}
+
+	// Later occurrences reopen the same room, keeping its members and settings
+	result = ms.db.Model(&room).Updates(map[string]interface{}{
+		"is_active":    true,
+		"expires_at":   expiresAt,
+		"max_duration": maxDuration,
+		"started_at":   nil,
+		"ended_at":     nil,
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to reopen meeting room: %w", result.Error)
+	}
+	emitRoomEvent(ms.db, events.EventRoomCreated, &room, events.NewRoomData(&room))
+
+	return ms.roomService.GetRoom(meeting.RoomName)
+}
+
+// opensAt returns when joining an occurrence becomes possible
+func (ms *MeetingService) opensAt(meeting *models.Meeting, occurrence *models.MeetingOccurrence) time.Time {
+	return occurrence.StartsAt.Add(-time.Duration(meeting.EarlyJoinMinutes) * time.Minute)
+}
+
+// ValidateMeeting checks the schedule of a meeting and normalises its recurrence rule
+func ValidateMeeting(meeting *models.Meeting) error {
+	meeting.Title = strings.TrimSpace(meeting.Title)
+	if meeting.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidMeeting)
+	}
+
+	duration := meeting.Duration()
+	if duration <= 0 {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidMeeting)
+	}
+	if duration > MaxMeetingDuration {
+		return fmt.Errorf("%w: a meeting can last at most 24 hours", ErrInvalidMeeting)
+	}
+
+	if meeting.EarlyJoinMinutes < 0 || meeting.EarlyJoinMinutes > MaxEarlyJoinMinutes {
+		return fmt.Errorf("%w: early_join_minutes must be between 0 and %d", ErrInvalidMeeting, MaxEarlyJoinMinutes)
+	}
+
+	if meeting.Timezone == "" {
+		meeting.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(meeting.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidMeeting, meeting.Timezone)
+	}
+
+	meeting.Recurrence = strings.TrimPrefix(strings.TrimSpace(meeting.Recurrence), "RRULE:")
+	if strings.ContainsAny(meeting.Recurrence, "\r\n") {
+		return fmt.Errorf("%w: recurrence must be a single RRULE", ErrInvalidMeeting)
+	}
+	rule, err := meetingRule(meeting)
+	if err != nil {
+		return err
+	}
+
+	if len(meeting.ExcludedDates) > 0 && rule == nil {
+		return fmt.Errorf("%w: excluded_dates need a recurrence", ErrInvalidMeeting)
+	}
+	for _, date := range meeting.ExcludedDates {
+		// An excluded date that isn't the start of an occurrence would silently skip nothing
+		if start := rule.GetRRule().After(date, true); !start.Equal(date) {
+			return fmt.Errorf("%w: excluded date %s is not the start of an occurrence", ErrInvalidMeeting, date.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+// NextOccurrence returns the running occurrence of a meeting, or the next one
+// to start. It returns nil when the meeting has no occurrences left.
+func NextOccurrence(meeting *models.Meeting, now time.Time) (*models.MeetingOccurrence, error) {
+	rule, err := meetingRule(meeting)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := meeting.Duration()
+	if rule == nil {
+		if !now.Before(meeting.EndsAt) {
+			return nil, nil
+		}
+		return &models.MeetingOccurrence{StartsAt: meeting.StartsAt, EndsAt: meeting.EndsAt}, nil
+	}
+
+	if start := rule.Before(now, true); !start.IsZero() && now.Before(start.Add(duration)) {
+		return &models.MeetingOccurrence{StartsAt: start, EndsAt: start.Add(duration)}, nil
+	}
+	if start := rule.After(now, false); !start.IsZero() {
+		return &models.MeetingOccurrence{StartsAt: start, EndsAt: start.Add(duration)}, nil
+	}
+
+	return nil, nil
+}
+
+// Occurrences returns the occurrences of a meeting that overlap a time range
+func Occurrences(meeting *models.Meeting, from, to time.Time) ([]models.MeetingOccurrence, error) {
+	rule, err := meetingRule(meeting)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := meeting.Duration()
+	starts := []time.Time{meeting.StartsAt}
+	if rule != nil {
+		starts = rule.Between(from.Add(-duration), to, true)
+	}
+
+	occurrences := make([]models.MeetingOccurrence, 0, len(starts))
+	for _, start := range starts {
+		end := start.Add(duration)
+		if end.After(from) && start.Before(to) {
+			occurrences = append(occurrences, models.MeetingOccurrence{StartsAt: start, EndsAt: end})
+		}
+	}
+
+	return occurrences, nil
+}
+
+// meetingRule builds the recurrence of a meeting, expanded in its timezone so
+// occurrences keep their local time across daylight saving changes. Excluded
+// dates are left out. It returns nil for meetings that don't repeat.
+func meetingRule(meeting *models.Meeting) (*rrule.Set, error) {
+	if meeting.Recurrence == "" {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(meeting.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidMeeting, meeting.Timezone)
+	}
+
+	option, err := rrule.StrToROptionInLocation(meeting.Recurrence, location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: recurrence: %v", ErrInvalidMeeting, err)
+	}
+	if option.Freq == rrule.SECONDLY || option.Freq == rrule.MINUTELY {
+		return nil, fmt.Errorf("%w: recurrence can repeat at most hourly", ErrInvalidMeeting)
+	}
+
+	option.Dtstart = meeting.StartsAt.In(location)
+	rule, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, fmt.Errorf("%w: recurrence: %v", ErrInvalidMeeting, err)
+	}
+
+	set := &rrule.Set{}
+	set.RRule(rule)
+	for _, date := range meeting.ExcludedDates {
+		set.ExDate(date)
+	}
+
+	return set, nil
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return location
+}
+
+func TestNextOccurrence(t *testing.T) {
+	amsterdam := mustLoadLocation(t, "Europe/Amsterdam")
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, amsterdam)
+	}
+
+	single := &models.Meeting{StartsAt: at(2026, 3, 23, 10, 0), EndsAt: at(2026, 3, 23, 10, 30), Timezone: "Europe/Amsterdam"}
+	weekly := &models.Meeting{
+		StartsAt:   at(2026, 3, 23, 10, 0),
+		EndsAt:     at(2026, 3, 23, 10, 30),
+		Timezone:   "Europe/Amsterdam",
+		Recurrence: "FREQ=WEEKLY;BYDAY=MO;COUNT=3",
+	}
+	excluded := &models.Meeting{
+		StartsAt:      at(2026, 3, 23, 10, 0),
+		EndsAt:        at(2026, 3, 23, 10, 30),
+		Timezone:      "Europe/Amsterdam",
+		Recurrence:    "FREQ=WEEKLY;BYDAY=MO",
+		ExcludedDates: []time.Time{at(2026, 3, 30, 10, 0)},
+	}
+	// Daily at 09:30 local, across the start and end of summer time
+	daily := &models.Meeting{
+		StartsAt:   at(2026, 3, 27, 9, 30),
+		EndsAt:     at(2026, 3, 27, 9, 45),
+		Timezone:   "Europe/Amsterdam",
+		Recurrence: "FREQ=DAILY",
+	}
+
+	tests := []struct {
+		name    string
+		meeting *models.Meeting
+		now     time.Time
+		want    time.Time // zero when there is no occurrence left
+	}{
+		{"single before the start", single, at(2026, 3, 20, 9, 0), at(2026, 3, 23, 10, 0)},
+		{"single while running", single, at(2026, 3, 23, 10, 15), at(2026, 3, 23, 10, 0)},
+		{"single at the end", single, at(2026, 3, 23, 10, 30), time.Time{}},
+		{"weekly while running", weekly, at(2026, 3, 30, 10, 29), at(2026, 3, 30, 10, 0)},
+		{"weekly between occurrences", weekly, at(2026, 3, 30, 10, 30), at(2026, 4, 6, 10, 0)},
+		{"weekly after the last count", weekly, at(2026, 4, 6, 11, 0), time.Time{}},
+		{"excluded date is skipped", excluded, at(2026, 3, 24, 9, 0), at(2026, 4, 6, 10, 0)},
+		{"excluded date is not running", excluded, at(2026, 3, 30, 10, 15), at(2026, 4, 6, 10, 0)},
+		{"before summer time", daily, at(2026, 3, 28, 8, 0), at(2026, 3, 28, 9, 30)},
+		{"first day of summer time", daily, at(2026, 3, 29, 8, 0), at(2026, 3, 29, 9, 30)},
+		{"first day of winter time", daily, at(2026, 10, 25, 9, 40), at(2026, 10, 25, 9, 30)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			occurrence, err := NextOccurrence(test.meeting, test.now)
+			if err != nil {
+				t.Fatalf("NextOccurrence: %v", err)
+			}
+			if test.want.IsZero() {
+				if occurrence != nil {
+					t.Fatalf("occurrence = %v, want none", occurrence.StartsAt)
+				}
+				return
+			}
+			if occurrence == nil {
+				t.Fatalf("no occurrence, want %v", test.want)
+			}
+			if !occurrence.StartsAt.Equal(test.want) {
+				t.Errorf("starts at %v, want %v", occurrence.StartsAt.In(amsterdam), test.want)
+			}
+			if duration := occurrence.EndsAt.Sub(occurrence.StartsAt); duration != test.meeting.Duration() {
+				t.Errorf("lasts %v, want %v", duration, test.meeting.Duration())
+			}
+		})
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	amsterdam := mustLoadLocation(t, "Europe/Amsterdam")
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, amsterdam)
+	}
+
+	meeting := &models.Meeting{
+		StartsAt:      at(2026, 10, 22, 9, 30),
+		EndsAt:        at(2026, 10, 22, 10, 0),
+		Timezone:      "Europe/Amsterdam",
+		Recurrence:    "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+		ExcludedDates: []time.Time{at(2026, 10, 27, 9, 30)},
+	}
+
+	// The range starts during the first occurrence and spans the end of summer time
+	occurrences, err := Occurrences(meeting, at(2026, 10, 22, 9, 45), at(2026, 10, 29, 0, 0))
+	if err != nil {
+		t.Fatalf("Occurrences: %v", err)
+	}
+
+	want := []time.Time{
+		at(2026, 10, 22, 9, 30),
+		at(2026, 10, 23, 9, 30),
+		at(2026, 10, 26, 9, 30),
+		at(2026, 10, 28, 9, 30),
+	}
+	if len(occurrences) != len(want) {
+		t.Fatalf("got %d occurrences, want %d: %v", len(occurrences), len(want), occurrences)
+	}
+	for i, occurrence := range occurrences {
+		if !occurrence.StartsAt.Equal(want[i]) {
+			t.Errorf("occurrence %d starts at %v, want %v", i, occurrence.StartsAt.In(amsterdam), want[i])
+		}
+		if local := occurrence.StartsAt.In(amsterdam); local.Hour() != 9 || local.Minute() != 30 {
+			t.Errorf("occurrence %d starts at %s local time, want 09:30", i, local.Format("15:04"))
+		}
+	}
+
+	// A single meeting only overlaps ranges around its one occurrence
+	single := &models.Meeting{StartsAt: at(2026, 10, 22, 9, 30), EndsAt: at(2026, 10, 22, 10, 0), Timezone: "UTC"}
+	if occurrences, _ := Occurrences(single, at(2026, 10, 22, 10, 0), at(2026, 10, 23, 0, 0)); len(occurrences) != 0 {
+		t.Errorf("single meeting after its end: %v, want none", occurrences)
+	}
+	if occurrences, _ := Occurrences(single, at(2026, 10, 22, 0, 0), at(2026, 10, 22, 9, 45)); len(occurrences) != 1 {
+		t.Errorf("single meeting in range: %d occurrences, want 1", len(occurrences))
+	}
+}
+
+func TestValidateMeetingExcludedDates(t *testing.T) {
+	start := time.Date(2026, 3, 23, 9, 0, 0, 0, time.UTC)
+	newMeeting := func(recurrence string, excluded ...time.Time) *models.Meeting {
+		return &models.Meeting{
+			Title:         "Standup",
+			StartsAt:      start,
+			EndsAt:        start.Add(30 * time.Minute),
+			Timezone:      "UTC",
+			Recurrence:    recurrence,
+			ExcludedDates: excluded,
+		}
+	}
+
+	if err := ValidateMeeting(newMeeting("FREQ=WEEKLY", start.AddDate(0, 0, 7))); err != nil {
+		t.Errorf("excluding an occurrence: %v", err)
+	}
+	if err := ValidateMeeting(newMeeting("FREQ=WEEKLY", start.AddDate(0, 0, 8))); !errors.Is(err, ErrInvalidMeeting) {
+		t.Errorf("excluding a day without an occurrence: err = %v, want %v", err, ErrInvalidMeeting)
+	}
+	if err := ValidateMeeting(newMeeting("", start)); !errors.Is(err, ErrInvalidMeeting) {
+		t.Errorf("excluding without a recurrence: err = %v, want %v", err, ErrInvalidMeeting)
+	}
+	if err := ValidateMeeting(newMeeting("FREQ=MINUTELY")); !errors.Is(err, ErrInvalidMeeting) {
+		t.Errorf("minutely recurrence: err = %v, want %v", err, ErrInvalidMeeting)
+	}
+}
+
+// newTestMeeting stores a daily meeting whose occurrence of today is running
+func newTestMeeting(t *testing.T) (*MeetingService, *models.Meeting) {
+	t.Helper()
+	db := testdb.Open(t,
+		&models.Meeting{},
+		&models.Room{},
+		&models.RoomParticipant{},
+		&models.RoomMember{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+	)
+	ms := &MeetingService{db: db, roomService: &RoomService{db: db}}
+
+	start := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	meeting := &models.Meeting{
+		Title:       "Standup",
+		OrganizerID: "organizer",
+		StartsAt:    start.AddDate(0, 0, -7),
+		EndsAt:      start.AddDate(0, 0, -7).Add(30 * time.Minute),
+		Timezone:    "UTC",
+		Recurrence:  "FREQ=DAILY",
+		RoomName:    "abc-defg-hij",
+	}
+	if err := db.Create(meeting).Error; err != nil {
+		t.Fatalf("failed to create meeting: %v", err)
+	}
+	return ms, meeting
+}
+
+func TestResolveRoomReopensRoomOfPreviousOccurrence(t *testing.T) {
+	ms, meeting := newTestMeeting(t)
+
+	room, err := ms.ResolveRoom(meeting.RoomName)
+	if err != nil {
+		t.Fatalf("ResolveRoom: %v", err)
+	}
+	running, _ := NextOccurrence(meeting, time.Now())
+
+	// Yesterday's occurrence expired the room
+	yesterday := running.EndsAt.AddDate(0, 0, -1)
+	ms.db.Model(room).Updates(map[string]interface{}{"is_active": false, "expires_at": yesterday})
+
+	reopened, err := ms.ResolveRoom(meeting.RoomName)
+	if err != nil {
+		t.Fatalf("ResolveRoom after the previous occurrence: %v", err)
+	}
+	if reopened.ID != room.ID {
+		t.Errorf("reopened room %s, want the meeting room %s", reopened.ID, room.ID)
+	}
+	if reopened.ExpiresAt == nil || !reopened.ExpiresAt.Equal(running.EndsAt) {
+		t.Errorf("expires at %v, want the end of the running occurrence %v", reopened.ExpiresAt, running.EndsAt)
+	}
+}
+
+func TestResolveRoomKeepsRoomClosedByHost(t *testing.T) {
+	ms, meeting := newTestMeeting(t)
+
+	room, err := ms.ResolveRoom(meeting.RoomName)
+	if err != nil {
+		t.Fatalf("ResolveRoom: %v", err)
+	}
+	if err := ms.roomService.DeactivateRoom(room.ID); err != nil {
+		t.Fatalf("DeactivateRoom: %v", err)
+	}
+
+	if _, err := ms.ResolveRoom(meeting.RoomName); !errors.Is(err, ErrMeetingRoomClosed) {
+		t.Errorf("ResolveRoom after a host closed the room: err = %v, want %v", err, ErrMeetingRoomClosed)
+	}
+
+	var stored models.Room
+	ms.db.Where("id = ?", room.ID).First(&stored)
+	if stored.IsActive {
+		t.Error("room closed by a host was reopened")
+	}
+}
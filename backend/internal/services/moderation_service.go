@@ -0,0 +1,577 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"meet-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/livekit/protocol/livekit"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+)
+
+// ModerationTopic is the data topic moderation messages are sent on
+const ModerationTopic = "moderation"
+
+var (
+	ErrParticipantNotFound = errors.New("participant not found")
+	ErrTrackNotFound       = errors.New("track not found")
+	ErrInvalidModeration   = errors.New("invalid moderation request")
+)
+
+// reservedMetadataKeys are set by the token issuer and cannot be changed by
+// moderators; the LiveKit webhook relies on user_id
+var reservedMetadataKeys = []string{"guest", "user_id", "joinedAt", "maxDuration"}
+
+// RoomClient is the part of the LiveKit room service API used for moderation.
+// *lksdk.RoomServiceClient implements it.
+type RoomClient interface {
+	ListParticipants(ctx context.Context, req *livekit.ListParticipantsRequest) (*livekit.ListParticipantsResponse, error)
+	GetParticipant(ctx context.Context, req *livekit.RoomParticipantIdentity) (*livekit.ParticipantInfo, error)
+	RemoveParticipant(ctx context.Context, req *livekit.RoomParticipantIdentity) (*livekit.RemoveParticipantResponse, error)
+	MutePublishedTrack(ctx context.Context, req *livekit.MuteRoomTrackRequest) (*livekit.MuteRoomTrackResponse, error)
+	UpdateParticipant(ctx context.Context, req *livekit.UpdateParticipantRequest) (*livekit.ParticipantInfo, error)
+	SendData(ctx context.Context, req *livekit.SendDataRequest) (*livekit.SendDataResponse, error)
+}
+
+// ModerationService performs moderation actions through LiveKit and keeps an
+// audit log of them
+type ModerationService struct {
+	db            *gorm.DB
+	client        RoomClient
+	tokenIssuer   *TokenIssuer
+	memberService *RoomMemberService
+	policyService *RoomPolicyService
+	banService    *BanService
+}
+
+// NewModerationService creates a moderation service that keeps its audit log
+// and looks up members, policies and bans in db
+func NewModerationService(db *gorm.DB, client RoomClient, tokenIssuer *TokenIssuer) *ModerationService {
+	return &ModerationService{
+		db:            db,
+		client:        client,
+		tokenIssuer:   tokenIssuer,
+		memberService: &RoomMemberService{db: db},
+		policyService: &RoomPolicyService{db: db},
+		banService:    &BanService{db: db},
+	}
+}
+
+// MuteParticipant mutes or unmutes the tracks of a participant selected by
+// the request, and returns the SIDs of the tracks that changed. Unmuting only
+// works when LiveKit runs with enable_remote_unmute.
+func (ms *ModerationService) MuteParticipant(ctx context.Context, room *models.Room, actorID, identity string, request models.MuteParticipantRequest) ([]string, error) {
+	muted := true
+	if request.Muted != nil {
+		muted = *request.Muted
+	}
+
+	participant, err := ms.getParticipant(ctx, room.Name, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []*livekit.TrackInfo
+	if request.TrackSID != "" {
+		track := findTrack(participant, request.TrackSID)
+		if track == nil {
+			return nil, ErrTrackNotFound
+		}
+		tracks = []*livekit.TrackInfo{track}
+	} else {
+		types, err := trackTypes(request.Kind)
+		if err != nil {
+			return nil, err
+		}
+		tracks = selectTracks(participant, types, muted)
+	}
+
+	sids, err := ms.muteTracks(ctx, room.Name, identity, tracks, muted)
+
+	action := models.ModerationMute
+	if !muted {
+		action = models.ModerationUnmute
+	}
+	ms.record(room, actorID, action, identity, map[string]interface{}{
+		"kind":       request.Kind,
+		"track_sids": sids,
+	}, err)
+
+	return sids, err
+}
+
+// MuteAll mutes the tracks of a kind for everyone in the room except the
+// moderator doing it, and returns how many participants and tracks were muted
+func (ms *ModerationService) MuteAll(ctx context.Context, room *models.Room, actorID string, request models.MuteAllRequest) (int, int, error) {
+	types, err := trackTypes(request.Kind)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	response, err := ms.client.ListParticipants(ctx, &livekit.ListParticipantsRequest{Room: room.Name})
+	if err != nil {
+		return 0, 0, liveKitError(err)
+	}
+
+	participants, tracks := 0, 0
+	for _, participant := range response.Participants {
+		// Signed-in users join with their user ID as identity
+		if participant.Identity == actorID || participant.Kind == livekit.ParticipantInfo_EGRESS {
+			continue
+		}
+
+		sids, muteErr := ms.muteTracks(ctx, room.Name, participant.Identity, selectTracks(participant, types, true), true)
+		if len(sids) > 0 {
+			participants++
+			tracks += len(sids)
+		}
+		// Participants leaving in the meantime don't fail the action
+		if muteErr != nil && !errors.Is(muteErr, ErrParticipantNotFound) && err == nil {
+			err = muteErr
+		}
+	}
+
+	ms.record(room, actorID, models.ModerationMuteAll, "", map[string]interface{}{
+		"kind":         request.Kind,
+		"participants": participants,
+		"tracks":       tracks,
+	}, err)
+
+	return participants, tracks, err
+}
+
+// UpdatePermissions changes what a participant may do. Revoking publish
+// rights makes LiveKit unpublish the participant's tracks.
+func (ms *ModerationService) UpdatePermissions(ctx context.Context, room *models.Room, actorID, identity string, request models.ParticipantPermissionsRequest) (*livekit.ParticipantInfo, error) {
+	participant, err := ms.getParticipant(ctx, room.Name, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	// LiveKit replaces the permissions as a whole, so start from the current ones
+	permission := &livekit.ParticipantPermission{}
+	if participant.Permission != nil {
+		permission = proto.Clone(participant.Permission).(*livekit.ParticipantPermission)
+	}
+
+	details := map[string]interface{}{}
+	if request.CanPublish != nil {
+		permission.CanPublish = *request.CanPublish
+		details["can_publish"] = *request.CanPublish
+	}
+	if request.CanSubscribe != nil {
+		permission.CanSubscribe = *request.CanSubscribe
+		details["can_subscribe"] = *request.CanSubscribe
+	}
+	if request.CanPublishData != nil {
+		permission.CanPublishData = *request.CanPublishData
+		details["can_publish_data"] = *request.CanPublishData
+	}
+	if request.CanPublishSources != nil {
+		sources, err := trackSources(*request.CanPublishSources)
+		if err != nil {
+			return nil, err
+		}
+		permission.CanPublishSources = sources
+		details["can_publish_sources"] = *request.CanPublishSources
+	}
+	if len(details) == 0 {
+		return nil, fmt.Errorf("%w: no permissions given", ErrInvalidModeration)
+	}
+
+	updated, err := ms.client.UpdateParticipant(ctx, &livekit.UpdateParticipantRequest{
+		Room:       room.Name,
+		Identity:   identity,
+		Permission: permission,
+	})
+	if err != nil {
+		err = liveKitError(err)
+	}
+
+	ms.record(room, actorID, models.ModerationUpdatePermissions, identity, details, err)
+
+	return updated, err
+}
+
+// UpdateMetadata merges keys into the metadata of a participant and can
+// change their display name. Keys set by the server cannot be changed.
+func (ms *ModerationService) UpdateMetadata(ctx context.Context, room *models.Room, actorID, identity string, request models.ParticipantMetadataRequest) (*livekit.ParticipantInfo, error) {
+	if request.Metadata == nil && request.Name == nil {
+		return nil, fmt.Errorf("%w: metadata or name is required", ErrInvalidModeration)
+	}
+	for _, key := range reservedMetadataKeys {
+		if _, ok := request.Metadata[key]; ok {
+			return nil, fmt.Errorf("%w: metadata key %s cannot be changed", ErrInvalidModeration, key)
+		}
+	}
+
+	participant, err := ms.getParticipant(ctx, room.Name, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &livekit.UpdateParticipantRequest{
+		Room:     room.Name,
+		Identity: identity,
+	}
+	details := map[string]interface{}{}
+
+	if request.Metadata != nil {
+		metadata := map[string]interface{}{}
+		if participant.Metadata != "" {
+			// Metadata that isn't a JSON object is replaced
+			_ = json.Unmarshal([]byte(participant.Metadata), &metadata)
+		}
+		for key, value := range request.Metadata {
+			if value == nil {
+				delete(metadata, key)
+			} else {
+				metadata[key] = value
+			}
+		}
+
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, err
+		}
+		update.Metadata = string(encoded)
+		details["metadata"] = request.Metadata
+	}
+	if request.Name != nil {
+		name := strings.TrimSpace(*request.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidModeration)
+		}
+		update.Name = name
+		details["name"] = name
+	}
+
+	updated, err := ms.client.UpdateParticipant(ctx, update)
+	if err != nil {
+		err = liveKitError(err)
+	}
+
+	ms.record(room, actorID, models.ModerationUpdateMetadata, identity, details, err)
+
+	return updated, err
+}
+
+// RemoveParticipant disconnects a participant from the room
+func (ms *ModerationService) RemoveParticipant(ctx context.Context, room *models.Room, actorID, identity string) error {
+	_, err := ms.client.RemoveParticipant(ctx, &livekit.RoomParticipantIdentity{
+		Room:     room.Name,
+		Identity: identity,
+	})
+	if err != nil {
+		err = liveKitError(err)
+		if errors.Is(err, ErrParticipantNotFound) {
+			return err
+		}
+	}
+
+	ms.record(room, actorID, models.ModerationRemove, identity, nil, err)
+
+	return err
+}
+
+// MoveParticipant sends a participant a token for another room on the
+// moderation data topic; the client switches rooms when it receives it.
+// LiveKit can't move participants itself in the version we run. The token
+// has the grants the participant would get in the target room, but skips
+// its passcode and lobby since a moderator admits them.
+func (ms *ModerationService) MoveParticipant(ctx context.Context, room, target *models.Room, actorID, identity string) error {
+	if room.ID == target.ID {
+		return fmt.Errorf("%w: participant is already in this room", ErrInvalidModeration)
+	}
+
+	participant, err := ms.getParticipant(ctx, room.Name, identity)
+	if err != nil {
+		return err
+	}
+
+	err = ms.sendRoomToken(ctx, room, target, participant.Identity, participant.Name, metadataUserID(participant.Metadata), models.ModerationMove)
+
+	ms.record(room, actorID, models.ModerationMove, identity, map[string]interface{}{
+		"target_room": target.Name,
+	}, err)
+
+	return err
+}
+
+// sendRoomToken sends a participant of a room a token for the target room
+// on the moderation topic, with the grants they would get in the target room.
+// messageType tells the client why it should switch rooms.
+func (ms *ModerationService) sendRoomToken(ctx context.Context, room, target *models.Room, identity, name string, userID *string, messageType string) error {
+	tokenRequest := TokenRequest{
+		Identity: identity,
+		Name:     name,
+		UserID:   userID,
+	}
+	if userID != nil {
+		member, err := ms.memberService.GetMember(target.ID, *userID)
+		if err != nil && !errors.Is(err, ErrRoomMemberNotFound) {
+			return err
+		}
+		if member != nil {
+			tokenRequest.RoomRole = member.Role
+		}
+	}
+
+	ban, err := ms.banService.FindBan(target.ID, BanSubject{UserID: userID, Identity: identity})
+	if err != nil {
+		return err
+	}
+	if ban != nil {
+		return ErrBanned
+	}
+
+	policy, err := ms.policyService.GetPolicy(target.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := ms.tokenIssuer.IssueToken(target, policy, tokenRequest)
+	if err != nil {
+		return err
+	}
+
+	message, err := json.Marshal(map[string]interface{}{
+		"type":       messageType,
+		"room_name":  target.Name,
+		"server_url": ms.tokenIssuer.ServerURL(),
+		"token":      token.Token,
+		"expires_at": token.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	topic := ModerationTopic
+	_, err = ms.client.SendData(ctx, &livekit.SendDataRequest{
+		Room:                  room.Name,
+		Data:                  message,
+		Kind:                  livekit.DataPacket_RELIABLE,
+		DestinationIdentities: []string{identity},
+		Topic:                 &topic,
+	})
+	if err != nil {
+		return liveKitError(err)
+	}
+
+	return nil
+}
+
+// Ban bans someone from a room, or from every room when room is nil, and
+// removes the participants it applies to. It returns the ban and how many
+// participants were removed.
+func (ms *ModerationService) Ban(ctx context.Context, room *models.Room, actorID string, request models.BanRequest) (*models.Ban, int, error) {
+	ban, err := ms.banService.CreateBan(room, request, actorID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if room != nil {
+		ms.record(room, actorID, models.ModerationBan, ban.Identity, banDetails(ban), nil)
+	}
+
+	// The ban stands even if someone couldn't be removed; they can't rejoin
+	participants, err := ms.banService.ActiveParticipants(ban)
+	if err != nil {
+		log.Printf("Failed to remove banned participants: %v", err)
+		return ban, 0, nil
+	}
+
+	removed := 0
+	for i := range participants {
+		participant := &participants[i]
+		err := ms.RemoveParticipant(ctx, &participant.Room, actorID, participant.Identity)
+		if err != nil && !errors.Is(err, ErrParticipantNotFound) {
+			log.Printf("Failed to remove banned participant %s from room %s: %v", participant.Identity, participant.Room.Name, err)
+			continue
+		}
+		removed++
+	}
+
+	return ban, removed, nil
+}
+
+// LiftBan removes a ban; lifting a room ban is recorded in the room's audit log
+func (ms *ModerationService) LiftBan(room *models.Room, actorID string, ban *models.Ban) error {
+	if err := ms.banService.DeleteBan(ban); err != nil {
+		return err
+	}
+
+	if room != nil {
+		ms.record(room, actorID, models.ModerationUnban, ban.Identity, banDetails(ban), nil)
+	}
+
+	return nil
+}
+
+// banDetails describes a ban in the audit log
+func banDetails(ban *models.Ban) map[string]interface{} {
+	details := map[string]interface{}{
+		"ban_id":    ban.ID,
+		"ip_banned": ban.IPAddress != "",
+	}
+	if ban.UserID != "" {
+		details["user_id"] = ban.UserID
+	}
+	if ban.Reason != "" {
+		details["reason"] = ban.Reason
+	}
+	if ban.ExpiresAt != nil {
+		details["expires_at"] = ban.ExpiresAt
+	}
+	return details
+}
+
+// ListActions returns the audit log of a room, newest first
+func (ms *ModerationService) ListActions(roomID uuid.UUID, limit int) ([]models.ModerationAction, error) {
+	var actions []models.ModerationAction
+	result := ms.db.Where("room_id = ?", roomID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&actions)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list moderation actions: %w", result.Error)
+	}
+
+	return actions, nil
+}
+
+// record adds an action to the audit log. The action already happened in
+// LiveKit, so a failure to record it is only logged.
+func (ms *ModerationService) record(room *models.Room, actorID, action, identity string, details map[string]interface{}, actionErr error) {
+	entry := models.ModerationAction{
+		RoomID:         room.ID,
+		RoomName:       room.Name,
+		ActorID:        actorID,
+		Action:         action,
+		TargetIdentity: identity,
+		Details:        details,
+	}
+	if actionErr != nil {
+		entry.Error = actionErr.Error()
+	}
+
+	if err := ms.db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record %s moderation action in room %s: %v", action, room.Name, err)
+	}
+}
+
+// getParticipant looks up a participant in LiveKit
+func (ms *ModerationService) getParticipant(ctx context.Context, roomName, identity string) (*livekit.ParticipantInfo, error) {
+	participant, err := ms.client.GetParticipant(ctx, &livekit.RoomParticipantIdentity{
+		Room:     roomName,
+		Identity: identity,
+	})
+	if err != nil {
+		return nil, liveKitError(err)
+	}
+	return participant, nil
+}
+
+// muteTracks mutes or unmutes tracks one by one and returns the SIDs of the
+// tracks that changed before an error stopped it
+func (ms *ModerationService) muteTracks(ctx context.Context, roomName, identity string, tracks []*livekit.TrackInfo, muted bool) ([]string, error) {
+	sids := []string{}
+	for _, track := range tracks {
+		_, err := ms.client.MutePublishedTrack(ctx, &livekit.MuteRoomTrackRequest{
+			Room:     roomName,
+			Identity: identity,
+			TrackSid: track.Sid,
+			Muted:    muted,
+		})
+		if err != nil {
+			return sids, liveKitError(err)
+		}
+		sids = append(sids, track.Sid)
+	}
+	return sids, nil
+}
+
+// findTrack returns the published track of a participant with a SID
+func findTrack(participant *livekit.ParticipantInfo, sid string) *livekit.TrackInfo {
+	for _, track := range participant.Tracks {
+		if track.Sid == sid {
+			return track
+		}
+	}
+	return nil
+}
+
+// selectTracks returns the tracks of the given types that aren't muted or
+// unmuted already
+func selectTracks(participant *livekit.ParticipantInfo, types []livekit.TrackType, muted bool) []*livekit.TrackInfo {
+	var tracks []*livekit.TrackInfo
+	for _, track := range participant.Tracks {
+		if track.Muted == muted {
+			continue
+		}
+		for _, trackType := range types {
+			if track.Type == trackType {
+				tracks = append(tracks, track)
+				break
+			}
+		}
+	}
+	return tracks
+}
+
+// trackTypes maps the kind of a mute request to LiveKit track types;
+// screen shares are video or audio tracks too
+func trackTypes(kind string) ([]livekit.TrackType, error) {
+	switch kind {
+	case "", "audio":
+		return []livekit.TrackType{livekit.TrackType_AUDIO}, nil
+	case "video":
+		return []livekit.TrackType{livekit.TrackType_VIDEO}, nil
+	case "all":
+		return []livekit.TrackType{livekit.TrackType_AUDIO, livekit.TrackType_VIDEO}, nil
+	}
+	return nil, fmt.Errorf("%w: kind must be audio, video or all", ErrInvalidModeration)
+}
+
+// trackSources maps source names as used in tokens to LiveKit track sources
+func trackSources(names []string) ([]livekit.TrackSource, error) {
+	sources := make([]livekit.TrackSource, 0, len(names))
+	for _, name := range names {
+		value, ok := livekit.TrackSource_value[strings.ToUpper(name)]
+		if !ok || livekit.TrackSource(value) == livekit.TrackSource_UNKNOWN {
+			return nil, fmt.Errorf("%w: unknown source %q", ErrInvalidModeration, name)
+		}
+		sources = append(sources, livekit.TrackSource(value))
+	}
+	return sources, nil
+}
+
+// metadataUserID returns the user ID the token issuer stored in the
+// participant metadata, or nil for guests
+func metadataUserID(metadata string) *string {
+	var data struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal([]byte(metadata), &data); err != nil || data.UserID == "" {
+		return nil
+	}
+	return &data.UserID
+}
+
+// liveKitError maps LiveKit's "not found" to ErrParticipantNotFound
+func liveKitError(err error) error {
+	var twirpErr twirp.Error
+	if errors.As(err, &twirpErr) && twirpErr.Code() == twirp.NotFound {
+		return ErrParticipantNotFound
+	}
+	return fmt.Errorf("livekit request failed: %w", err)
+}
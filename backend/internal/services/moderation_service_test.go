@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeRoomClient is a LiveKit room service holding the participants of one room
+type fakeRoomClient struct {
+	participants map[string]*livekit.ParticipantInfo
+	muted        []string // identity/track SID of every mute request
+	updates      []*livekit.UpdateParticipantRequest
+	failUpdates  error
+	sent         []*livekit.SendDataRequest
+}
+
+func newFakeRoomClient(participants ...*livekit.ParticipantInfo) *fakeRoomClient {
+	client := &fakeRoomClient{participants: make(map[string]*livekit.ParticipantInfo)}
+	for _, participant := range participants {
+		client.participants[participant.Identity] = participant
+	}
+	return client
+}
+
+func (f *fakeRoomClient) ListParticipants(ctx context.Context, req *livekit.ListParticipantsRequest) (*livekit.ListParticipantsResponse, error) {
+	identities := make([]string, 0, len(f.participants))
+	for identity := range f.participants {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+
+	response := &livekit.ListParticipantsResponse{}
+	for _, identity := range identities {
+		response.Participants = append(response.Participants, f.participants[identity])
+	}
+	return response, nil
+}
+
+func (f *fakeRoomClient) GetParticipant(ctx context.Context, req *livekit.RoomParticipantIdentity) (*livekit.ParticipantInfo, error) {
+	participant, ok := f.participants[req.Identity]
+	if !ok {
+		return nil, twirp.NotFoundError("participant not found")
+	}
+	return participant, nil
+}
+
+func (f *fakeRoomClient) RemoveParticipant(ctx context.Context, req *livekit.RoomParticipantIdentity) (*livekit.RemoveParticipantResponse, error) {
+	if _, ok := f.participants[req.Identity]; !ok {
+		return nil, twirp.NotFoundError("participant not found")
+	}
+	delete(f.participants, req.Identity)
+	return &livekit.RemoveParticipantResponse{}, nil
+}
+
+func (f *fakeRoomClient) MutePublishedTrack(ctx context.Context, req *livekit.MuteRoomTrackRequest) (*livekit.MuteRoomTrackResponse, error) {
+	f.muted = append(f.muted, req.Identity+"/"+req.TrackSid)
+	return &livekit.MuteRoomTrackResponse{}, nil
+}
+
+func (f *fakeRoomClient) UpdateParticipant(ctx context.Context, req *livekit.UpdateParticipantRequest) (*livekit.ParticipantInfo, error) {
+	if f.failUpdates != nil {
+		return nil, f.failUpdates
+	}
+	f.updates = append(f.updates, req)
+
+	participant := proto.Clone(f.participants[req.Identity]).(*livekit.ParticipantInfo)
+	if req.Permission != nil {
+		participant.Permission = req.Permission
+	}
+	if req.Metadata != "" {
+		participant.Metadata = req.Metadata
+	}
+	if req.Name != "" {
+		participant.Name = req.Name
+	}
+	return participant, nil
+}
+
+func (f *fakeRoomClient) SendData(ctx context.Context, req *livekit.SendDataRequest) (*livekit.SendDataResponse, error) {
+	f.sent = append(f.sent, req)
+	return &livekit.SendDataResponse{}, nil
+}
+
+func newTestModerationService(t *testing.T, client RoomClient) (*ModerationService, *models.Room) {
+	t.Helper()
+
+	db := testdb.Open(t, &models.ModerationAction{}, &models.RoomMember{}, &models.RoomPolicy{}, &models.Ban{})
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "host")
+	return NewModerationService(db, client, nil), room
+}
+
+// auditLog returns the recorded actions, oldest first
+func auditLog(t *testing.T, ms *ModerationService) []models.ModerationAction {
+	t.Helper()
+	var actions []models.ModerationAction
+	if err := ms.db.Order("created_at").Find(&actions).Error; err != nil {
+		t.Fatalf("failed to load audit log: %v", err)
+	}
+	return actions
+}
+
+func alice() *livekit.ParticipantInfo {
+	return &livekit.ParticipantInfo{
+		Identity: "alice",
+		Name:     "Alice",
+		Metadata: `{"user_id":"user-alice","hand":"raised"}`,
+		Permission: &livekit.ParticipantPermission{
+			CanPublish:     true,
+			CanSubscribe:   true,
+			CanPublishData: true,
+		},
+		Tracks: []*livekit.TrackInfo{
+			{Sid: "TR_alice_mic", Type: livekit.TrackType_AUDIO},
+			{Sid: "TR_alice_cam", Type: livekit.TrackType_VIDEO},
+		},
+	}
+}
+
+func TestModerationMuteParticipant(t *testing.T) {
+	client := newFakeRoomClient(alice())
+	ms, room := newTestModerationService(t, client)
+
+	sids, err := ms.MuteParticipant(context.Background(), room, "host", "alice", models.MuteParticipantRequest{})
+	if err != nil {
+		t.Fatalf("MuteParticipant: %v", err)
+	}
+	if strings.Join(sids, ",") != "TR_alice_mic" || strings.Join(client.muted, ",") != "alice/TR_alice_mic" {
+		t.Errorf("muted %v (%v), want only the microphone", sids, client.muted)
+	}
+
+	// Unknown participants are reported as such and not recorded
+	if _, err := ms.MuteParticipant(context.Background(), room, "host", "nobody", models.MuteParticipantRequest{}); !errors.Is(err, ErrParticipantNotFound) {
+		t.Errorf("unknown participant: err = %v, want %v", err, ErrParticipantNotFound)
+	}
+	if _, err := ms.MuteParticipant(context.Background(), room, "host", "alice", models.MuteParticipantRequest{TrackSID: "TR_other"}); !errors.Is(err, ErrTrackNotFound) {
+		t.Errorf("unknown track: err = %v, want %v", err, ErrTrackNotFound)
+	}
+
+	actions := auditLog(t, ms)
+	if len(actions) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(actions))
+	}
+	action := actions[0]
+	if action.Action != models.ModerationMute || action.ActorID != "host" || action.TargetIdentity != "alice" ||
+		action.RoomID != room.ID || action.RoomName != room.Name || action.Error != "" {
+		t.Errorf("audit entry %+v", action)
+	}
+	if sids, _ := json.Marshal(action.Details["track_sids"]); string(sids) != `["TR_alice_mic"]` {
+		t.Errorf("audit track_sids = %s", sids)
+	}
+}
+
+func TestModerationMuteAll(t *testing.T) {
+	host := &livekit.ParticipantInfo{Identity: "host", Tracks: []*livekit.TrackInfo{{Sid: "TR_host_mic", Type: livekit.TrackType_AUDIO}}}
+	bob := &livekit.ParticipantInfo{Identity: "bob", Tracks: []*livekit.TrackInfo{
+		{Sid: "TR_bob_mic", Type: livekit.TrackType_AUDIO, Muted: true},
+		{Sid: "TR_bob_cam", Type: livekit.TrackType_VIDEO},
+	}}
+	egress := &livekit.ParticipantInfo{Identity: "EG_1", Kind: livekit.ParticipantInfo_EGRESS, Tracks: []*livekit.TrackInfo{{Sid: "TR_egress", Type: livekit.TrackType_AUDIO}}}
+
+	client := newFakeRoomClient(host, alice(), bob, egress)
+	ms, room := newTestModerationService(t, client)
+
+	participants, tracks, err := ms.MuteAll(context.Background(), room, "host", models.MuteAllRequest{Kind: "all"})
+	if err != nil {
+		t.Fatalf("MuteAll: %v", err)
+	}
+
+	// The moderator and egress are skipped, muted tracks stay as they are
+	if participants != 2 || tracks != 3 {
+		t.Errorf("muted %d participants and %d tracks, want 2 and 3", participants, tracks)
+	}
+	if got := strings.Join(client.muted, ","); got != "alice/TR_alice_mic,alice/TR_alice_cam,bob/TR_bob_cam" {
+		t.Errorf("muted %s", got)
+	}
+
+	if _, _, err := ms.MuteAll(context.Background(), room, "host", models.MuteAllRequest{Kind: "screen"}); !errors.Is(err, ErrInvalidModeration) {
+		t.Errorf("unknown kind: err = %v, want %v", err, ErrInvalidModeration)
+	}
+
+	actions := auditLog(t, ms)
+	if len(actions) != 1 || actions[0].Action != models.ModerationMuteAll || actions[0].TargetIdentity != "" {
+		t.Fatalf("audit log %+v, want one mute_all entry", actions)
+	}
+	if actions[0].Details["participants"] != float64(2) || actions[0].Details["tracks"] != float64(3) {
+		t.Errorf("audit details %v", actions[0].Details)
+	}
+}
+
+func TestModerationUpdatePermissions(t *testing.T) {
+	client := newFakeRoomClient(alice())
+	ms, room := newTestModerationService(t, client)
+
+	canPublish := false
+	sources := []string{"microphone"}
+	updated, err := ms.UpdatePermissions(context.Background(), room, "host", "alice", models.ParticipantPermissionsRequest{
+		CanPublish:        &canPublish,
+		CanPublishSources: &sources,
+	})
+	if err != nil {
+		t.Fatalf("UpdatePermissions: %v", err)
+	}
+
+	// LiveKit replaces permissions as a whole, so the others are kept
+	permission := updated.Permission
+	if permission.CanPublish || !permission.CanSubscribe || !permission.CanPublishData {
+		t.Errorf("permission %+v, want only can_publish revoked", permission)
+	}
+	if len(permission.CanPublishSources) != 1 || permission.CanPublishSources[0] != livekit.TrackSource_MICROPHONE {
+		t.Errorf("sources %v, want the microphone", permission.CanPublishSources)
+	}
+
+	invalid := []string{"hologram"}
+	if _, err := ms.UpdatePermissions(context.Background(), room, "host", "alice", models.ParticipantPermissionsRequest{CanPublishSources: &invalid}); !errors.Is(err, ErrInvalidModeration) {
+		t.Errorf("unknown source: err = %v, want %v", err, ErrInvalidModeration)
+	}
+	if _, err := ms.UpdatePermissions(context.Background(), room, "host", "alice", models.ParticipantPermissionsRequest{}); !errors.Is(err, ErrInvalidModeration) {
+		t.Errorf("no permissions: err = %v, want %v", err, ErrInvalidModeration)
+	}
+
+	// Failures in LiveKit are recorded with their error
+	client.failUpdates = errors.New("connection refused")
+	if _, err := ms.UpdatePermissions(context.Background(), room, "host", "alice", models.ParticipantPermissionsRequest{CanPublish: &canPublish}); err == nil {
+		t.Error("UpdatePermissions succeeded while LiveKit failed")
+	}
+
+	actions := auditLog(t, ms)
+	if len(actions) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(actions))
+	}
+	if actions[0].Action != models.ModerationUpdatePermissions || actions[0].Details["can_publish"] != false || actions[0].Error != "" {
+		t.Errorf("first audit entry %+v", actions[0])
+	}
+	if !strings.Contains(actions[1].Error, "connection refused") {
+		t.Errorf("failed action recorded with error %q", actions[1].Error)
+	}
+}
+
+func TestModerationUpdateMetadata(t *testing.T) {
+	client := newFakeRoomClient(alice())
+	ms, room := newTestModerationService(t, client)
+
+	name := "  Alice (host)  "
+	_, err := ms.UpdateMetadata(context.Background(), room, "host", "alice", models.ParticipantMetadataRequest{
+		Metadata: map[string]interface{}{"hand": nil, "role": "presenter"},
+		Name:     &name,
+	})
+	if err != nil {
+		t.Fatalf("UpdateMetadata: %v", err)
+	}
+
+	if len(client.updates) != 1 {
+		t.Fatalf("got %d updates, want 1", len(client.updates))
+	}
+	update := client.updates[0]
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(update.Metadata), &metadata); err != nil {
+		t.Fatalf("metadata %q is not JSON: %v", update.Metadata, err)
+	}
+	if metadata["user_id"] != "user-alice" || metadata["role"] != "presenter" || metadata["hand"] != nil || len(metadata) != 2 {
+		t.Errorf("metadata %v, want user_id kept, role added and hand removed", metadata)
+	}
+	if update.Name != "Alice (host)" {
+		t.Errorf("name %q, want it trimmed", update.Name)
+	}
+
+	// Keys set by the token issuer are refused before anything happens
+	_, err = ms.UpdateMetadata(context.Background(), room, "host", "alice", models.ParticipantMetadataRequest{
+		Metadata: map[string]interface{}{"user_id": "someone-else"},
+	})
+	if !errors.Is(err, ErrInvalidModeration) {
+		t.Errorf("reserved key: err = %v, want %v", err, ErrInvalidModeration)
+	}
+	if len(client.updates) != 1 {
+		t.Error("reserved key was sent to LiveKit")
+	}
+
+	actions := auditLog(t, ms)
+	if len(actions) != 1 || actions[0].Action != models.ModerationUpdateMetadata || actions[0].Details["name"] != "Alice (host)" {
+		t.Errorf("audit log %+v, want one update_metadata entry", actions)
+	}
+}
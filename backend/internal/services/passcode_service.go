@@ -0,0 +1,215 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+)
+
+// Argon2id parameters (OWASP recommendation: 19 MiB, 2 iterations, 1 thread)
+const (
+	argon2Memory  = 19 * 1024
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2KeyLen  = 32
+)
+
+// Passcode attempt limits per room and IP address
+const (
+	passcodeWindow      = time.Minute
+	passcodeMaxAttempts = 10 // per window
+	passcodeMaxFailures = 5  // consecutive wrong passcodes before a lockout
+	passcodeLockout     = 15 * time.Minute
+)
+
+var (
+	// ErrPasscodeRequired is returned when joining a protected room without a passcode
+	ErrPasscodeRequired = errors.New("passcode required")
+	// ErrInvalidPasscode is returned for a wrong passcode
+	ErrInvalidPasscode = errors.New("invalid passcode")
+	// ErrPasscodeLocked is returned while an IP address is locked out of a room
+	ErrPasscodeLocked = errors.New("too many attempts, try again later")
+	// ErrInvalidPasscodeFormat is returned for passcodes that are too short or too long
+	ErrInvalidPasscodeFormat = errors.New("passcode must be between 4 and 128 characters")
+)
+
+type PasscodeService struct {
+	db *gorm.DB
+}
+
+func NewPasscodeService() *PasscodeService {
+	return &PasscodeService{
+		db: database.GetDatabase(),
+	}
+}
+
+// HashPasscode hashes a room passcode or PIN with argon2id
+func HashPasscode(passcode string) (string, error) {
+	if len(passcode) < 4 || len(passcode) > 128 {
+		return "", ErrInvalidPasscodeFormat
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(passcode), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// verifyPasscode checks a passcode against a hash made by HashPasscode
+func verifyPasscode(hash, passcode string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(passcode), salt, iterations, memory, threads, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// CheckPasscode verifies the passcode for a room, enforcing the attempt
+// limits for the caller's IP address. When locked out it also returns how
+// long until the next attempt is allowed.
+func (ps *PasscodeService) CheckPasscode(room *models.Room, ipAddress, passcode string) (time.Duration, error) {
+	if !room.HasPasscode() {
+		return 0, nil
+	}
+	if passcode == "" {
+		return 0, ErrPasscodeRequired
+	}
+
+	var retryAfter time.Duration
+	var result error
+	err := ps.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		attempt := models.PasscodeAttempt{
+			RoomID:      room.ID,
+			IPAddress:   ipAddress,
+			WindowStart: now,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&attempt).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("room_id = ? AND ip_address = ?", room.ID, ipAddress).
+			First(&attempt).Error; err != nil {
+			return err
+		}
+
+		if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+			retryAfter = attempt.LockedUntil.Sub(now)
+			result = ErrPasscodeLocked
+			return nil
+		}
+
+		if now.Sub(attempt.WindowStart) >= passcodeWindow {
+			attempt.WindowStart = now
+			attempt.WindowAttempts = 0
+		}
+		if attempt.WindowAttempts >= passcodeMaxAttempts {
+			retryAfter = attempt.WindowStart.Add(passcodeWindow).Sub(now)
+			result = ErrPasscodeLocked
+			return nil
+		}
+		attempt.WindowAttempts++
+
+		if verifyPasscode(room.PasscodeHash, passcode) {
+			attempt.Failures = 0
+			attempt.LockedUntil = nil
+		} else {
+			attempt.Failures++
+			result = ErrInvalidPasscode
+			if attempt.Failures >= passcodeMaxFailures {
+				lockedUntil := now.Add(passcodeLockout)
+				attempt.LockedUntil = &lockedUntil
+				attempt.Failures = 0
+				log.Printf("Locking %s out of room %s after %d wrong passcodes", ipAddress, room.Name, passcodeMaxFailures)
+			}
+		}
+
+		return tx.Save(&attempt).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to check passcode: %w", err)
+	}
+
+	return retryAfter, result
+}
+
+// SetPasscode sets or, with an empty passcode, removes the passcode of a room
+func (ps *PasscodeService) SetPasscode(room *models.Room, passcode string) error {
+	hash := ""
+	if passcode != "" {
+		var err error
+		hash, err = HashPasscode(passcode)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := ps.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Room{}).Where("id = ?", room.ID).Update("passcode_hash", hash).Error; err != nil {
+			return err
+		}
+		// Lockouts were for the old passcode
+		return tx.Where("room_id = ?", room.ID).Delete(&models.PasscodeAttempt{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update passcode: %w", err)
+	}
+
+	room.PasscodeHash = hash
+	return nil
+}
+
+// StartCleanupRoutine periodically removes attempt records that no longer limit anyone
+func (ps *PasscodeService) StartCleanupRoutine() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		err := ps.db.Where("updated_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-passcodeLockout), now).
+			Delete(&models.PasscodeAttempt{}).Error
+		if err != nil {
+			log.Printf("Error removing old passcode attempts: %v", err)
+		}
+	}
+}
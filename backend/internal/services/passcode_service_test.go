@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+// newTestPasscodeRoom returns a passcode service and a room protected with
+// the passcode 1234
+func newTestPasscodeRoom(t *testing.T) (*PasscodeService, *models.Room) {
+	t.Helper()
+
+	ps := &PasscodeService{db: testdb.Open(t, &models.Room{}, &models.PasscodeAttempt{})}
+	room := models.CreateAuthenticatedRoom("pas-scod-eee", "owner")
+	if err := ps.db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	if err := ps.SetPasscode(room, "1234"); err != nil {
+		t.Fatalf("SetPasscode: %v", err)
+	}
+	return ps, room
+}
+
+func TestHashPasscode(t *testing.T) {
+	hash, err := HashPasscode("correct horse")
+	if err != nil {
+		t.Fatalf("HashPasscode: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("hash %q, want argon2id with the OWASP parameters", hash)
+	}
+	if !verifyPasscode(hash, "correct horse") || verifyPasscode(hash, "correct horsE") {
+		t.Error("hash does not verify only its own passcode")
+	}
+	if other, _ := HashPasscode("correct horse"); other == hash {
+		t.Error("hashes of the same passcode share a salt")
+	}
+
+	for _, passcode := range []string{"123", strings.Repeat("x", 129)} {
+		if _, err := HashPasscode(passcode); !errors.Is(err, ErrInvalidPasscodeFormat) {
+			t.Errorf("HashPasscode of %d characters: err = %v, want %v", len(passcode), err, ErrInvalidPasscodeFormat)
+		}
+	}
+}
+
+func TestCheckPasscodeLocksOutAfterFailures(t *testing.T) {
+	ps, room := newTestPasscodeRoom(t)
+
+	if _, err := ps.CheckPasscode(room, "192.0.2.1", ""); !errors.Is(err, ErrPasscodeRequired) {
+		t.Errorf("without a passcode: err = %v, want %v", err, ErrPasscodeRequired)
+	}
+
+	for i := 1; i < passcodeMaxFailures; i++ {
+		if _, err := ps.CheckPasscode(room, "192.0.2.1", "0000"); !errors.Is(err, ErrInvalidPasscode) {
+			t.Fatalf("failure %d: err = %v, want %v", i, err, ErrInvalidPasscode)
+		}
+	}
+	// A right passcode resets the failures
+	if _, err := ps.CheckPasscode(room, "192.0.2.1", "1234"); err != nil {
+		t.Fatalf("right passcode: %v", err)
+	}
+
+	for i := 1; i <= passcodeMaxFailures; i++ {
+		if _, err := ps.CheckPasscode(room, "192.0.2.1", "0000"); !errors.Is(err, ErrInvalidPasscode) {
+			t.Fatalf("failure %d: err = %v, want %v", i, err, ErrInvalidPasscode)
+		}
+	}
+
+	// Locked out, also with the right passcode
+	retryAfter, err := ps.CheckPasscode(room, "192.0.2.1", "1234")
+	if !errors.Is(err, ErrPasscodeLocked) {
+		t.Fatalf("after %d failures: err = %v, want %v", passcodeMaxFailures, err, ErrPasscodeLocked)
+	}
+	if retryAfter <= passcodeLockout-time.Minute || retryAfter > passcodeLockout {
+		t.Errorf("retry after %v, want about %v", retryAfter, passcodeLockout)
+	}
+
+	// Other addresses are not affected
+	if _, err := ps.CheckPasscode(room, "198.51.100.1", "1234"); err != nil {
+		t.Errorf("another address: %v", err)
+	}
+
+	// Changing the passcode lifts the lockout
+	if err := ps.SetPasscode(room, "5678"); err != nil {
+		t.Fatalf("SetPasscode: %v", err)
+	}
+	if _, err := ps.CheckPasscode(room, "192.0.2.1", "5678"); err != nil {
+		t.Errorf("after changing the passcode: %v", err)
+	}
+}
+
+func TestCheckPasscodeLimitsAttemptsPerWindow(t *testing.T) {
+	ps, room := newTestPasscodeRoom(t)
+
+	for i := 1; i <= passcodeMaxAttempts; i++ {
+		if _, err := ps.CheckPasscode(room, "192.0.2.1", "1234"); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	retryAfter, err := ps.CheckPasscode(room, "192.0.2.1", "1234")
+	if !errors.Is(err, ErrPasscodeLocked) || retryAfter <= 0 || retryAfter > passcodeWindow {
+		t.Fatalf("attempt %d: err = %v, retry after %v, want locked for the rest of the window", passcodeMaxAttempts+1, err, retryAfter)
+	}
+
+	// The next window starts over
+	ps.db.Model(&models.PasscodeAttempt{}).Where("room_id = ?", room.ID).
+		Update("window_start", time.Now().Add(-passcodeWindow))
+	if _, err := ps.CheckPasscode(room, "192.0.2.1", "1234"); err != nil {
+		t.Errorf("next window: %v", err)
+	}
+}
+
+func TestCheckPasscodeWithoutPasscode(t *testing.T) {
+	ps, room := newTestPasscodeRoom(t)
+	if err := ps.SetPasscode(room, ""); err != nil {
+		t.Fatalf("SetPasscode: %v", err)
+	}
+
+	if _, err := ps.CheckPasscode(room, "192.0.2.1", ""); err != nil {
+		t.Errorf("open room: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"meet-backend/internal/config"
+	"meet-backend/internal/models"
+)
+
+// ErrInvalidRecordingRequest is returned when a recording request asks for
+// an output, layout or target that the server does not allow
+var ErrInvalidRecordingRequest = errors.New("invalid recording request")
+
+// RecordingConfig holds the server-side defaults and limits for recordings
+type RecordingConfig struct {
+	S3                    *livekit.S3Upload // nil stores files on the egress server
+	DefaultLayout         string
+	AllowedLayouts        []string
+	DefaultPreset         livekit.EncodingOptionsPreset
+	AllowedStreamPrefixes []string // RTMP/SRT URL prefixes; streaming is disabled when empty
+	SegmentDuration       uint32   // HLS segment length in seconds
+}
+
+// NewRecordingConfigFromEnv loads the recording configuration from environment variables
+func NewRecordingConfigFromEnv() *RecordingConfig {
+	rc := &RecordingConfig{
+		DefaultLayout:         os.Getenv("RECORDING_LAYOUT"),
+		AllowedLayouts:        config.SplitList(os.Getenv("RECORDING_ALLOWED_LAYOUTS")),
+		DefaultPreset:         livekit.EncodingOptionsPreset_H264_720P_30,
+		AllowedStreamPrefixes: config.SplitList(os.Getenv("RECORDING_STREAM_URLS")),
+		SegmentDuration:       6,
+	}
+
+	if rc.DefaultLayout == "" {
+		rc.DefaultLayout = "speaker-light"
+	}
+
+	if len(rc.AllowedLayouts) == 0 {
+		rc.AllowedLayouts = []string{
+			"speaker-light", "speaker-dark",
+			"grid-light", "grid-dark",
+			"single-speaker-light", "single-speaker-dark",
+		}
+	}
+
+	if preset, ok := livekit.EncodingOptionsPreset_value[os.Getenv("RECORDING_PRESET")]; ok {
+		rc.DefaultPreset = livekit.EncodingOptionsPreset(preset)
+	}
+
+	if duration, err := strconv.Atoi(os.Getenv("RECORDING_SEGMENT_DURATION")); err == nil && duration > 0 {
+		rc.SegmentDuration = uint32(duration)
+	}
+
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		forcePathStyle, _ := strconv.ParseBool(os.Getenv("S3_FORCE_PATH_STYLE"))
+		rc.S3 = &livekit.S3Upload{
+			AccessKey:      os.Getenv("S3_KEY_ID"),
+			Secret:         os.Getenv("S3_KEY_SECRET"),
+			Region:         os.Getenv("S3_REGION"),
+			Endpoint:       os.Getenv("S3_ENDPOINT"),
+			Bucket:         bucket,
+			ForcePathStyle: forcePathStyle,
+		}
+	}
+
+	return rc
+}
+
+// BuildEgressRequest turns a recording request into a LiveKit egress request.
+// It returns the request together with the file or playlist path, which is
+// empty for livestreams.
+func (rc *RecordingConfig) BuildEgressRequest(roomName string, request models.StartRecordingRequest) (*livekit.RoomCompositeEgressRequest, string, error) {
+	layout := request.Layout
+	if layout == "" {
+		layout = rc.DefaultLayout
+	}
+	if !slices.Contains(rc.AllowedLayouts, layout) {
+		return nil, "", fmt.Errorf("%w: layout '%s' is not allowed", ErrInvalidRecordingRequest, layout)
+	}
+
+	preset := rc.DefaultPreset
+	if request.Preset != "" {
+		value, ok := livekit.EncodingOptionsPreset_value[request.Preset]
+		if !ok {
+			return nil, "", fmt.Errorf("%w: unknown preset '%s'", ErrInvalidRecordingRequest, request.Preset)
+		}
+		preset = livekit.EncodingOptionsPreset(value)
+	}
+
+	egressRequest := &livekit.RoomCompositeEgressRequest{
+		RoomName:  roomName,
+		Layout:    layout,
+		AudioOnly: request.AudioOnly,
+		Options: &livekit.RoomCompositeEgressRequest_Preset{
+			Preset: preset,
+		},
+	}
+
+	timestamp := time.Now().Unix()
+	var path string
+
+	switch request.OutputType() {
+	case models.RecordingOutputFile:
+		fileType := livekit.EncodedFileType_MP4
+		extension := "mp4"
+		if request.AudioOnly {
+			fileType = livekit.EncodedFileType_OGG
+			extension = "ogg"
+		}
+
+		path = fmt.Sprintf("%s-%d.%s", roomName, timestamp, extension)
+		output := &livekit.EncodedFileOutput{
+			FileType: fileType,
+			Filepath: path,
+		}
+		if rc.S3 != nil {
+			output.Output = &livekit.EncodedFileOutput_S3{S3: rc.S3}
+		}
+		egressRequest.FileOutputs = []*livekit.EncodedFileOutput{output}
+
+	case models.RecordingOutputHLS:
+		prefix := fmt.Sprintf("%s-%d/segment", roomName, timestamp)
+		path = fmt.Sprintf("%s-%d/playlist.m3u8", roomName, timestamp)
+		output := &livekit.SegmentedFileOutput{
+			Protocol:         livekit.SegmentedFileProtocol_HLS_PROTOCOL,
+			FilenamePrefix:   prefix,
+			PlaylistName:     "playlist.m3u8",
+			LivePlaylistName: "live.m3u8",
+			SegmentDuration:  rc.SegmentDuration,
+		}
+		if rc.S3 != nil {
+			output.Output = &livekit.SegmentedFileOutput_S3{S3: rc.S3}
+		}
+		egressRequest.SegmentOutputs = []*livekit.SegmentedFileOutput{output}
+
+	case models.RecordingOutputStream:
+		if len(request.StreamURLs) == 0 {
+			return nil, "", fmt.Errorf("%w: at least one stream URL is required", ErrInvalidRecordingRequest)
+		}
+
+		protocol, err := rc.streamProtocol(request.StreamURLs)
+		if err != nil {
+			return nil, "", err
+		}
+		egressRequest.StreamOutputs = []*livekit.StreamOutput{{
+			Protocol: protocol,
+			Urls:     request.StreamURLs,
+		}}
+
+	default:
+		return nil, "", fmt.Errorf("%w: unknown output '%s'", ErrInvalidRecordingRequest, request.Output)
+	}
+
+	return egressRequest, path, nil
+}
+
+// streamProtocol checks stream URLs against the allowed targets and picks the protocol
+func (rc *RecordingConfig) streamProtocol(urls []string) (livekit.StreamProtocol, error) {
+	if len(rc.AllowedStreamPrefixes) == 0 {
+		return 0, fmt.Errorf("%w: streaming is not enabled on this server", ErrInvalidRecordingRequest)
+	}
+
+	rtmp := 0
+	for _, streamURL := range urls {
+		target, err := url.Parse(streamURL)
+		if err != nil || target.Host == "" {
+			return 0, fmt.Errorf("%w: invalid stream URL", ErrInvalidRecordingRequest)
+		}
+
+		allowed := false
+		for _, prefix := range rc.AllowedStreamPrefixes {
+			if streamTargetAllowed(target, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return 0, fmt.Errorf("%w: stream target is not allowed", ErrInvalidRecordingRequest)
+		}
+
+		switch strings.ToLower(target.Scheme) {
+		case "rtmp", "rtmps":
+			rtmp++
+		case "srt":
+		default:
+			return 0, fmt.Errorf("%w: stream URLs must use rtmp, rtmps or srt", ErrInvalidRecordingRequest)
+		}
+	}
+
+	if rtmp == len(urls) {
+		return livekit.StreamProtocol_RTMP, nil
+	}
+	if rtmp > 0 {
+		return 0, fmt.Errorf("%w: RTMP and SRT targets cannot be mixed", ErrInvalidRecordingRequest)
+	}
+
+	// LiveKit picks SRT from the URL scheme
+	return livekit.StreamProtocol_DEFAULT_PROTOCOL, nil
+}
+
+// streamTargetAllowed reports whether a stream URL is covered by an allowed
+// prefix. Scheme and host must match exactly, so a prefix can't be extended
+// into another host, and the path must match up to a '/' boundary.
+func streamTargetAllowed(target *url.URL, prefix string) bool {
+	allowed, err := url.Parse(prefix)
+	if err != nil || allowed.Host == "" {
+		return false
+	}
+	if !strings.EqualFold(target.Scheme, allowed.Scheme) || !strings.EqualFold(target.Host, allowed.Host) {
+		return false
+	}
+
+	// Dot segments must not climb out of the allowed path
+	prefixPath := strings.TrimSuffix(allowed.Path, "/")
+	targetPath := path.Clean("/" + target.Path)
+	return prefixPath == "" || targetPath == prefixPath || strings.HasPrefix(targetPath, prefixPath+"/")
+}
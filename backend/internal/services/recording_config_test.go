@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/livekit/protocol/livekit"
+	"meet-backend/internal/models"
+)
+
+func newTestRecordingConfig() *RecordingConfig {
+	return &RecordingConfig{
+		DefaultLayout:         "speaker-light",
+		AllowedLayouts:        []string{"speaker-light", "grid-dark"},
+		DefaultPreset:         livekit.EncodingOptionsPreset_H264_720P_30,
+		AllowedStreamPrefixes: []string{"rtmp://a.rtmp.youtube.com/live2/", "srt://ingest.example.com:9000"},
+		SegmentDuration:       6,
+	}
+}
+
+func TestBuildEgressRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  models.StartRecordingRequest
+		layout   string
+		preset   livekit.EncodingOptionsPreset
+		fileType livekit.EncodedFileType // for file outputs
+		path     string                  // suffix of the returned path
+	}{
+		{
+			name:     "defaults",
+			request:  models.StartRecordingRequest{},
+			layout:   "speaker-light",
+			preset:   livekit.EncodingOptionsPreset_H264_720P_30,
+			fileType: livekit.EncodedFileType_MP4,
+			path:     ".mp4",
+		},
+		{
+			name:     "audio only",
+			request:  models.StartRecordingRequest{Output: models.RecordingOutputFile, AudioOnly: true},
+			layout:   "speaker-light",
+			preset:   livekit.EncodingOptionsPreset_H264_720P_30,
+			fileType: livekit.EncodedFileType_OGG,
+			path:     ".ogg",
+		},
+		{
+			name:     "layout and preset",
+			request:  models.StartRecordingRequest{Layout: "grid-dark", Preset: "H264_1080P_30"},
+			layout:   "grid-dark",
+			preset:   livekit.EncodingOptionsPreset_H264_1080P_30,
+			fileType: livekit.EncodedFileType_MP4,
+			path:     ".mp4",
+		},
+		{
+			name:    "hls",
+			request: models.StartRecordingRequest{Output: models.RecordingOutputHLS},
+			layout:  "speaker-light",
+			preset:  livekit.EncodingOptionsPreset_H264_720P_30,
+			path:    "/playlist.m3u8",
+		},
+	}
+
+	rc := newTestRecordingConfig()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			egressRequest, path, err := rc.BuildEgressRequest("abc-defg-hij", test.request)
+			if err != nil {
+				t.Fatalf("BuildEgressRequest: %v", err)
+			}
+
+			if egressRequest.RoomName != "abc-defg-hij" {
+				t.Errorf("room = %q, want abc-defg-hij", egressRequest.RoomName)
+			}
+			if egressRequest.Layout != test.layout {
+				t.Errorf("layout = %q, want %q", egressRequest.Layout, test.layout)
+			}
+			if preset := egressRequest.GetPreset(); preset != test.preset {
+				t.Errorf("preset = %v, want %v", preset, test.preset)
+			}
+			if !strings.HasPrefix(path, "abc-defg-hij-") || !strings.HasSuffix(path, test.path) {
+				t.Errorf("path = %q, want abc-defg-hij-<timestamp>%s", path, test.path)
+			}
+
+			switch test.request.OutputType() {
+			case models.RecordingOutputFile:
+				if len(egressRequest.FileOutputs) != 1 || len(egressRequest.SegmentOutputs) != 0 {
+					t.Fatalf("got %d file and %d segment outputs, want one file", len(egressRequest.FileOutputs), len(egressRequest.SegmentOutputs))
+				}
+				output := egressRequest.FileOutputs[0]
+				if output.FileType != test.fileType || output.Filepath != path {
+					t.Errorf("file output = %v %q, want %v %q", output.FileType, output.Filepath, test.fileType, path)
+				}
+			case models.RecordingOutputHLS:
+				if len(egressRequest.SegmentOutputs) != 1 || len(egressRequest.FileOutputs) != 0 {
+					t.Fatalf("got %d file and %d segment outputs, want one segment output", len(egressRequest.FileOutputs), len(egressRequest.SegmentOutputs))
+				}
+				output := egressRequest.SegmentOutputs[0]
+				if output.Protocol != livekit.SegmentedFileProtocol_HLS_PROTOCOL || output.SegmentDuration != 6 {
+					t.Errorf("segment output = %v every %ds, want HLS every 6s", output.Protocol, output.SegmentDuration)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildEgressRequestUploadsToS3(t *testing.T) {
+	rc := newTestRecordingConfig()
+	rc.S3 = &livekit.S3Upload{Bucket: "recordings"}
+
+	egressRequest, _, err := rc.BuildEgressRequest("abc-defg-hij", models.StartRecordingRequest{})
+	if err != nil {
+		t.Fatalf("BuildEgressRequest: %v", err)
+	}
+	if s3 := egressRequest.FileOutputs[0].GetS3(); s3 == nil || s3.Bucket != "recordings" {
+		t.Errorf("file output uploads to %v, want the recordings bucket", s3)
+	}
+}
+
+func TestBuildEgressRequestStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		urls     []string
+		protocol livekit.StreamProtocol
+		allowed  bool
+	}{
+		{"rtmp", []string{"rtmp://a.rtmp.youtube.com/live2/stream-key"}, livekit.StreamProtocol_RTMP, true},
+		{"host is case insensitive", []string{"rtmp://A.RTMP.YouTube.com/live2/stream-key"}, livekit.StreamProtocol_RTMP, true},
+		{"srt", []string{"srt://ingest.example.com:9000?streamid=key"}, livekit.StreamProtocol_DEFAULT_PROTOCOL, true},
+		{"host extended with another domain", []string{"rtmp://a.rtmp.youtube.com.evil.com/live2/stream-key"}, 0, false},
+		{"host in user info", []string{"rtmp://a.rtmp.youtube.com@evil.com/live2/stream-key"}, 0, false},
+		{"path without boundary", []string{"rtmp://a.rtmp.youtube.com/live2evil/stream-key"}, 0, false},
+		{"path climbing out", []string{"rtmp://a.rtmp.youtube.com/live2/../other/stream-key"}, 0, false},
+		{"other scheme", []string{"rtmps://a.rtmp.youtube.com/live2/stream-key"}, 0, false},
+		{"other port", []string{"srt://ingest.example.com:9001"}, 0, false},
+		{"not a URL", []string{"a.rtmp.youtube.com/live2/stream-key"}, 0, false},
+		{"one target not allowed", []string{"rtmp://a.rtmp.youtube.com/live2/key", "rtmp://evil.com/live2/key"}, 0, false},
+		{"rtmp and srt mixed", []string{"rtmp://a.rtmp.youtube.com/live2/key", "srt://ingest.example.com:9000"}, 0, false},
+		{"no targets", nil, 0, false},
+	}
+
+	rc := newTestRecordingConfig()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := models.StartRecordingRequest{Output: models.RecordingOutputStream, StreamURLs: test.urls}
+			egressRequest, path, err := rc.BuildEgressRequest("abc-defg-hij", request)
+
+			if !test.allowed {
+				if !errors.Is(err, ErrInvalidRecordingRequest) {
+					t.Errorf("err = %v, want %v", err, ErrInvalidRecordingRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildEgressRequest: %v", err)
+			}
+			if path != "" {
+				t.Errorf("path = %q, want none for a livestream", path)
+			}
+			if len(egressRequest.StreamOutputs) != 1 {
+				t.Fatalf("got %d stream outputs, want 1", len(egressRequest.StreamOutputs))
+			}
+			output := egressRequest.StreamOutputs[0]
+			if output.Protocol != test.protocol {
+				t.Errorf("protocol = %v, want %v", output.Protocol, test.protocol)
+			}
+			if len(output.Urls) != len(test.urls) {
+				t.Errorf("urls = %v, want %v", output.Urls, test.urls)
+			}
+		})
+	}
+}
+
+func TestBuildEgressRequestRejectsInvalidRequests(t *testing.T) {
+	rc := newTestRecordingConfig()
+
+	tests := map[string]models.StartRecordingRequest{
+		"layout not allowed": {Layout: "single-speaker-light"},
+		"unknown preset":     {Preset: "H264_8K"},
+		"unknown output":     {Output: "dvd"},
+	}
+	for name, request := range tests {
+		if _, _, err := rc.BuildEgressRequest("abc-defg-hij", request); !errors.Is(err, ErrInvalidRecordingRequest) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidRecordingRequest)
+		}
+	}
+
+	// Streaming is disabled without allowed targets
+	rc.AllowedStreamPrefixes = nil
+	request := models.StartRecordingRequest{Output: models.RecordingOutputStream, StreamURLs: []string{"rtmp://a.rtmp.youtube.com/live2/key"}}
+	if _, _, err := rc.BuildEgressRequest("abc-defg-hij", request); !errors.Is(err, ErrInvalidRecordingRequest) {
+		t.Errorf("streaming disabled: err = %v, want %v", err, ErrInvalidRecordingRequest)
+	}
+}
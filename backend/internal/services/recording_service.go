@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/livekit/protocol/livekit"
+	"gorm.io/gorm"
+	"meet-backend/internal/database"
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+	"meet-backend/internal/webhooks"
+)
+
+// ErrRecordingNotFound is returned when no recording exists for an ID or egress ID
+var ErrRecordingNotFound = errors.New("recording not found")
+
+// finishedRecordingStatuses are the final statuses of a recording
+var finishedRecordingStatuses = []string{
+	models.RecordingStatusComplete,
+	models.RecordingStatusFailed,
+	models.RecordingStatusAborted,
+}
+
+type RecordingService struct {
+	db *gorm.DB
+}
+
+func NewRecordingService() *RecordingService {
+	return &RecordingService{
+		db: database.GetDatabase(),
+	}
+}
+
+// CreateRecording stores a recording for an egress that was just started
+func (s *RecordingService) CreateRecording(info *livekit.EgressInfo, outputType, filePath, requestedBy string) (*models.Recording, error) {
+	recording := &models.Recording{
+		RoomName:    info.GetRoomName(),
+		EgressID:    info.GetEgressId(),
+		RequestedBy: requestedBy,
+		OutputType:  outputType,
+		FilePath:    filePath,
+	}
+
+	var room models.Room
+	if err := s.db.Where("name = ?", info.GetRoomName()).Order("created_at DESC").First(&room).Error; err == nil {
+		recording.RoomID = &room.ID
+	}
+
+	applyEgressInfo(recording, info)
+
+	if err := s.db.Create(recording).Error; err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	s.emitStatusChange("", recording)
+
+	return recording, nil
+}
+
+// UpdateFromEgressInfo applies the latest egress state reported by LiveKit.
+// Recordings that already reached a final status are left untouched.
+func (s *RecordingService) UpdateFromEgressInfo(info *livekit.EgressInfo) (*models.Recording, error) {
+	recording, err := s.GetRecordingByEgressID(info.GetEgressId())
+	if err != nil {
+		return nil, err
+	}
+
+	if recording.IsFinished() {
+		return recording, nil
+	}
+
+	return s.updateRecording(recording, info)
+}
+
+// updateRecording stores the egress state on a recording that was unfinished
+// when it was loaded. The webhook and the status poller can report the same
+// egress at once, so the update only applies while the stored recording is
+// still unfinished, and only the update that applied emits events.
+func (s *RecordingService) updateRecording(recording *models.Recording, info *livekit.EgressInfo) (*models.Recording, error) {
+	previous := recording.Status
+	applyEgressInfo(recording, info)
+
+	result := s.db.Model(recording).
+		Where("status NOT IN ?", finishedRecordingStatuses).
+		Select("*").
+		Updates(recording)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update recording: %w", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		// Another update finished the recording first
+		return s.GetRecordingByEgressID(recording.EgressID)
+	}
+
+	s.emitStatusChange(previous, recording)
+
+	return recording, nil
+}
+
+// MarkStopped records who requested the recording to stop
+func (s *RecordingService) MarkStopped(egressID, stoppedBy string) error {
+	result := s.db.Model(&models.Recording{}).
+		Where("egress_id = ?", egressID).
+		Update("stopped_by", stoppedBy)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update recording: %w", result.Error)
+	}
+
+	return nil
+}
+
+// GetRecording retrieves a recording by ID
+func (s *RecordingService) GetRecording(id uuid.UUID) (*models.Recording, error) {
+	var recording models.Recording
+	result := s.db.Where("id = ?", id).First(&recording)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrRecordingNotFound
+		}
+		return nil, fmt.Errorf("failed to get recording: %w", result.Error)
+	}
+
+	return &recording, nil
+}
+
+// GetRecordingByEgressID retrieves a recording by its LiveKit egress ID
+func (s *RecordingService) GetRecordingByEgressID(egressID string) (*models.Recording, error) {
+	var recording models.Recording
+	result := s.db.Where("egress_id = ?", egressID).First(&recording)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrRecordingNotFound
+		}
+		return nil, fmt.Errorf("failed to get recording: %w", result.Error)
+	}
+
+	return &recording, nil
+}
+
+// ListRoomRecordings returns all recordings of a room, newest first
+func (s *RecordingService) ListRoomRecordings(roomName string) ([]models.Recording, error) {
+	var recordings []models.Recording
+	result := s.db.Where("room_name = ?", roomName).Order("created_at DESC").Find(&recordings)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", result.Error)
+	}
+
+	return recordings, nil
+}
+
+// ListUnfinishedRecordings returns recordings whose egress has not reached a final status
+func (s *RecordingService) ListUnfinishedRecordings() ([]models.Recording, error) {
+	var recordings []models.Recording
+	result := s.db.Where("status NOT IN ?", finishedRecordingStatuses).Find(&recordings)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", result.Error)
+	}
+
+	return recordings, nil
+}
+
+// emitStatusChange sends recording.started when the egress became active and
+// recording.finished when it reached a final status
+func (s *RecordingService) emitStatusChange(previous string, recording *models.Recording) {
+	var eventType string
+	switch {
+	case recording.IsFinished():
+		eventType = events.EventRecordingFinished
+	case recording.Status == models.RecordingStatusActive && previous != models.RecordingStatusActive:
+		eventType = events.EventRecordingStarted
+	default:
+		return
+	}
+
+	// Recordings of rooms without a database record only reach all-rooms webhooks
+	webhooks.Emit(s.db, eventType, recording.RoomID, recording)
+	events.Publish(recording.RoomName, eventType, recording)
+}
+
+// applyEgressInfo copies status, timing and file results from LiveKit onto a recording
+func applyEgressInfo(recording *models.Recording, info *livekit.EgressInfo) {
+	recording.Status = recordingStatus(info.GetStatus())
+	recording.Error = info.GetError()
+
+	if info.GetStartedAt() > 0 {
+		startedAt := time.Unix(0, info.GetStartedAt())
+		recording.StartedAt = &startedAt
+	}
+	if info.GetEndedAt() > 0 {
+		endedAt := time.Unix(0, info.GetEndedAt())
+		recording.EndedAt = &endedAt
+	}
+
+	if files := info.GetFileResults(); len(files) > 0 {
+		file := files[0]
+		if file.GetLocation() != "" {
+			recording.FilePath = file.GetLocation()
+		} else if file.GetFilename() != "" {
+			recording.FilePath = file.GetFilename()
+		}
+		recording.Size = file.GetSize()
+		recording.Duration = int64(time.Duration(file.GetDuration()).Seconds())
+	}
+
+	if segments := info.GetSegmentResults(); len(segments) > 0 {
+		playlist := segments[0]
+		if playlist.GetPlaylistLocation() != "" {
+			recording.FilePath = playlist.GetPlaylistLocation()
+		} else if playlist.GetPlaylistName() != "" {
+			recording.FilePath = playlist.GetPlaylistName()
+		}
+		recording.Size = playlist.GetSize()
+		recording.Duration = int64(time.Duration(playlist.GetDuration()).Seconds())
+	}
+
+	if streams := info.GetStreamResults(); len(streams) > 0 {
+		recording.Duration = int64(time.Duration(streams[0].GetDuration()).Seconds())
+	}
+}
+
+// recordingStatus maps a LiveKit egress status onto a recording status
+func recordingStatus(status livekit.EgressStatus) string {
+	switch status {
+	case livekit.EgressStatus_EGRESS_ACTIVE:
+		return models.RecordingStatusActive
+	case livekit.EgressStatus_EGRESS_ENDING:
+		return models.RecordingStatusEnding
+	case livekit.EgressStatus_EGRESS_COMPLETE, livekit.EgressStatus_EGRESS_LIMIT_REACHED:
+		return models.RecordingStatusComplete
+	case livekit.EgressStatus_EGRESS_FAILED:
+		return models.RecordingStatusFailed
+	case livekit.EgressStatus_EGRESS_ABORTED:
+		return models.RecordingStatusAborted
+	default:
+		return models.RecordingStatusStarting
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+func newTestRecordingService(t *testing.T) *RecordingService {
+	t.Helper()
+	return &RecordingService{db: testdb.Open(t,
+		&models.Room{},
+		&models.RoomMember{},
+		&models.Recording{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+	)}
+}
+
+func egressInfo(egressID string, status livekit.EgressStatus) *livekit.EgressInfo {
+	return &livekit.EgressInfo{EgressId: egressID, RoomName: "abc-defg-hij", Status: status}
+}
+
+func TestCreateRecording(t *testing.T) {
+	rs := newTestRecordingService(t)
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	rs.db.Create(room)
+	subscription := subscribeRoom(t, room.Name)
+
+	recording, err := rs.CreateRecording(egressInfo("EG_1", livekit.EgressStatus_EGRESS_STARTING), models.RecordingOutputFile, "abc.mp4", "owner")
+	if err != nil {
+		t.Fatalf("CreateRecording: %v", err)
+	}
+	if recording.RoomID == nil || *recording.RoomID != room.ID || recording.Status != models.RecordingStatusStarting {
+		t.Errorf("recording = %+v, want a starting recording of room %s", recording, room.ID)
+	}
+	if types := eventTypes(subscription); len(types) != 0 {
+		t.Errorf("creating a starting recording sent %v, want nothing", types)
+	}
+
+	// A recording of a room without a database record is still stored
+	recording, err = rs.CreateRecording(&livekit.EgressInfo{EgressId: "EG_2", RoomName: "unknown", Status: livekit.EgressStatus_EGRESS_ACTIVE}, models.RecordingOutputFile, "", "owner")
+	if err != nil || recording.RoomID != nil {
+		t.Errorf("recording of an unknown room = %+v, %v", recording, err)
+	}
+}
+
+func TestUpdateFromEgressInfo(t *testing.T) {
+	rs := newTestRecordingService(t)
+	subscription := subscribeRoom(t, "abc-defg-hij")
+
+	if _, err := rs.CreateRecording(egressInfo("EG_1", livekit.EgressStatus_EGRESS_STARTING), models.RecordingOutputFile, "", "owner"); err != nil {
+		t.Fatalf("CreateRecording: %v", err)
+	}
+
+	started := time.Now().Add(-time.Minute)
+	active := egressInfo("EG_1", livekit.EgressStatus_EGRESS_ACTIVE)
+	active.StartedAt = started.UnixNano()
+	recording, err := rs.UpdateFromEgressInfo(active)
+	if err != nil {
+		t.Fatalf("UpdateFromEgressInfo: %v", err)
+	}
+	if recording.Status != models.RecordingStatusActive || recording.StartedAt == nil || !recording.StartedAt.Equal(started) {
+		t.Errorf("recording = %+v, want active since %v", recording, started)
+	}
+
+	// A repeated report doesn't announce the recording again
+	if _, err := rs.UpdateFromEgressInfo(active); err != nil {
+		t.Fatalf("UpdateFromEgressInfo: %v", err)
+	}
+
+	complete := egressInfo("EG_1", livekit.EgressStatus_EGRESS_COMPLETE)
+	complete.FileResults = []*livekit.FileInfo{{Location: "s3://recordings/abc.mp4", Size: 2048, Duration: int64(90 * time.Second)}}
+	recording, err = rs.UpdateFromEgressInfo(complete)
+	if err != nil {
+		t.Fatalf("UpdateFromEgressInfo: %v", err)
+	}
+	if recording.Status != models.RecordingStatusComplete || recording.FilePath != "s3://recordings/abc.mp4" || recording.Size != 2048 || recording.Duration != 90 {
+		t.Errorf("recording = %+v, want the completed file", recording)
+	}
+
+	// A late report doesn't reopen a finished recording
+	recording, err = rs.UpdateFromEgressInfo(egressInfo("EG_1", livekit.EgressStatus_EGRESS_FAILED))
+	if err != nil || recording.Status != models.RecordingStatusComplete {
+		t.Errorf("late report: recording = %+v, %v, want it to stay complete", recording, err)
+	}
+
+	types := eventTypes(subscription)
+	if countEventType(types, events.EventRecordingStarted) != 1 || countEventType(types, events.EventRecordingFinished) != 1 {
+		t.Errorf("events %v, want one %s and one %s", types, events.EventRecordingStarted, events.EventRecordingFinished)
+	}
+
+	if _, err := rs.UpdateFromEgressInfo(egressInfo("EG_missing", livekit.EgressStatus_EGRESS_ACTIVE)); !errors.Is(err, ErrRecordingNotFound) {
+		t.Errorf("unknown egress: err = %v, want %v", err, ErrRecordingNotFound)
+	}
+}
+
+func TestUpdateRecordingFinishesOnce(t *testing.T) {
+	rs := newTestRecordingService(t)
+	subscription := subscribeRoom(t, "abc-defg-hij")
+
+	if _, err := rs.CreateRecording(egressInfo("EG_1", livekit.EgressStatus_EGRESS_ACTIVE), models.RecordingOutputFile, "", "owner"); err != nil {
+		t.Fatalf("CreateRecording: %v", err)
+	}
+	eventTypes(subscription)
+
+	// The webhook and the poller both loaded the recording while it was active
+	webhook, _ := rs.GetRecordingByEgressID("EG_1")
+	poller, _ := rs.GetRecordingByEgressID("EG_1")
+
+	if _, err := rs.updateRecording(webhook, egressInfo("EG_1", livekit.EgressStatus_EGRESS_COMPLETE)); err != nil {
+		t.Fatalf("updateRecording: %v", err)
+	}
+	recording, err := rs.updateRecording(poller, egressInfo("EG_1", livekit.EgressStatus_EGRESS_ABORTED))
+	if err != nil {
+		t.Fatalf("updateRecording: %v", err)
+	}
+	if recording.Status != models.RecordingStatusComplete {
+		t.Errorf("status = %s, want the first final status %s", recording.Status, models.RecordingStatusComplete)
+	}
+
+	if types := eventTypes(subscription); countEventType(types, events.EventRecordingFinished) != 1 {
+		t.Errorf("events %v, want a single %s", types, events.EventRecordingFinished)
+	}
+}
+
+func TestListUnfinishedRecordings(t *testing.T) {
+	rs := newTestRecordingService(t)
+
+	statuses := map[string]livekit.EgressStatus{
+		"EG_starting": livekit.EgressStatus_EGRESS_STARTING,
+		"EG_active":   livekit.EgressStatus_EGRESS_ACTIVE,
+		"EG_ending":   livekit.EgressStatus_EGRESS_ENDING,
+		"EG_complete": livekit.EgressStatus_EGRESS_COMPLETE,
+		"EG_failed":   livekit.EgressStatus_EGRESS_FAILED,
+		"EG_aborted":  livekit.EgressStatus_EGRESS_ABORTED,
+	}
+	for egressID, status := range statuses {
+		if _, err := rs.CreateRecording(egressInfo(egressID, status), models.RecordingOutputFile, "", "owner"); err != nil {
+			t.Fatalf("CreateRecording: %v", err)
+		}
+	}
+
+	recordings, err := rs.ListUnfinishedRecordings()
+	if err != nil {
+		t.Fatalf("ListUnfinishedRecordings: %v", err)
+	}
+	if len(recordings) != 3 {
+		t.Fatalf("got %d recordings, want the starting, active and ending ones", len(recordings))
+	}
+	for _, recording := range recordings {
+		if recording.IsFinished() {
+			t.Errorf("finished recording %s is listed", recording.EgressID)
+		}
+	}
+}
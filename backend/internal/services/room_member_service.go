@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+)
+
+var (
+	// ErrRoomMemberNotFound is returned when a user has no role in a room
+	ErrRoomMemberNotFound = errors.New("room member not found")
+	// ErrOwnerRoleImmutable is returned when changing the role of a room's owner
+	ErrOwnerRoleImmutable = errors.New("the room owner's role cannot be changed")
+)
+
+type RoomMemberService struct {
+	db *gorm.DB
+}
+
+func NewRoomMemberService() *RoomMemberService {
+	return &RoomMemberService{
+		db: database.GetDatabase(),
+	}
+}
+
+// GetMember retrieves the membership of a user in a room
+func (rms *RoomMemberService) GetMember(roomID uuid.UUID, userID string) (*models.RoomMember, error) {
+	var member models.RoomMember
+	result := rms.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&member)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomMemberNotFound
+		}
+		return nil, fmt.Errorf("failed to get room member: %w", result.Error)
+	}
+
+	return &member, nil
+}
+
+// ListMembers returns the members of a room, owner and moderators first
+func (rms *RoomMemberService) ListMembers(roomID uuid.UUID) ([]models.RoomMember, error) {
+	var members []models.RoomMember
+	result := rms.db.Where("room_id = ?", roomID).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "CASE role WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END, created_at",
+			Vars:               []interface{}{models.RoomRoleOwner, models.RoomRoleModerator},
+			WithoutParentheses: true,
+		}}).
+		Find(&members)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list room members: %w", result.Error)
+	}
+
+	return members, nil
+}
+
+// EnsureMember records a signed-in user as member of a room, keeping any role they already have
+func (rms *RoomMemberService) EnsureMember(roomID uuid.UUID, userID string) error {
+	member := &models.RoomMember{
+		RoomID: roomID,
+		UserID: userID,
+		Role:   models.RoomRoleMember,
+	}
+
+	result := rms.db.Clauses(clause.OnConflict{DoNothing: true}).Create(member)
+	if result.Error != nil {
+		return fmt.Errorf("failed to add room member: %w", result.Error)
+	}
+
+	return nil
+}
+
+// GrantModerator makes a user moderator of a room
+func (rms *RoomMemberService) GrantModerator(roomID uuid.UUID, userID, grantedBy string) (*models.RoomMember, error) {
+	err := rms.db.Transaction(func(tx *gorm.DB) error {
+		var member models.RoomMember
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("room_id = ? AND user_id = ?", roomID, userID).
+			First(&member)
+
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return tx.Create(&models.RoomMember{
+				RoomID:    roomID,
+				UserID:    userID,
+				Role:      models.RoomRoleModerator,
+				GrantedBy: &grantedBy,
+			}).Error
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if member.Role == models.RoomRoleOwner {
+			return ErrOwnerRoleImmutable
+		}
+
+		return tx.Model(&member).Updates(map[string]interface{}{
+			"role":       models.RoomRoleModerator,
+			"granted_by": grantedBy,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrOwnerRoleImmutable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to grant moderator: %w", err)
+	}
+
+	return rms.GetMember(roomID, userID)
+}
+
+// RevokeModerator turns a moderator back into a regular member of a room
+func (rms *RoomMemberService) RevokeModerator(roomID uuid.UUID, userID string) error {
+	member, err := rms.GetMember(roomID, userID)
+	if err != nil {
+		return err
+	}
+
+	switch member.Role {
+	case models.RoomRoleOwner:
+		return ErrOwnerRoleImmutable
+	case models.RoomRoleModerator:
+		result := rms.db.Model(member).Updates(map[string]interface{}{
+			"role":       models.RoomRoleMember,
+			"granted_by": nil,
+		})
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke moderator: %w", result.Error)
+		}
+	}
+
+	return nil
+}
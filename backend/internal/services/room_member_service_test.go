@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func newTestRoomMemberService(t *testing.T) (*RoomMemberService, *models.Room) {
+	t.Helper()
+	rms := &RoomMemberService{db: testdb.Open(t, &models.Room{}, &models.RoomMember{})}
+
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	if err := rms.db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	if err := rms.db.Create(&models.RoomMember{RoomID: room.ID, UserID: "owner", Role: models.RoomRoleOwner}).Error; err != nil {
+		t.Fatalf("failed to create owner: %v", err)
+	}
+	return rms, room
+}
+
+func mustGetRole(t *testing.T, rms *RoomMemberService, room *models.Room, userID string) string {
+	t.Helper()
+	member, err := rms.GetMember(room.ID, userID)
+	if err != nil {
+		t.Fatalf("GetMember(%s): %v", userID, err)
+	}
+	return member.Role
+}
+
+func TestEnsureMember(t *testing.T) {
+	rms, room := newTestRoomMemberService(t)
+
+	if _, err := rms.GetMember(room.ID, "alice"); !errors.Is(err, ErrRoomMemberNotFound) {
+		t.Fatalf("GetMember before joining: err = %v, want %v", err, ErrRoomMemberNotFound)
+	}
+
+	// Joining twice adds the member once
+	for i := 0; i < 2; i++ {
+		if err := rms.EnsureMember(room.ID, "alice"); err != nil {
+			t.Fatalf("EnsureMember: %v", err)
+		}
+	}
+	if role := mustGetRole(t, rms, room, "alice"); role != models.RoomRoleMember {
+		t.Errorf("alice is %s, want %s", role, models.RoomRoleMember)
+	}
+
+	// Existing roles are kept
+	if _, err := rms.GrantModerator(room.ID, "bob", "owner"); err != nil {
+		t.Fatalf("GrantModerator: %v", err)
+	}
+	for _, userID := range []string{"owner", "bob"} {
+		if err := rms.EnsureMember(room.ID, userID); err != nil {
+			t.Fatalf("EnsureMember(%s): %v", userID, err)
+		}
+	}
+	if role := mustGetRole(t, rms, room, "owner"); role != models.RoomRoleOwner {
+		t.Errorf("owner is %s after joining, want %s", role, models.RoomRoleOwner)
+	}
+	if role := mustGetRole(t, rms, room, "bob"); role != models.RoomRoleModerator {
+		t.Errorf("bob is %s after joining, want %s", role, models.RoomRoleModerator)
+	}
+}
+
+func TestGrantAndRevokeModerator(t *testing.T) {
+	rms, room := newTestRoomMemberService(t)
+	rms.EnsureMember(room.ID, "alice")
+
+	// Members are promoted and users who never joined are added as moderator
+	for _, userID := range []string{"alice", "bob"} {
+		member, err := rms.GrantModerator(room.ID, userID, "owner")
+		if err != nil {
+			t.Fatalf("GrantModerator(%s): %v", userID, err)
+		}
+		if member.Role != models.RoomRoleModerator || member.GrantedBy == nil || *member.GrantedBy != "owner" {
+			t.Errorf("%s = %+v, want a moderator granted by owner", userID, member)
+		}
+	}
+
+	if err := rms.RevokeModerator(room.ID, "alice"); err != nil {
+		t.Fatalf("RevokeModerator: %v", err)
+	}
+	member, _ := rms.GetMember(room.ID, "alice")
+	if member.Role != models.RoomRoleMember || member.GrantedBy != nil {
+		t.Errorf("alice = %+v, want a member without a grant", member)
+	}
+	// Revoking a regular member changes nothing
+	if err := rms.RevokeModerator(room.ID, "alice"); err != nil {
+		t.Errorf("RevokeModerator of a member: %v", err)
+	}
+
+	if _, err := rms.GrantModerator(room.ID, "owner", "moderator"); !errors.Is(err, ErrOwnerRoleImmutable) {
+		t.Errorf("GrantModerator of the owner: err = %v, want %v", err, ErrOwnerRoleImmutable)
+	}
+	if err := rms.RevokeModerator(room.ID, "owner"); !errors.Is(err, ErrOwnerRoleImmutable) {
+		t.Errorf("RevokeModerator of the owner: err = %v, want %v", err, ErrOwnerRoleImmutable)
+	}
+	if role := mustGetRole(t, rms, room, "owner"); role != models.RoomRoleOwner {
+		t.Errorf("owner is %s, want %s", role, models.RoomRoleOwner)
+	}
+	if err := rms.RevokeModerator(room.ID, "nobody"); !errors.Is(err, ErrRoomMemberNotFound) {
+		t.Errorf("RevokeModerator of a stranger: err = %v, want %v", err, ErrRoomMemberNotFound)
+	}
+}
+
+func TestListMembers(t *testing.T) {
+	rms, room := newTestRoomMemberService(t)
+	rms.EnsureMember(room.ID, "alice")
+	rms.GrantModerator(room.ID, "bob", "owner")
+	rms.EnsureMember(room.ID, "carol")
+
+	other := models.CreateAuthenticatedRoom("klm-nopq-rst", "other")
+	rms.db.Create(other)
+	rms.EnsureMember(other.ID, "dave")
+
+	members, err := rms.ListMembers(room.ID)
+	if err != nil {
+		t.Fatalf("ListMembers: %v", err)
+	}
+
+	var got []string
+	for _, member := range members {
+		got = append(got, member.UserID)
+	}
+	want := []string{"owner", "bob", "alice", "carol"}
+	if len(got) != len(want) {
+		t.Fatalf("members %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("members %v, want the owner and moderators first: %v", got, want)
+			break
+		}
+	}
+}
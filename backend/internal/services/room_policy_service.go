@@ -0,0 +1,55 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+)
+
+type RoomPolicyService struct {
+	db *gorm.DB
+}
+
+func NewRoomPolicyService() *RoomPolicyService {
+	return &RoomPolicyService{
+		db: database.GetDatabase(),
+	}
+}
+
+// GetPolicy returns the policy of a room; rooms without overrides get an empty policy
+func (rps *RoomPolicyService) GetPolicy(roomID uuid.UUID) (*models.RoomPolicy, error) {
+	var policy models.RoomPolicy
+	result := rps.db.Where("room_id = ?", roomID).First(&policy)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return &models.RoomPolicy{RoomID: roomID}, nil
+		}
+		return nil, fmt.Errorf("failed to get room policy: %w", result.Error)
+	}
+
+	return &policy, nil
+}
+
+// SetPolicy replaces the overrides of a room
+func (rps *RoomPolicyService) SetPolicy(policy *models.RoomPolicy) error {
+	result := rps.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "room_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"members_can_publish", "members_can_screen_share",
+			"guests_can_publish", "guests_can_screen_share",
+			"chat_enabled", "updated_by", "updated_at",
+		}),
+	}).Create(policy)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to store room policy: %w", result.Error)
+	}
+
+	return nil
+}
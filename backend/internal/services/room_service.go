@@ -1,16 +1,41 @@
 package services
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"log"
+	"math/big"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"meet-backend/internal/database"
+	"meet-backend/internal/events"
 	"meet-backend/internal/models"
+	"meet-backend/internal/webhooks"
 )
 
+// ErrRoomNotFound is returned when no room record exists for a name
+var ErrRoomNotFound = errors.New("room not found")
+
+// roomClosedHooks run when a room is deactivated or expires, or a breakout
+// room closes
+var (
+	roomClosedMu    sync.RWMutex
+	roomClosedHooks []func(roomName string)
+)
+
+// OnRoomClosed registers a function to run with the name of every room that
+// is deactivated or expires, or breakout room that closes
+func OnRoomClosed(hook func(roomName string)) {
+	roomClosedMu.Lock()
+	defer roomClosedMu.Unlock()
+	roomClosedHooks = append(roomClosedHooks, hook)
+}
+
 type RoomService struct {
 	db *gorm.DB
 }
@@ -21,8 +46,10 @@ func NewRoomService() *RoomService {
 	}
 }
 
-// CreateRoom creates a new room (guest or authenticated)
-func (rs *RoomService) CreateRoom(name string, userID *string) (*models.Room, error) {
+// CreateRoom creates a new room (guest or authenticated). Only unlimited
+// rooms are created without the guest time limit. passcodeHash comes from
+// HashPasscode and is empty for open rooms.
+func (rs *RoomService) CreateRoom(name string, userID *string, unlimited bool, passcodeHash string) (*models.Room, error) {
 	// Check if room already exists
 	var existingRoom models.Room
 	result := rs.db.Where("name = ? AND is_active = ?", name, true).First(&existingRoom)
@@ -31,26 +58,57 @@ func (rs *RoomService) CreateRoom(name string, userID *string) (*models.Room, er
 		// Room exists and is active
 		if existingRoom.IsExpired() {
 			// Room expired, mark as inactive
-			rs.db.Model(&existingRoom).Update("is_active", false)
+			rs.expireRoom(&existingRoom)
 		} else {
 			return nil, fmt.Errorf("room '%s' already exists and is active", name)
 		}
 	}
 	
+	// Rooms of scheduled meetings are only opened through their meeting
+	reserved, err := rs.isMeetingRoom(name)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, fmt.Errorf("room '%s' is reserved for a scheduled meeting", name)
+	}
+
 	// Create new room
 	var room *models.Room
 	if userID == nil {
 		// Guest room with 30-minute limit
 		room = models.CreateGuestRoom(name)
+	} else if !unlimited {
+		// Authenticated room with the guest time limit
+		room = models.CreateGuestRoom(name)
+		room.CreatedBy = userID
 	} else {
 		// Authenticated room without limit
 		room = models.CreateAuthenticatedRoom(name, *userID)
 	}
 	
-	if err := rs.db.Create(room).Error; err != nil {
+	room.PasscodeHash = passcodeHash
+
+	// The creator of an authenticated room becomes its owner
+	err = rs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(room).Error; err != nil {
+			return err
+		}
+		if userID == nil {
+			return nil
+		}
+		return tx.Create(&models.RoomMember{
+			RoomID: room.ID,
+			UserID: *userID,
+			Role:   models.RoomRoleOwner,
+		}).Error
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to create room: %w", err)
 	}
 	
+	emitRoomEvent(rs.db, events.EventRoomCreated, room, events.NewRoomData(room))
+	
 	return room, nil
 }
 
@@ -69,13 +127,45 @@ func (rs *RoomService) GetRoom(name string) (*models.Room, error) {
 	// Check if room is expired
 	if room.IsExpired() {
 		// Mark as inactive
-		rs.db.Model(&room).Update("is_active", false)
+		rs.expireRoom(&room)
 		return nil, fmt.Errorf("room '%s' has expired", name)
 	}
 	
 	return &room, nil
 }
 
+// FindRoom retrieves the latest room with a name, also when it is no
+// longer active, e.g. to look back at a meeting that ended
+func (rs *RoomService) FindRoom(name string) (*models.Room, error) {
+	return rs.findRoomByName(name)
+}
+
+// IsMemberOrParticipant checks if a user is a member of a room or joined it at
+// any time; they may follow its events and read its chat
+func (rs *RoomService) IsMemberOrParticipant(roomID uuid.UUID, userID string) (bool, error) {
+	return isMemberOrParticipant(rs.db, roomID, userID)
+}
+
+// isMemberOrParticipant is the rule for who may see what goes on in a room
+func isMemberOrParticipant(db *gorm.DB, roomID uuid.UUID, userID string) (bool, error) {
+	if userID == "" {
+		return false, nil
+	}
+
+	var count int64
+	if err := db.Model(&models.RoomMember{}).Where("room_id = ? AND user_id = ?", roomID, userID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	if err := db.Model(&models.RoomParticipant{}).Where("room_id = ? AND user_id = ?", roomID, userID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check participants: %w", err)
+	}
+	return count > 0, nil
+}
+
 // GetRoomByID retrieves a room by ID
 func (rs *RoomService) GetRoomByID(id uuid.UUID) (*models.Room, error) {
 	var room models.Room
@@ -91,8 +181,9 @@ func (rs *RoomService) GetRoomByID(id uuid.UUID) (*models.Room, error) {
 	return &room, nil
 }
 
-// AddParticipant adds a participant to a room
-func (rs *RoomService) AddParticipant(roomID uuid.UUID, userID *string, identity, name string, isGuest bool) (*models.RoomParticipant, error) {
+// AddParticipant adds a participant to a room. The IP address of guests is
+// kept so a ban on them can cover their IP address.
+func (rs *RoomService) AddParticipant(roomID uuid.UUID, userID *string, identity, name string, isGuest bool, ipAddress string) (*models.RoomParticipant, error) {
 	// Check if participant already exists and is active
 	var existingParticipant models.RoomParticipant
 	result := rs.db.Where("room_id = ? AND identity = ? AND left_at IS NULL", roomID, identity).First(&existingParticipant)
@@ -104,25 +195,30 @@ func (rs *RoomService) AddParticipant(roomID uuid.UUID, userID *string, identity
 	
 	// Create new participant
 	participant := &models.RoomParticipant{
-		RoomID:   roomID,
-		UserID:   userID,
-		Identity: identity,
-		Name:     name,
-		JoinedAt: time.Now(),
-		IsGuest:  isGuest,
+		RoomID:    roomID,
+		UserID:    userID,
+		Identity:  identity,
+		Name:      name,
+		JoinedAt:  time.Now(),
+		IsGuest:   isGuest,
+		IPAddress: ipAddress,
 	}
 	
 	if err := rs.db.Create(participant).Error; err != nil {
 		return nil, fmt.Errorf("failed to add participant: %w", err)
 	}
 	
+	rs.emitParticipantEvent(events.EventParticipantJoined, participant)
+	
 	return participant, nil
 }
 
 // RemoveParticipant marks a participant as left
 func (rs *RoomService) RemoveParticipant(roomID uuid.UUID, identity string) error {
 	now := time.Now()
-	result := rs.db.Model(&models.RoomParticipant{}).
+	var left []models.RoomParticipant
+	result := rs.db.Model(&left).
+		Clauses(clause.Returning{}).
 		Where("room_id = ? AND identity = ? AND left_at IS NULL", roomID, identity).
 		Update("left_at", now)
 	
@@ -134,6 +230,10 @@ func (rs *RoomService) RemoveParticipant(roomID uuid.UUID, identity string) erro
 		return fmt.Errorf("participant not found in room")
 	}
 	
+	for i := range left {
+		rs.emitParticipantEvent(events.EventParticipantLeft, &left[i])
+	}
+	
 	return nil
 }
 
@@ -171,22 +271,34 @@ func (rs *RoomService) ExtendRoom(roomID uuid.UUID, additionalMinutes int) error
 		return fmt.Errorf("failed to extend room: %w", result.Error)
 	}
 	
+	room.ExpiresAt = &newExpiresAt
+	emitRoomEvent(rs.db, events.EventRoomExtended, &room, events.NewRoomData(&room))
+	
 	return nil
 }
 
-// DeactivateRoom marks a room as inactive
+// DeactivateRoom marks a room and its breakout rooms as inactive
 func (rs *RoomService) DeactivateRoom(roomID uuid.UUID) error {
 	// Mark room as inactive
-	result := rs.db.Model(&models.Room{}).Where("id = ?", roomID).Update("is_active", false)
+	var deactivated []models.Room
+	result := rs.db.Model(&deactivated).
+		Clauses(clause.Returning{}).
+		Where("id = ? AND is_active = ?", roomID, true).
+		Update("is_active", false)
 	if result.Error != nil {
 		return fmt.Errorf("failed to deactivate room: %w", result.Error)
 	}
+	for i := range deactivated {
+		emitRoomEvent(rs.db, events.EventRoomDeactivated, &deactivated[i], events.NewRoomData(&deactivated[i]))
+	}
+	
+	// Breakout rooms close with their main room
+	rs.closeBreakouts(roomID, events.EventRoomDeactivated)
 	
 	// Mark all participants as left
-	now := time.Now()
-	rs.db.Model(&models.RoomParticipant{}).
-		Where("room_id = ? AND left_at IS NULL", roomID).
-		Update("left_at", now)
+	for i := range deactivated {
+		closeRoom(rs.db, &deactivated[i], time.Now())
+	}
 	
 	return nil
 }
@@ -210,9 +322,20 @@ func (rs *RoomService) GetRoomStats(roomID uuid.UUID) (map[string]interface{}, e
 		Where("room_id = ?", roomID).
 		Count(&totalCount)
 	
+	// Resolve the creator to a name for authenticated rooms
+	var createdByName *string
+	if room.CreatedBy != nil {
+		var creator models.User
+		if err := rs.db.Where("id = ?", *room.CreatedBy).First(&creator).Error; err == nil {
+			createdByName = &creator.Name
+		}
+	}
+	
 	stats := map[string]interface{}{
 		"room_id":              room.ID,
 		"room_name":            room.Name,
+		"created_by":           room.CreatedBy,
+		"created_by_name":      createdByName,
 		"created_at":           room.CreatedAt,
 		"expires_at":           room.ExpiresAt,
 		"time_remaining":       room.TimeRemaining(),
@@ -221,7 +344,331 @@ func (rs *RoomService) GetRoomStats(roomID uuid.UUID) (map[string]interface{}, e
 		"total_participants":   totalCount,
 		"is_active":           room.IsActive,
 		"is_expired":          room.IsExpired(),
+		"lobby_enabled":       room.LobbyEnabled,
+		"passcode_protected":  room.HasPasscode(),
 	}
 	
 	return stats, nil
 }
+
+// findRoomByName looks up a room by name regardless of its active state
+func (rs *RoomService) findRoomByName(name string) (*models.Room, error) {
+	var room models.Room
+	result := rs.db.Where("name = ?", name).Order("created_at DESC").First(&room)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrRoomNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to get room: %w", result.Error)
+	}
+
+	return &room, nil
+}
+
+// MarkRoomStarted records that the LiveKit room has started.
+// Redelivered events are ignored because only an unset started_at is written.
+func (rs *RoomService) MarkRoomStarted(name string, at time.Time) error {
+	room, err := rs.findRoomByName(name)
+	if err != nil {
+		return err
+	}
+
+	result := rs.db.Model(&models.Room{}).
+		Where("id = ? AND started_at IS NULL", room.ID).
+		Update("started_at", at)
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark room started: %w", result.Error)
+	}
+
+	// A room that finished earlier and is started again is no longer ended
+	result = rs.db.Model(&models.Room{}).
+		Where("id = ? AND ended_at IS NOT NULL AND ended_at <= ?", room.ID, at).
+		Update("ended_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark room started: %w", result.Error)
+	}
+
+	return nil
+}
+
+// MarkRoomFinished records that the LiveKit room has closed and marks every
+// participant still present as left at the same moment
+func (rs *RoomService) MarkRoomFinished(name string, at time.Time) error {
+	room, err := rs.findRoomByName(name)
+	if err != nil {
+		return err
+	}
+
+	var left []models.RoomParticipant
+	err = rs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Room{}).
+			Where("id = ? AND (ended_at IS NULL OR ended_at < ?)", room.ID, at).
+			Update("ended_at", at).Error; err != nil {
+			return fmt.Errorf("failed to mark room finished: %w", err)
+		}
+
+		var err error
+		left, err = leaveRoom(tx, room.ID, at)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	emitParticipantsLeft(rs.db, room, left)
+	return nil
+}
+
+// SyncParticipantJoined records a participant reported by LiveKit as joined.
+// If the participant is already present, or a session covering this join has
+// already been recorded, nothing is written so redelivery is harmless.
+func (rs *RoomService) SyncParticipantJoined(roomName string, userID *string, identity, name string, at time.Time) error {
+	room, err := rs.findRoomByName(roomName)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	result := rs.db.Model(&models.RoomParticipant{}).
+		Where("room_id = ? AND identity = ? AND (left_at IS NULL OR left_at >= ?)", room.ID, identity, at).
+		Count(&count)
+	if result.Error != nil {
+		return fmt.Errorf("failed to check participant: %w", result.Error)
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	if name == "" {
+		name = identity
+	}
+
+	participant := &models.RoomParticipant{
+		RoomID:   room.ID,
+		UserID:   userID,
+		Identity: identity,
+		Name:     name,
+		JoinedAt: at,
+		IsGuest:  userID == nil,
+	}
+
+	if err := rs.db.Create(participant).Error; err != nil {
+		return fmt.Errorf("failed to add participant: %w", err)
+	}
+
+	rs.emitParticipantEvent(events.EventParticipantJoined, participant)
+
+	return nil
+}
+
+// SyncParticipantLeft marks a participant reported by LiveKit as left.
+// Unlike RemoveParticipant it does not fail when the participant is already
+// gone, so redelivered events are harmless.
+func (rs *RoomService) SyncParticipantLeft(roomName, identity string, at time.Time) error {
+	room, err := rs.findRoomByName(roomName)
+	if err != nil {
+		return err
+	}
+
+	var left []models.RoomParticipant
+	result := rs.db.Model(&left).
+		Clauses(clause.Returning{}).
+		Where("room_id = ? AND identity = ? AND left_at IS NULL AND joined_at <= ?", room.ID, identity, at).
+		Update("left_at", at)
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove participant: %w", result.Error)
+	}
+
+	for i := range left {
+		rs.emitParticipantEvent(events.EventParticipantLeft, &left[i])
+	}
+
+	return nil
+}
+
+// GenerateRoomName returns an unused, hard to guess room name like abc-defg-hij
+func (rs *RoomService) GenerateRoomName() (string, error) {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+
+	for attempt := 0; attempt < 5; attempt++ {
+		name := make([]byte, 0, 12)
+		for i := 0; i < 10; i++ {
+			if i == 3 || i == 7 {
+				name = append(name, '-')
+			}
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+			if err != nil {
+				return "", err
+			}
+			name = append(name, letters[n.Int64()])
+		}
+
+		// Names stay reserved by inactive and deleted rooms and by scheduled meetings too
+		var count int64
+		if err := rs.db.Unscoped().Model(&models.Room{}).Where("name = ?", string(name)).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check room name: %w", err)
+		}
+		reserved, err := rs.isMeetingRoom(string(name))
+		if err != nil {
+			return "", err
+		}
+		if count == 0 && !reserved {
+			return string(name), nil
+		}
+	}
+
+	return "", errors.New("failed to generate an unused room name")
+}
+
+// isMeetingRoom checks if a room name belongs to a scheduled meeting
+func (rs *RoomService) isMeetingRoom(name string) (bool, error) {
+	var count int64
+	if err := rs.db.Model(&models.Meeting{}).Where("room_name = ?", name).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check room name: %w", err)
+	}
+	return count > 0, nil
+}
+
+// StartExpiryRoutine periodically expires rooms past their time limit that
+// nobody looked up since
+func (rs *RoomService) StartExpiryRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rs.ExpireRooms()
+	}
+}
+
+// ExpireRooms expires every active room past its time limit
+func (rs *RoomService) ExpireRooms() {
+	// Breakout rooms are closed by the breakout timer
+	var expired []models.Room
+	result := rs.db.Where("expires_at IS NOT NULL AND expires_at < ? AND is_active = ? AND parent_id IS NULL", time.Now(), true).
+		Find(&expired)
+	if result.Error != nil {
+		log.Printf("Error finding expired rooms: %v", result.Error)
+		return
+	}
+
+	for i := range expired {
+		if rs.expireRoom(&expired[i]) {
+			log.Printf("Expired room %s", expired[i].Name)
+		}
+	}
+}
+
+// expireRoom marks a room past its time limit as inactive and its
+// participants as left, together with its breakout rooms. Breakout rooms
+// themselves are left to the breakout timer, which sends their participants
+// back to the main room first. It returns false when the room was already
+// inactive, e.g. expired by another replica.
+func (rs *RoomService) expireRoom(room *models.Room) bool {
+	if room.ParentID != nil {
+		return false
+	}
+	result := rs.db.Model(room).Where("is_active = ?", true).Update("is_active", false)
+	if result.Error != nil {
+		log.Printf("Failed to expire room %s: %v", room.Name, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	emitRoomEvent(rs.db, events.EventRoomExpired, room, events.NewRoomData(room))
+	closeRoom(rs.db, room, time.Now())
+	rs.closeBreakouts(room.ID, events.EventRoomExpired)
+	return true
+}
+
+// closeBreakouts marks the open breakout rooms of a room as inactive and
+// their participants as left, sending eventType for each of them
+func (rs *RoomService) closeBreakouts(parentID uuid.UUID, eventType string) {
+	var closed []models.Room
+	result := rs.db.Model(&closed).
+		Clauses(clause.Returning{}).
+		Where("parent_id = ? AND is_active = ?", parentID, true).
+		Update("is_active", false)
+	if result.Error != nil {
+		log.Printf("Failed to close breakout rooms of room %s: %v", parentID, result.Error)
+		return
+	}
+
+	now := time.Now()
+	for i := range closed {
+		emitRoomEvent(rs.db, eventType, &closed[i], events.NewRoomData(&closed[i]))
+		closeRoom(rs.db, &closed[i], now)
+	}
+}
+
+// HasBreakoutAssignment checks if an identity is assigned to a breakout room
+func (rs *RoomService) HasBreakoutAssignment(roomID uuid.UUID, identity string) (bool, error) {
+	var count int64
+	if err := rs.db.Model(&models.BreakoutAssignment{}).Where("room_id = ? AND identity = ?", roomID, identity).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check breakout assignment: %w", err)
+	}
+	return count > 0, nil
+}
+
+// emitParticipantEvent sends a participant event with the room it happened in
+func (rs *RoomService) emitParticipantEvent(eventType string, participant *models.RoomParticipant) {
+	var room models.Room
+	if err := rs.db.Unscoped().Where("id = ?", participant.RoomID).First(&room).Error; err != nil {
+		log.Printf("Failed to load room for %s webhook: %v", eventType, err)
+		return
+	}
+	emitRoomEvent(rs.db, eventType, &room, events.NewParticipantData(&room, participant))
+}
+
+// closeRoom marks everyone still in a room that was made inactive as left
+// and runs the room closed hooks
+func closeRoom(db *gorm.DB, room *models.Room, at time.Time) {
+	markParticipantsLeft(db, room, at)
+
+	roomClosedMu.RLock()
+	hooks := roomClosedHooks
+	roomClosedMu.RUnlock()
+	for _, hook := range hooks {
+		hook(room.Name)
+	}
+}
+
+// markParticipantsLeft marks everyone still in a room as left and sends
+// participant.left for each of them
+func markParticipantsLeft(db *gorm.DB, room *models.Room, at time.Time) {
+	left, err := leaveRoom(db, room.ID, at)
+	if err != nil {
+		log.Printf("Failed to mark participants of room %s as left: %v", room.Name, err)
+		return
+	}
+	emitParticipantsLeft(db, room, left)
+}
+
+// leaveRoom marks the participants present in a room at a time as left and returns them
+func leaveRoom(db *gorm.DB, roomID uuid.UUID, at time.Time) ([]models.RoomParticipant, error) {
+	var left []models.RoomParticipant
+	result := db.Model(&left).
+		Clauses(clause.Returning{}).
+		Where("room_id = ? AND left_at IS NULL AND joined_at <= ?", roomID, at).
+		Update("left_at", at)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to mark participants as left: %w", result.Error)
+	}
+	return left, nil
+}
+
+// emitParticipantsLeft sends participant.left for participants who left a room
+func emitParticipantsLeft(db *gorm.DB, room *models.Room, left []models.RoomParticipant) {
+	for i := range left {
+		emitRoomEvent(db, events.EventParticipantLeft, room, events.NewParticipantData(room, &left[i]))
+	}
+}
+
+// emitRoomEvent sends an event to webhook subscribers and to clients streaming the room
+func emitRoomEvent(db *gorm.DB, eventType string, room *models.Room, data interface{}) {
+	webhooks.Emit(db, eventType, &room.ID, data)
+	events.Publish(room.Name, eventType, data)
+}
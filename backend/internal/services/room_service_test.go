@@ -0,0 +1,187 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func newTestRoomService(t *testing.T) *RoomService {
+	t.Helper()
+	return &RoomService{db: testdb.Open(t,
+		&models.Room{},
+		&models.RoomParticipant{},
+		&models.RoomMember{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+	)}
+}
+
+// createTestRoom stores a room with one present participant
+func createTestRoom(t *testing.T, rs *RoomService, room *models.Room) {
+	t.Helper()
+	if err := rs.db.Create(room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	participant := &models.RoomParticipant{RoomID: room.ID, Identity: "guest-" + room.Name, Name: "Guest", IsGuest: true, JoinedAt: time.Now().Add(-time.Minute)}
+	if err := rs.db.Create(participant).Error; err != nil {
+		t.Fatalf("failed to create participant: %v", err)
+	}
+}
+
+func subscribeRoom(t *testing.T, name string) events.Subscription {
+	t.Helper()
+	subscription, err := events.GetBus().Subscribe(name)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	t.Cleanup(subscription.Close)
+	return subscription
+}
+
+// eventTypes returns the types of the events waiting on a subscription
+func eventTypes(subscription events.Subscription) []string {
+	var types []string
+	for {
+		select {
+		case event := <-subscription.Events():
+			types = append(types, event.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func countEventType(types []string, eventType string) int {
+	count := 0
+	for _, t := range types {
+		if t == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+func TestExpireRooms(t *testing.T) {
+	rs := newTestRoomService(t)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	expired := models.CreateAuthenticatedRoom("exp-ired-one", "owner")
+	expired.ExpiresAt = &past
+	createTestRoom(t, rs, expired)
+
+	breakout := models.CreateAuthenticatedRoom("exp-ired-brk", "owner")
+	breakout.ParentID = &expired.ID
+	createTestRoom(t, rs, breakout)
+
+	running := models.CreateAuthenticatedRoom("sti-llr-unn", "owner")
+	running.ExpiresAt = &future
+	createTestRoom(t, rs, running)
+
+	expiredEvents := subscribeRoom(t, expired.Name)
+	breakoutEvents := subscribeRoom(t, breakout.Name)
+
+	rs.ExpireRooms()
+	// Another replica running it again changes nothing
+	rs.ExpireRooms()
+
+	for _, room := range []*models.Room{expired, breakout, running} {
+		var stored models.Room
+		rs.db.First(&stored, "id = ?", room.ID)
+		var present int64
+		rs.db.Model(&models.RoomParticipant{}).Where("room_id = ? AND left_at IS NULL", room.ID).Count(&present)
+
+		wantActive := room == running
+		if stored.IsActive != wantActive {
+			t.Errorf("room %s active = %v, want %v", room.Name, stored.IsActive, wantActive)
+		}
+		if wantPresent := map[bool]int64{true: 1, false: 0}[wantActive]; present != wantPresent {
+			t.Errorf("room %s has %d present participants, want %d", room.Name, present, wantPresent)
+		}
+	}
+
+	for name, subscription := range map[string]events.Subscription{"expired": expiredEvents, "breakout": breakoutEvents} {
+		types := eventTypes(subscription)
+		if countEventType(types, events.EventRoomExpired) != 1 || countEventType(types, events.EventParticipantLeft) != 1 {
+			t.Errorf("%s room events %v, want one room.expired and one participant.left", name, types)
+		}
+	}
+}
+
+func TestDeactivateRoomEmitsParticipantLeft(t *testing.T) {
+	rs := newTestRoomService(t)
+
+	room := models.CreateAuthenticatedRoom("dea-ctiv-ate", "owner")
+	createTestRoom(t, rs, room)
+	breakout := models.CreateAuthenticatedRoom("dea-ctiv-brk", "owner")
+	breakout.ParentID = &room.ID
+	createTestRoom(t, rs, breakout)
+
+	roomEvents := subscribeRoom(t, room.Name)
+	breakoutEvents := subscribeRoom(t, breakout.Name)
+
+	if err := rs.DeactivateRoom(room.ID); err != nil {
+		t.Fatalf("DeactivateRoom: %v", err)
+	}
+	if err := rs.DeactivateRoom(room.ID); err != nil {
+		t.Fatalf("DeactivateRoom again: %v", err)
+	}
+
+	var present int64
+	rs.db.Model(&models.RoomParticipant{}).Where("left_at IS NULL").Count(&present)
+	if present != 0 {
+		t.Errorf("%d participants still present", present)
+	}
+
+	for name, subscription := range map[string]events.Subscription{"main": roomEvents, "breakout": breakoutEvents} {
+		types := eventTypes(subscription)
+		if countEventType(types, events.EventRoomDeactivated) != 1 || countEventType(types, events.EventParticipantLeft) != 1 {
+			t.Errorf("%s room events %v, want one room.deactivated and one participant.left", name, types)
+		}
+	}
+}
+
+func TestRoomClosedHooks(t *testing.T) {
+	rs := newTestRoomService(t)
+
+	var mu sync.Mutex
+	closed := map[string]int{}
+	OnRoomClosed(func(roomName string) {
+		mu.Lock()
+		defer mu.Unlock()
+		closed[roomName]++
+	})
+
+	past := time.Now().Add(-time.Minute)
+	expired := models.CreateAuthenticatedRoom("hoo-kexp-ire", "owner")
+	expired.ExpiresAt = &past
+	createTestRoom(t, rs, expired)
+
+	room := models.CreateAuthenticatedRoom("hoo-kdea-ctv", "owner")
+	createTestRoom(t, rs, room)
+	breakout := models.CreateAuthenticatedRoom("hoo-kbrk-out", "owner")
+	breakout.ParentID = &room.ID
+	createTestRoom(t, rs, breakout)
+
+	rs.ExpireRooms()
+	if err := rs.DeactivateRoom(room.ID); err != nil {
+		t.Fatalf("DeactivateRoom: %v", err)
+	}
+	if err := rs.DeactivateRoom(room.ID); err != nil {
+		t.Fatalf("DeactivateRoom again: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{expired.Name, room.Name, breakout.Name} {
+		if closed[name] != 1 {
+			t.Errorf("hooks ran %d times for room %s, want once", closed[name], name)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"meet-backend/internal/database"
+	"meet-backend/internal/encryption"
+	"meet-backend/internal/models"
+)
+
+// SessionLifetime is how long a session lasts before the user has to log in again
+const SessionLifetime = 30 * 24 * time.Hour
+
+var (
+	// ErrSessionNotFound is returned for unknown sessions and refresh tokens
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionInactive is returned for revoked or expired sessions
+	ErrSessionInactive = errors.New("session revoked or expired")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is used again
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+type SessionService struct {
+	db *gorm.DB
+}
+
+func NewSessionService() *SessionService {
+	return &SessionService{
+		db: database.GetDatabase(),
+	}
+}
+
+// CreateSession starts a new session and returns it with its first refresh token.
+// The upstream refresh token is encrypted when DB_ENCRYPTION_KEY is set.
+func (ss *SessionService) CreateSession(userID, userAgent, ipAddress, upstreamRefreshToken string) (*models.Session, string, error) {
+	encrypted, err := encryption.Encrypt(upstreamRefreshToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		UserID:               userID,
+		UserAgent:            userAgent,
+		IPAddress:            ipAddress,
+		UpstreamRefreshToken: encrypted,
+		LastUsedAt:           now,
+		ExpiresAt:            now.Add(SessionLifetime),
+	}
+
+	var token string
+	err = ss.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		token, err = createRefreshToken(tx, session.ID)
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	session.UpstreamRefreshToken = upstreamRefreshToken
+	return session, token, nil
+}
+
+// GetSessionByRefreshToken returns the active session a refresh token belongs to,
+// with its upstream refresh token decrypted.
+// Presenting a token that was already rotated revokes the whole session.
+func (ss *SessionService) GetSessionByRefreshToken(token string) (*models.Session, error) {
+	var refreshToken models.RefreshToken
+	result := ss.db.Where("token_hash = ?", hashToken(token)).First(&refreshToken)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", result.Error)
+	}
+
+	if refreshToken.UsedAt != nil {
+		ss.revokeForReuse(refreshToken.SessionID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	session, err := ss.GetActiveSession(refreshToken.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.UpstreamRefreshToken, err = encryption.Decrypt(session.UpstreamRefreshToken); err != nil {
+		return nil, fmt.Errorf("failed to read upstream refresh token: %w", err)
+	}
+
+	return session, nil
+}
+
+// RotateRefreshToken consumes a refresh token and issues its successor.
+// A non-empty upstream refresh token replaces the stored one.
+func (ss *SessionService) RotateRefreshToken(token, userAgent, ipAddress, upstreamRefreshToken string) (string, error) {
+	encryptedUpstream, err := encryption.Encrypt(upstreamRefreshToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	var newToken string
+	var sessionID uuid.UUID
+	reused := false
+
+	err = ss.db.Transaction(func(tx *gorm.DB) error {
+		var refreshToken models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(token)).First(&refreshToken).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSessionNotFound
+			}
+			return err
+		}
+		sessionID = refreshToken.SessionID
+
+		// Only one caller can consume a token, a concurrent second use is reuse
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("token_hash = ? AND used_at IS NULL", refreshToken.TokenHash).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		updates := map[string]interface{}{
+			"last_used_at": now,
+			"user_agent":   userAgent,
+			"ip_address":   ipAddress,
+		}
+		if upstreamRefreshToken != "" {
+			updates["upstream_refresh_token"] = encryptedUpstream
+		}
+		result = tx.Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, now).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSessionInactive
+		}
+
+		var err error
+		newToken, err = createRefreshToken(tx, sessionID)
+		return err
+	})
+
+	if reused {
+		ss.revokeForReuse(sessionID)
+	}
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) || errors.Is(err, ErrSessionInactive) || errors.Is(err, ErrRefreshTokenReused) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return newToken, nil
+}
+
+// GetActiveSession retrieves a session that is neither revoked nor expired
+func (ss *SessionService) GetActiveSession(id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	result := ss.db.Where("id = ?", id).First(&session)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", result.Error)
+	}
+
+	if !session.IsActive() {
+		return nil, ErrSessionInactive
+	}
+
+	return &session, nil
+}
+
+// IsSessionActive checks if a session can still be used
+func (ss *SessionService) IsSessionActive(id uuid.UUID) bool {
+	var count int64
+	ss.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// ListUserSessions returns the active sessions of a user, most recently used first
+func (ss *SessionService) ListUserSessions(userID string) ([]models.Session, error) {
+	var sessions []models.Session
+	result := ss.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", result.Error)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes a session; with a non-empty userID only that user's session is revoked
+func (ss *SessionService) RevokeSession(id uuid.UUID, userID string) error {
+	query := ss.db.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id)
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	result := query.Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeUserSessions revokes every session of a user
+func (ss *SessionService) RevokeUserSessions(userID string) error {
+	result := ss.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", result.Error)
+	}
+
+	return nil
+}
+
+// StartCleanupRoutine encrypts upstream refresh tokens stored before
+// DB_ENCRYPTION_KEY was set, then periodically removes sessions that expired
+// or were revoked together with their refresh tokens
+func (ss *SessionService) StartCleanupRoutine() {
+	ss.encryptUpstreamTokens()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := ss.PurgeEndedSessions(); err != nil {
+			log.Printf("Error purging sessions: %v", err)
+		}
+	}
+}
+
+// PurgeEndedSessions deletes expired and revoked sessions and their refresh tokens
+func (ss *SessionService) PurgeEndedSessions() error {
+	ended := ss.db.Model(&models.Session{}).
+		Select("id").
+		Where("revoked_at IS NOT NULL OR expires_at <= ?", time.Now())
+
+	return ss.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id IN (?)", ended).Delete(&models.RefreshToken{}).Error; err != nil {
+			return fmt.Errorf("failed to delete refresh tokens: %w", err)
+		}
+		if err := tx.Where("id IN (?)", ended).Delete(&models.Session{}).Error; err != nil {
+			return fmt.Errorf("failed to delete sessions: %w", err)
+		}
+		return nil
+	})
+}
+
+// encryptUpstreamTokens encrypts upstream refresh tokens that are stored in plaintext
+func (ss *SessionService) encryptUpstreamTokens() {
+	if !encryption.Enabled() {
+		return
+	}
+
+	var sessions []models.Session
+	err := ss.db.Select("id", "upstream_refresh_token").
+		Where("upstream_refresh_token <> ''").
+		Find(&sessions).Error
+	if err != nil {
+		log.Printf("Error loading upstream refresh tokens: %v", err)
+		return
+	}
+
+	for _, session := range sessions {
+		if encryption.IsEncrypted(session.UpstreamRefreshToken) {
+			continue
+		}
+
+		encrypted, err := encryption.Encrypt(session.UpstreamRefreshToken)
+		if err == nil {
+			err = ss.db.Model(&models.Session{}).Where("id = ?", session.ID).Update("upstream_refresh_token", encrypted).Error
+		}
+		if err != nil {
+			log.Printf("Error encrypting upstream refresh token of session %s: %v", session.ID, err)
+		}
+	}
+}
+
+// revokeForReuse revokes a session whose refresh token was used twice
+func (ss *SessionService) revokeForReuse(sessionID uuid.UUID) {
+	log.Printf("Refresh token reuse detected, revoking session %s", sessionID)
+	if err := ss.RevokeSession(sessionID, ""); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		log.Printf("Failed to revoke session %s: %v", sessionID, err)
+	}
+}
+
+// createRefreshToken stores a new refresh token for a session and returns it
+func createRefreshToken(tx *gorm.DB, sessionID uuid.UUID) (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(data)
+
+	record := &models.RefreshToken{
+		TokenHash: hashToken(token),
+		SessionID: sessionID,
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// hashToken hashes an opaque token for storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
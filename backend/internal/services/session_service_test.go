@@ -0,0 +1,193 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"meet-backend/internal/encryption"
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func newTestSessionService(t *testing.T) *SessionService {
+	t.Helper()
+	return &SessionService{db: testdb.Open(t, &models.Session{}, &models.RefreshToken{})}
+}
+
+func TestSessionUpstreamRefreshTokenIsEncrypted(t *testing.T) {
+	encryption.SetKey(bytes.Repeat([]byte{7}, 32))
+	defer encryption.SetKey(nil)
+
+	ss := newTestSessionService(t)
+	session, token, err := ss.CreateSession("user-1", "test", "127.0.0.1", "upstream-1")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if session.UpstreamRefreshToken != "upstream-1" {
+		t.Errorf("returned upstream token = %q, want it decrypted", session.UpstreamRefreshToken)
+	}
+
+	var stored models.Session
+	ss.db.First(&stored, "id = ?", session.ID)
+	if !encryption.IsEncrypted(stored.UpstreamRefreshToken) {
+		t.Errorf("upstream token stored as %q, want it encrypted", stored.UpstreamRefreshToken)
+	}
+
+	found, err := ss.GetSessionByRefreshToken(token)
+	if err != nil {
+		t.Fatalf("GetSessionByRefreshToken: %v", err)
+	}
+	if found.UpstreamRefreshToken != "upstream-1" {
+		t.Errorf("upstream token = %q, want upstream-1", found.UpstreamRefreshToken)
+	}
+
+	next, err := ss.RotateRefreshToken(token, "test", "127.0.0.1", "upstream-2")
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	ss.db.First(&stored, "id = ?", session.ID)
+	if !encryption.IsEncrypted(stored.UpstreamRefreshToken) {
+		t.Errorf("rotated upstream token stored as %q, want it encrypted", stored.UpstreamRefreshToken)
+	}
+	if found, err = ss.GetSessionByRefreshToken(next); err != nil || found.UpstreamRefreshToken != "upstream-2" {
+		t.Errorf("after rotation got %v, %v, want upstream-2", found, err)
+	}
+}
+
+func TestSessionRotatesWithoutUpstreamRefreshToken(t *testing.T) {
+	ss := newTestSessionService(t)
+	session, token, err := ss.CreateSession("user-1", "test", "127.0.0.1", "")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	next, err := ss.RotateRefreshToken(token, "test", "127.0.0.1", "")
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+
+	// The session lifetime still bounds the refreshes
+	ss.db.Model(&models.Session{}).Where("id = ?", session.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := ss.RotateRefreshToken(next, "test", "127.0.0.1", ""); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("rotating an expired session: err = %v, want %v", err, ErrSessionInactive)
+	}
+}
+
+func TestSessionEncryptsStoredUpstreamTokens(t *testing.T) {
+	ss := newTestSessionService(t)
+	session, _, err := ss.CreateSession("user-1", "test", "127.0.0.1", "upstream-1")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	encryption.SetKey(bytes.Repeat([]byte{7}, 32))
+	defer encryption.SetKey(nil)
+	ss.encryptUpstreamTokens()
+
+	var stored models.Session
+	ss.db.First(&stored, "id = ?", session.ID)
+	if plaintext, err := encryption.Decrypt(stored.UpstreamRefreshToken); !encryption.IsEncrypted(stored.UpstreamRefreshToken) || err != nil || plaintext != "upstream-1" {
+		t.Errorf("upstream token stored as %q, want upstream-1 encrypted", stored.UpstreamRefreshToken)
+	}
+}
+
+func TestPurgeEndedSessions(t *testing.T) {
+	ss := newTestSessionService(t)
+
+	active, _, _ := ss.CreateSession("user-1", "test", "127.0.0.1", "")
+	expired, _, _ := ss.CreateSession("user-1", "test", "127.0.0.1", "")
+	revoked, _, _ := ss.CreateSession("user-2", "test", "127.0.0.1", "")
+
+	ss.db.Model(&models.Session{}).Where("id = ?", expired.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	if err := ss.RevokeSession(revoked.ID, ""); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	if err := ss.PurgeEndedSessions(); err != nil {
+		t.Fatalf("PurgeEndedSessions: %v", err)
+	}
+
+	var sessions []models.Session
+	ss.db.Find(&sessions)
+	if len(sessions) != 1 || sessions[0].ID != active.ID {
+		t.Errorf("got %d sessions, want only the active one", len(sessions))
+	}
+
+	var tokens []models.RefreshToken
+	ss.db.Find(&tokens)
+	if len(tokens) != 1 || tokens[0].SessionID != active.ID {
+		t.Errorf("got %d refresh tokens, want only the active session's", len(tokens))
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	ss := newTestSessionService(t)
+	session, first, err := ss.CreateSession("user-1", "test", "127.0.0.1", "")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	other, otherToken, err := ss.CreateSession("user-1", "other device", "127.0.0.1", "")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	second, err := ss.RotateRefreshToken(first, "test", "127.0.0.1", "")
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if second == first {
+		t.Fatal("rotation returned the same refresh token")
+	}
+
+	// Someone replays the rotated token
+	if _, err := ss.RotateRefreshToken(first, "attacker", "203.0.113.1", ""); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing a rotated token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if ss.IsSessionActive(session.ID) {
+		t.Error("session still active after its refresh token was reused")
+	}
+
+	// The current token of the family is revoked with it
+	if _, err := ss.RotateRefreshToken(second, "test", "127.0.0.1", ""); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("rotating the current token: err = %v, want %v", err, ErrSessionInactive)
+	}
+	if _, err := ss.GetSessionByRefreshToken(second); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("looking up the current token: err = %v, want %v", err, ErrSessionInactive)
+	}
+
+	// Other sessions of the user are not affected
+	if !ss.IsSessionActive(other.ID) {
+		t.Error("another session of the user was revoked")
+	}
+	if _, err := ss.RotateRefreshToken(otherToken, "other device", "127.0.0.1", ""); err != nil {
+		t.Errorf("rotating another session: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseDetectedOnLookup(t *testing.T) {
+	ss := newTestSessionService(t)
+	session, first, err := ss.CreateSession("user-1", "test", "127.0.0.1", "")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	second, err := ss.RotateRefreshToken(first, "test", "127.0.0.1", "")
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+
+	if _, err := ss.GetSessionByRefreshToken(first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("looking up a rotated token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if ss.IsSessionActive(session.ID) {
+		t.Error("session still active after its refresh token was reused")
+	}
+	if _, err := ss.RotateRefreshToken(second, "test", "127.0.0.1", ""); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("rotating the current token: err = %v, want %v", err, ErrSessionInactive)
+	}
+
+	if _, err := ss.GetSessionByRefreshToken("unknown"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("unknown token: err = %v, want %v", err, ErrSessionNotFound)
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+	"meet-backend/internal/models"
+)
+
+// MaxTokenLifetime is the longest a LiveKit access token is valid
+const MaxTokenLifetime = 6 * time.Hour
+
+// ErrRoomExpired is returned when a token is requested for a room whose time is up
+var ErrRoomExpired = errors.New("room has expired")
+
+// ParticipantToken is a LiveKit access token together with what it was issued for
+type ParticipantToken struct {
+	Token     string
+	Identity  string
+	Name      string
+	ExpiresAt time.Time
+}
+
+// TokenRequest describes who a token is issued for. The grants are derived
+// from it by the server, never taken from the client.
+type TokenRequest struct {
+	Identity string
+	Name     string
+	UserID   *string // nil for guests
+	RoomRole string  // the user's role in the room, empty for guests and non-members
+	Moderate bool    // global permission to moderate every room
+	Record   bool    // global permission to record rooms
+	Hidden   bool    // join invisibly; only honoured for moderators
+}
+
+// IsModerator checks if the token is for someone managing the room
+func (tr TokenRequest) IsModerator() bool {
+	return tr.Moderate || tr.RoomRole == models.RoomRoleOwner || tr.RoomRole == models.RoomRoleModerator
+}
+
+// TokenIssuer creates LiveKit access tokens with server-side grants
+type TokenIssuer struct {
+	apiKey           string
+	apiSecret        string
+	serverURL        string
+	guestScreenShare bool
+}
+
+// NewTokenIssuer creates a token issuer; GUEST_ALLOW_SCREENSHARE=false stops
+// guests from sharing their screen unless a room policy allows it
+func NewTokenIssuer(apiKey, apiSecret, serverURL string) *TokenIssuer {
+	guestScreenShare := true
+	if value, err := strconv.ParseBool(os.Getenv("GUEST_ALLOW_SCREENSHARE")); err == nil {
+		guestScreenShare = value
+	}
+
+	return &TokenIssuer{
+		apiKey:           apiKey,
+		apiSecret:        apiSecret,
+		serverURL:        serverURL,
+		guestScreenShare: guestScreenShare,
+	}
+}
+
+// ServerURL returns the LiveKit URL clients connect to
+func (ti *TokenIssuer) ServerURL() string {
+	return ti.serverURL
+}
+
+// NewGuestIdentity generates an identity for a guest, so guests cannot pick
+// the identity of another participant
+func NewGuestIdentity() (string, error) {
+	data := make([]byte, 8)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return "guest-" + hex.EncodeToString(data), nil
+}
+
+// IssueToken creates a token to join a room with grants derived from the
+// request and the room's policy. The token is never valid beyond the room's expiry.
+func (ti *TokenIssuer) IssueToken(room *models.Room, policy *models.RoomPolicy, request TokenRequest) (*ParticipantToken, error) {
+	validFor := MaxTokenLifetime
+	if room.ExpiresAt != nil {
+		remaining := time.Until(*room.ExpiresAt)
+		if remaining <= 0 {
+			return nil, ErrRoomExpired
+		}
+		if remaining < validFor {
+			validFor = remaining
+		}
+	}
+
+	// joinedAt and maxDuration (milliseconds) drive the guest countdown in the frontend
+	guest := request.UserID == nil
+	metadata := map[string]interface{}{"guest": guest}
+	if request.UserID != nil {
+		metadata["user_id"] = *request.UserID
+	}
+	if room.ExpiresAt != nil {
+		metadata["joinedAt"] = time.Now().UnixMilli()
+		metadata["maxDuration"] = validFor.Milliseconds()
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	at := auth.NewAccessToken(ti.apiKey, ti.apiSecret)
+	at.AddGrant(ti.buildGrant(room, policy, request)).
+		SetIdentity(request.Identity).
+		SetName(request.Name).
+		SetValidFor(validFor).
+		SetMetadata(string(metadataJSON))
+
+	token, err := at.ToJWT()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &ParticipantToken{
+		Token:     token,
+		Identity:  request.Identity,
+		Name:      request.Name,
+		ExpiresAt: time.Now().Add(validFor),
+	}, nil
+}
+
+// buildGrant derives the LiveKit grant:
+//   - moderators publish every source, always chat, administer the room and may join hidden
+//   - members and guests publish camera and microphone, and their screen if allowed
+//   - only users with the record permission may record
+func (ti *TokenIssuer) buildGrant(room *models.Room, policy *models.RoomPolicy, request TokenRequest) *auth.VideoGrant {
+	moderator := request.IsModerator()
+	guest := request.UserID == nil
+
+	canPublish := true
+	canScreenShare := true
+	if guest {
+		canPublish = policyValue(policy.GuestsCanPublish, true)
+		canScreenShare = policyValue(policy.GuestsCanScreenShare, ti.guestScreenShare)
+	} else if !moderator {
+		canPublish = policyValue(policy.MembersCanPublish, true)
+		canScreenShare = policyValue(policy.MembersCanScreenShare, true)
+	}
+
+	canSubscribe := true
+	canPublishData := moderator || policyValue(policy.ChatEnabled, true)
+	canUpdateMetadata := false
+
+	grant := &auth.VideoGrant{
+		RoomJoin:             true,
+		Room:                 room.Name,
+		RoomAdmin:            moderator,
+		RoomRecord:           request.Record,
+		Hidden:               moderator && request.Hidden,
+		CanPublish:           &canPublish,
+		CanSubscribe:         &canSubscribe,
+		CanPublishData:       &canPublishData,
+		CanUpdateOwnMetadata: &canUpdateMetadata,
+	}
+
+	if canPublish {
+		grant.CanPublishSources = []string{"camera", "microphone"}
+		if canScreenShare {
+			grant.CanPublishSources = append(grant.CanPublishSources, "screen_share", "screen_share_audio")
+		}
+	}
+
+	return grant
+}
+
+// policyValue returns a room policy override, or the default when it is not set
+func policyValue(value *bool, fallback bool) bool {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
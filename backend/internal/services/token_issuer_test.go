@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"meet-backend/internal/models"
+
+	"github.com/livekit/protocol/auth"
+)
+
+const (
+	testAPIKey    = "test-key"
+	testAPISecret = "test-secret-that-is-long-enough"
+)
+
+// issueGrant issues a token and returns the grant it carries
+func issueGrant(t *testing.T, ti *TokenIssuer, room *models.Room, policy *models.RoomPolicy, request TokenRequest) *auth.VideoGrant {
+	t.Helper()
+
+	token, err := ti.IssueToken(room, policy, request)
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	verifier, err := auth.ParseAPIToken(token.Token)
+	if err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	claims, err := verifier.Verify(testAPISecret)
+	if err != nil {
+		t.Fatalf("failed to verify token: %v", err)
+	}
+	if claims.Identity != request.Identity {
+		t.Errorf("identity = %q, want %q", claims.Identity, request.Identity)
+	}
+	return claims.Video
+}
+
+func TestIssueTokenGrants(t *testing.T) {
+	t.Setenv("GUEST_ALLOW_SCREENSHARE", "")
+	ti := NewTokenIssuer(testAPIKey, testAPISecret, "ws://localhost:7880")
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+
+	no, yes := false, true
+	userID := "alice"
+	member := TokenRequest{Identity: "alice", UserID: &userID, RoomRole: models.RoomRoleMember}
+	guest := TokenRequest{Identity: "guest-1"}
+	owner := TokenRequest{Identity: "owner", UserID: &userID, RoomRole: models.RoomRoleOwner}
+
+	all := []string{"camera", "microphone", "screen_share", "screen_share_audio"}
+	media := []string{"camera", "microphone"}
+
+	tests := []struct {
+		name        string
+		policy      models.RoomPolicy
+		request     TokenRequest
+		admin       bool
+		hidden      bool
+		sources     []string
+		publishData bool
+	}{
+		{"member", models.RoomPolicy{}, member, false, false, all, true},
+		{"guest", models.RoomPolicy{}, guest, false, false, all, true},
+		{"owner", models.RoomPolicy{}, owner, true, false, all, true},
+		{"global moderator", models.RoomPolicy{}, TokenRequest{Identity: "mod", UserID: &userID, Moderate: true}, true, false, all, true},
+
+		// Only moderators may join hidden
+		{"hidden owner", models.RoomPolicy{}, TokenRequest{Identity: "owner", UserID: &userID, RoomRole: models.RoomRoleOwner, Hidden: true}, true, true, all, true},
+		{"hidden member", models.RoomPolicy{}, TokenRequest{Identity: "alice", UserID: &userID, RoomRole: models.RoomRoleMember, Hidden: true}, false, false, all, true},
+		{"hidden guest", models.RoomPolicy{}, TokenRequest{Identity: "guest-1", Hidden: true}, false, false, all, true},
+
+		{"member without screen share", models.RoomPolicy{MembersCanScreenShare: &no}, member, false, false, media, true},
+		{"member without publishing", models.RoomPolicy{MembersCanPublish: &no}, member, false, false, nil, true},
+		{"guest without screen share", models.RoomPolicy{GuestsCanScreenShare: &no}, guest, false, false, media, true},
+		{"guest without publishing", models.RoomPolicy{GuestsCanPublish: &no}, guest, false, false, nil, true},
+		{"guest policy leaves members alone", models.RoomPolicy{GuestsCanPublish: &no}, member, false, false, all, true},
+		{"chat disabled", models.RoomPolicy{ChatEnabled: &no}, member, false, false, all, false},
+		{"chat enabled", models.RoomPolicy{ChatEnabled: &yes}, guest, false, false, all, true},
+
+		// Moderators keep every source and the chat whatever the policy says
+		{"owner under a strict policy", models.RoomPolicy{MembersCanPublish: &no, MembersCanScreenShare: &no, ChatEnabled: &no}, owner, true, false, all, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grant := issueGrant(t, ti, room, &test.policy, test.request)
+
+			if !grant.RoomJoin || grant.Room != room.Name {
+				t.Errorf("grant joins %q (%v), want %q", grant.Room, grant.RoomJoin, room.Name)
+			}
+			if grant.RoomAdmin != test.admin {
+				t.Errorf("RoomAdmin = %v, want %v", grant.RoomAdmin, test.admin)
+			}
+			if grant.Hidden != test.hidden {
+				t.Errorf("Hidden = %v, want %v", grant.Hidden, test.hidden)
+			}
+			if canPublish := grant.GetCanPublish(); canPublish != (test.sources != nil) {
+				t.Errorf("CanPublish = %v, want %v", canPublish, test.sources != nil)
+			}
+			if !reflect.DeepEqual(grant.CanPublishSources, test.sources) {
+				t.Errorf("CanPublishSources = %v, want %v", grant.CanPublishSources, test.sources)
+			}
+			if grant.GetCanPublishData() != test.publishData {
+				t.Errorf("CanPublishData = %v, want %v", grant.GetCanPublishData(), test.publishData)
+			}
+			if grant.RoomRecord || grant.GetCanUpdateOwnMetadata() {
+				t.Errorf("grant records (%v) or updates its metadata (%v), want neither", grant.RoomRecord, grant.GetCanUpdateOwnMetadata())
+			}
+		})
+	}
+}
+
+func TestIssueTokenGuestScreenShareDefault(t *testing.T) {
+	t.Setenv("GUEST_ALLOW_SCREENSHARE", "false")
+	ti := NewTokenIssuer(testAPIKey, testAPISecret, "ws://localhost:7880")
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	guest := TokenRequest{Identity: "guest-1"}
+
+	media := []string{"camera", "microphone"}
+	if grant := issueGrant(t, ti, room, &models.RoomPolicy{}, guest); !reflect.DeepEqual(grant.CanPublishSources, media) {
+		t.Errorf("guest publishes %v, want %v", grant.CanPublishSources, media)
+	}
+
+	// A room policy overrides the server default
+	yes := true
+	all := []string{"camera", "microphone", "screen_share", "screen_share_audio"}
+	if grant := issueGrant(t, ti, room, &models.RoomPolicy{GuestsCanScreenShare: &yes}, guest); !reflect.DeepEqual(grant.CanPublishSources, all) {
+		t.Errorf("guest publishes %v, want %v", grant.CanPublishSources, all)
+	}
+}
+
+func TestIssueTokenRecordAndExpiry(t *testing.T) {
+	ti := NewTokenIssuer(testAPIKey, testAPISecret, "ws://localhost:7880")
+	room := models.CreateAuthenticatedRoom("abc-defg-hij", "owner")
+	userID := "recorder"
+
+	grant := issueGrant(t, ti, room, &models.RoomPolicy{}, TokenRequest{Identity: "recorder", UserID: &userID, Record: true})
+	if !grant.RoomRecord || grant.RoomAdmin {
+		t.Errorf("grant records (%v) and administers (%v), want only recording", grant.RoomRecord, grant.RoomAdmin)
+	}
+
+	// The token ends with the room
+	expiresAt := time.Now().Add(10 * time.Minute)
+	room.ExpiresAt = &expiresAt
+	token, err := ti.IssueToken(room, &models.RoomPolicy{}, TokenRequest{Identity: "guest-1"})
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	if token.ExpiresAt.After(expiresAt.Add(time.Second)) {
+		t.Errorf("token expires at %v, after the room at %v", token.ExpiresAt, expiresAt)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	room.ExpiresAt = &expired
+	if _, err := ti.IssueToken(room, &models.RoomPolicy{}, TokenRequest{Identity: "guest-1"}); !errors.Is(err, ErrRoomExpired) {
+		t.Errorf("err = %v, want %v", err, ErrRoomExpired)
+	}
+}
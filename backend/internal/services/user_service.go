@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+)
+
+var (
+	// ErrUserNotFound is returned when no user exists for an ID
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserDisabled is returned when a disabled user tries to sign in
+	ErrUserDisabled = errors.New("user is disabled")
+)
+
+type UserService struct {
+	db *gorm.DB
+}
+
+func NewUserService() *UserService {
+	return &UserService{
+		db: database.GetDatabase(),
+	}
+}
+
+// UpsertUser stores the profile from the identity provider and records the login.
+// It returns the stored user, including the disabled flag.
+func (us *UserService) UpsertUser(user *models.User) (*models.User, error) {
+	now := time.Now()
+	record := &models.User{
+		ID:           user.ID,
+		Email:        user.Email,
+		Name:         user.Name,
+		Username:     user.Username,
+		Groups:       user.Groups,
+		FirstLoginAt: now,
+		LastLoginAt:  now,
+	}
+
+	result := us.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email", "name", "username", "groups", "last_login_at"}),
+	}).Create(record)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to store user: %w", result.Error)
+	}
+
+	return us.GetUser(user.ID)
+}
+
+// GetUser retrieves a user by ID
+func (us *UserService) GetUser(id string) (*models.User, error) {
+	var user models.User
+	result := us.db.Where("id = ?", id).First(&user)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", result.Error)
+	}
+
+	return &user, nil
+}
+
+// IsUserDisabled checks if a user has been disabled by an admin
+func (us *UserService) IsUserDisabled(id string) (bool, error) {
+	var count int64
+	if err := us.db.Model(&models.User{}).Where("id = ? AND disabled = ?", id, true).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check user: %w", err)
+	}
+	return count > 0, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, so a search matches
+// them literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListUsers returns a page of users matching an optional search term, and the total number of matches
+func (us *UserService) ListUsers(search string, page, pageSize int) ([]models.User, int64, error) {
+	query := us.db.Model(&models.User{})
+	if search = strings.TrimSpace(search); search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(search)) + "%"
+		query = query.Where(`LOWER(email) LIKE ? ESCAPE '\' OR LOWER(name) LIKE ? ESCAPE '\' OR LOWER(username) LIKE ? ESCAPE '\'`, pattern, pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	var users []models.User
+	result := query.Order("last_login_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&users)
+	if result.Error != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", result.Error)
+	}
+
+	return users, total, nil
+}
+
+// SetUserDisabled enables or disables a user
+func (us *UserService) SetUserDisabled(id string, disabled bool) (*models.User, error) {
+	result := us.db.Model(&models.User{}).Where("id = ?", id).Update("disabled", disabled)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return us.GetUser(id)
+}
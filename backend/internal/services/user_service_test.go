@@ -0,0 +1,92 @@
+package services
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"meet-backend/internal/models"
+	"meet-backend/internal/testdb"
+)
+
+func TestIsUserDisabled(t *testing.T) {
+	db := testdb.Open(t, &models.User{})
+	us := &UserService{db: db}
+
+	db.Create(&models.User{ID: "active", Email: "active@example.com"})
+	db.Create(&models.User{ID: "disabled", Email: "disabled@example.com"})
+	db.Model(&models.User{}).Where("id = ?", "disabled").Update("disabled", true)
+
+	for id, want := range map[string]bool{"active": false, "disabled": true, "unknown": false} {
+		disabled, err := us.IsUserDisabled(id)
+		if err != nil {
+			t.Fatalf("IsUserDisabled(%q): %v", id, err)
+		}
+		if disabled != want {
+			t.Errorf("IsUserDisabled(%q) = %v, want %v", id, disabled, want)
+		}
+	}
+
+	// A failing check must not read as "not disabled"
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	if _, err := us.IsUserDisabled("disabled"); err == nil {
+		t.Error("IsUserDisabled returned no error on a closed database")
+	}
+}
+
+func TestListUsersSearch(t *testing.T) {
+	db := testdb.Open(t, &models.User{})
+	us := &UserService{db: db}
+
+	now := time.Now()
+	for i, user := range []models.User{
+		{ID: "1", Email: "alice@example.com", Name: "Alice", Username: "alice"},
+		{ID: "2", Email: "bob@example.com", Name: "Bob 100% sure", Username: "bob"},
+		{ID: "3", Email: "carol_x@example.com", Name: "Carol", Username: "carol_x"},
+		{ID: "4", Email: "caroleax@example.com", Name: "Carole", Username: "caroleax"},
+		{ID: "5", Email: "dave@example.com", Name: `Dave \ Ops`, Username: "dave"},
+	} {
+		user.LastLoginAt = now.Add(-time.Duration(i) * time.Minute)
+		db.Create(&user)
+	}
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"", []string{"1", "2", "3", "4", "5"}},
+		{"ALICE", []string{"1"}},
+		{"example.com", []string{"1", "2", "3", "4", "5"}},
+		// Wildcards in the search term match literally
+		{"%", []string{"2"}},
+		{"100%", []string{"2"}},
+		{"carol_", []string{"3"}},
+		{"_", []string{"3"}},
+		{`\`, []string{"5"}},
+		{"nobody", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.search, func(t *testing.T) {
+			users, total, err := us.ListUsers(test.search, 1, 10)
+			if err != nil {
+				t.Fatalf("ListUsers(%q): %v", test.search, err)
+			}
+			var got []string
+			for _, user := range users {
+				got = append(got, user.ID)
+			}
+			sort.Strings(got)
+			if len(got) != len(test.want) || int(total) != len(test.want) {
+				t.Fatalf("ListUsers(%q) = %v (total %d), want %v", test.search, got, total, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("ListUsers(%q) = %v, want %v", test.search, got, test.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"meet-backend/internal/database"
+	"meet-backend/internal/models"
+	"meet-backend/internal/webhooks"
+)
+
+const (
+	// MaxWebhooksPerUser is the most subscriptions a single user can register
+	MaxWebhooksPerUser = 10
+	// minWebhookSecretLength keeps chosen secrets from being guessable
+	minWebhookSecretLength = 16
+)
+
+// Delivery states to filter the delivery log on
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+var (
+	// ErrWebhookNotFound is returned for unknown subscriptions and deliveries
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrInvalidWebhook is returned for subscriptions with an invalid URL, secret or event filter
+	ErrInvalidWebhook = errors.New("invalid webhook")
+)
+
+type WebhookService struct {
+	db *gorm.DB
+}
+
+func NewWebhookService() *WebhookService {
+	return &WebhookService{
+		db: database.GetDatabase(),
+	}
+}
+
+// CreateSubscription registers a subscription. A secret is generated when
+// none is given; it is returned so it can be shown to the user once.
+func (ws *WebhookService) CreateSubscription(subscription *models.WebhookSubscription) (string, error) {
+	if subscription.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return "", err
+		}
+		subscription.Secret = secret
+	}
+	if err := ValidateWebhook(subscription); err != nil {
+		return "", err
+	}
+
+	var count int64
+	if err := ws.db.Model(&models.WebhookSubscription{}).Where("user_id = ?", subscription.UserID).Count(&count).Error; err != nil {
+		return "", fmt.Errorf("failed to count webhooks: %w", err)
+	}
+	if count >= MaxWebhooksPerUser {
+		return "", fmt.Errorf("%w: at most %d webhooks can be registered", ErrInvalidWebhook, MaxWebhooksPerUser)
+	}
+
+	subscription.Active = true
+	if err := ws.db.Create(subscription).Error; err != nil {
+		return "", fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return subscription.Secret, nil
+}
+
+// GetSubscription retrieves a subscription by ID
+func (ws *WebhookService) GetSubscription(id uuid.UUID) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	result := ws.db.Where("id = ?", id).First(&subscription)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", result.Error)
+	}
+
+	return &subscription, nil
+}
+
+// ListSubscriptions returns the subscriptions of a user, oldest first
+func (ws *WebhookService) ListSubscriptions(userID string) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	result := ws.db.Where("user_id = ?", userID).Order("created_at").Find(&subscriptions)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", result.Error)
+	}
+
+	return subscriptions, nil
+}
+
+// UpdateSubscription validates and saves a changed subscription
+func (ws *WebhookService) UpdateSubscription(subscription *models.WebhookSubscription) error {
+	if err := ValidateWebhook(subscription); err != nil {
+		return err
+	}
+
+	if err := ws.db.Save(subscription).Error; err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSubscription removes a subscription and its delivery log
+func (ws *WebhookService) DeleteSubscription(subscription *models.WebhookSubscription) error {
+	err := ws.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", subscription.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(subscription).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the most recent deliveries of a subscription,
+// optionally only those in one of the DeliveryStatus states
+func (ws *WebhookService) ListDeliveries(subscriptionID uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error) {
+	query := ws.db.Where("subscription_id = ?", subscriptionID)
+	switch status {
+	case "":
+	case DeliveryStatusPending:
+		query = query.Where("delivered_at IS NULL AND failed_at IS NULL")
+	case DeliveryStatusDelivered:
+		query = query.Where("delivered_at IS NOT NULL")
+	case DeliveryStatusFailed:
+		query = query.Where("failed_at IS NOT NULL")
+	default:
+		return nil, fmt.Errorf("%w: unknown delivery status %q", ErrInvalidWebhook, status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	result := query.Order("created_at DESC").Limit(limit).Find(&deliveries)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", result.Error)
+	}
+
+	return deliveries, nil
+}
+
+// GetDelivery retrieves a delivery of a subscription
+func (ws *WebhookService) GetDelivery(subscriptionID, id uuid.UUID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	result := ws.db.Where("id = ? AND subscription_id = ?", id, subscriptionID).First(&delivery)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to get delivery: %w", result.Error)
+	}
+
+	return &delivery, nil
+}
+
+// Redeliver sends the event of a delivery again as a new delivery
+func (ws *WebhookService) Redeliver(delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	return webhooks.Redeliver(ws.db, delivery)
+}
+
+// ValidateWebhook checks the URL, secret and event filter of a subscription
+func ValidateWebhook(subscription *models.WebhookSubscription) error {
+	parsed, err := url.Parse(subscription.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("%w: url must not contain credentials", ErrInvalidWebhook)
+	}
+
+	if len(subscription.Secret) < minWebhookSecretLength {
+		return fmt.Errorf("%w: secret must be at least %d characters", ErrInvalidWebhook, minWebhookSecretLength)
+	}
+
+	for i, event := range subscription.Events {
+		event = strings.TrimSpace(event)
+		if event != "*" && !webhooks.IsEventType(event) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+		subscription.Events[i] = event
+	}
+
+	return nil
+}
+
+// generateWebhookSecret returns a random signing secret
+func generateWebhookSecret() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(data), nil
+}
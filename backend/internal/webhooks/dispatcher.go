@@ -0,0 +1,296 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"meet-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxDeliveryAttempts is how often a delivery is tried before it is given up on
+	maxDeliveryAttempts = 10
+	// deliveryLease keeps other replicas from picking up a delivery that is being sent
+	deliveryLease = 2 * time.Minute
+	// deliveryBatchSize is the number of deliveries sent per run
+	deliveryBatchSize = 50
+	// deliveryTimeout is how long a subscriber gets to respond
+	deliveryTimeout = 10 * time.Second
+	// deliveryRetention is how long the delivery log is kept
+	deliveryRetention = 30 * 24 * time.Hour
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Meet-Event"
+	HeaderDelivery  = "X-Meet-Delivery"
+	HeaderSignature = "X-Meet-Signature"
+)
+
+// errPrivateAddress is returned for subscriber URLs that resolve to internal addresses
+var errPrivateAddress = errors.New("webhook URL resolves to a private address")
+
+// Dispatcher sends queued deliveries to subscribers
+type Dispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+}
+
+// NewDispatcher creates a dispatcher. Deliveries to loopback, private and
+// link-local addresses are refused unless WEBHOOK_ALLOW_PRIVATE_NETWORKS is
+// true, so subscriptions can't be used to probe the internal network.
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	allowPrivate, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS"))
+
+	dialer := &net.Dialer{Timeout: deliveryTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &Dispatcher{
+		db: db,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   deliveryTimeout,
+			// Redirects are reported as failures instead of followed
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Sign returns the signature header of a payload sent at a moment:
+// t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<payload>">
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Redeliver queues a new attempt series for an earlier delivery
+func Redeliver(db *gorm.DB, delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	redelivery := &models.WebhookDelivery{
+		SubscriptionID: delivery.SubscriptionID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Payload:        delivery.Payload,
+		RedeliveryOf:   &delivery.ID,
+		NextAttemptAt:  time.Now(),
+	}
+	if err := db.Create(redelivery).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue redelivery: %w", err)
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+
+	return redelivery, nil
+}
+
+// StartDeliveryRoutine sends queued deliveries until the process exits
+func (d *Dispatcher) StartDeliveryRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+	for {
+		d.deliverDue()
+
+		if time.Since(lastCleanup) > time.Hour {
+			d.cleanup()
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// deliverDue sends the deliveries whose next attempt is due
+func (d *Dispatcher) deliverDue() {
+	for {
+		deliveries, err := d.claimDue()
+		if err != nil {
+			log.Printf("Error loading webhook deliveries: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+
+		ids := make([]uuid.UUID, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.SubscriptionID)
+		}
+		var subscriptions []models.WebhookSubscription
+		if err := d.db.Where("id IN ?", ids).Find(&subscriptions).Error; err != nil {
+			log.Printf("Error loading webhook subscriptions: %v", err)
+			return
+		}
+		byID := make(map[uuid.UUID]*models.WebhookSubscription, len(subscriptions))
+		for i := range subscriptions {
+			byID[subscriptions[i].ID] = &subscriptions[i]
+		}
+
+		for i := range deliveries {
+			d.deliver(&deliveries[i], byID[deliveries[i].SubscriptionID])
+		}
+
+		if len(deliveries) < deliveryBatchSize {
+			return
+		}
+	}
+}
+
+// claimDue loads a batch of due deliveries and leases them, so concurrent
+// replicas don't send the same delivery twice
+func (d *Dispatcher) claimDue() ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+			Order("next_attempt_at").
+			Limit(deliveryBatchSize).
+			Find(&deliveries)
+		if result.Error != nil || len(deliveries) == 0 {
+			return result.Error
+		}
+
+		ids := make([]uuid.UUID, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(deliveryLease)).Error
+	})
+
+	return deliveries, err
+}
+
+// deliver posts one delivery and records the outcome
+func (d *Dispatcher) deliver(delivery *models.WebhookDelivery, subscription *models.WebhookSubscription) {
+	now := time.Now()
+	updates := map[string]interface{}{"attempts": delivery.Attempts + 1}
+
+	if subscription == nil || !subscription.Active {
+		// Deleted or paused subscriptions don't get their queued events
+		updates["last_error"] = "subscription is disabled"
+		updates["failed_at"] = now
+	} else {
+		statusCode, err := d.post(subscription, delivery)
+		updates["status_code"] = statusCode
+		updates["duration_ms"] = time.Since(now).Milliseconds()
+
+		if err == nil {
+			updates["delivered_at"] = time.Now()
+			updates["last_error"] = ""
+		} else {
+			updates["last_error"] = err.Error()
+			if delivery.Attempts+1 >= maxDeliveryAttempts {
+				log.Printf("Giving up on webhook delivery %s to %s: %v", delivery.ID, subscription.URL, err)
+				updates["failed_at"] = now
+			} else {
+				updates["next_attempt_at"] = now.Add(retryDelay(delivery.Attempts + 1))
+			}
+		}
+	}
+
+	if err := d.db.Model(delivery).Updates(updates).Error; err != nil {
+		log.Printf("Error updating webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// post sends a delivery and returns the HTTP status of the response. Any
+// status outside 2xx is an error.
+func (d *Dispatcher) post(subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "meet-backend-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// cleanup removes finished deliveries past the retention period
+func (d *Dispatcher) cleanup() {
+	cutoff := time.Now().Add(-deliveryRetention)
+	result := d.db.Where("delivered_at < ? OR failed_at < ?", cutoff, cutoff).Delete(&models.WebhookDelivery{})
+	if result.Error != nil {
+		log.Printf("Error removing old webhook deliveries: %v", result.Error)
+	}
+}
+
+// retryDelay returns the backoff after a number of failed attempts:
+// 30 seconds, 1, 2, 4 ... minutes, at most 6 hours
+func retryDelay(attempts int) time.Duration {
+	delay := 30 * time.Second << (attempts - 1)
+	if delay > 6*time.Hour || delay <= 0 {
+		return 6 * time.Hour
+	}
+	return delay
+}
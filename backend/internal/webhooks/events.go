@@ -0,0 +1,122 @@
+// Package webhooks sends signed room, participant and recording events to
+// subscribed URLs. Events are stored as deliveries first and sent in the
+// background, so failed deliveries are retried and survive restarts.
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"meet-backend/internal/events"
+	"meet-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EventTypes lists every event a subscription can filter on
+var EventTypes = []string{
+	events.EventRoomCreated,
+	events.EventRoomExpired,
+	events.EventRoomDeactivated,
+	events.EventParticipantJoined,
+	events.EventParticipantLeft,
+	events.EventRecordingStarted,
+	events.EventRecordingFinished,
+}
+
+// Event is the JSON body posted to subscribers
+type Event struct {
+	ID        uuid.UUID   `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// IsEventType checks if subscriptions can receive an event type
+func IsEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// wake tells the dispatcher that new deliveries are waiting
+var wake = make(chan struct{}, 1)
+
+// Emit queues an event for every subscription that wants it. Events that
+// aren't in EventTypes are only streamed and are ignored here. Admin
+// subscriptions for all rooms get every event; other subscriptions only get
+// events of rooms their owner manages, so events without a room only go to
+// the former. Failures are logged rather than returned so an unreachable
+// subscriber never undoes the state change that caused the event.
+func Emit(db *gorm.DB, eventType string, roomID *uuid.UUID, data interface{}) {
+	if !IsEventType(eventType) {
+		return
+	}
+	if err := enqueue(db, eventType, roomID, data); err != nil {
+		log.Printf("Failed to queue %s webhook: %v", eventType, err)
+	}
+}
+
+// enqueue stores a delivery of the event for each matching subscription
+func enqueue(db *gorm.DB, eventType string, roomID *uuid.UUID, data interface{}) error {
+	query := db.Where("active = ?", true)
+	if roomID != nil {
+		query = query.Where("all_rooms = ? OR user_id IN (?)", true,
+			db.Model(&models.RoomMember{}).
+				Select("user_id").
+				Where("room_id = ? AND role IN ?", *roomID, []string{models.RoomRoleOwner, models.RoomRoleModerator}))
+	} else {
+		query = query.Where("all_rooms = ?", true)
+	}
+
+	var subscriptions []models.WebhookSubscription
+	if err := query.Find(&subscriptions).Error; err != nil {
+		return fmt.Errorf("failed to find subscriptions: %w", err)
+	}
+
+	event := Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if !subscription.Wants(eventType) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      eventType,
+			Payload:        payload,
+			NextAttemptAt:  event.CreatedAt,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := db.Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("failed to queue deliveries: %w", err)
+	}
+
+	// Send right away instead of waiting for the next tick
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
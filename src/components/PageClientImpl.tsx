@@ -7,6 +7,7 @@ import { SettingsMenu } from '../lib/SettingsMenu';
 import { GuestAccessBanner } from '../lib/GuestAccessBanner';
 import { CameraPermissionHelper } from '../lib/CameraPermissionHelper';
 import { ConnectionDetails } from '../lib/types';
+import { apiClient } from '../lib/api-client';
 import {
   formatChatMessageLinks,
   LocalUserChoices,
@@ -30,8 +31,6 @@ import { useNavigate } from 'react-router-dom';
 import { useSetupE2EE } from '../lib/useSetupE2EE';
 import { useLowCPUOptimizer } from '../lib/usePerfomanceOptimiser';
 
-const CONN_DETAILS_ENDPOINT =
-  import.meta.env.VITE_CONN_DETAILS_ENDPOINT ?? '/api/connection-details';
 const SHOW_SETTINGS_MENU = import.meta.env.VITE_SHOW_SETTINGS_MENU == 'true';
 
 export function PageClientImpl(props: {
@@ -56,15 +55,13 @@ export function PageClientImpl(props: {
 
   const handlePreJoinSubmit = React.useCallback(async (values: LocalUserChoices) => {
     setPreJoinChoices(values);
-    const url = new URL(CONN_DETAILS_ENDPOINT, window.location.origin);
-    url.searchParams.append('roomName', props.roomName);
-    url.searchParams.append('participantName', values.username);
-    if (props.region) {
-      url.searchParams.append('region', props.region);
-    }
-    const connectionDetailsResp = await fetch(url.toString());
-    const connectionDetailsData = await connectionDetailsResp.json();
-    setConnectionDetails(connectionDetailsData);
+    const joined = await apiClient.joinRoom(props.roomName, values.username);
+    setConnectionDetails({
+      serverUrl: joined.server_url,
+      roomName: props.roomName,
+      participantName: joined.name,
+      participantToken: joined.token,
+    });
   }, []);
   const handlePreJoinError = React.useCallback((e: any) => console.error(e), []);
 
@@ -17,15 +17,27 @@ interface TokenResponse {
   room_name: string;
   identity: string;
   name: string;
+  expires_at: string;
+}
+
+interface JoinRoomResponse {
+  participant_id: string;
+  room_id: string;
+  identity: string;
+  name: string;
+  is_guest: boolean;
+  token: string;
+  token_expires_at: string;
+  server_url: string;
+  room_expires_at?: string;
+  time_remaining?: number;
 }
 
+// Identity and grants are decided by the backend
 interface RoomTokenRequest {
   room_name: string;
-  identity?: string;
   name?: string;
-  can_publish?: boolean;
-  can_subscribe?: boolean;
-  can_record?: boolean;
+  hidden?: boolean;
 }
 
 class ApiClient {
@@ -174,6 +186,25 @@ class ApiClient {
     });
   }
 
+  // Join a room through the public API, creating it first if it does not exist.
+  // Works for guests and signed-in users; the backend picks the identity.
+  async joinRoom(roomName: string, name: string, passcode?: string): Promise<JoinRoomResponse> {
+    const path = `/api/public/rooms/${encodeURIComponent(roomName)}`;
+    try {
+      await this.makeRequest(`/api/public/rooms/`, {
+        method: 'POST',
+        body: JSON.stringify({ name: roomName }),
+      });
+    } catch {
+      // The room already exists
+    }
+
+    return this.makeRequest<JoinRoomResponse>(`${path}/join`, {
+      method: 'POST',
+      body: JSON.stringify({ name, passcode }),
+    });
+  }
+
   async getRoomParticipants(roomName: string) {
     return this.makeRequest(`/api/rooms/${roomName}/participants`);
   }
@@ -11,7 +11,6 @@ export default function AuthCallbackPage() {
     const handleCallback = async () => {
       try {
         const code = searchParams.get('code')
-        const state = searchParams.get('state')
         const error = searchParams.get('error')
 
         if (error) {
@@ -20,20 +19,21 @@ export default function AuthCallbackPage() {
           return
         }
 
-        if (!code || !state) {
-          setError('Missing authorization code or state parameter')
+        if (!code) {
+          setError('Missing login code')
           setStatus('error')
           return
         }
 
-        // The backend will handle the OAuth callback
-        // We just need to extract the token from the URL or make a request
+        // The backend handled the OAuth callback and gave us a one-time code
+        // that we exchange for the tokens
         const backendUrl = import.meta.env.VITE_BACKEND_URL || 'http://localhost:8080'
-        const callbackUrl = `${backendUrl}/auth/callback?code=${code}&state=${state}`
-        
-        const response = await fetch(callbackUrl, {
-          method: 'GET',
-          credentials: 'include',
+        const response = await fetch(`${backendUrl}/auth/exchange`, {
+          method: 'POST',
+          headers: {
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ code }),
         })
 
         if (!response.ok) {
@@ -50,11 +50,15 @@ export default function AuthCallbackPage() {
         setStatus('success')
         
         // Redirect to the original destination or home
-        const returnUrl = localStorage.getItem('auth_return_url') || '/'
+        const returnUrl = searchParams.get('return_to') || localStorage.getItem('auth_return_url') || '/'
         localStorage.removeItem('auth_return_url')
         
         setTimeout(() => {
-          navigate(returnUrl)
+          if (returnUrl.startsWith('/')) {
+            navigate(returnUrl)
+          } else {
+            window.location.href = returnUrl
+          }
         }, 1000)
 
       } catch (err) {